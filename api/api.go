@@ -2,28 +2,133 @@ package api
 
 import (
 	"context"
+	"crypto/rand"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/GetStream/stream-backend-homework-assignment/markdown"
 	"github.com/go-playground/validator/v10"
 	"github.com/uptrace/bun/driver/pgdriver"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"io"
 	"log/slog"
 	"net/http"
-	"strconv"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const pageSize = 10
 const cacheSize = 10
 
+// degradedHeader is set on responses served while the DB is unavailable.
+const degradedHeader = "X-Degraded"
+
 var ErrMessageNotFoundInCache = fmt.Errorf("message not found in cache")
 
+// ErrCacheUnavailable is returned by a Cache that is known to be down, so
+// callers can skip it instead of failing.
+var ErrCacheUnavailable = fmt.Errorf("cache unavailable")
+
+// ErrDBUnavailable is returned by a DB when it cannot reach the database, as
+// opposed to rejecting a query.
+var ErrDBUnavailable = fmt.Errorf("database unavailable")
+
+// ErrAPIKeyNotFound is returned by an APIKeyStore for unknown keys.
+var ErrAPIKeyNotFound = fmt.Errorf("api key not found")
+
+var ErrAPIKeyNotFoundInCache = fmt.Errorf("api key not found in cache")
+
+// ErrMessageNotFound is returned by a DB for operations on unknown messages.
+var ErrMessageNotFound = fmt.Errorf("message not found")
+
+// ErrReadMarkerNotFound is returned by a DB for users who never read a
+// message.
+var ErrReadMarkerNotFound = fmt.Errorf("read marker not found")
+
+// ErrAttachmentNotFound is returned by a DB for unknown attachments, and
+// when sending attachments that are not the sender's or were sent already.
+var ErrAttachmentNotFound = fmt.Errorf("attachment not found")
+
+// ErrBlobNotFound is returned by a BlobStore for unknown keys.
+var ErrBlobNotFound = fmt.Errorf("blob not found")
+
+// ErrPinNotFound is returned by a DB when unpinning a message that isn't
+// pinned.
+var ErrPinNotFound = fmt.Errorf("pin not found")
+
+// ErrModerationRuleNotFound is returned by a ModerationRuleStore for unknown
+// rules.
+var ErrModerationRuleNotFound = fmt.Errorf("moderation rule not found")
+
+// ErrBanNotFound is returned by a BanStore for unknown bans.
+var ErrBanNotFound = fmt.Errorf("ban not found")
+
+var ErrBansNotFoundInCache = fmt.Errorf("bans not found in cache")
+
+// ErrBlockNotFound is returned by a BlockStore when unblocking a user who
+// isn't blocked.
+var ErrBlockNotFound = fmt.Errorf("block not found")
+
+var ErrBlocksNotFoundInCache = fmt.Errorf("blocks not found in cache")
+
+// ErrUserNotFound is returned by a UserStore for users without a profile.
+var ErrUserNotFound = fmt.Errorf("user not found")
+
+// ErrUserExists is returned by a UserStore when creating a profile for a user
+// who has one.
+var ErrUserExists = fmt.Errorf("user exists")
+
+// ErrErasureJobNotFound is returned by a UserDataStore for unknown erasure
+// jobs.
+var ErrErasureJobNotFound = fmt.Errorf("erasure job not found")
+
+var ErrPinsNotFoundInCache = fmt.Errorf("pins not found in cache")
+
+var ErrReadMarkerNotFoundInCache = fmt.Errorf("read marker not found in cache")
+
 // A DB provides a storage layer that persists messages.
 type DB interface {
-	ListMessages(ctx context.Context, limit int, offset int, excludeMsgIDs ...string) ([]Message, error)
+	ListMessages(ctx context.Context, q ListQuery, excludeMsgIDs ...string) ([]Message, error)
 	InsertMessage(ctx context.Context, msg Message) (Message, error)
 	InsertReaction(ctx context.Context, reaction Reaction) (Reaction, error)
+	SearchMessages(ctx context.Context, q SearchQuery) ([]SearchResult, error)
+	ListMentions(ctx context.Context, q MentionQuery) ([]Mention, error)
+	// MarkMentionsRead marks the mentions of userID in the given messages, or
+	// all of them if none are given, as read and returns how many were unread.
+	MarkMentionsRead(ctx context.Context, userID string, msgIDs ...string) (int, error)
+	// MarkRead moves the read marker of userID forward to messageID, marking
+	// the mentions up to it read, and returns the marker. A marker already
+	// past the message is kept.
+	MarkRead(ctx context.Context, userID, messageID string) (ReadMarker, error)
+	GetReadMarker(ctx context.Context, userID string) (*ReadMarker, error)
+	// CountUnread counts what userID has not read after marker, which is nil
+	// for users who never read a message.
+	CountUnread(ctx context.Context, userID string, marker *ReadMarker) (UnreadCounts, error)
+	// PinMessage pins a message, unless it is pinned already, and returns
+	// the pin.
+	PinMessage(ctx context.Context, messageID, userID string) (Pin, error)
+	UnpinMessage(ctx context.Context, messageID string) error
+	// ListPins returns the pinned messages, most recently pinned first,
+	// without their reaction counts.
+	ListPins(ctx context.Context) ([]Pin, error)
+	InsertAttachment(ctx context.Context, attachment Attachment) (Attachment, error)
+	// GetAttachment returns an attachment, or ErrAttachmentNotFound, also if
+	// its message is hidden by moderation.
+	GetAttachment(ctx context.Context, id string) (*Attachment, error)
+	// FlagMessage records a user's flag of a message, unless they flagged it
+	// already, and hides the message once hideAfter users have flagged it
+	// since it was last reviewed. Removed messages can't be flagged.
+	FlagMessage(ctx context.Context, flag Flag, hideAfter int) (FlagResult, error)
+	// ListFlaggedMessages returns the messages awaiting review, oldest first:
+	// those with pending flags and those flagged or hidden by moderation.
+	ListFlaggedMessages(ctx context.Context, q FlagQuery) ([]FlaggedMessage, error)
+	// ReviewMessage resolves the pending flags of a message with a decision
+	// of a moderator, and returns the message as moderated.
+	ReviewMessage(ctx context.Context, messageID, moderatorID, decision string) (Message, error)
 }
 
 // A Cache provides a storage layer that caches messages.
@@ -34,6 +139,214 @@ type Cache interface {
 	DeleteMessage(ctx context.Context, messageID string) error
 }
 
+// A Queue durably buffers writes that could not be persisted to the DB so
+// they can be replayed in order once it recovers.
+type Queue interface {
+	Enqueue(ctx context.Context, w QueuedWrite) error
+	Pending(ctx context.Context, count int) ([]QueuedWrite, error)
+	Ack(ctx context.Context, id string) error
+}
+
+// An Authenticator verifies a bearer token and returns the subject, the ID of
+// the user, it was issued to.
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (string, error)
+}
+
+// An APIKeyStore persists API keys, which are looked up by the hash of their
+// secret.
+type APIKeyStore interface {
+	InsertAPIKey(ctx context.Context, key APIKey) (APIKey, error)
+	ListAPIKeys(ctx context.Context) ([]APIKey, error)
+	GetAPIKey(ctx context.Context, hash string) (*APIKey, error)
+	RevokeAPIKey(ctx context.Context, id string) (*APIKey, error)
+}
+
+// An APIKeyCache caches API key lookups by hash.
+type APIKeyCache interface {
+	GetAPIKey(ctx context.Context, hash string) (*APIKey, error)
+	SetAPIKey(ctx context.Context, key APIKey) error
+	DeleteAPIKey(ctx context.Context, hash string) error
+}
+
+// A ReadMarkerCache caches read markers by user.
+type ReadMarkerCache interface {
+	GetReadMarker(ctx context.Context, userID string) (*ReadMarker, error)
+	SetReadMarker(ctx context.Context, marker ReadMarker) error
+	DeleteReadMarker(ctx context.Context, userID string) error
+}
+
+// A PinCache caches the pinned messages, all of them at once.
+type PinCache interface {
+	ListPins(ctx context.Context) ([]Pin, error)
+	SetPins(ctx context.Context, pins []Pin) error
+}
+
+// A BlobStore stores the content of uploaded files by key.
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// A ThumbnailStore tracks the generation of thumbnails for uploaded images.
+// Claimed jobs are leased: a job that is neither completed nor failed
+// before its lease runs out is claimed again.
+type ThumbnailStore interface {
+	EnqueueThumbnails(ctx context.Context, attachmentID string) error
+	ClaimThumbnailJobs(ctx context.Context, limit int, lease time.Duration) ([]ThumbnailJob, error)
+	// CompleteThumbnailJob records the thumbnails and returns the attachment
+	// with them, which may have been sent since the job was claimed.
+	CompleteThumbnailJob(ctx context.Context, attachmentID string, thumbs []Thumbnail) (Attachment, error)
+	// FailThumbnailJob records why a job failed and runs it again after
+	// retryAfter, or never if it is zero.
+	FailThumbnailJob(ctx context.Context, attachmentID string, jobErr error, retryAfter time.Duration) error
+}
+
+// A Moderator decides what happens to a message before it is stored.
+type Moderator interface {
+	Moderate(text string) ModerationVerdict
+	// CheckRule reports why a rule can't be applied, such as a pattern that
+	// does not compile.
+	CheckRule(rule ModerationRule) error
+}
+
+// A ModerationRuleStore keeps the rules a Moderator applies, which
+// administrators edit.
+type ModerationRuleStore interface {
+	// ListModerationRules returns all rules, including disabled ones, oldest
+	// first.
+	ListModerationRules(ctx context.Context) ([]ModerationRule, error)
+	InsertModerationRule(ctx context.Context, rule ModerationRule) (ModerationRule, error)
+	UpdateModerationRule(ctx context.Context, rule ModerationRule) (ModerationRule, error)
+	DeleteModerationRule(ctx context.Context, id string) error
+}
+
+// A BanStore keeps the bans moderators place on users.
+type BanStore interface {
+	InsertBan(ctx context.Context, ban Ban) (Ban, error)
+	// ListBans returns all bans of a user, including lifted and expired ones,
+	// newest first.
+	ListBans(ctx context.Context, userID string) ([]Ban, error)
+	// ActiveBans returns the bans of a user that are neither lifted nor
+	// expired.
+	ActiveBans(ctx context.Context, userID string) ([]Ban, error)
+	LiftBan(ctx context.Context, id string) (*Ban, error)
+}
+
+// A BanCache caches the active bans of users by user, including that a user
+// has none.
+type BanCache interface {
+	GetBans(ctx context.Context, userID string) ([]Ban, error)
+	SetBans(ctx context.Context, userID string, bans []Ban) error
+	DeleteBans(ctx context.Context, userID string) error
+}
+
+// A BlockStore keeps the users each user blocked.
+type BlockStore interface {
+	// BlockUser records the block, unless it exists, and returns it and
+	// whether it is new.
+	BlockUser(ctx context.Context, block Block) (Block, bool, error)
+	UnblockUser(ctx context.Context, userID, blockedUserID string) error
+	// ListBlocks returns the blocks of a user, newest first.
+	ListBlocks(ctx context.Context, userID string) ([]Block, error)
+}
+
+// A BlockCache caches the IDs of the users each user blocked, including that
+// they blocked nobody.
+type BlockCache interface {
+	GetBlockedUsers(ctx context.Context, userID string) ([]string, error)
+	SetBlockedUsers(ctx context.Context, userID string, blocked []string) error
+	DeleteBlockedUsers(ctx context.Context, userID string) error
+}
+
+// A UserStore keeps user profiles.
+type UserStore interface {
+	InsertUser(ctx context.Context, user User) (User, error)
+	GetUser(ctx context.Context, id string) (*User, error)
+	// GetUsers returns the profiles of those users who have one, in no
+	// particular order.
+	GetUsers(ctx context.Context, ids []string) ([]User, error)
+	UpdateUser(ctx context.Context, user User) (User, error)
+	DeactivateUser(ctx context.Context, id string) (*User, error)
+}
+
+// A UserCache caches user profiles by ID. A nil profile records that the
+// user has none.
+type UserCache interface {
+	// GetUsers returns the cached profiles of the users, leaving out those
+	// that are not cached.
+	GetUsers(ctx context.Context, ids []string) (map[string]*User, error)
+	SetUsers(ctx context.Context, users map[string]*User) error
+	DeleteUser(ctx context.Context, id string) error
+}
+
+// A UserDataStore exports and erases the data of users. Erasure jobs are
+// leased like thumbnail jobs, and each batch is committed with the progress
+// of its job, so a job whose worker stops is claimed again and resumes where
+// it stopped.
+type UserDataStore interface {
+	// ExportUserData calls fn with each message of the user, then each
+	// reaction, oldest first, and stops at the first error.
+	ExportUserData(ctx context.Context, userID string, fn func(UserDataRecord) error) error
+	InsertErasureJob(ctx context.Context, job ErasureJob) (ErasureJob, error)
+	GetErasureJob(ctx context.Context, id string) (*ErasureJob, error)
+	ClaimErasureJobs(ctx context.Context, limit int, lease time.Duration) ([]ErasureJob, error)
+	// EraseUserData erases the next batch of the job's data, at most
+	// batchSize rows of each kind, and once nothing is left completes the
+	// job with an audit record.
+	EraseUserData(ctx context.Context, job ErasureJob, batchSize int) (ErasureBatch, error)
+	// ListUserArchives returns the keys of the archives that hold messages
+	// or mentions of the user.
+	ListUserArchives(ctx context.Context, userID string) ([]string, error)
+	// DeleteArchiveUser records that the archive under key no longer holds
+	// anything of the user.
+	DeleteArchiveUser(ctx context.Context, key, userID string) error
+}
+
+// A RetentionStore finds and deletes the messages past their retention.
+type RetentionStore interface {
+	// ExpiredMessages returns up to limit messages created before cutoff,
+	// oldest first, with their reaction counts and attachments, whatever
+	// their moderation. After, if not nil, is the last message of the
+	// previous page.
+	ExpiredMessages(ctx context.Context, cutoff time.Time, after *Message, limit int) ([]Message, error)
+	// DeleteMessages deletes the messages with everything on them, and
+	// returns the keys of the contents of their attachments and thumbnails.
+	DeleteMessages(ctx context.Context, ids []string) ([]string, error)
+	// InsertArchive records the users whose messages or mentions the archive
+	// under key holds, so that erasing their data finds it. Recording an
+	// archive again adds to its users.
+	InsertArchive(ctx context.Context, key string, userIDs []string) error
+}
+
+// A RateLimiter counts requests under a key against a limit. Every call
+// takes a request, whether it is allowed or not.
+type RateLimiter interface {
+	Allow(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error)
+}
+
+// An IdempotencyStore keeps the responses to requests made with an
+// idempotency key. Reserve stores a record for an in-flight request under key,
+// unless one exists, in which case that record is returned instead.
+type IdempotencyStore interface {
+	Reserve(ctx context.Context, key, fingerprint string, ttl time.Duration) (*IdempotencyRecord, error)
+	Save(ctx context.Context, key string, rec IdempotencyRecord, ttl time.Duration) error
+	Release(ctx context.Context, key string) error
+}
+
+// A Pinger checks that a dependency is reachable.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// A StateReporter reports the state of named components, such as circuit
+// breakers, for the health endpoint. Any state other than "closed" marks the
+// application as degraded.
+type StateReporter interface {
+	States() map[string]string
+}
+
 // Validator validates the struct based on the validation tags
 type Validator interface {
 	Struct(interface{}) error
@@ -41,28 +354,140 @@ type Validator interface {
 
 // API provides the REST endpoints for the application.
 type API struct {
-	Logger   *slog.Logger
-	DB       DB
-	Cache    Cache
-	Validate Validator
-	once     sync.Once
-	mux      *http.ServeMux
+	Logger            *slog.Logger
+	DB                DB
+	Cache             Cache
+	Queue             Queue // optional, buffers writes while the DB is unavailable
+	Validate          Validator
+	Auth              Authenticator            // optional, requires a bearer token for writes
+	APIKeys           APIKeyStore              // optional, accepts X-Api-Key and serves /admin/api-keys
+	APIKeyCache       APIKeyCache              // optional, caches API key lookups
+	ReadMarkers       ReadMarkerCache          // optional, caches read markers
+	Pins              PinCache                 // optional, caches pinned messages
+	Blobs             BlobStore                // optional, accepts uploads for attachments
+	MaxUploadSize     int64                    // in bytes, defaults to 10 MiB
+	UploadTypes       []string                 // allowed MIME types, defaults to images, PDF and plain text
+	Thumbnails        ThumbnailStore           // optional, queues thumbnails of uploaded images
+	Moderator         Moderator                // optional, moderates new messages
+	FlagsToHide       int                      // flags that hide a message until it is reviewed, defaults to 3
+	ModerationRules   ModerationRuleStore      // optional, serves /admin/moderation/rules
+	Bans              BanStore                 // optional, enforces bans and serves /admin/moderation/bans
+	BanCache          BanCache                 // optional, caches active bans
+	Blocks            BlockStore               // optional, filters blocked authors and serves /users/{userID}/blocks
+	BlockCache        BlockCache               // optional, caches blocked users
+	Users             UserStore                // optional, adds authors to messages and serves /users
+	UserCache         UserCache                // optional, caches user profiles
+	UserData          UserDataStore            // optional, serves /users/{userID}/export and /users/{userID}/data
+	RateLimiter       RateLimiter              // optional, enforces RateLimits
+	RateLimits        map[string]RateLimitRule // keyed by route pattern
+	TrustForwardedFor bool                     // use X-Forwarded-For, set by a proxy, as the client IP
+	Idempotency       IdempotencyStore         // optional, honours Idempotency-Key on writes
+	IdempotencyTTL    time.Duration            // how long responses are kept, defaults to a day
+	Health            []StateReporter          // reported by /health
+	Dependencies      map[string]Pinger        // pinged by /readyz, keyed by name
+	Optional          map[string]bool          // dependencies whose outage /readyz reports as degraded but ready
+	PingTimeout       time.Duration            // bounds each ping, defaults to one second
+	Metrics           *Metrics                 // optional, served on /metrics
+	TracerProvider    trace.TracerProvider     // defaults to the global provider
+	tracer            trace.Tracer
+	once              sync.Once
+	mux               *http.ServeMux
+	draining          atomic.Bool
 }
 
 func (a *API) setupRoutes() {
+	tp := a.TracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	a.tracer = tp.Tracer("github.com/GetStream/stream-backend-homework-assignment/api")
+
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("GET /messages", a.listMessages)
-	mux.HandleFunc("POST /messages", a.createMessage)
-	mux.HandleFunc("POST /messages/{messageID}/reactions", a.createReaction)
+	mux.HandleFunc("GET /messages/search", a.searchMessages)
+	mux.HandleFunc("POST /messages", a.authenticated(a.rateLimited(a.idempotent(a.createMessage))))
+	mux.HandleFunc("POST /messages/{messageID}/reactions", a.authenticated(a.rateLimited(a.idempotent(a.createReaction))))
+	mux.HandleFunc("POST /messages/{messageID}/pin", a.authenticated(a.rateLimited(a.pinMessage)))
+	mux.HandleFunc("DELETE /messages/{messageID}/pin", a.authenticated(a.rateLimited(a.unpinMessage)))
+	mux.HandleFunc("GET /pins", a.listPins)
+	mux.HandleFunc("POST /messages/{messageID}/read", a.authenticated(a.rateLimited(a.markRead)))
+	mux.HandleFunc("GET /users/{userID}/unread", a.authenticated(a.unreadCounts))
+	mux.HandleFunc("GET /users/{userID}/mentions", a.authenticated(a.listMentions))
+	mux.HandleFunc("POST /users/{userID}/mentions/read", a.authenticated(a.rateLimited(a.markMentionsRead)))
+	mux.HandleFunc("POST /messages/{messageID}/flag", a.authenticated(a.rateLimited(a.flagMessage)))
+	mux.HandleFunc("GET /admin/moderation/flags", a.authenticated(a.listFlaggedMessages))
+	mux.HandleFunc("POST /admin/moderation/messages/{messageID}/review", a.authenticated(a.reviewMessage))
+	mux.HandleFunc("GET /health", a.health)
+	mux.HandleFunc("GET /healthz", a.healthz)
+	mux.HandleFunc("GET /readyz", a.readyz)
+	if a.Metrics != nil {
+		mux.Handle("GET /metrics", a.Metrics.reg)
+	}
+	if a.Blobs != nil {
+		mux.HandleFunc("POST /uploads", a.authenticated(a.rateLimited(a.upload)))
+		mux.HandleFunc("GET /uploads/{attachmentID}", a.download)
+		mux.HandleFunc("GET /uploads/{attachmentID}/thumbnails/{size}", a.downloadThumbnail)
+	}
+	if a.APIKeys != nil {
+		mux.HandleFunc("POST /admin/api-keys", a.authenticated(a.createAPIKey))
+		mux.HandleFunc("GET /admin/api-keys", a.authenticated(a.listAPIKeys))
+		mux.HandleFunc("DELETE /admin/api-keys/{keyID}", a.authenticated(a.revokeAPIKey))
+	}
+	if a.ModerationRules != nil {
+		mux.HandleFunc("POST /admin/moderation/rules", a.authenticated(a.createModerationRule))
+		mux.HandleFunc("GET /admin/moderation/rules", a.authenticated(a.listModerationRules))
+		mux.HandleFunc("PUT /admin/moderation/rules/{ruleID}", a.authenticated(a.updateModerationRule))
+		mux.HandleFunc("DELETE /admin/moderation/rules/{ruleID}", a.authenticated(a.deleteModerationRule))
+	}
+	if a.Users != nil {
+		mux.HandleFunc("POST /users", a.authenticated(a.rateLimited(a.createUser)))
+		mux.HandleFunc("GET /users/{userID}", a.getUser)
+		mux.HandleFunc("PATCH /users/{userID}", a.authenticated(a.rateLimited(a.updateUser)))
+		mux.HandleFunc("DELETE /users/{userID}", a.authenticated(a.deactivateUser))
+	}
+	if a.UserData != nil {
+		mux.HandleFunc("GET /users/{userID}/export", a.authenticated(a.rateLimited(a.exportUserData)))
+		mux.HandleFunc("DELETE /users/{userID}/data", a.authenticated(a.rateLimited(a.eraseUserData)))
+		mux.HandleFunc("GET /users/{userID}/data/erasures/{jobID}", a.authenticated(a.getErasureJob))
+	}
+	if a.Blocks != nil {
+		mux.HandleFunc("GET /users/{userID}/blocks", a.authenticated(a.listBlocks))
+		mux.HandleFunc("PUT /users/{userID}/blocks/{blockedID}", a.authenticated(a.rateLimited(a.blockUser)))
+		mux.HandleFunc("DELETE /users/{userID}/blocks/{blockedID}", a.authenticated(a.rateLimited(a.unblockUser)))
+	}
+	if a.Bans != nil {
+		mux.HandleFunc("POST /admin/moderation/users/{userID}/bans", a.authenticated(a.createBan))
+		mux.HandleFunc("GET /admin/moderation/users/{userID}/bans", a.authenticated(a.listBans))
+		mux.HandleFunc("DELETE /admin/moderation/bans/{banID}", a.authenticated(a.liftBan))
+	}
 
 	a.mux = mux
 }
 
 func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	a.once.Do(a.setupRoutes)
-	a.Logger.Info("Request received", "method", r.Method, "path", r.URL.Path)
-	a.mux.ServeHTTP(w, r)
+	start := time.Now()
+
+	id := requestID(r)
+	w.Header().Set(requestIDHeader, id)
+	info := &requestInfo{}
+	ctx := WithLogger(r.Context(), a.Logger.With("request_id", id))
+	ctx = context.WithValue(ctx, requestInfoKey{}, info)
+	r = r.WithContext(ctx)
+
+	_, route := a.mux.Handler(r)
+	info.route = route
+	ctx, span := a.startSpan(r, route)
+	defer span.End()
+	span.SetAttributes(attribute.String("http.request.id", id))
+
+	rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+	a.mux.ServeHTTP(rec, r.WithContext(ctx))
+	d := time.Since(start)
+	endSpan(span, rec.status)
+	a.Metrics.observeRequest(route, rec.status, d)
+	logRequest(ctx, r, route, rec, info, d)
 }
 
 func (a *API) respond(w http.ResponseWriter, status int, body any) {
@@ -73,7 +498,7 @@ func (a *API) respond(w http.ResponseWriter, status int, body any) {
 	}
 }
 
-func (a *API) respondError(w http.ResponseWriter, status int, err error, msg string) {
+func (a *API) respondError(w http.ResponseWriter, r *http.Request, status int, err error, msg string) {
 	type response struct {
 		Error  string            `json:"error"`
 		Fields map[string]string `json:"fields,omitempty"`
@@ -88,7 +513,7 @@ func (a *API) respondError(w http.ResponseWriter, status int, err error, msg str
 		}
 		resp.Error = "Validation Error"
 	}
-	a.Logger.Warn("Error", "error", err.Error())
+	LoggerFrom(r.Context()).Warn("Error", "error", err.Error())
 	a.respond(w, status, resp)
 }
 
@@ -105,6 +530,12 @@ type message struct {
 	UserID                string                  `json:"user_id"`
 	CreatedAt             string                  `json:"created_at"`
 	MessageReactionCounts []messageReactionCounts `json:"message_reactions"`
+	Mentions              []mention               `json:"mentions,omitempty"`
+	Pinned                bool                    `json:"pinned,omitempty"`
+	Attachments           []attachment            `json:"attachments,omitempty"`
+	Format                string                  `json:"format,omitempty"`
+	HTML                  string                  `json:"html,omitempty"`
+	User                  *user                   `json:"user,omitempty"`
 }
 
 func (a *API) listMessages(w http.ResponseWriter, r *http.Request) {
@@ -112,23 +543,39 @@ func (a *API) listMessages(w http.ResponseWriter, r *http.Request) {
 		Messages []message `json:"messages"`
 	}
 
-	p := r.URL.Query().Get("page")
-	page, err := strconv.Atoi(p)
-	if err != nil || page < 1 {
-		page = 1
+	log := LoggerFrom(r.Context())
+	q, err := parseListQuery(r)
+	if err != nil {
+		a.respondError(w, r, http.StatusBadRequest, err, err.Error())
+		return
+	}
+	offset := q.Offset
+	q.Viewer = a.viewer(r)
+	if q.Viewer != "" {
+		q.ExcludeUserIDs = a.blockedUsers(r.Context(), q.Viewer)
 	}
-	offset := (page - 1) * pageSize
 
 	var msgs []Message
-	if offset < cacheSize {
+	if q.Filtered() {
+		// The cache only holds the newest messages.
+		log.Info("Filtered list, not using cache")
+	} else if q.Viewer != "" && banOf(a.activeBans(r.Context(), q.Viewer), BanShadow) != nil {
+		// Nor the messages of shadow-banned users, which they still see.
+		log.Info("Viewer is shadow-banned, not using cache")
+	} else if offset < cacheSize {
 		// Get messages from cache
 		msgs, err = a.Cache.ListMessages(r.Context())
 		if err != nil {
-			a.Logger.Error("Error listing messages from cache, trying database", "error", err.Error())
+			log.Error("Error listing messages from cache, trying database", "error", err.Error())
 		}
+		// The cache is shared, so blocked authors are left out here and the
+		// database tops the page up.
+		msgs = slices.DeleteFunc(msgs, func(m Message) bool {
+			return slices.Contains(q.ExcludeUserIDs, m.UserID)
+		})
 	}
 	cacheMsgCount := len(msgs)
-	a.Logger.Info("Got messages from cache", "count", cacheMsgCount)
+	log.Info("Got messages from cache", "count", cacheMsgCount)
 
 	// Get any remaining messages from DB
 	msgIDs := make([]string, cacheMsgCount)
@@ -137,23 +584,76 @@ func (a *API) listMessages(w http.ResponseWriter, r *http.Request) {
 	}
 	var dbMsgs []Message
 	if cacheMsgCount < pageSize {
-		dbMsgs, err = a.DB.ListMessages(r.Context(), pageSize-cacheMsgCount, offset, msgIDs...)
-		if err != nil {
-			a.Logger.Error("Error listing messages from db, trying database", "error", err.Error())
-			a.respondError(w, http.StatusInternalServerError, err, "Could not list messages")
+		q.Limit = pageSize - cacheMsgCount
+		dbMsgs, err = a.DB.ListMessages(r.Context(), q, msgIDs...)
+		if err != nil && cacheMsgCount == 0 {
+			log.Error("Error listing messages from db, trying database", "error", err.Error())
+			a.respondError(w, r, http.StatusInternalServerError, err, "Could not list messages")
 			return
 		}
+		if err != nil {
+			// The cache still has the latest messages, serve those rather
+			// than failing the whole request.
+			log.Warn("Error listing messages from db, serving cache only", "error", err.Error())
+			w.Header().Set(degradedHeader, "true")
+		}
+	} else if q.Viewer != "" {
+		// The cache fills the page, but the viewer may have shadowed
+		// messages that are newer than some of it.
+		dbMsgs = a.ownMessages(r.Context(), q.Viewer, msgs)
 	}
-	a.Logger.Info("Got remaining messages from DB", "count", len(dbMsgs))
+	log.Info("Got remaining messages from DB", "count", len(dbMsgs))
+	a.Metrics.observeList(cacheMsgCount, len(dbMsgs))
 	msgs = append(msgs, dbMsgs...)
+	if q.Viewer != "" && cacheMsgCount > 0 {
+		// The viewer's shadowed messages are not cached, so they may be
+		// newer than cached ones.
+		slices.SortStableFunc(msgs, func(a, b Message) int {
+			return b.CreatedAt.Compare(a.CreatedAt)
+		})
+		msgs = msgs[:min(len(msgs), pageSize)]
+	}
+	pinned := a.pinnedIDs(r.Context())
+	for i := range msgs {
+		msgs[i].Pinned = pinned[msgs[i].ID]
+	}
 
+	authors := make([]string, len(msgs))
+	for i := range msgs {
+		authors[i] = msgs[i].UserID
+	}
+	users := a.loadUsers(r.Context(), authors)
 	out := toMessage(msgs)
+	for i := range out {
+		out[i].User = toUser(users[msgs[i].UserID])
+	}
 	res := response{
 		Messages: out,
 	}
 	a.respond(w, http.StatusOK, res)
 }
 
+// ownMessages lists the messages of the viewer that are not among the cached
+// msgs but newer than the oldest of them, such as those shadowed by
+// moderation, which the shared cache never holds but their author sees.
+func (a *API) ownMessages(ctx context.Context, viewer string, msgs []Message) []Message {
+	ids := make([]string, len(msgs))
+	for i, m := range msgs {
+		ids[i] = m.ID
+	}
+	own, err := a.DB.ListMessages(ctx, ListQuery{
+		Limit:  pageSize,
+		UserID: viewer,
+		Since:  msgs[len(msgs)-1].CreatedAt,
+		Viewer: viewer,
+	}, ids...)
+	if err != nil {
+		LoggerFrom(ctx).Warn("Error listing the viewer's own messages, serving cache only", "error", err.Error())
+		return nil
+	}
+	return own
+}
+
 // toMessage converts the Message list to message dto list
 func toMessage(msgs []Message) []message {
 	out := make([]message, len(msgs))
@@ -164,6 +664,11 @@ func toMessage(msgs []Message) []message {
 			UserID:                msg.UserID,
 			CreatedAt:             msg.CreatedAt.Format(time.RFC1123),
 			MessageReactionCounts: make([]messageReactionCounts, 0),
+			Mentions:              messageMentions(msg),
+			Pinned:                msg.Pinned,
+			Attachments:           toAttachments(msg.Attachments),
+			Format:                msg.Format,
+			HTML:                  messageHTML(msg),
 		}
 		for _, reaction := range msg.MessageReactionCounts {
 			out[i].MessageReactionCounts = append(out[i].MessageReactionCounts, messageReactionCounts{
@@ -175,56 +680,141 @@ func toMessage(msgs []Message) []message {
 	return out
 }
 
+// messageHTML renders the text of markdown messages as sanitized HTML.
+// Plain text is left to clients to escape.
+func messageHTML(msg Message) string {
+	if msg.Format != FormatMarkdown {
+		return ""
+	}
+	return markdown.ToHTML(msg.Text)
+}
+
 func (a *API) createMessage(w http.ResponseWriter, r *http.Request) {
 	type (
 		request struct {
-			Text   string `json:"text" validate:"required"`
-			UserID string `json:"user_id" validate:"required"`
+			Text          string   `json:"text" validate:"required"`
+			UserID        string   `json:"user_id" validate:"required"`
+			AttachmentIDs []string `json:"attachment_ids" validate:"max=10,dive,required"`
+			Format        string   `json:"format" validate:"omitempty,oneof=text markdown"`
 		}
 		response struct {
-			ID        string `json:"id"`
-			Text      string `json:"text"`
-			UserID    string `json:"user_id"`
-			CreatedAt string `json:"created_at"`
+			ID          string       `json:"id"`
+			Text        string       `json:"text"`
+			UserID      string       `json:"user_id"`
+			CreatedAt   string       `json:"created_at"`
+			Mentions    []mention    `json:"mentions,omitempty"`
+			Attachments []attachment `json:"attachments,omitempty"`
+			Format      string       `json:"format,omitempty"`
+			HTML        string       `json:"html,omitempty"`
 		}
 	)
 
+	if !a.requireScope(w, r, ScopeMessagesWrite) {
+		return
+	}
+	log := LoggerFrom(r.Context())
 	var body request
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		a.Logger.Warn("Error decoding request body", "error", err.Error())
-		a.respondError(w, http.StatusBadRequest, err, "Could not decode request body")
+		log.Warn("Error decoding request body", "error", err.Error())
+		a.respondError(w, r, http.StatusBadRequest, err, "Could not decode request body")
 		return
 	}
 	r.Body.Close()
 
+	userID, ok := a.authorizeUser(w, r, body.UserID)
+	if !ok {
+		return
+	}
+	body.UserID = userID
+
 	// Validate the request body
 	if err := a.Validate.Struct(body); err != nil {
-		a.respondError(w, http.StatusBadRequest, err, "Validation failed")
+		a.respondError(w, r, http.StatusBadRequest, err, "Validation failed")
+		return
+	}
+	setUser(r.Context(), body.UserID)
+	bans := a.activeBans(r.Context(), body.UserID)
+	if ban := banOf(bans, BanBan, BanMute); ban != nil {
+		a.respondBanned(w, r, ban)
+		return
+	}
+	if !a.requireActive(w, r, body.UserID) {
 		return
 	}
 
-	msg, err := a.DB.InsertMessage(r.Context(), Message{
+	verdict := a.moderate(r.Context(), body.Text)
+	if verdict.Action == ModerationBlock {
+		a.respondError(w, r, http.StatusUnprocessableEntity, blockedError(verdict), "Message was blocked by moderation")
+		return
+	}
+	if banOf(bans, BanShadow) != nil {
+		verdict.Action = ModerationShadow
+	}
+
+	msg := Message{
 		Text:      body.Text,
 		UserID:    body.UserID,
 		CreatedAt: time.Now(),
-	})
-	if err != nil {
-		a.Logger.Error("Error creating message in DB", "error", err.Error())
-		a.respondError(w, http.StatusInternalServerError, err, "Could not insert message")
+		Mentions:  mentionedUsers(body.Text),
+	}
+	if body.Format == FormatMarkdown {
+		msg.Format = FormatMarkdown
+	}
+	switch verdict.Action {
+	case ModerationFlag:
+		msg.Moderation = ModerationFlag
+	case ModerationShadow:
+		// Nobody is notified of a message nobody sees.
+		msg.Moderation = ModerationShadow
+		msg.Mentions = nil
+	}
+	for _, id := range body.AttachmentIDs {
+		msg.Attachments = append(msg.Attachments, Attachment{ID: id})
+	}
+	status := http.StatusCreated
+	stored, err := a.DB.InsertMessage(r.Context(), msg)
+	switch {
+	case err == nil:
+		msg = stored
+	case errors.Is(err, ErrAttachmentNotFound):
+		a.respondError(w, r, http.StatusBadRequest, err, "Unknown attachment")
+		return
+	// Attachments can't be checked without the DB, so those messages aren't
+	// queued.
+	case a.Queue != nil && errors.Is(err, ErrDBUnavailable) && len(msg.Attachments) == 0:
+		log.Warn("Database unavailable, queueing message", "error", err.Error())
+		msg.ID = newID()
+		if err := a.Queue.Enqueue(r.Context(), QueuedWrite{Message: &msg}); err != nil {
+			log.Error("Error queueing message", "error", err.Error())
+			a.respondError(w, r, http.StatusInternalServerError, err, "Could not insert message")
+			return
+		}
+		w.Header().Set(degradedHeader, "true")
+		status = http.StatusAccepted
+	default:
+		log.Error("Error creating message in DB", "error", err.Error())
+		a.respondError(w, r, http.StatusInternalServerError, err, "Could not insert message")
 		return
 	}
 
-	if err := a.Cache.InsertMessage(r.Context(), msg); err != nil {
-		a.Logger.Error("Could not cache message", "error", err.Error())
+	// The cache only holds what is listed.
+	if msg.Moderation != ModerationShadow {
+		if err := a.Cache.InsertMessage(r.Context(), msg); err != nil {
+			log.Error("Could not cache message", "error", err.Error())
+		}
 	}
 
 	res := response{
-		ID:        msg.ID,
-		Text:      msg.Text,
-		UserID:    msg.UserID,
-		CreatedAt: msg.CreatedAt.Format(time.RFC1123),
+		ID:          msg.ID,
+		Text:        msg.Text,
+		UserID:      msg.UserID,
+		CreatedAt:   msg.CreatedAt.Format(time.RFC1123),
+		Mentions:    messageMentions(msg),
+		Attachments: toAttachments(msg.Attachments),
+		Format:      msg.Format,
+		HTML:        messageHTML(msg),
 	}
-	a.respond(w, http.StatusCreated, res)
+	a.respond(w, status, res)
 }
 
 func (a *API) createReaction(w http.ResponseWriter, r *http.Request) {
@@ -244,43 +834,85 @@ func (a *API) createReaction(w http.ResponseWriter, r *http.Request) {
 		}
 	)
 
+	if !a.requireScope(w, r, ScopeReactionsWrite) {
+		return
+	}
+	log := LoggerFrom(r.Context())
 	messageID := r.PathValue("messageID")
 	var body request
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		a.Logger.Warn("Error decoding request body", "error", err.Error())
-		a.respondError(w, http.StatusBadRequest, err, "Could not decode request body")
+		log.Warn("Error decoding request body", "error", err.Error())
+		a.respondError(w, r, http.StatusBadRequest, err, "Could not decode request body")
 		return
 	}
 	r.Body.Close()
+	userID, ok := a.authorizeUser(w, r, body.UserID)
+	if !ok {
+		return
+	}
+	body.UserID = userID
+
 	// Validate the request body
 	if err := a.Validate.Struct(body); err != nil {
-		a.respondError(w, http.StatusBadRequest, err, "Validation failed")
+		a.respondError(w, r, http.StatusBadRequest, err, "Validation failed")
+		return
+	}
+	setUser(r.Context(), body.UserID)
+	if ban := banOf(a.activeBans(r.Context(), body.UserID), BanBan); ban != nil {
+		a.respondBanned(w, r, ban)
+		return
+	}
+	if !a.requireActive(w, r, body.UserID) {
 		return
 	}
-	reaction, err := a.DB.InsertReaction(r.Context(), Reaction{
+	reaction := Reaction{
 		MessageID: messageID,
 		UserID:    body.UserID,
 		Type:      body.Type,
 		Score:     body.Score,
 		CreatedAt: time.Now(),
-	})
-	if err != nil {
+	}
+	status := http.StatusCreated
+	stored, err := a.DB.InsertReaction(r.Context(), reaction)
+	switch {
+	case err == nil:
+		reaction = stored
+	case a.Queue != nil && errors.Is(err, ErrDBUnavailable):
+		log.Warn("Database unavailable, queueing reaction", "error", err.Error())
+		reaction.ID = newID()
+		if reaction.Score == 0 {
+			reaction.Score = 1
+		}
+		if err := a.Queue.Enqueue(r.Context(), QueuedWrite{Reaction: &reaction}); err != nil {
+			log.Error("Error queueing reaction", "error", err.Error())
+			a.respondError(w, r, http.StatusInternalServerError, err, "Could not insert reaction")
+			return
+		}
+		w.Header().Set(degradedHeader, "true")
+		status = http.StatusAccepted
+	default:
 		var pgErr pgdriver.Error
 		if ok := errors.As(err, &pgErr); ok {
 			if pgErr.IntegrityViolation() {
-				a.Logger.Warn("Duplicate reaction", "error", pgErr.Error())
-				a.respondError(w, http.StatusConflict, err, "Already reacted to this message")
+				log.Warn("Duplicate reaction", "error", pgErr.Error())
+				a.respondError(w, r, http.StatusConflict, err, "Already reacted to this message")
 				return
 			}
 		}
-		a.respondError(w, http.StatusInternalServerError, err, "Could not insert reaction")
+		a.respondError(w, r, http.StatusInternalServerError, err, "Could not insert reaction")
 		return
 	}
 
+	a.Metrics.observeReaction(reaction.Type)
+
 	m, err := a.Cache.GetMessage(r.Context(), messageID)
+	if errors.Is(err, ErrCacheUnavailable) {
+		log.Warn("Cache unavailable, not updating cached message", "error", err.Error())
+		m, err = nil, nil
+	}
 	if err != nil && !errors.Is(err, ErrMessageNotFoundInCache) {
-		a.Logger.Error("Could not cache message", "error", err.Error())
-		a.respondError(w, http.StatusInternalServerError, err, "Could not update the cache")
+		log.Error("Could not cache message", "error", err.Error())
+		a.respondError(w, r, http.StatusInternalServerError, err, "Could not update the cache")
 		return
 	}
 
@@ -303,15 +935,15 @@ func (a *API) createReaction(w http.ResponseWriter, r *http.Request) {
 		//Update the cache
 		err = a.Cache.DeleteMessage(r.Context(), messageID)
 		if err != nil {
-			a.Logger.Error("Could not cache message", "error", err.Error())
-			a.respondError(w, http.StatusInternalServerError, err, "Could not update the cache")
+			log.Error("Could not cache message", "error", err.Error())
+			a.respondError(w, r, http.StatusInternalServerError, err, "Could not update the cache")
 			return
 		}
 
 		err = a.Cache.InsertMessage(r.Context(), *m)
 		if err != nil {
-			a.Logger.Error("Could not cache message", "error", err.Error())
-			a.respondError(w, http.StatusInternalServerError, err, "Could not update the cache")
+			log.Error("Could not cache message", "error", err.Error())
+			a.respondError(w, r, http.StatusInternalServerError, err, "Could not update the cache")
 			return
 		}
 	}
@@ -324,7 +956,7 @@ func (a *API) createReaction(w http.ResponseWriter, r *http.Request) {
 		UserID:    reaction.UserID,
 		CreatedAt: reaction.CreatedAt.Format(time.RFC1123),
 	}
-	a.respond(w, http.StatusCreated, res)
+	a.respond(w, status, res)
 }
 
 func (a *API) validateRequest(body interface{}) error {
@@ -337,3 +969,13 @@ func (a *API) validateRequest(body interface{}) error {
 	}
 	return nil
 }
+
+// newID returns a random (version 4) UUID. It is used for writes that are
+// queued while the DB, which normally generates IDs, is unavailable.
+func newID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
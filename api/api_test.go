@@ -15,15 +15,17 @@ import (
 	"time"
 
 	"github.com/neilotoole/slogt"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func TestAPI_listMessages(t *testing.T) {
 	tests := []struct {
-		name       string
-		db         *testdb
-		cache      *testcache
-		wantStatus int
-		wantBody   string
+		name         string
+		db           *testdb
+		cache        *testcache
+		wantStatus   int
+		wantBody     string
+		wantDegraded bool
 	}{
 		{
 			name: "DBError",
@@ -42,6 +44,39 @@ func TestAPI_listMessages(t *testing.T) {
 				"error": "Could not list messages"
 			}`,
 		},
+		{
+			name: "DBErrorServesCache",
+			cache: &testcache{
+				listMessages: func(t *testing.T) ([]Message, error) {
+					return []Message{
+						{
+							ID:        "1",
+							Text:      "Hello",
+							UserID:    "testuser",
+							CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+						},
+					}, nil
+				},
+			},
+			db: &testdb{
+				listMessages: func(t *testing.T, excludeMsgIDs ...string) ([]Message, error) {
+					return nil, fmt.Errorf("scan: %w", ErrDBUnavailable)
+				},
+			},
+			wantStatus: 200,
+			wantBody: `{
+				"messages": [
+					{
+						"id": "1",
+						"text": "Hello",
+						"user_id": "testuser",
+						"created_at": "Mon, 01 Jan 2024 00:00:00 UTC",
+						"message_reactions": []
+					}
+				]
+			}`,
+			wantDegraded: true,
+		},
 		{
 			name: "CacheError",
 			cache: &testcache{
@@ -217,19 +252,79 @@ func TestAPI_listMessages(t *testing.T) {
 			}
 			checkStatus(t, resp.StatusCode, tt.wantStatus)
 			checkBody(t, resp, tt.wantBody)
+			checkDegraded(t, resp, tt.wantDegraded)
+		})
+	}
+}
+
+func TestAPI_listMessages_ownShadowed(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var cached []Message
+	for i := range pageSize {
+		cached = append(cached, Message{
+			ID:        fmt.Sprint(pageSize - i),
+			Text:      "Hello",
+			UserID:    "bob",
+			CreatedAt: created.Add(time.Duration(pageSize-i) * time.Minute),
 		})
 	}
+	api := &API{
+		Logger: slogt.New(t),
+		DB: &testdb{
+			T: t,
+			listQuery: func(t *testing.T, q ListQuery) {
+				if q.UserID != "alice" || q.Viewer != "alice" || !q.Since.Equal(cached[pageSize-1].CreatedAt) {
+					t.Errorf("Got query %+v, want alice's messages since the oldest cached one", q)
+				}
+			},
+			listMessages: func(t *testing.T, excludeMsgIDs ...string) ([]Message, error) {
+				if len(excludeMsgIDs) != pageSize {
+					t.Errorf("Got excluded IDs %v, want the cached messages", excludeMsgIDs)
+				}
+				return []Message{{ID: "shadowed", Text: "Buy now", UserID: "alice", CreatedAt: created.Add(time.Hour)}}, nil
+			},
+		},
+		Cache: &testcache{
+			T: t,
+			listMessages: func(t *testing.T) ([]Message, error) {
+				return cached, nil
+			},
+		},
+		Validate: &MockValidator{},
+	}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	resp := doWithKey(t, "GET", srv.URL+"/messages?viewer=alice", "", "")
+	checkStatus(t, resp.StatusCode, http.StatusOK)
+	var body struct {
+		Messages []message `json:"messages"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Messages) != pageSize {
+		t.Fatalf("Got %d messages, want a page of %d", len(body.Messages), pageSize)
+	}
+	if body.Messages[0].ID != "shadowed" {
+		t.Errorf("Got first message %q, want the viewer's shadowed message", body.Messages[0].ID)
+	}
+	if last := body.Messages[pageSize-1].ID; last != "2" {
+		t.Errorf("Got last message %q, want the oldest cached one pushed off the page", last)
+	}
 }
 
 func TestAPI_createMessage(t *testing.T) {
 	tests := []struct {
-		name        string
-		cache       *testcache
-		db          *testdb
-		req         string
-		wantStatus  int
-		wantBody    string
-		containsLog string
+		name         string
+		cache        *testcache
+		db           *testdb
+		queue        *testqueue
+		req          string
+		wantStatus   int
+		wantBody     string
+		wantDegraded bool
+		containsLog  string
 	}{
 		{
 			name:       "InvalidJSON",
@@ -255,6 +350,62 @@ func TestAPI_createMessage(t *testing.T) {
 				"error": "Could not insert message"
 			}`,
 		},
+		{
+			name: "DBUnavailableQueues",
+			req: `{
+				"text": "hello",
+				"user_id": "test"
+			}`,
+			db: &testdb{
+				insertMessage: func(t *testing.T, msg Message) (Message, error) {
+					return Message{}, fmt.Errorf("insert: %w", ErrDBUnavailable)
+				},
+			},
+			queue: &testqueue{
+				enqueue: func(t *testing.T, w QueuedWrite) error {
+					if w.Message == nil || w.Message.ID == "" {
+						t.Fatalf("Got queued write %+v, want message with ID", w)
+					}
+					w.Message.ID = "1"
+					w.Message.CreatedAt = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+					return nil
+				},
+			},
+			cache: &testcache{
+				insertMessage: func(t *testing.T, msg Message) error {
+					return nil
+				},
+			},
+			wantStatus: 202,
+			wantBody: `{
+				"id": "1",
+				"text": "hello",
+				"user_id": "test",
+				"created_at": "Mon, 01 Jan 2024 00:00:00 UTC"
+			}`,
+			wantDegraded: true,
+		},
+		{
+			name: "DBUnavailableQueueError",
+			req: `{
+				"text": "hello",
+				"user_id": "test"
+			}`,
+			db: &testdb{
+				insertMessage: func(t *testing.T, msg Message) (Message, error) {
+					return Message{}, fmt.Errorf("insert: %w", ErrDBUnavailable)
+				},
+			},
+			queue: &testqueue{
+				enqueue: func(t *testing.T, w QueuedWrite) error {
+					return errors.New("something went wrong")
+				},
+			},
+			wantStatus: 500,
+			wantBody: `{
+				"error": "Could not insert message"
+			}`,
+		},
 		{
 			name: "CacheError",
 			req: `{
@@ -285,6 +436,71 @@ func TestAPI_createMessage(t *testing.T) {
 			}`,
 			containsLog: "Could not cache message",
 		},
+		{
+			name: "Markdown",
+			req: `{
+				"text": "**hi** <b>",
+				"user_id": "test",
+				"format": "markdown"
+			}`,
+			db: &testdb{
+				insertMessage: func(t *testing.T, msg Message) (Message, error) {
+					if msg.Format != FormatMarkdown {
+						t.Errorf("Got Format %q, want markdown", msg.Format)
+					}
+					msg.ID = "1"
+					msg.CreatedAt = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+					return msg, nil
+				},
+			},
+			cache: &testcache{
+				insertMessage: func(t *testing.T, msg Message) error {
+					if msg.Format != FormatMarkdown {
+						t.Errorf("Got cached Format %q, want markdown", msg.Format)
+					}
+					return nil
+				},
+			},
+			wantStatus: 201,
+			wantBody: `{
+				"id": "1",
+				"text": "**hi** \u003cb\u003e",
+				"user_id": "test",
+				"created_at": "Mon, 01 Jan 2024 00:00:00 UTC",
+				"format": "markdown",
+				"html": "\u003cp\u003e\u003cstrong\u003ehi\u003c/strong\u003e \u0026lt;b\u0026gt;\u003c/p\u003e"
+			}`,
+		},
+		{
+			name: "TextFormat",
+			req: `{
+				"text": "**hi**",
+				"user_id": "test",
+				"format": "text"
+			}`,
+			db: &testdb{
+				insertMessage: func(t *testing.T, msg Message) (Message, error) {
+					if msg.Format != "" {
+						t.Errorf("Got Format %q, want empty", msg.Format)
+					}
+					msg.ID = "1"
+					msg.CreatedAt = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+					return msg, nil
+				},
+			},
+			cache: &testcache{
+				insertMessage: func(t *testing.T, msg Message) error {
+					return nil
+				},
+			},
+			wantStatus: 201,
+			wantBody: `{
+				"id": "1",
+				"text": "**hi**",
+				"user_id": "test",
+				"created_at": "Mon, 01 Jan 2024 00:00:00 UTC"
+			}`,
+		},
 		{
 			name: "OK",
 			req: `{
@@ -345,6 +561,10 @@ func TestAPI_createMessage(t *testing.T) {
 				},
 				Logger: slog.New(slog.NewTextHandler(buf, nil)),
 			}
+			if tt.queue != nil {
+				tt.queue.T = t
+				api.Queue = tt.queue
+			}
 
 			srv := httptest.NewServer(api)
 			defer srv.Close()
@@ -356,6 +576,7 @@ func TestAPI_createMessage(t *testing.T) {
 			}
 			checkStatus(t, resp.StatusCode, tt.wantStatus)
 			checkBody(t, resp, tt.wantBody)
+			checkDegraded(t, resp, tt.wantDegraded)
 			checkLog(t, buf, tt.containsLog)
 		})
 	}
@@ -483,6 +704,40 @@ func TestAPI_createReaction(t *testing.T) {
             "error": "Could not insert reaction"
           }`,
 		},
+		{
+			name: "OKCacheUnavailable",
+			req: `{
+				"type": "like",
+				"user_id": "test"
+			}`,
+			messageID: "12345",
+			db: &testdb{
+				insertReaction: func(t *testing.T, reaction Reaction) (Reaction, error) {
+					return Reaction{
+						ID:        "1",
+						MessageID: "12345",
+						Score:     1,
+						Type:      reaction.Type,
+						UserID:    reaction.UserID,
+						CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+					}, nil
+				},
+			},
+			cache: &testcache{
+				getMessage: func(t *testing.T, id string) (*Message, error) {
+					return nil, fmt.Errorf("%w: circuit breaker is open", ErrCacheUnavailable)
+				},
+			},
+			wantStatus: 201,
+			wantBody: `{
+				"id": "1",
+				"message_id": "12345",
+				"type": "like",
+				"score": 1,
+				"user_id": "test",
+				"created_at": "Mon, 01 Jan 2024 00:00:00 UTC"
+			}`,
+		},
 		{
 			name: "ERRCacheFails",
 			req: `{
@@ -560,13 +815,35 @@ func TestAPI_createReaction(t *testing.T) {
 }
 
 type testdb struct {
-	T              *testing.T
-	listMessages   func(t *testing.T, excludeMsgIDs ...string) ([]Message, error)
-	insertMessage  func(t *testing.T, msg Message) (Message, error)
-	insertReaction func(t *testing.T, reaction Reaction) (Reaction, error)
+	T               *testing.T
+	listMessages    func(t *testing.T, excludeMsgIDs ...string) ([]Message, error)
+	listMessagesCtx func(sc trace.SpanContext)
+	listQuery       func(t *testing.T, q ListQuery)
+	insertMessage   func(t *testing.T, msg Message) (Message, error)
+	insertReaction  func(t *testing.T, reaction Reaction) (Reaction, error)
+	searchMessages  func(t *testing.T, q SearchQuery) ([]SearchResult, error)
+	listMentions    func(t *testing.T, q MentionQuery) ([]Mention, error)
+	markMentions    func(t *testing.T, userID string, msgIDs ...string) (int, error)
+	markRead        func(t *testing.T, userID, messageID string) (ReadMarker, error)
+	getReadMarker   func(t *testing.T, userID string) (*ReadMarker, error)
+	countUnread     func(t *testing.T, userID string, marker *ReadMarker) (UnreadCounts, error)
+	pinMessage      func(t *testing.T, messageID, userID string) (Pin, error)
+	unpinMessage    func(t *testing.T, messageID string) error
+	listPins        func(t *testing.T) ([]Pin, error) // optional, no pins by default
+	insertAttach    func(t *testing.T, attachment Attachment) (Attachment, error)
+	getAttach       func(t *testing.T, id string) (*Attachment, error)
+	flagMessage     func(t *testing.T, flag Flag, hideAfter int) (FlagResult, error)
+	listFlagged     func(t *testing.T, q FlagQuery) ([]FlaggedMessage, error)
+	reviewMessage   func(t *testing.T, messageID, moderatorID, decision string) (Message, error)
 }
 
-func (db *testdb) ListMessages(ctx context.Context, limit int, offset int, excludeMsgIDs ...string) ([]Message, error) {
+func (db *testdb) ListMessages(ctx context.Context, q ListQuery, excludeMsgIDs ...string) ([]Message, error) {
+	if db.listMessagesCtx != nil {
+		db.listMessagesCtx(trace.SpanContextFromContext(ctx))
+	}
+	if db.listQuery != nil {
+		db.listQuery(db.T, q)
+	}
 	return db.listMessages(db.T, excludeMsgIDs...)
 }
 
@@ -578,6 +855,65 @@ func (db *testdb) InsertReaction(_ context.Context, reaction Reaction) (Reaction
 	return db.insertReaction(db.T, reaction)
 }
 
+func (db *testdb) SearchMessages(_ context.Context, q SearchQuery) ([]SearchResult, error) {
+	return db.searchMessages(db.T, q)
+}
+
+func (db *testdb) ListMentions(_ context.Context, q MentionQuery) ([]Mention, error) {
+	return db.listMentions(db.T, q)
+}
+
+func (db *testdb) MarkMentionsRead(_ context.Context, userID string, msgIDs ...string) (int, error) {
+	return db.markMentions(db.T, userID, msgIDs...)
+}
+
+func (db *testdb) MarkRead(_ context.Context, userID, messageID string) (ReadMarker, error) {
+	return db.markRead(db.T, userID, messageID)
+}
+
+func (db *testdb) GetReadMarker(_ context.Context, userID string) (*ReadMarker, error) {
+	return db.getReadMarker(db.T, userID)
+}
+
+func (db *testdb) CountUnread(_ context.Context, userID string, marker *ReadMarker) (UnreadCounts, error) {
+	return db.countUnread(db.T, userID, marker)
+}
+
+func (db *testdb) PinMessage(_ context.Context, messageID, userID string) (Pin, error) {
+	return db.pinMessage(db.T, messageID, userID)
+}
+
+func (db *testdb) UnpinMessage(_ context.Context, messageID string) error {
+	return db.unpinMessage(db.T, messageID)
+}
+
+func (db *testdb) ListPins(context.Context) ([]Pin, error) {
+	if db.listPins == nil {
+		return nil, nil
+	}
+	return db.listPins(db.T)
+}
+
+func (db *testdb) InsertAttachment(_ context.Context, attachment Attachment) (Attachment, error) {
+	return db.insertAttach(db.T, attachment)
+}
+
+func (db *testdb) GetAttachment(_ context.Context, id string) (*Attachment, error) {
+	return db.getAttach(db.T, id)
+}
+
+func (db *testdb) FlagMessage(_ context.Context, flag Flag, hideAfter int) (FlagResult, error) {
+	return db.flagMessage(db.T, flag, hideAfter)
+}
+
+func (db *testdb) ListFlaggedMessages(_ context.Context, q FlagQuery) ([]FlaggedMessage, error) {
+	return db.listFlagged(db.T, q)
+}
+
+func (db *testdb) ReviewMessage(_ context.Context, messageID, moderatorID, decision string) (Message, error) {
+	return db.reviewMessage(db.T, messageID, moderatorID, decision)
+}
+
 type testcache struct {
 	T             *testing.T
 	listMessages  func(t *testing.T) ([]Message, error)
@@ -602,6 +938,25 @@ func (c *testcache) InsertMessage(_ context.Context, msg Message) error {
 	return c.insertMessage(c.T, msg)
 }
 
+type testqueue struct {
+	T       *testing.T
+	enqueue func(t *testing.T, w QueuedWrite) error
+	pending func(t *testing.T, count int) ([]QueuedWrite, error)
+	ack     func(t *testing.T, id string) error
+}
+
+func (q *testqueue) Enqueue(_ context.Context, w QueuedWrite) error {
+	return q.enqueue(q.T, w)
+}
+
+func (q *testqueue) Pending(_ context.Context, count int) ([]QueuedWrite, error) {
+	return q.pending(q.T, count)
+}
+
+func (q *testqueue) Ack(_ context.Context, id string) error {
+	return q.ack(q.T, id)
+}
+
 type MockValidator struct {
 	ShouldFail bool
 	Err        error
@@ -630,6 +985,13 @@ func checkBody(t *testing.T, resp *http.Response, want string) {
 	}
 }
 
+func checkDegraded(t *testing.T, resp *http.Response, want bool) {
+	t.Helper()
+	if got := resp.Header.Get(degradedHeader) == "true"; got != want {
+		t.Errorf("Got degraded %t, want %t", got, want)
+	}
+}
+
 func checkLog(t *testing.T, buffer *bytes.Buffer, want string) {
 	t.Helper()
 
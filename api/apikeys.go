@@ -0,0 +1,228 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// apiKeyHeader carries the secret of an API key.
+const apiKeyHeader = "X-Api-Key"
+
+// Scopes an API key can be granted. ScopeAdmin implies all others.
+const (
+	ScopeMessagesWrite  = "messages:write"
+	ScopeReactionsWrite = "reactions:write"
+	ScopeModerate       = "moderate"
+	ScopePrivacy        = "privacy" // exports and erases the data of any user
+	ScopeAdmin          = "admin"
+)
+
+// apiKeyPrefixLength is how much of the secret is kept in the clear, enough
+// to recognise a key in a listing but not to guess it.
+const apiKeyPrefixLength = 11
+
+type scopesKey struct{}
+
+func withScopes(ctx context.Context, scopes []string) context.Context {
+	return context.WithValue(ctx, scopesKey{}, scopes)
+}
+
+// requireScope reports whether the request was granted scope, and responds
+// with an error if it was not. Requests that were let through without
+// credentials, because no Authenticator is configured, may do anything but
+// administer, moderate and handle users' data.
+func (a *API) requireScope(w http.ResponseWriter, r *http.Request, scope string) bool {
+	scopes, ok := r.Context().Value(scopesKey{}).([]string)
+	if !ok {
+		if scope != ScopeAdmin && scope != ScopeModerate && scope != ScopePrivacy {
+			return true
+		}
+		a.respondError(w, r, http.StatusUnauthorized, errors.New("missing API key"), "Authentication required")
+		return false
+	}
+	if !slices.Contains(scopes, scope) && !slices.Contains(scopes, ScopeAdmin) {
+		err := fmt.Errorf("scope %q not granted", scope)
+		a.respondError(w, r, http.StatusForbidden, err, "Missing scope "+scope)
+		return false
+	}
+	return true
+}
+
+// NewAPIKey generates a key with the given scopes. The secret is returned
+// separately, as only its hash is stored.
+func NewAPIKey(name string, scopes []string, expiresAt *time.Time) (APIKey, string) {
+	var b [24]byte
+	_, _ = rand.Read(b[:])
+	secret := "sk_" + hex.EncodeToString(b[:])
+	return APIKey{
+		Name:      name,
+		Prefix:    secret[:apiKeyPrefixLength],
+		Hash:      hashAPIKey(secret),
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}, secret
+}
+
+// hashAPIKey hashes the secret of an API key. Secrets are random, so a plain
+// SHA-256 is enough; there is nothing to brute force.
+func hashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// lookupAPIKey returns the key for secret, trying the cache first.
+func (a *API) lookupAPIKey(ctx context.Context, secret string) (*APIKey, error) {
+	log := LoggerFrom(ctx)
+	hash := hashAPIKey(secret)
+	if a.APIKeyCache != nil {
+		key, err := a.APIKeyCache.GetAPIKey(ctx, hash)
+		if err == nil {
+			return key, nil
+		}
+		if !errors.Is(err, ErrAPIKeyNotFoundInCache) {
+			log.Warn("Error getting API key from cache, trying database", "error", err.Error())
+		}
+	}
+
+	key, err := a.APIKeys.GetAPIKey(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	if a.APIKeyCache != nil {
+		if err := a.APIKeyCache.SetAPIKey(ctx, *key); err != nil {
+			log.Warn("Could not cache API key", "error", err.Error())
+		}
+	}
+	return key, nil
+}
+
+// apiKey represents the API key DTO. Key, the secret, is only set in the
+// response to creating the key.
+type apiKey struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Key       string   `json:"key,omitempty"`
+	Prefix    string   `json:"prefix"`
+	Scopes    []string `json:"scopes"`
+	CreatedAt string   `json:"created_at"`
+	ExpiresAt string   `json:"expires_at,omitempty"`
+	RevokedAt string   `json:"revoked_at,omitempty"`
+}
+
+func toAPIKey(k APIKey) apiKey {
+	out := apiKey{
+		ID:        k.ID,
+		Name:      k.Name,
+		Prefix:    k.Prefix,
+		Scopes:    k.Scopes,
+		CreatedAt: k.CreatedAt.Format(time.RFC1123),
+	}
+	if k.ExpiresAt != nil {
+		out.ExpiresAt = k.ExpiresAt.Format(time.RFC1123)
+	}
+	if k.RevokedAt != nil {
+		out.RevokedAt = k.RevokedAt.Format(time.RFC1123)
+	}
+	return out
+}
+
+func (a *API) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	type request struct {
+		Name      string     `json:"name" validate:"required"`
+		Scopes    []string   `json:"scopes" validate:"required,min=1,dive,oneof=messages:write reactions:write moderate privacy admin"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+
+	if !a.requireScope(w, r, ScopeAdmin) {
+		return
+	}
+	log := LoggerFrom(r.Context())
+	var body request
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		log.Warn("Error decoding request body", "error", err.Error())
+		a.respondError(w, r, http.StatusBadRequest, err, "Could not decode request body")
+		return
+	}
+	r.Body.Close()
+
+	if err := a.Validate.Struct(body); err != nil {
+		a.respondError(w, r, http.StatusBadRequest, err, "Validation failed")
+		return
+	}
+	if body.ExpiresAt != nil && !body.ExpiresAt.After(time.Now()) {
+		err := fmt.Errorf("expiry %s is in the past", body.ExpiresAt)
+		a.respondError(w, r, http.StatusBadRequest, err, "Expiry must be in the future")
+		return
+	}
+
+	key, secret := NewAPIKey(body.Name, body.Scopes, body.ExpiresAt)
+	key, err := a.APIKeys.InsertAPIKey(r.Context(), key)
+	if err != nil {
+		log.Error("Error creating API key in DB", "error", err.Error())
+		a.respondError(w, r, http.StatusInternalServerError, err, "Could not create API key")
+		return
+	}
+	log.Info("Created API key", "api_key_id", key.ID, "scopes", key.Scopes)
+
+	res := toAPIKey(key)
+	res.Key = secret
+	a.respond(w, http.StatusCreated, res)
+}
+
+func (a *API) listAPIKeys(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		APIKeys []apiKey `json:"api_keys"`
+	}
+
+	if !a.requireScope(w, r, ScopeAdmin) {
+		return
+	}
+	keys, err := a.APIKeys.ListAPIKeys(r.Context())
+	if err != nil {
+		LoggerFrom(r.Context()).Error("Error listing API keys from DB", "error", err.Error())
+		a.respondError(w, r, http.StatusInternalServerError, err, "Could not list API keys")
+		return
+	}
+
+	res := response{APIKeys: make([]apiKey, len(keys))}
+	for i, k := range keys {
+		res.APIKeys[i] = toAPIKey(k)
+	}
+	a.respond(w, http.StatusOK, res)
+}
+
+func (a *API) revokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	if !a.requireScope(w, r, ScopeAdmin) {
+		return
+	}
+	log := LoggerFrom(r.Context())
+	key, err := a.APIKeys.RevokeAPIKey(r.Context(), r.PathValue("keyID"))
+	if errors.Is(err, ErrAPIKeyNotFound) {
+		a.respondError(w, r, http.StatusNotFound, err, "API key not found")
+		return
+	}
+	if err != nil {
+		log.Error("Error revoking API key in DB", "error", err.Error())
+		a.respondError(w, r, http.StatusInternalServerError, err, "Could not revoke API key")
+		return
+	}
+	log.Info("Revoked API key", "api_key_id", key.ID)
+
+	if a.APIKeyCache != nil {
+		if err := a.APIKeyCache.DeleteAPIKey(r.Context(), key.Hash); err != nil {
+			// The cached copy expires on its own, but until then the key
+			// still works.
+			log.Error("Could not evict revoked API key from cache", "error", err.Error())
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
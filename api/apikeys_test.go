@@ -0,0 +1,345 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/neilotoole/slogt"
+)
+
+func TestAPI_apiKeyAuthentication(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	keys := newTestKeys()
+	writer := keys.add(t, []string{ScopeMessagesWrite}, nil)
+	reactor := keys.add(t, []string{ScopeReactionsWrite}, nil)
+	admin := keys.add(t, []string{ScopeAdmin}, nil)
+	expired := keys.add(t, []string{ScopeMessagesWrite}, &past)
+	revoked := keys.add(t, []string{ScopeMessagesWrite}, nil)
+	keys.revoke(revoked)
+
+	tests := []struct {
+		name       string
+		key        string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "Scoped",
+			key:        writer,
+			wantStatus: 201,
+		},
+		{
+			name:       "Admin",
+			key:        admin,
+			wantStatus: 201,
+		},
+		{
+			name:       "MissingScope",
+			key:        reactor,
+			wantStatus: 403,
+			wantBody:   `{"error": "Missing scope messages:write"}`,
+		},
+		{
+			name:       "Unknown",
+			key:        "sk_unknown",
+			wantStatus: 401,
+			wantBody:   `{"error": "Invalid API key"}`,
+		},
+		{
+			name:       "Expired",
+			key:        expired,
+			wantStatus: 401,
+			wantBody:   `{"error": "Invalid API key"}`,
+		},
+		{
+			name:       "Revoked",
+			key:        revoked,
+			wantStatus: 401,
+			wantBody:   `{"error": "Invalid API key"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &API{
+				Logger: slogt.New(t),
+				DB: &testdb{
+					T: t,
+					insertMessage: func(t *testing.T, msg Message) (Message, error) {
+						msg.ID = "1"
+						return msg, nil
+					},
+				},
+				Cache: &testcache{
+					T: t,
+					insertMessage: func(t *testing.T, msg Message) error {
+						return nil
+					},
+				},
+				Validate: &MockValidator{},
+				// Keys must work even when bearer tokens are required.
+				Auth:    testauth{},
+				APIKeys: keys,
+			}
+			srv := httptest.NewServer(api)
+			defer srv.Close()
+
+			resp := doWithKey(t, "POST", srv.URL+"/messages", tt.key, `{"text": "hello", "user_id": "system"}`)
+			checkStatus(t, resp.StatusCode, tt.wantStatus)
+			if tt.wantBody != "" {
+				checkBody(t, resp, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestAPI_apiKeyCache(t *testing.T) {
+	keys := newTestKeys()
+	secret := keys.add(t, []string{ScopeAdmin}, nil)
+	cache := &testkeycache{keys: map[string]APIKey{}}
+	api := &API{
+		Logger:      slogt.New(t),
+		Validate:    &MockValidator{},
+		APIKeys:     keys,
+		APIKeyCache: cache,
+	}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	for range 3 {
+		resp := doWithKey(t, "GET", srv.URL+"/admin/api-keys", secret, "")
+		checkStatus(t, resp.StatusCode, http.StatusOK)
+	}
+	if keys.lookups != 1 {
+		t.Errorf("Looked up key in DB %d times, want 1", keys.lookups)
+	}
+
+	// Revoking evicts the cached key, so it stops working at once.
+	id := keys.byHash[hashAPIKey(secret)].ID
+	resp := doWithKey(t, "DELETE", srv.URL+"/admin/api-keys/"+id, secret, "")
+	checkStatus(t, resp.StatusCode, http.StatusNoContent)
+	resp = doWithKey(t, "GET", srv.URL+"/admin/api-keys", secret, "")
+	checkStatus(t, resp.StatusCode, http.StatusUnauthorized)
+}
+
+func TestAPI_adminAPIKeys(t *testing.T) {
+	keys := newTestKeys()
+	admin := keys.add(t, []string{ScopeAdmin}, nil)
+	writer := keys.add(t, []string{ScopeMessagesWrite}, nil)
+	api := &API{
+		Logger: slogt.New(t),
+		DB: &testdb{
+			T: t,
+			insertReaction: func(t *testing.T, reaction Reaction) (Reaction, error) {
+				reaction.ID = "1"
+				return reaction, nil
+			},
+		},
+		Cache: &testcache{
+			T: t,
+			getMessage: func(t *testing.T, id string) (*Message, error) {
+				return nil, ErrMessageNotFoundInCache
+			},
+		},
+		Validate: &MockValidator{},
+		Auth:     testauth{"alice-token": "alice"},
+		APIKeys:  keys,
+	}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	t.Run("RequiresAdmin", func(t *testing.T) {
+		resp := doWithKey(t, "GET", srv.URL+"/admin/api-keys", "", "")
+		checkStatus(t, resp.StatusCode, http.StatusUnauthorized)
+
+		resp = doWithKey(t, "GET", srv.URL+"/admin/api-keys", writer, "")
+		checkStatus(t, resp.StatusCode, http.StatusForbidden)
+
+		req, _ := http.NewRequest("GET", srv.URL+"/admin/api-keys", nil)
+		req.Header.Set("Authorization", "Bearer alice-token")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkStatus(t, resp.StatusCode, http.StatusForbidden)
+	})
+
+	var created struct {
+		ID     string   `json:"id"`
+		Key    string   `json:"key"`
+		Prefix string   `json:"prefix"`
+		Scopes []string `json:"scopes"`
+	}
+	t.Run("Create", func(t *testing.T) {
+		resp := doWithKey(t, "POST", srv.URL+"/admin/api-keys", admin, `{"name": "billing", "scopes": ["reactions:write"]}`)
+		checkStatus(t, resp.StatusCode, http.StatusCreated)
+		if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(created.Key, created.Prefix) || len(created.Key) <= len(created.Prefix) {
+			t.Errorf("Got key %q with prefix %q", created.Key, created.Prefix)
+		}
+		if _, ok := keys.byHash[hashAPIKey(created.Key)]; !ok {
+			t.Error("Created key was not stored by its hash")
+		}
+
+		resp = doWithKey(t, "POST", srv.URL+"/messages/1/reactions", created.Key, `{"type": "like", "user_id": "billing"}`)
+		checkStatus(t, resp.StatusCode, http.StatusCreated)
+	})
+
+	t.Run("CreateExpired", func(t *testing.T) {
+		resp := doWithKey(t, "POST", srv.URL+"/admin/api-keys", admin, `{"name": "old", "scopes": ["admin"], "expires_at": "2020-01-01T00:00:00Z"}`)
+		checkStatus(t, resp.StatusCode, http.StatusBadRequest)
+	})
+
+	t.Run("List", func(t *testing.T) {
+		resp := doWithKey(t, "GET", srv.URL+"/admin/api-keys", admin, "")
+		checkStatus(t, resp.StatusCode, http.StatusOK)
+		var body struct {
+			APIKeys []map[string]any `json:"api_keys"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if len(body.APIKeys) != 3 {
+			t.Errorf("Listed %d keys, want 3", len(body.APIKeys))
+		}
+		for _, k := range body.APIKeys {
+			if _, ok := k["key"]; ok {
+				t.Errorf("Listing exposes the secret of key %v", k["id"])
+			}
+		}
+	})
+
+	t.Run("Revoke", func(t *testing.T) {
+		resp := doWithKey(t, "DELETE", srv.URL+"/admin/api-keys/"+created.ID, admin, "")
+		checkStatus(t, resp.StatusCode, http.StatusNoContent)
+
+		resp = doWithKey(t, "DELETE", srv.URL+"/admin/api-keys/unknown", admin, "")
+		checkStatus(t, resp.StatusCode, http.StatusNotFound)
+
+		resp = doWithKey(t, "POST", srv.URL+"/messages/1/reactions", created.Key, `{"type": "like", "user_id": "billing"}`)
+		checkStatus(t, resp.StatusCode, http.StatusUnauthorized)
+	})
+}
+
+func doWithKey(t *testing.T, method, url, key, body string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(apiKeyHeader, key)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// testkeys is an in-memory APIKeyStore.
+type testkeys struct {
+	mu      sync.Mutex
+	byHash  map[string]*APIKey
+	lookups int
+}
+
+func newTestKeys() *testkeys {
+	return &testkeys{byHash: map[string]*APIKey{}}
+}
+
+// add stores a new key and returns its secret.
+func (k *testkeys) add(t *testing.T, scopes []string, expiresAt *time.Time) string {
+	t.Helper()
+	key, secret := NewAPIKey("test", scopes, expiresAt)
+	if _, err := k.InsertAPIKey(context.Background(), key); err != nil {
+		t.Fatal(err)
+	}
+	return secret
+}
+
+func (k *testkeys) revoke(secret string) {
+	now := time.Now()
+	k.byHash[hashAPIKey(secret)].RevokedAt = &now
+}
+
+func (k *testkeys) InsertAPIKey(_ context.Context, key APIKey) (APIKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	key.ID = fmt.Sprint(len(k.byHash) + 1)
+	k.byHash[key.Hash] = &key
+	return key, nil
+}
+
+func (k *testkeys) ListAPIKeys(context.Context) ([]APIKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	var out []APIKey
+	for _, key := range k.byHash {
+		out = append(out, *key)
+	}
+	return out, nil
+}
+
+func (k *testkeys) GetAPIKey(_ context.Context, hash string) (*APIKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.lookups++
+	key, ok := k.byHash[hash]
+	if !ok {
+		return nil, ErrAPIKeyNotFound
+	}
+	cp := *key
+	return &cp, nil
+}
+
+func (k *testkeys) RevokeAPIKey(_ context.Context, id string) (*APIKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for _, key := range k.byHash {
+		if key.ID == id {
+			now := time.Now()
+			key.RevokedAt = &now
+			cp := *key
+			return &cp, nil
+		}
+	}
+	return nil, ErrAPIKeyNotFound
+}
+
+// testkeycache is an in-memory APIKeyCache.
+type testkeycache struct {
+	mu   sync.Mutex
+	keys map[string]APIKey
+}
+
+func (c *testkeycache) GetAPIKey(_ context.Context, hash string) (*APIKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key, ok := c.keys[hash]
+	if !ok {
+		return nil, ErrAPIKeyNotFoundInCache
+	}
+	return &key, nil
+}
+
+func (c *testkeycache) SetAPIKey(_ context.Context, key APIKey) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.keys[key.Hash] = key
+	return nil
+}
+
+func (c *testkeycache) DeleteAPIKey(_ context.Context, hash string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.keys, hash)
+	return nil
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type subjectKey struct{}
+
+// userScopes are granted to every user with a valid bearer token.
+var userScopes = []string{ScopeMessagesWrite, ScopeReactionsWrite}
+
+// authenticated requires a valid API key or bearer token before calling next,
+// which can read the token's subject with authorizeUser and check the granted
+// scopes with requireScope. Without an Authenticator, requests without an API
+// key are let through.
+func (a *API) authenticated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if secret := r.Header.Get(apiKeyHeader); secret != "" && a.APIKeys != nil {
+			key, err := a.lookupAPIKey(r.Context(), secret)
+			switch {
+			case errors.Is(err, ErrAPIKeyNotFound):
+				a.respondError(w, r, http.StatusUnauthorized, err, "Invalid API key")
+				return
+			case err != nil:
+				a.respondError(w, r, http.StatusInternalServerError, err, "Could not check API key")
+				return
+			case !key.Active(time.Now()):
+				err := fmt.Errorf("api key %s is revoked or expired", key.ID)
+				a.respondError(w, r, http.StatusUnauthorized, err, "Invalid API key")
+				return
+			}
+			setAPIKey(r.Context(), key.ID)
+			next(w, r.WithContext(withScopes(r.Context(), key.Scopes)))
+			return
+		}
+
+		if a.Auth == nil {
+			next(w, r)
+			return
+		}
+
+		token, ok := bearerToken(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			a.respondError(w, r, http.StatusUnauthorized, errors.New("missing bearer token"), "Authentication required")
+			return
+		}
+		subject, err := a.Auth.Authenticate(r.Context(), token)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			a.respondError(w, r, http.StatusUnauthorized, err, "Invalid token")
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), subjectKey{}, subject)
+		ctx = withScopes(ctx, userScopes)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// authorizeUser returns the user a write is made as. For an authenticated
+// request that is the token's subject, and naming anyone else in the body is
+// forbidden. Otherwise the user from the body is trusted as is.
+func (a *API) authorizeUser(w http.ResponseWriter, r *http.Request, bodyUser string) (string, bool) {
+	subject, ok := r.Context().Value(subjectKey{}).(string)
+	if !ok {
+		return bodyUser, true
+	}
+	if bodyUser != "" && bodyUser != subject {
+		err := fmt.Errorf("%q cannot act as %q", subject, bodyUser)
+		a.respondError(w, r, http.StatusForbidden, err, "Cannot act on behalf of another user")
+		return "", false
+	}
+	return subject, true
+}
+
+// authorizeAccount returns the user whose own state a request reads or
+// changes, such as their mentions or blocks, and responds with an error if
+// the request may not. With a bearer token that takes being the user. An API
+// key acts for no user in particular, so it must be granted scope instead.
+// Without an Authenticator, requests without credentials may act on any
+// account, as they may write as anyone, but not export or erase its data.
+func (a *API) authorizeAccount(w http.ResponseWriter, r *http.Request, userID, scope string) (string, bool) {
+	if _, ok := r.Context().Value(subjectKey{}).(string); ok {
+		return a.authorizeUser(w, r, userID)
+	}
+	if _, ok := r.Context().Value(scopesKey{}).([]string); !ok && scope != ScopePrivacy {
+		return userID, true
+	}
+	if !a.requireScope(w, r, scope) {
+		return "", false
+	}
+	return userID, true
+}
+
+// viewer returns the user listing messages, who also sees their own
+// shadowed messages: the subject of the bearer token or, without an
+// Authenticator, the viewer query parameter. Listing is public, so a missing
+// or invalid token lists messages as nobody in particular.
+func (a *API) viewer(r *http.Request) string {
+	if a.Auth == nil {
+		return r.URL.Query().Get("viewer")
+	}
+	token, ok := bearerToken(r)
+	if !ok {
+		return ""
+	}
+	subject, err := a.Auth.Authenticate(r.Context(), token)
+	if err != nil {
+		LoggerFrom(r.Context()).Info("Invalid token listing messages", "error", err.Error())
+		return ""
+	}
+	return subject
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return token, true
+}
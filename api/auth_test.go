@@ -0,0 +1,150 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neilotoole/slogt"
+)
+
+func TestAPI_authentication(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     string
+		req        string
+		wantStatus int
+		wantBody   string
+		wantUser   string // user the message is inserted as
+	}{
+		{
+			name:       "MissingToken",
+			req:        `{"text": "hello", "user_id": "alice"}`,
+			wantStatus: 401,
+			wantBody:   `{"error": "Authentication required"}`,
+		},
+		{
+			name:       "WrongScheme",
+			header:     "Basic YWxpY2U6c2VjcmV0",
+			req:        `{"text": "hello", "user_id": "alice"}`,
+			wantStatus: 401,
+			wantBody:   `{"error": "Authentication required"}`,
+		},
+		{
+			name:       "InvalidToken",
+			header:     "Bearer bad",
+			req:        `{"text": "hello", "user_id": "alice"}`,
+			wantStatus: 401,
+			wantBody:   `{"error": "Invalid token"}`,
+		},
+		{
+			name:       "OtherUser",
+			header:     "Bearer alice-token",
+			req:        `{"text": "hello", "user_id": "bob"}`,
+			wantStatus: 403,
+			wantBody:   `{"error": "Cannot act on behalf of another user"}`,
+		},
+		{
+			name:       "SubjectReplacesMissingUser",
+			header:     "Bearer alice-token",
+			req:        `{"text": "hello"}`,
+			wantStatus: 201,
+			wantUser:   "alice",
+		},
+		{
+			name:       "SameUser",
+			header:     "bearer alice-token",
+			req:        `{"text": "hello", "user_id": "alice"}`,
+			wantStatus: 201,
+			wantUser:   "alice",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var inserted string
+			api := &API{
+				Logger: slogt.New(t),
+				DB: &testdb{
+					T: t,
+					insertMessage: func(t *testing.T, msg Message) (Message, error) {
+						inserted = msg.UserID
+						msg.ID = "1"
+						msg.CreatedAt = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+						return msg, nil
+					},
+				},
+				Cache: &testcache{
+					T: t,
+					insertMessage: func(t *testing.T, msg Message) error {
+						return nil
+					},
+				},
+				Validate: &MockValidator{},
+				Auth:     testauth{"alice-token": "alice"},
+			}
+			srv := httptest.NewServer(api)
+			defer srv.Close()
+
+			req, _ := http.NewRequest("POST", srv.URL+"/messages", strings.NewReader(tt.req))
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkStatus(t, resp.StatusCode, tt.wantStatus)
+			if tt.wantBody != "" {
+				checkBody(t, resp, tt.wantBody)
+			}
+			if tt.wantStatus == 401 && resp.Header.Get("WWW-Authenticate") == "" {
+				t.Error("401 response without WWW-Authenticate header")
+			}
+			if inserted != tt.wantUser {
+				t.Errorf("Inserted message as %q, want %q", inserted, tt.wantUser)
+			}
+		})
+	}
+}
+
+func TestAPI_authenticationReadsArePublic(t *testing.T) {
+	api := &API{
+		Logger: slogt.New(t),
+		DB: &testdb{
+			T: t,
+			listMessages: func(t *testing.T, excludeMsgIDs ...string) ([]Message, error) {
+				return nil, nil
+			},
+		},
+		Cache: &testcache{
+			T: t,
+			listMessages: func(t *testing.T) ([]Message, error) {
+				return nil, nil
+			},
+		},
+		Auth: testauth{},
+	}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/messages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStatus(t, resp.StatusCode, http.StatusOK)
+}
+
+// testauth maps tokens to subjects.
+type testauth map[string]string
+
+func (a testauth) Authenticate(_ context.Context, token string) (string, error) {
+	if sub, ok := a[token]; ok {
+		return sub, nil
+	}
+	return "", errors.New("invalid token")
+}
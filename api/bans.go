@@ -0,0 +1,207 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// activeBans returns the bans the user is under, trying the cache first.
+// Without a BanStore nobody is banned. Errors are logged and treated as no
+// bans, so writes don't fail whenever bans can't be looked up.
+func (a *API) activeBans(ctx context.Context, userID string) []Ban {
+	if a.Bans == nil {
+		return nil
+	}
+	log := LoggerFrom(ctx)
+	if a.BanCache != nil {
+		bans, err := a.BanCache.GetBans(ctx, userID)
+		if err == nil {
+			return bans
+		}
+		if !errors.Is(err, ErrBansNotFoundInCache) {
+			log.Warn("Error getting bans from cache, trying database", "error", err.Error())
+		}
+	}
+
+	bans, err := a.Bans.ActiveBans(ctx, userID)
+	if err != nil {
+		log.Error("Error getting bans from DB, not enforcing them", "error", err.Error())
+		return nil
+	}
+	if a.BanCache != nil {
+		if err := a.BanCache.SetBans(ctx, userID, bans); err != nil {
+			log.Warn("Could not cache bans", "error", err.Error())
+		}
+	}
+	return bans
+}
+
+// banOf returns the first of bans of one of kinds that is active now.
+func banOf(bans []Ban, kinds ...string) *Ban {
+	now := time.Now()
+	for _, b := range bans {
+		if b.Active(now) && slices.Contains(kinds, b.Kind) {
+			return &b
+		}
+	}
+	return nil
+}
+
+// respondBanned responds to a write the ban forbids.
+func (a *API) respondBanned(w http.ResponseWriter, r *http.Request, ban *Ban) {
+	err := fmt.Errorf("user %s is under %s %s", ban.UserID, ban.Kind, ban.ID)
+	msg := "User is banned"
+	if ban.Kind == BanMute {
+		msg = "User is muted"
+	}
+	a.respondError(w, r, http.StatusForbidden, err, msg)
+}
+
+// ban represents the ban DTO.
+type ban struct {
+	ID        string `json:"id"`
+	UserID    string `json:"user_id"`
+	Kind      string `json:"kind"`
+	Reason    string `json:"reason,omitempty"`
+	CreatedBy string `json:"created_by"`
+	CreatedAt string `json:"created_at"`
+	ExpiresAt string `json:"expires_at,omitempty"`
+	LiftedAt  string `json:"lifted_at,omitempty"`
+}
+
+func toBan(b Ban) ban {
+	out := ban{
+		ID:        b.ID,
+		UserID:    b.UserID,
+		Kind:      b.Kind,
+		Reason:    b.Reason,
+		CreatedBy: b.CreatedBy,
+		CreatedAt: b.CreatedAt.Format(time.RFC1123),
+	}
+	if b.ExpiresAt != nil {
+		out.ExpiresAt = b.ExpiresAt.Format(time.RFC1123)
+	}
+	if b.LiftedAt != nil {
+		out.LiftedAt = b.LiftedAt.Format(time.RFC1123)
+	}
+	return out
+}
+
+// evictBans drops the cached bans of a user after they changed.
+func (a *API) evictBans(ctx context.Context, userID string) {
+	if a.BanCache == nil {
+		return
+	}
+	if err := a.BanCache.DeleteBans(ctx, userID); err != nil {
+		// The cached bans expire on their own, but until then the change
+		// does not apply.
+		LoggerFrom(ctx).Error("Could not evict bans from cache", "error", err.Error())
+	}
+}
+
+func (a *API) createBan(w http.ResponseWriter, r *http.Request) {
+	type request struct {
+		UserID    string     `json:"user_id" validate:"required"`
+		Kind      string     `json:"kind" validate:"required,oneof=ban mute shadow"`
+		ChannelID string     `json:"channel_id"` // only to reject channel bans
+		Reason    string     `json:"reason" validate:"max=500"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+
+	if !a.requireScope(w, r, ScopeModerate) {
+		return
+	}
+	log := LoggerFrom(r.Context())
+	var body request
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		log.Warn("Error decoding request body", "error", err.Error())
+		a.respondError(w, r, http.StatusBadRequest, err, "Could not decode request body")
+		return
+	}
+	r.Body.Close()
+	userID, ok := a.authorizeUser(w, r, body.UserID)
+	if !ok {
+		return
+	}
+	body.UserID = userID
+	if err := a.Validate.Struct(body); err != nil {
+		a.respondError(w, r, http.StatusBadRequest, err, "Validation failed")
+		return
+	}
+	if body.ChannelID != "" {
+		// Messages are not in channels, so a channel ban would never apply.
+		err := fmt.Errorf("ban in channel %q", body.ChannelID)
+		a.respondError(w, r, http.StatusBadRequest, err, "Channel bans are not supported")
+		return
+	}
+	if body.ExpiresAt != nil && !body.ExpiresAt.After(time.Now()) {
+		err := fmt.Errorf("expiry %s is in the past", body.ExpiresAt)
+		a.respondError(w, r, http.StatusBadRequest, err, "Expiry must be in the future")
+		return
+	}
+	setUser(r.Context(), body.UserID)
+
+	b, err := a.Bans.InsertBan(r.Context(), Ban{
+		UserID:    r.PathValue("userID"),
+		Kind:      body.Kind,
+		Reason:    body.Reason,
+		CreatedBy: body.UserID,
+		CreatedAt: time.Now(),
+		ExpiresAt: body.ExpiresAt,
+	})
+	if err != nil {
+		log.Error("Error creating ban in DB", "error", err.Error())
+		a.respondError(w, r, http.StatusInternalServerError, err, "Could not create ban")
+		return
+	}
+	log.Info("Banned user", "ban_id", b.ID, "banned_user_id", b.UserID, "kind", b.Kind)
+	a.evictBans(r.Context(), b.UserID)
+	a.respond(w, http.StatusCreated, toBan(b))
+}
+
+func (a *API) listBans(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Bans []ban `json:"bans"`
+	}
+
+	if !a.requireScope(w, r, ScopeModerate) {
+		return
+	}
+	bans, err := a.Bans.ListBans(r.Context(), r.PathValue("userID"))
+	if err != nil {
+		LoggerFrom(r.Context()).Error("Error listing bans from DB", "error", err.Error())
+		a.respondError(w, r, http.StatusInternalServerError, err, "Could not list bans")
+		return
+	}
+
+	res := response{Bans: make([]ban, len(bans))}
+	for i, b := range bans {
+		res.Bans[i] = toBan(b)
+	}
+	a.respond(w, http.StatusOK, res)
+}
+
+func (a *API) liftBan(w http.ResponseWriter, r *http.Request) {
+	if !a.requireScope(w, r, ScopeModerate) {
+		return
+	}
+	log := LoggerFrom(r.Context())
+	b, err := a.Bans.LiftBan(r.Context(), r.PathValue("banID"))
+	if errors.Is(err, ErrBanNotFound) {
+		a.respondError(w, r, http.StatusNotFound, err, "Ban not found")
+		return
+	}
+	if err != nil {
+		log.Error("Error lifting ban in DB", "error", err.Error())
+		a.respondError(w, r, http.StatusInternalServerError, err, "Could not lift ban")
+		return
+	}
+	log.Info("Lifted ban", "ban_id", b.ID, "banned_user_id", b.UserID)
+	a.evictBans(r.Context(), b.UserID)
+	a.respond(w, http.StatusOK, toBan(*b))
+}
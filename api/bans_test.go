@@ -0,0 +1,300 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/neilotoole/slogt"
+)
+
+func TestAPI_bannedWrites(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name       string
+		ban        Ban
+		path       string
+		req        string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "BannedMessage",
+			ban:        Ban{Kind: BanBan},
+			path:       "/messages",
+			req:        `{"text": "hello", "user_id": "spammer"}`,
+			wantStatus: 403,
+			wantBody:   `{"error": "User is banned"}`,
+		},
+		{
+			name:       "MutedMessage",
+			ban:        Ban{Kind: BanMute},
+			path:       "/messages",
+			req:        `{"text": "hello", "user_id": "spammer"}`,
+			wantStatus: 403,
+			wantBody:   `{"error": "User is muted"}`,
+		},
+		{
+			name:       "BannedReaction",
+			ban:        Ban{Kind: BanBan},
+			path:       "/messages/m1/reactions",
+			req:        `{"type": "like", "user_id": "spammer"}`,
+			wantStatus: 403,
+			wantBody:   `{"error": "User is banned"}`,
+		},
+		{
+			name:       "MutedReaction",
+			ban:        Ban{Kind: BanMute},
+			path:       "/messages/m1/reactions",
+			req:        `{"type": "like", "user_id": "spammer"}`,
+			wantStatus: 201,
+		},
+		{
+			name:       "BannedFlag",
+			ban:        Ban{Kind: BanBan},
+			path:       "/messages/m1/flag",
+			req:        `{"user_id": "spammer", "reason": "spam"}`,
+			wantStatus: 403,
+			wantBody:   `{"error": "User is banned"}`,
+		},
+		{
+			name:       "ExpiredBan",
+			ban:        Ban{Kind: BanBan, ExpiresAt: &past},
+			path:       "/messages",
+			req:        `{"text": "hello", "user_id": "spammer"}`,
+			wantStatus: 201,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.ban.ID = "b1"
+			tt.ban.UserID = "spammer"
+			api := &API{
+				Logger: slogt.New(t),
+				DB: &testdb{
+					T: t,
+					insertMessage: func(t *testing.T, msg Message) (Message, error) {
+						msg.ID = "m1"
+						return msg, nil
+					},
+					insertReaction: func(t *testing.T, reaction Reaction) (Reaction, error) {
+						return reaction, nil
+					},
+				},
+				Cache: &testcache{
+					T: t,
+					insertMessage: func(t *testing.T, msg Message) error {
+						return nil
+					},
+					getMessage: func(t *testing.T, id string) (*Message, error) {
+						return nil, ErrMessageNotFoundInCache
+					},
+				},
+				Validate: &MockValidator{},
+				Bans:     &testbans{bans: []Ban{tt.ban}},
+			}
+			srv := httptest.NewServer(api)
+			defer srv.Close()
+
+			resp := doWithKey(t, "POST", srv.URL+tt.path, "", tt.req)
+			checkStatus(t, resp.StatusCode, tt.wantStatus)
+			if tt.wantBody != "" {
+				checkBody(t, resp, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestAPI_shadowBan(t *testing.T) {
+	var inserted Message
+	cached := false
+	api := &API{
+		Logger: slogt.New(t),
+		DB: &testdb{
+			T: t,
+			insertMessage: func(t *testing.T, msg Message) (Message, error) {
+				msg.ID = "m1"
+				inserted = msg
+				return msg, nil
+			},
+			listMessages: func(t *testing.T, excludeMsgIDs ...string) ([]Message, error) {
+				return []Message{inserted}, nil
+			},
+			listQuery: func(t *testing.T, q ListQuery) {
+				if q.Viewer != "spammer" || q.Limit != pageSize {
+					t.Errorf("Got query %+v, want a full page for spammer", q)
+				}
+			},
+		},
+		Cache: &testcache{
+			T: t,
+			insertMessage: func(t *testing.T, msg Message) error {
+				cached = true
+				return nil
+			},
+			listMessages: func(t *testing.T) ([]Message, error) {
+				t.Error("Listed the cache, which doesn't hold shadowed messages")
+				return nil, nil
+			},
+		},
+		Validate: &MockValidator{},
+		Bans:     &testbans{bans: []Ban{{ID: "b1", UserID: "spammer", Kind: BanShadow}}},
+	}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	resp := doWithKey(t, "POST", srv.URL+"/messages", "", `{"text": "hi @bob", "user_id": "spammer"}`)
+	checkStatus(t, resp.StatusCode, http.StatusCreated)
+	if inserted.Moderation != ModerationShadow || len(inserted.Mentions) != 0 {
+		t.Errorf("Got message %+v, want it shadowed without mentions", inserted)
+	}
+	if cached {
+		t.Error("Cached the shadowed message")
+	}
+
+	resp = doWithKey(t, "GET", srv.URL+"/messages?viewer=spammer", "", "")
+	checkStatus(t, resp.StatusCode, http.StatusOK)
+}
+
+func TestAPI_activeBans(t *testing.T) {
+	store := &testbans{}
+	cache := &testbancache{bans: map[string][]Ban{}}
+	api := &API{Logger: slogt.New(t), Bans: store, BanCache: cache}
+	ctx := WithLogger(context.Background(), slogt.New(t))
+
+	for range 2 {
+		if bans := api.activeBans(ctx, "alice"); len(bans) != 0 {
+			t.Errorf("Got bans %+v, want none", bans)
+		}
+	}
+	if store.lookups != 1 {
+		t.Errorf("Got %d lookups in the store, want 1 with no bans cached", store.lookups)
+	}
+}
+
+func TestAPI_bans(t *testing.T) {
+	keys := newTestKeys()
+	moderator := keys.add(t, []string{ScopeModerate}, nil)
+	writer := keys.add(t, []string{ScopeMessagesWrite}, nil)
+	store := &testbans{}
+	cache := &testbancache{bans: map[string][]Ban{"spammer": {}}}
+	api := &API{
+		Logger:   slogt.New(t),
+		Validate: &MockValidator{},
+		APIKeys:  keys,
+		Bans:     store,
+		BanCache: cache,
+	}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	req := `{"user_id": "mod", "kind": "mute", "reason": "spam"}`
+	resp := doWithKey(t, "POST", srv.URL+"/admin/moderation/users/spammer/bans", writer, req)
+	checkStatus(t, resp.StatusCode, http.StatusForbidden)
+	resp = doWithKey(t, "POST", srv.URL+"/admin/moderation/users/spammer/bans", moderator,
+		`{"user_id": "mod", "kind": "mute", "expires_at": "2020-01-01T00:00:00Z"}`)
+	checkStatus(t, resp.StatusCode, http.StatusBadRequest)
+	resp = doWithKey(t, "POST", srv.URL+"/admin/moderation/users/spammer/bans", moderator,
+		`{"user_id": "mod", "kind": "ban", "channel_id": "general"}`)
+	checkStatus(t, resp.StatusCode, http.StatusBadRequest)
+	checkBody(t, resp, `{"error": "Channel bans are not supported"}`)
+
+	resp = doWithKey(t, "POST", srv.URL+"/admin/moderation/users/spammer/bans", moderator, req)
+	checkStatus(t, resp.StatusCode, http.StatusCreated)
+	checkBody(t, resp, `{
+		"id": "b1",
+		"user_id": "spammer",
+		"kind": "mute",
+		"reason": "spam",
+		"created_by": "mod",
+		"created_at": "Mon, 01 Jan 2024 00:00:00 UTC"
+	}`)
+	if _, ok := cache.bans["spammer"]; ok {
+		t.Error("Kept the cached bans of the banned user")
+	}
+
+	resp = doWithKey(t, "GET", srv.URL+"/admin/moderation/users/spammer/bans", moderator, "")
+	checkStatus(t, resp.StatusCode, http.StatusOK)
+	checkBody(t, resp, `{
+		"bans": [{
+			"id": "b1",
+			"user_id": "spammer",
+			"kind": "mute",
+			"reason": "spam",
+			"created_by": "mod",
+			"created_at": "Mon, 01 Jan 2024 00:00:00 UTC"
+		}]
+	}`)
+
+	cache.bans["spammer"] = store.bans
+	resp = doWithKey(t, "DELETE", srv.URL+"/admin/moderation/bans/b1", moderator, "")
+	checkStatus(t, resp.StatusCode, http.StatusOK)
+	if _, ok := cache.bans["spammer"]; ok {
+		t.Error("Kept the cached bans of the unbanned user")
+	}
+	resp = doWithKey(t, "DELETE", srv.URL+"/admin/moderation/bans/b2", moderator, "")
+	checkStatus(t, resp.StatusCode, http.StatusNotFound)
+}
+
+// testbans is a BanStore of bans given up front, or inserted.
+type testbans struct {
+	bans    []Ban
+	lookups int
+}
+
+func (s *testbans) InsertBan(_ context.Context, ban Ban) (Ban, error) {
+	ban.ID = "b1"
+	ban.CreatedAt = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.bans = append(s.bans, ban)
+	return ban, nil
+}
+
+func (s *testbans) ListBans(_ context.Context, userID string) ([]Ban, error) {
+	var out []Ban
+	for _, b := range s.bans {
+		if b.UserID == userID {
+			out = append(out, b)
+		}
+	}
+	return out, nil
+}
+
+func (s *testbans) ActiveBans(ctx context.Context, userID string) ([]Ban, error) {
+	s.lookups++
+	return s.ListBans(ctx, userID)
+}
+
+func (s *testbans) LiftBan(_ context.Context, id string) (*Ban, error) {
+	for i, b := range s.bans {
+		if b.ID == id {
+			now := time.Now()
+			s.bans[i].LiftedAt = &now
+			return &s.bans[i], nil
+		}
+	}
+	return nil, ErrBanNotFound
+}
+
+type testbancache struct {
+	bans map[string][]Ban
+}
+
+func (c *testbancache) GetBans(_ context.Context, userID string) ([]Ban, error) {
+	bans, ok := c.bans[userID]
+	if !ok {
+		return nil, ErrBansNotFoundInCache
+	}
+	return bans, nil
+}
+
+func (c *testbancache) SetBans(_ context.Context, userID string, bans []Ban) error {
+	c.bans[userID] = bans
+	return nil
+}
+
+func (c *testbancache) DeleteBans(_ context.Context, userID string) error {
+	delete(c.bans, userID)
+	return nil
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// blockedUsers returns the IDs of the users userID blocked, trying the cache
+// first. Errors are logged and treated as no blocks, so the feed still lists.
+func (a *API) blockedUsers(ctx context.Context, userID string) []string {
+	if a.Blocks == nil {
+		return nil
+	}
+	log := LoggerFrom(ctx)
+	if a.BlockCache != nil {
+		blocked, err := a.BlockCache.GetBlockedUsers(ctx, userID)
+		if err == nil {
+			return blocked
+		}
+		if !errors.Is(err, ErrBlocksNotFoundInCache) {
+			log.Warn("Error getting blocked users from cache, trying database", "error", err.Error())
+		}
+	}
+
+	blocks, err := a.Blocks.ListBlocks(ctx, userID)
+	if err != nil {
+		log.Error("Error listing blocks from DB, not filtering them", "error", err.Error())
+		return nil
+	}
+	blocked := make([]string, len(blocks))
+	for i, b := range blocks {
+		blocked[i] = b.BlockedUserID
+	}
+	if a.BlockCache != nil {
+		if err := a.BlockCache.SetBlockedUsers(ctx, userID, blocked); err != nil {
+			log.Warn("Could not cache blocked users", "error", err.Error())
+		}
+	}
+	return blocked
+}
+
+// evictBlocks drops the cached blocked users of a user after they changed.
+func (a *API) evictBlocks(ctx context.Context, userID string) {
+	if a.BlockCache == nil {
+		return
+	}
+	if err := a.BlockCache.DeleteBlockedUsers(ctx, userID); err != nil {
+		// The cached blocks expire on their own, but until then the change
+		// does not show.
+		LoggerFrom(ctx).Error("Could not evict blocked users from cache", "error", err.Error())
+	}
+}
+
+// block represents the block DTO.
+type block struct {
+	UserID        string `json:"user_id"`
+	BlockedUserID string `json:"blocked_user_id"`
+	CreatedAt     string `json:"created_at"`
+}
+
+func toBlock(b Block) block {
+	return block{
+		UserID:        b.UserID,
+		BlockedUserID: b.BlockedUserID,
+		CreatedAt:     b.CreatedAt.Format(time.RFC1123),
+	}
+}
+
+func (a *API) listBlocks(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Blocks []block `json:"blocks"`
+	}
+
+	userID, ok := a.authorizeAccount(w, r, r.PathValue("userID"), ScopeAdmin)
+	if !ok {
+		return
+	}
+	setUser(r.Context(), userID)
+	blocks, err := a.Blocks.ListBlocks(r.Context(), userID)
+	if err != nil {
+		LoggerFrom(r.Context()).Error("Error listing blocks from DB", "error", err.Error())
+		a.respondError(w, r, http.StatusInternalServerError, err, "Could not list blocks")
+		return
+	}
+
+	res := response{Blocks: make([]block, len(blocks))}
+	for i, b := range blocks {
+		res.Blocks[i] = toBlock(b)
+	}
+	a.respond(w, http.StatusOK, res)
+}
+
+// blockUser hides the messages of the user in the path from the user
+// blocking them. Blocking someone twice keeps the first block.
+func (a *API) blockUser(w http.ResponseWriter, r *http.Request) {
+	log := LoggerFrom(r.Context())
+	userID, ok := a.authorizeAccount(w, r, r.PathValue("userID"), ScopeAdmin)
+	if !ok {
+		return
+	}
+	setUser(r.Context(), userID)
+	blockedID := r.PathValue("blockedID")
+	if blockedID == userID {
+		err := fmt.Errorf("%q blocking themselves", userID)
+		a.respondError(w, r, http.StatusBadRequest, err, "Cannot block yourself")
+		return
+	}
+
+	b, created, err := a.Blocks.BlockUser(r.Context(), Block{
+		UserID:        userID,
+		BlockedUserID: blockedID,
+		CreatedAt:     time.Now(),
+	})
+	if err != nil {
+		log.Error("Error blocking user in DB", "error", err.Error())
+		a.respondError(w, r, http.StatusInternalServerError, err, "Could not block user")
+		return
+	}
+	status := http.StatusOK
+	if created {
+		log.Info("Blocked user", "blocked_user_id", blockedID)
+		a.evictBlocks(r.Context(), userID)
+		status = http.StatusCreated
+	}
+	a.respond(w, status, toBlock(b))
+}
+
+func (a *API) unblockUser(w http.ResponseWriter, r *http.Request) {
+	log := LoggerFrom(r.Context())
+	userID, ok := a.authorizeAccount(w, r, r.PathValue("userID"), ScopeAdmin)
+	if !ok {
+		return
+	}
+	setUser(r.Context(), userID)
+	blockedID := r.PathValue("blockedID")
+	err := a.Blocks.UnblockUser(r.Context(), userID, blockedID)
+	if errors.Is(err, ErrBlockNotFound) {
+		a.respondError(w, r, http.StatusNotFound, err, "User is not blocked")
+		return
+	}
+	if err != nil {
+		log.Error("Error unblocking user in DB", "error", err.Error())
+		a.respondError(w, r, http.StatusInternalServerError, err, "Could not unblock user")
+		return
+	}
+	log.Info("Unblocked user", "blocked_user_id", blockedID)
+	a.evictBlocks(r.Context(), userID)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,225 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/neilotoole/slogt"
+)
+
+func TestAPI_listMessages_blocked(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	api := &API{
+		Logger: slogt.New(t),
+		DB: &testdb{
+			T: t,
+			listQuery: func(t *testing.T, q ListQuery) {
+				if !slices.Equal(q.ExcludeUserIDs, []string{"troll"}) || q.Limit != pageSize-1 {
+					t.Errorf("Got query %+v, want troll left out of the rest of the page", q)
+				}
+			},
+			listMessages: func(t *testing.T, excludeMsgIDs ...string) ([]Message, error) {
+				if !slices.Equal(excludeMsgIDs, []string{"2"}) {
+					t.Errorf("Got excluded IDs %v, want the cached message", excludeMsgIDs)
+				}
+				return []Message{{ID: "3", Text: "Older", UserID: "bob", CreatedAt: created}}, nil
+			},
+		},
+		Cache: &testcache{
+			T: t,
+			listMessages: func(t *testing.T) ([]Message, error) {
+				return []Message{
+					{ID: "1", Text: "Buy now", UserID: "troll", CreatedAt: created},
+					{ID: "2", Text: "Hello", UserID: "alice", CreatedAt: created},
+				}, nil
+			},
+		},
+		Validate:   &MockValidator{},
+		Blocks:     &testblocks{blocks: []Block{{UserID: "alice", BlockedUserID: "troll"}}},
+		BlockCache: &testblockcache{blocked: map[string][]string{}},
+	}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	resp := doWithKey(t, "GET", srv.URL+"/messages?viewer=alice", "", "")
+	checkStatus(t, resp.StatusCode, http.StatusOK)
+	checkBody(t, resp, `{
+		"messages": [
+			{
+				"id": "2",
+				"text": "Hello",
+				"user_id": "alice",
+				"created_at": "Mon, 01 Jan 2024 00:00:00 UTC",
+				"message_reactions": []
+			},
+			{
+				"id": "3",
+				"text": "Older",
+				"user_id": "bob",
+				"created_at": "Mon, 01 Jan 2024 00:00:00 UTC",
+				"message_reactions": []
+			}
+		]
+	}`)
+}
+
+func TestAPI_blocks(t *testing.T) {
+	store := &testblocks{}
+	cache := &testblockcache{blocked: map[string][]string{"alice": {}}}
+	api := &API{
+		Logger:     slogt.New(t),
+		Validate:   &MockValidator{},
+		Blocks:     store,
+		BlockCache: cache,
+	}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	resp := doWithKey(t, "PUT", srv.URL+"/users/alice/blocks/alice", "", "")
+	checkStatus(t, resp.StatusCode, http.StatusBadRequest)
+
+	resp = doWithKey(t, "PUT", srv.URL+"/users/alice/blocks/troll", "", "")
+	checkStatus(t, resp.StatusCode, http.StatusCreated)
+	checkBody(t, resp, `{
+		"user_id": "alice",
+		"blocked_user_id": "troll",
+		"created_at": "Mon, 01 Jan 2024 00:00:00 UTC"
+	}`)
+	if _, ok := cache.blocked["alice"]; ok {
+		t.Error("Kept the cached blocks after blocking")
+	}
+	resp = doWithKey(t, "PUT", srv.URL+"/users/alice/blocks/troll", "", "")
+	checkStatus(t, resp.StatusCode, http.StatusOK)
+
+	resp = doWithKey(t, "GET", srv.URL+"/users/alice/blocks", "", "")
+	checkStatus(t, resp.StatusCode, http.StatusOK)
+	checkBody(t, resp, `{
+		"blocks": [{
+			"user_id": "alice",
+			"blocked_user_id": "troll",
+			"created_at": "Mon, 01 Jan 2024 00:00:00 UTC"
+		}]
+	}`)
+
+	cache.blocked["alice"] = []string{"troll"}
+	resp = doWithKey(t, "DELETE", srv.URL+"/users/alice/blocks/troll", "", "")
+	checkStatus(t, resp.StatusCode, http.StatusNoContent)
+	if _, ok := cache.blocked["alice"]; ok {
+		t.Error("Kept the cached blocks after unblocking")
+	}
+	resp = doWithKey(t, "DELETE", srv.URL+"/users/alice/blocks/troll", "", "")
+	checkStatus(t, resp.StatusCode, http.StatusNotFound)
+}
+
+func TestAPI_blocks_authorization(t *testing.T) {
+	tests := []struct {
+		name       string
+		token      string
+		scopes     []string // of an API key to send instead of a token
+		wantStatus int
+	}{
+		{name: "Owner", token: "alice-token", wantStatus: http.StatusOK},
+		{name: "OtherUser", token: "bob-token", wantStatus: http.StatusForbidden},
+		{name: "APIKeyWithoutAdmin", scopes: []string{ScopeMessagesWrite}, wantStatus: http.StatusForbidden},
+		{name: "AdminAPIKey", scopes: []string{ScopeAdmin}, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys := newTestKeys()
+			api := &API{
+				Logger:   slogt.New(t),
+				Validate: &MockValidator{},
+				Auth:     testauth{"alice-token": "alice", "bob-token": "bob"},
+				APIKeys:  keys,
+				Blocks:   &testblocks{},
+			}
+			srv := httptest.NewServer(api)
+			defer srv.Close()
+
+			for _, method := range []string{"GET", "PUT"} {
+				path := "/users/alice/blocks"
+				if method == "PUT" {
+					path += "/troll"
+				}
+				req, _ := http.NewRequest(method, srv.URL+path, nil)
+				if tt.scopes != nil {
+					req.Header.Set(apiKeyHeader, keys.add(t, tt.scopes, nil))
+				} else {
+					req.Header.Set("Authorization", "Bearer "+tt.token)
+				}
+				resp, err := http.DefaultClient.Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp.Body.Close()
+				want := tt.wantStatus
+				if method == "PUT" && want == http.StatusOK {
+					want = http.StatusCreated
+				}
+				checkStatus(t, resp.StatusCode, want)
+			}
+		})
+	}
+}
+
+// testblocks is a BlockStore of blocks given up front, or made.
+type testblocks struct {
+	blocks []Block
+}
+
+func (s *testblocks) BlockUser(_ context.Context, block Block) (Block, bool, error) {
+	for _, b := range s.blocks {
+		if b.UserID == block.UserID && b.BlockedUserID == block.BlockedUserID {
+			return b, false, nil
+		}
+	}
+	block.CreatedAt = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.blocks = append(s.blocks, block)
+	return block, true, nil
+}
+
+func (s *testblocks) UnblockUser(_ context.Context, userID, blockedUserID string) error {
+	for i, b := range s.blocks {
+		if b.UserID == userID && b.BlockedUserID == blockedUserID {
+			s.blocks = slices.Delete(s.blocks, i, i+1)
+			return nil
+		}
+	}
+	return ErrBlockNotFound
+}
+
+func (s *testblocks) ListBlocks(_ context.Context, userID string) ([]Block, error) {
+	var out []Block
+	for _, b := range s.blocks {
+		if b.UserID == userID {
+			out = append(out, b)
+		}
+	}
+	return out, nil
+}
+
+type testblockcache struct {
+	blocked map[string][]string
+}
+
+func (c *testblockcache) GetBlockedUsers(_ context.Context, userID string) ([]string, error) {
+	blocked, ok := c.blocked[userID]
+	if !ok {
+		return nil, ErrBlocksNotFoundInCache
+	}
+	return blocked, nil
+}
+
+func (c *testblockcache) SetBlockedUsers(_ context.Context, userID string, blocked []string) error {
+	c.blocked[userID] = blocked
+	return nil
+}
+
+func (c *testblockcache) DeleteBlockedUsers(_ context.Context, userID string) error {
+	delete(c.blocked, userID)
+	return nil
+}
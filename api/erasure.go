@@ -0,0 +1,192 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const (
+	defaultErasureBatchSize = 100
+	// erasureLease is how long a claimed job has to finish before another
+	// worker may claim it and carry on.
+	erasureLease = 10 * time.Minute
+)
+
+// An Eraser runs the erasure jobs queued by DELETE /users/{userID}/data in
+// the background, a batch at a time. After each batch the erased messages,
+// profile, blocks, bans and read marker are purged from the caches, and the
+// erased attachments from the BlobStore. Before the first, the archives of
+// expired messages holding the user's data are rewritten without it.
+type Eraser struct {
+	Logger    *slog.Logger
+	Store     UserDataStore
+	Cache     Cache
+	Pins      PinCache        // optional, refreshed from DB when messages are erased
+	DB        DB              // lists the pins to cache, required with Pins
+	Users     UserCache       // optional, caches user profiles
+	Blocks    BlockCache      // optional, caches blocked users
+	Bans      BanCache        // optional, caches bans
+	Markers   ReadMarkerCache // optional, caches read markers
+	Blobs     BlobStore       // optional, holds the contents of attachments and the archives
+	Interval  time.Duration   // how often to look for jobs
+	BatchSize int             // rows of each kind per batch, defaults to 100
+}
+
+// Run processes erasure jobs every Interval until ctx is cancelled.
+func (e *Eraser) Run(ctx context.Context) {
+	tick := time.NewTicker(e.Interval)
+	defer tick.Stop()
+	for {
+		if err := e.Process(ctx); err != nil {
+			e.Logger.Warn("Could not process erasure jobs", "error", err.Error())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+// Process runs the jobs that are due until none are left. A job that fails
+// is left to be claimed again once its lease runs out.
+func (e *Eraser) Process(ctx context.Context) error {
+	for {
+		jobs, err := e.Store.ClaimErasureJobs(ctx, 1, erasureLease)
+		if err != nil {
+			return fmt.Errorf("claim: %w", err)
+		}
+		if len(jobs) == 0 {
+			return nil
+		}
+		if err := e.erase(ctx, jobs[0]); err != nil {
+			return fmt.Errorf("erase %s: %w", jobs[0].ID, err)
+		}
+	}
+}
+
+func (e *Eraser) erase(ctx context.Context, job ErasureJob) error {
+	size := e.BatchSize
+	if size == 0 {
+		size = defaultErasureBatchSize
+	}
+	log := e.Logger.With("erasure_job_id", job.ID, "mode", job.Mode)
+	if e.Blobs != nil {
+		if err := e.eraseArchives(ctx, log, job); err != nil {
+			return err
+		}
+	}
+	for {
+		batch, err := e.Store.EraseUserData(ctx, job, size)
+		if err != nil {
+			return err
+		}
+		p := purger{
+			cache:   e.Cache,
+			pins:    e.Pins,
+			db:      e.DB,
+			blobs:   e.Blobs,
+			users:   e.Users,
+			blocks:  e.Blocks,
+			bans:    e.Bans,
+			markers: e.Markers,
+		}
+		p.purge(ctx, log, batch.MessageIDs, batch.BlobKeys)
+		p.purgeUsers(ctx, log, batch.UserIDs)
+		job.Messages += batch.Messages
+		job.Attachments += batch.Attachments
+		job.Reactions += batch.Reactions
+		if batch.Done {
+			log.Info("Erased user data",
+				"messages", job.Messages, "attachments", job.Attachments, "reactions", job.Reactions)
+			return nil
+		}
+	}
+}
+
+// eraseArchives rewrites the archives that hold messages or mentions of the
+// job's user. Each is forgotten for the user once rewritten, so a job that
+// fails carries on with the rest.
+func (e *Eraser) eraseArchives(ctx context.Context, log *slog.Logger, job ErasureJob) error {
+	keys, err := e.Store.ListUserArchives(ctx, job.UserID)
+	if err != nil {
+		return fmt.Errorf("list archives: %w", err)
+	}
+	for _, key := range keys {
+		if err := eraseArchive(ctx, e.Blobs, key, job); err != nil {
+			return fmt.Errorf("erase archive %s: %w", key, err)
+		}
+		if err := e.Store.DeleteArchiveUser(ctx, key, job.UserID); err != nil {
+			return fmt.Errorf("forget archive %s: %w", key, err)
+		}
+		log.Info("Erased user data from archive", "key", key)
+	}
+	return nil
+}
+
+// A purger drops deleted messages and users from the caches, and the
+// contents of attachments from the BlobStore. The data is gone from the DB,
+// so failures are logged rather than retried.
+type purger struct {
+	cache   Cache
+	pins    PinCache        // optional
+	db      DB              // lists the pins to cache, required with pins
+	blobs   BlobStore       // optional
+	users   UserCache       // optional
+	blocks  BlockCache      // optional
+	bans    BanCache        // optional
+	markers ReadMarkerCache // optional
+}
+
+func (p purger) purge(ctx context.Context, log *slog.Logger, msgIDs, blobKeys []string) {
+	for _, id := range msgIDs {
+		if err := p.cache.DeleteMessage(ctx, id); err != nil {
+			log.Error("Could not evict deleted message from cache", "message_id", id, "error", err.Error())
+		}
+	}
+	if len(msgIDs) > 0 && p.pins != nil {
+		if pins, err := p.db.ListPins(ctx); err != nil {
+			log.Error("Could not list pins to cache", "error", err.Error())
+		} else if err := p.pins.SetPins(ctx, pins); err != nil {
+			log.Error("Could not cache pins", "error", err.Error())
+		}
+	}
+	if p.blobs == nil {
+		return
+	}
+	for _, key := range blobKeys {
+		if err := p.blobs.Delete(ctx, key); err != nil && !errors.Is(err, ErrBlobNotFound) {
+			log.Error("Could not delete blob", "key", key, "error", err.Error())
+		}
+	}
+}
+
+// purgeUsers drops the cached profiles, blocked users, bans and read markers
+// of the users.
+func (p purger) purgeUsers(ctx context.Context, log *slog.Logger, userIDs []string) {
+	for _, id := range userIDs {
+		if p.users != nil {
+			if err := p.users.DeleteUser(ctx, id); err != nil {
+				log.Error("Could not evict erased user from cache", "user_id", id, "error", err.Error())
+			}
+		}
+		if p.blocks != nil {
+			if err := p.blocks.DeleteBlockedUsers(ctx, id); err != nil {
+				log.Error("Could not evict blocked users from cache", "user_id", id, "error", err.Error())
+			}
+		}
+		if p.bans != nil {
+			if err := p.bans.DeleteBans(ctx, id); err != nil {
+				log.Error("Could not evict bans from cache", "user_id", id, "error", err.Error())
+			}
+		}
+		if p.markers != nil {
+			if err := p.markers.DeleteReadMarker(ctx, id); err != nil {
+				log.Error("Could not evict read marker from cache", "user_id", id, "error", err.Error())
+			}
+		}
+	}
+}
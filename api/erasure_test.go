@@ -0,0 +1,197 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/neilotoole/slogt"
+)
+
+func TestEraser_Process(t *testing.T) {
+	store := &testuserdata{
+		jobs: []ErasureJob{{ID: "j1", UserID: "alice", Mode: ErasureDelete, Status: ErasurePending}},
+		batches: []ErasureBatch{
+			{Messages: 2, Attachments: 1, MessageIDs: []string{"1", "2"}, BlobKeys: []string{"attachments/a1", "attachments/a1_160"}},
+			{Reactions: 1, MessageIDs: []string{"3"}, UserIDs: []string{"alice", "bob"}, Done: true},
+		},
+	}
+	var evicted []string
+	blobs := testblobs{
+		"attachments/a1":     []byte("a"),
+		"attachments/a1_160": []byte("a"),
+		"attachments/a2":     []byte("b"),
+	}
+	pins := &testpins{pins: []Pin{{Message: Message{ID: "1"}}, {Message: Message{ID: "4"}}}}
+	users := &testusercache{users: map[string]*User{"alice": {ID: "alice"}, "carol": {ID: "carol"}}}
+	blocks := &testblockcache{blocked: map[string][]string{"alice": {"carol"}, "bob": {"alice"}, "carol": {"bob"}}}
+	bans := &testbancache{bans: map[string][]Ban{"alice": {{ID: "b1"}}, "carol": nil}}
+	markers := testmarkers{"alice": {UserID: "alice"}, "carol": {UserID: "carol"}}
+	e := &Eraser{
+		Logger: slogt.New(t),
+		Store:  store,
+		Cache: &testcache{
+			T: t,
+			deleteMessage: func(t *testing.T, id string) error {
+				evicted = append(evicted, id)
+				return nil
+			},
+		},
+		Pins: pins,
+		DB: &testdb{
+			T: t,
+			listPins: func(t *testing.T) ([]Pin, error) {
+				return []Pin{{Message: Message{ID: "4"}}}, nil
+			},
+		},
+		Users:   users,
+		Blocks:  blocks,
+		Bans:    bans,
+		Markers: markers,
+		Blobs:   blobs,
+	}
+
+	if err := e.Process(context.Background()); err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+	if !slices.Equal(store.erased, []string{"j1", "j1"}) {
+		t.Errorf("Got batches erased for %v, want both for j1", store.erased)
+	}
+	if store.jobs[0].Status != ErasureDone {
+		t.Errorf("Got status %q, want done", store.jobs[0].Status)
+	}
+	if !slices.Equal(evicted, []string{"1", "2", "3"}) {
+		t.Errorf("Got evicted %v, want the erased messages", evicted)
+	}
+	if diff := cmp.Diff([]Pin{{Message: Message{ID: "4"}}}, pins.pins); diff != "" {
+		t.Errorf("Cached pins mismatch (-want +got):\n%s", diff)
+	}
+	if _, ok := users.users["alice"]; ok || len(users.users) != 1 {
+		t.Errorf("Got cached users %v, want only carol", users.users)
+	}
+	if diff := cmp.Diff(map[string][]string{"carol": {"bob"}}, blocks.blocked); diff != "" {
+		t.Errorf("Cached blocks mismatch (-want +got):\n%s", diff)
+	}
+	if _, ok := markers["alice"]; ok || len(markers) != 1 {
+		t.Errorf("Got cached read markers %v, want only carol's", markers)
+	}
+	if _, ok := bans.bans["alice"]; ok || len(bans.bans) != 1 {
+		t.Errorf("Got cached bans %v, want only carol's", bans.bans)
+	}
+	if _, ok := blobs["attachments/a1"]; ok || len(blobs) != 1 {
+		t.Errorf("Got blobs %v, want only a2 kept", blobs)
+	}
+
+	// Nothing is left to claim.
+	if err := e.Process(context.Background()); err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+	if len(store.erased) != 2 {
+		t.Errorf("Got %d batches, want none after the job is done", len(store.erased))
+	}
+}
+
+func TestEraser_Process_error(t *testing.T) {
+	// A failed batch leaves the job to be claimed again once its lease runs
+	// out.
+	store := &testuserdata{
+		jobs: []ErasureJob{{ID: "j1", UserID: "alice", Mode: ErasureAnonymize, Status: ErasurePending}},
+	}
+	e := &Eraser{Logger: slogt.New(t), Store: store, Cache: &testcache{T: t}}
+	if err := e.Process(context.Background()); err == nil {
+		t.Fatal("Process succeeded without batches, want error")
+	}
+	if store.jobs[0].Status != ErasureRunning {
+		t.Errorf("Got status %q, want still running", store.jobs[0].Status)
+	}
+}
+
+func TestEraser_Process_archives(t *testing.T) {
+	const key = "archives/messages/20240101T000000Z_1.ndjson.gz"
+	archived := []message{
+		{ID: "1", Text: "hi @bob", UserID: "alice", Mentions: []mention{{UserID: "bob", Offset: 3, Length: 4}}},
+		{ID: "2", Text: "hey @alice", UserID: "bob", Mentions: []mention{{UserID: "alice", Offset: 4, Length: 6}}},
+	}
+	tests := []struct {
+		name string
+		mode string
+		want []message
+	}{
+		{
+			name: "Delete",
+			mode: ErasureDelete,
+			want: []message{{ID: "2", Text: "hey @alice", UserID: "bob"}},
+		},
+		{
+			name: "Anonymize",
+			mode: ErasureAnonymize,
+			want: []message{
+				{ID: "1", UserID: "erased-x"},
+				{ID: "2", Text: "hey @alice", UserID: "bob"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blobs := testblobs{}
+			if err := putArchive(context.Background(), blobs, key, archived); err != nil {
+				t.Fatal(err)
+			}
+			store := &testuserdata{
+				jobs:     []ErasureJob{{ID: "j1", UserID: "alice", Mode: tt.mode, Pseudonym: "erased-x", Status: ErasurePending}},
+				batches:  []ErasureBatch{{Done: true}},
+				archives: map[string][]string{"alice": {key}, "bob": {key}},
+			}
+			e := &Eraser{Logger: slogt.New(t), Store: store, Cache: &testcache{T: t}, Blobs: blobs}
+			if err := e.Process(context.Background()); err != nil {
+				t.Fatalf("Process: %v", err)
+			}
+
+			zr, err := gzip.NewReader(bytes.NewReader(blobs[key]))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []message
+			dec := json.NewDecoder(zr)
+			for dec.More() {
+				var m message
+				if err := dec.Decode(&m); err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, m)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Archive mismatch (-want +got):\n%s", diff)
+			}
+			if len(store.archives["alice"]) != 0 || len(store.archives["bob"]) != 1 {
+				t.Errorf("Got archives %v, want only bob's left", store.archives)
+			}
+		})
+	}
+}
+
+func TestEraser_Process_emptyArchive(t *testing.T) {
+	// An archive of only the user's messages is deleted rather than left
+	// empty.
+	const key = "archives/messages/20240101T000000Z_1.ndjson.gz"
+	blobs := testblobs{}
+	if err := putArchive(context.Background(), blobs, key, []message{{ID: "1", Text: "hi", UserID: "alice"}}); err != nil {
+		t.Fatal(err)
+	}
+	store := &testuserdata{
+		jobs:     []ErasureJob{{ID: "j1", UserID: "alice", Mode: ErasureDelete, Status: ErasurePending}},
+		batches:  []ErasureBatch{{Done: true}},
+		archives: map[string][]string{"alice": {key}},
+	}
+	e := &Eraser{Logger: slogt.New(t), Store: store, Cache: &testcache{T: t}, Blobs: blobs}
+	if err := e.Process(context.Background()); err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+	if _, ok := blobs[key]; ok {
+		t.Error("Kept the archive with nothing left in it")
+	}
+}
@@ -0,0 +1,228 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// defaultFlagsToHide is how many users must flag a message to hide it, unless
+// FlagsToHide is set.
+const defaultFlagsToHide = 3
+
+// flag represents the flag DTO.
+type flag struct {
+	MessageID string `json:"message_id"`
+	UserID    string `json:"user_id"`
+	Reason    string `json:"reason"`
+	CreatedAt string `json:"created_at"`
+}
+
+func toFlag(f Flag) flag {
+	return flag{
+		MessageID: f.MessageID,
+		UserID:    f.UserID,
+		Reason:    f.Reason,
+		CreatedAt: f.CreatedAt.Format(time.RFC1123),
+	}
+}
+
+// flaggedMessage represents a message in the review queue DTO.
+type flaggedMessage struct {
+	Message    message `json:"message"`
+	Moderation string  `json:"moderation,omitempty"`
+	Flags      []flag  `json:"flags"`
+}
+
+func (a *API) flagMessage(w http.ResponseWriter, r *http.Request) {
+	type request struct {
+		UserID string `json:"user_id" validate:"required"`
+		Reason string `json:"reason" validate:"required,max=500"`
+	}
+
+	if !a.requireScope(w, r, ScopeMessagesWrite) {
+		return
+	}
+	log := LoggerFrom(r.Context())
+	var body request
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		log.Warn("Error decoding request body", "error", err.Error())
+		a.respondError(w, r, http.StatusBadRequest, err, "Could not decode request body")
+		return
+	}
+	r.Body.Close()
+	userID, ok := a.authorizeUser(w, r, body.UserID)
+	if !ok {
+		return
+	}
+	body.UserID = userID
+	if err := a.Validate.Struct(body); err != nil {
+		a.respondError(w, r, http.StatusBadRequest, err, "Validation failed")
+		return
+	}
+	setUser(r.Context(), body.UserID)
+	if ban := banOf(a.activeBans(r.Context(), body.UserID), BanBan); ban != nil {
+		a.respondBanned(w, r, ban)
+		return
+	}
+	if !a.requireActive(w, r, body.UserID) {
+		return
+	}
+
+	hideAfter := a.FlagsToHide
+	if hideAfter == 0 {
+		hideAfter = defaultFlagsToHide
+	}
+	f := Flag{
+		MessageID: r.PathValue("messageID"),
+		UserID:    body.UserID,
+		Reason:    body.Reason,
+		CreatedAt: time.Now(),
+	}
+	res, err := a.DB.FlagMessage(r.Context(), f, hideAfter)
+	if errors.Is(err, ErrMessageNotFound) {
+		a.respondError(w, r, http.StatusNotFound, err, "Message not found")
+		return
+	}
+	if err != nil {
+		log.Error("Error flagging message in DB", "error", err.Error())
+		a.respondError(w, r, http.StatusInternalServerError, err, "Could not flag message")
+		return
+	}
+	if res.Hidden {
+		log.Info("Hid flagged message", "message_id", f.MessageID)
+		if err := a.Cache.DeleteMessage(r.Context(), f.MessageID); err != nil {
+			log.Error("Could not evict hidden message from cache", "error", err.Error())
+		}
+		// A hidden message drops out of the pins until it is approved.
+		a.refreshPins(r.Context())
+	}
+
+	status := http.StatusCreated
+	if !res.Created {
+		status = http.StatusOK
+	}
+	a.respond(w, status, toFlag(res.Flag))
+}
+
+func (a *API) listFlaggedMessages(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Messages []flaggedMessage `json:"messages"`
+	}
+
+	if !a.requireScope(w, r, ScopeModerate) {
+		return
+	}
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	q := FlagQuery{
+		Limit:  pageSize,
+		Offset: (page - 1) * pageSize,
+	}
+	flagged, err := a.DB.ListFlaggedMessages(r.Context(), q)
+	if err != nil {
+		LoggerFrom(r.Context()).Error("Error listing flagged messages from DB", "error", err.Error())
+		a.respondError(w, r, http.StatusInternalServerError, err, "Could not list flagged messages")
+		return
+	}
+
+	res := response{Messages: make([]flaggedMessage, len(flagged))}
+	for i, fm := range flagged {
+		res.Messages[i] = flaggedMessage{
+			Message:    toMessage([]Message{fm.Message})[0],
+			Moderation: fm.Message.Moderation,
+			Flags:      make([]flag, len(fm.Flags)),
+		}
+		for j, f := range fm.Flags {
+			res.Messages[i].Flags[j] = toFlag(f)
+		}
+	}
+	a.respond(w, http.StatusOK, res)
+}
+
+func (a *API) reviewMessage(w http.ResponseWriter, r *http.Request) {
+	type (
+		request struct {
+			UserID   string `json:"user_id" validate:"required"`
+			Decision string `json:"decision" validate:"required,oneof=approve remove"`
+		}
+		response struct {
+			Message    message `json:"message"`
+			Moderation string  `json:"moderation,omitempty"`
+		}
+	)
+
+	if !a.requireScope(w, r, ScopeModerate) {
+		return
+	}
+	log := LoggerFrom(r.Context())
+	var body request
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		log.Warn("Error decoding request body", "error", err.Error())
+		a.respondError(w, r, http.StatusBadRequest, err, "Could not decode request body")
+		return
+	}
+	r.Body.Close()
+	userID, ok := a.authorizeUser(w, r, body.UserID)
+	if !ok {
+		return
+	}
+	body.UserID = userID
+	if err := a.Validate.Struct(body); err != nil {
+		a.respondError(w, r, http.StatusBadRequest, err, "Validation failed")
+		return
+	}
+	setUser(r.Context(), body.UserID)
+
+	messageID := r.PathValue("messageID")
+	msg, err := a.DB.ReviewMessage(r.Context(), messageID, body.UserID, body.Decision)
+	if errors.Is(err, ErrMessageNotFound) {
+		a.respondError(w, r, http.StatusNotFound, err, "Message not found")
+		return
+	}
+	if err != nil {
+		log.Error("Error reviewing message in DB", "error", err.Error())
+		a.respondError(w, r, http.StatusInternalServerError, err, "Could not review message")
+		return
+	}
+	log.Info("Reviewed message", "message_id", messageID, "decision", body.Decision)
+
+	if body.Decision == ReviewRemove {
+		if err := a.Cache.DeleteMessage(r.Context(), messageID); err != nil {
+			log.Error("Could not evict removed message from cache", "error", err.Error())
+		}
+	} else {
+		a.recache(r.Context(), msg.ID)
+	}
+	// Removing a message unpins it, and approving a hidden one shows its pin
+	// again.
+	a.refreshPins(r.Context())
+	a.respond(w, http.StatusOK, response{
+		Message:    toMessage([]Message{msg})[0],
+		Moderation: msg.Moderation,
+	})
+}
+
+// recache puts an approved message back in the cache if it is among the
+// newest cacheSize messages, which is what the cache holds.
+func (a *API) recache(ctx context.Context, messageID string) {
+	log := LoggerFrom(ctx)
+	newest, err := a.DB.ListMessages(ctx, ListQuery{Limit: cacheSize})
+	if err != nil {
+		log.Error("Could not list the newest messages to cache an approved one", "error", err.Error())
+		return
+	}
+	i := slices.IndexFunc(newest, func(m Message) bool { return m.ID == messageID })
+	if i < 0 {
+		return
+	}
+	if err := a.Cache.InsertMessage(ctx, newest[i]); err != nil {
+		log.Error("Could not insert approved message into cache", "error", err.Error())
+	}
+}
@@ -0,0 +1,271 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/neilotoole/slogt"
+)
+
+func TestAPI_flagMessage(t *testing.T) {
+	tests := []struct {
+		name        string
+		messageID   string
+		req         string
+		result      FlagResult
+		err         error
+		wantStatus  int
+		wantEvicted bool
+	}{
+		{
+			name:       "Created",
+			messageID:  "m1",
+			req:        `{"user_id": "bob", "reason": "spam"}`,
+			result:     FlagResult{Created: true},
+			wantStatus: 201,
+		},
+		{
+			name:       "AlreadyFlagged",
+			messageID:  "m1",
+			req:        `{"user_id": "bob", "reason": "spam"}`,
+			wantStatus: 200,
+		},
+		{
+			name:        "Hides",
+			messageID:   "m1",
+			req:         `{"user_id": "bob", "reason": "spam"}`,
+			result:      FlagResult{Created: true, Hidden: true},
+			wantStatus:  201,
+			wantEvicted: true,
+		},
+		{
+			name:       "NotFound",
+			messageID:  "m2",
+			req:        `{"user_id": "bob", "reason": "spam"}`,
+			err:        ErrMessageNotFound,
+			wantStatus: 404,
+		},
+		{
+			name:       "InvalidJSON",
+			messageID:  "m1",
+			req:        `not json`,
+			wantStatus: 400,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			evicted := false
+			pins := &testpins{pins: []Pin{{Message: Message{ID: tt.messageID}}}}
+			api := &API{
+				Logger: slogt.New(t),
+				DB: &testdb{
+					T: t,
+					flagMessage: func(t *testing.T, f Flag, hideAfter int) (FlagResult, error) {
+						if f.MessageID != tt.messageID || f.UserID != "bob" || f.Reason != "spam" {
+							t.Errorf("Got flag %+v", f)
+						}
+						if hideAfter != 2 {
+							t.Errorf("Got hide after %d, want 2", hideAfter)
+						}
+						res := tt.result
+						res.Flag = f
+						res.Flag.CreatedAt = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+						return res, tt.err
+					},
+				},
+				Cache: &testcache{
+					T: t,
+					deleteMessage: func(t *testing.T, id string) error {
+						evicted = id == tt.messageID
+						return nil
+					},
+				},
+				Pins:        pins,
+				Validate:    &MockValidator{},
+				FlagsToHide: 2,
+			}
+			srv := httptest.NewServer(api)
+			defer srv.Close()
+
+			resp := doWithKey(t, "POST", srv.URL+"/messages/"+tt.messageID+"/flag", "", tt.req)
+			checkStatus(t, resp.StatusCode, tt.wantStatus)
+			if tt.wantStatus < 300 {
+				checkBody(t, resp, `{
+					"message_id": "m1",
+					"user_id": "bob",
+					"reason": "spam",
+					"created_at": "Mon, 01 Jan 2024 00:00:00 UTC"
+				}`)
+			}
+			if evicted != tt.wantEvicted {
+				t.Errorf("Got evicted %t, want %t", evicted, tt.wantEvicted)
+			}
+			// The DB lists no pins, as it leaves out hidden messages.
+			if unpinned := len(pins.pins) == 0; unpinned != tt.wantEvicted {
+				t.Errorf("Got hidden message unpinned %t, want %t", unpinned, tt.wantEvicted)
+			}
+		})
+	}
+}
+
+func TestAPI_listFlaggedMessages(t *testing.T) {
+	keys := newTestKeys()
+	moderator := keys.add(t, []string{ScopeModerate}, nil)
+	writer := keys.add(t, []string{ScopeMessagesWrite}, nil)
+	api := &API{
+		Logger: slogt.New(t),
+		DB: &testdb{
+			T: t,
+			listFlagged: func(t *testing.T, q FlagQuery) ([]FlaggedMessage, error) {
+				if q.Offset != pageSize || q.Limit != pageSize {
+					t.Errorf("Got query %+v, want the second page", q)
+				}
+				return []FlaggedMessage{{
+					Message: Message{
+						ID:         "m1",
+						Text:       "buy now",
+						UserID:     "alice",
+						CreatedAt:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+						Moderation: ModerationHide,
+					},
+					Flags: []Flag{{
+						MessageID: "m1",
+						UserID:    "bob",
+						Reason:    "spam",
+						CreatedAt: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+					}},
+				}}, nil
+			},
+		},
+		Validate: &MockValidator{},
+		APIKeys:  keys,
+	}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	// Moderating takes credentials even without an Authenticator.
+	resp := doWithKey(t, "GET", srv.URL+"/admin/moderation/flags?page=2", "", "")
+	checkStatus(t, resp.StatusCode, http.StatusUnauthorized)
+	resp = doWithKey(t, "GET", srv.URL+"/admin/moderation/flags?page=2", writer, "")
+	checkStatus(t, resp.StatusCode, http.StatusForbidden)
+
+	resp = doWithKey(t, "GET", srv.URL+"/admin/moderation/flags?page=2", moderator, "")
+	checkStatus(t, resp.StatusCode, http.StatusOK)
+	checkBody(t, resp, `{
+		"messages": [{
+			"message": {
+				"id": "m1",
+				"text": "buy now",
+				"user_id": "alice",
+				"created_at": "Mon, 01 Jan 2024 00:00:00 UTC",
+				"message_reactions": []
+			},
+			"moderation": "hide",
+			"flags": [{
+				"message_id": "m1",
+				"user_id": "bob",
+				"reason": "spam",
+				"created_at": "Tue, 02 Jan 2024 00:00:00 UTC"
+			}]
+		}]
+	}`)
+}
+
+func TestAPI_reviewMessage(t *testing.T) {
+	tests := []struct {
+		name              string
+		decision          string
+		err               error
+		wantStatus        int
+		newest            []Message
+		wantEvicted       bool
+		wantCached        bool
+		wantPinsRefreshed bool
+	}{
+		{
+			name:              "Approve",
+			decision:          ReviewApprove,
+			newest:            []Message{{ID: "m2"}, {ID: "m1", Text: "buy now", UserID: "alice"}},
+			wantStatus:        200,
+			wantCached:        true,
+			wantPinsRefreshed: true,
+		},
+		{
+			name:              "ApproveOld",
+			decision:          ReviewApprove,
+			newest:            []Message{{ID: "m2"}, {ID: "m3"}},
+			wantStatus:        200,
+			wantPinsRefreshed: true,
+		},
+		{name: "Remove", decision: ReviewRemove, wantStatus: 200, wantEvicted: true, wantPinsRefreshed: true},
+		{name: "NotFound", decision: ReviewRemove, err: ErrMessageNotFound, wantStatus: 404},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys := newTestKeys()
+			moderator := keys.add(t, []string{ScopeModerate}, nil)
+			evicted := false
+			cached := false
+			pinsRefreshed := false
+			api := &API{
+				Logger: slogt.New(t),
+				DB: &testdb{
+					T: t,
+					reviewMessage: func(t *testing.T, messageID, moderatorID, decision string) (Message, error) {
+						if messageID != "m1" || moderatorID != "mod" || decision != tt.decision {
+							t.Errorf("Got review of %s by %s: %s", messageID, moderatorID, decision)
+						}
+						msg := Message{ID: "m1", Text: "buy now", UserID: "alice"}
+						if decision == ReviewRemove {
+							msg.Moderation = ModerationRemove
+						}
+						return msg, tt.err
+					},
+					listQuery: func(t *testing.T, q ListQuery) {
+						if q.Filtered() || q.Limit != cacheSize {
+							t.Errorf("Got query %+v, want the newest cached messages", q)
+						}
+					},
+					listMessages: func(t *testing.T, excludeMsgIDs ...string) ([]Message, error) {
+						return tt.newest, nil
+					},
+					listPins: func(t *testing.T) ([]Pin, error) {
+						pinsRefreshed = true
+						return nil, nil
+					},
+				},
+				Cache: &testcache{
+					T: t,
+					deleteMessage: func(t *testing.T, id string) error {
+						evicted = id == "m1"
+						return nil
+					},
+					insertMessage: func(t *testing.T, msg Message) error {
+						cached = msg.ID == "m1" && msg.Text == "buy now"
+						return nil
+					},
+				},
+				Pins:     &testpins{},
+				Validate: &MockValidator{},
+				APIKeys:  keys,
+			}
+			srv := httptest.NewServer(api)
+			defer srv.Close()
+
+			resp := doWithKey(t, "POST", srv.URL+"/admin/moderation/messages/m1/review", moderator,
+				`{"user_id": "mod", "decision": "`+tt.decision+`"}`)
+			checkStatus(t, resp.StatusCode, tt.wantStatus)
+			if evicted != tt.wantEvicted {
+				t.Errorf("Got evicted %t, want %t", evicted, tt.wantEvicted)
+			}
+			if cached != tt.wantCached {
+				t.Errorf("Got cached %t, want %t", cached, tt.wantCached)
+			}
+			if pinsRefreshed != tt.wantPinsRefreshed {
+				t.Errorf("Got pins refreshed %t, want %t", pinsRefreshed, tt.wantPinsRefreshed)
+			}
+		})
+	}
+}
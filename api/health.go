@@ -0,0 +1,116 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const defaultPingTimeout = time.Second
+
+// Drain makes the readiness probe fail so load balancers stop routing new
+// requests to this instance. It is called when the server starts shutting
+// down.
+func (a *API) Drain() {
+	a.draining.Store(true)
+}
+
+func (a *API) health(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Status     string            `json:"status"`
+		Components map[string]string `json:"components"`
+	}
+
+	res := response{
+		Status:     "ok",
+		Components: make(map[string]string),
+	}
+	for _, h := range a.Health {
+		for name, state := range h.States() {
+			res.Components[name] = state
+			if state != "closed" {
+				res.Status = "degraded"
+			}
+		}
+	}
+	a.respond(w, http.StatusOK, res)
+}
+
+// healthz reports that the process is up and serving requests. It doesn't
+// check any dependencies, so a liveness probe doesn't restart instances that
+// are only waiting for a database to come back.
+func (a *API) healthz(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Status string `json:"status"`
+	}
+	a.respond(w, http.StatusOK, response{Status: "ok"})
+}
+
+// readyz pings every dependency and reports whether the instance should
+// receive traffic. Instances that can serve without an Optional dependency,
+// such as from the cache with writes queued while Postgres is down, stay
+// ready without it and report themselves degraded, so an outage doesn't take
+// every instance out of rotation at once.
+func (a *API) readyz(w http.ResponseWriter, r *http.Request) {
+	type (
+		dependency struct {
+			Status string `json:"status"`
+			Error  string `json:"error,omitempty"`
+		}
+		response struct {
+			Status       string                `json:"status"`
+			Dependencies map[string]dependency `json:"dependencies"`
+		}
+	)
+
+	timeout := a.PingTimeout
+	if timeout <= 0 {
+		timeout = defaultPingTimeout
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	res := response{
+		Status:       "ok",
+		Dependencies: make(map[string]dependency, len(a.Dependencies)),
+	}
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for name, p := range a.Dependencies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dep := dependency{Status: "ok"}
+			if err := p.Ping(ctx); err != nil {
+				LoggerFrom(r.Context()).Warn("Readiness ping failed", "dependency", name, "error", err.Error())
+				dep = dependency{Status: "unavailable", Error: err.Error()}
+			}
+			mu.Lock()
+			res.Dependencies[name] = dep
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	status := http.StatusOK
+	for name, dep := range res.Dependencies {
+		switch {
+		case dep.Status == "ok":
+		case a.Optional[name]:
+			if status == http.StatusOK {
+				res.Status = "degraded"
+			}
+		default:
+			res.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+		}
+	}
+	if a.draining.Load() {
+		res.Status = "draining"
+		status = http.StatusServiceUnavailable
+	}
+	a.respond(w, status, res)
+}
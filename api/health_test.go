@@ -0,0 +1,240 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/neilotoole/slogt"
+)
+
+func TestAPI_health(t *testing.T) {
+	tests := []struct {
+		name     string
+		health   []StateReporter
+		wantBody string
+	}{
+		{
+			name: "NoComponents",
+			wantBody: `{
+				"status": "ok",
+				"components": {}
+			}`,
+		},
+		{
+			name: "Closed",
+			health: []StateReporter{
+				teststates{"db.ListMessages": "closed"},
+				teststates{"cache.ListMessages": "closed"},
+			},
+			wantBody: `{
+				"status": "ok",
+				"components": {
+					"cache.ListMessages": "closed",
+					"db.ListMessages": "closed"
+				}
+			}`,
+		},
+		{
+			name: "Open",
+			health: []StateReporter{
+				teststates{"db.ListMessages": "closed"},
+				teststates{"cache.ListMessages": "open"},
+			},
+			wantBody: `{
+				"status": "degraded",
+				"components": {
+					"cache.ListMessages": "open",
+					"db.ListMessages": "closed"
+				}
+			}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &API{
+				Logger: slogt.New(t),
+				Health: tt.health,
+			}
+
+			srv := httptest.NewServer(api)
+			defer srv.Close()
+
+			resp, err := http.Get(srv.URL + "/health")
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkStatus(t, resp.StatusCode, http.StatusOK)
+			checkBody(t, resp, tt.wantBody)
+		})
+	}
+}
+
+type teststates map[string]string
+
+func (s teststates) States() map[string]string {
+	return s
+}
+
+func TestAPI_healthz(t *testing.T) {
+	api := &API{
+		Logger: slogt.New(t),
+		Dependencies: map[string]Pinger{
+			"postgres": testpinger{err: errors.New("connection refused")},
+		},
+	}
+	api.Drain()
+
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	// Liveness doesn't depend on dependencies or draining.
+	resp, err := http.Get(srv.URL + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStatus(t, resp.StatusCode, http.StatusOK)
+	checkBody(t, resp, `{"status": "ok"}`)
+}
+
+func TestAPI_readyz(t *testing.T) {
+	tests := []struct {
+		name       string
+		deps       map[string]Pinger
+		optional   map[string]bool
+		drain      bool
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name: "OK",
+			deps: map[string]Pinger{
+				"postgres": testpinger{},
+				"redis":    testpinger{},
+			},
+			wantStatus: 200,
+			wantBody: `{
+				"status": "ok",
+				"dependencies": {
+					"postgres": {"status": "ok"},
+					"redis": {"status": "ok"}
+				}
+			}`,
+		},
+		{
+			name: "DependencyDown",
+			deps: map[string]Pinger{
+				"postgres": testpinger{},
+				"redis":    testpinger{err: errors.New("connection refused")},
+			},
+			wantStatus: 503,
+			wantBody: `{
+				"status": "unavailable",
+				"dependencies": {
+					"postgres": {"status": "ok"},
+					"redis": {"status": "unavailable", "error": "connection refused"}
+				}
+			}`,
+		},
+		{
+			name: "OptionalDependencyDown",
+			deps: map[string]Pinger{
+				"postgres": testpinger{err: errors.New("connection refused")},
+				"redis":    testpinger{},
+			},
+			optional:   map[string]bool{"postgres": true},
+			wantStatus: 200,
+			wantBody: `{
+				"status": "degraded",
+				"dependencies": {
+					"postgres": {"status": "unavailable", "error": "connection refused"},
+					"redis": {"status": "ok"}
+				}
+			}`,
+		},
+		{
+			name: "RequiredAndOptionalDependencyDown",
+			deps: map[string]Pinger{
+				"postgres": testpinger{err: errors.New("connection refused")},
+				"redis":    testpinger{err: errors.New("connection refused")},
+			},
+			optional:   map[string]bool{"postgres": true},
+			wantStatus: 503,
+			wantBody: `{
+				"status": "unavailable",
+				"dependencies": {
+					"postgres": {"status": "unavailable", "error": "connection refused"},
+					"redis": {"status": "unavailable", "error": "connection refused"}
+				}
+			}`,
+		},
+		{
+			name: "Timeout",
+			deps: map[string]Pinger{
+				"postgres": testpinger{block: true},
+			},
+			wantStatus: 503,
+			wantBody: `{
+				"status": "unavailable",
+				"dependencies": {
+					"postgres": {"status": "unavailable", "error": "context deadline exceeded"}
+				}
+			}`,
+		},
+		{
+			name: "Draining",
+			deps: map[string]Pinger{
+				"postgres": testpinger{},
+			},
+			drain:      true,
+			wantStatus: 503,
+			wantBody: `{
+				"status": "draining",
+				"dependencies": {
+					"postgres": {"status": "ok"}
+				}
+			}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &API{
+				Logger:       slogt.New(t),
+				Dependencies: tt.deps,
+				Optional:     tt.optional,
+				PingTimeout:  10 * time.Millisecond,
+			}
+			if tt.drain {
+				api.Drain()
+			}
+
+			srv := httptest.NewServer(api)
+			defer srv.Close()
+
+			resp, err := http.Get(srv.URL + "/readyz")
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkStatus(t, resp.StatusCode, tt.wantStatus)
+			checkBody(t, resp, tt.wantBody)
+		})
+	}
+}
+
+type testpinger struct {
+	err   error
+	block bool // wait for the context to be done
+}
+
+func (p testpinger) Ping(ctx context.Context) error {
+	if p.block {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return p.err
+}
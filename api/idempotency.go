@@ -0,0 +1,169 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	// idempotencyReplayedHeader marks a response replayed from the store.
+	idempotencyReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+	// defaultIdempotencyTTL is how long responses are kept by default.
+	defaultIdempotencyTTL = 24 * time.Hour
+	// idempotencyLockTTL bounds how long a request that never completes, for
+	// instance because the process died, blocks retries.
+	idempotencyLockTTL = time.Minute
+)
+
+// replayedHeaders are the response headers set by handlers that are stored
+// with the response.
+var replayedHeaders = []string{"Content-Type", degradedHeader}
+
+// An IdempotencyRecord is the outcome of a request made with an idempotency
+// key. Status is zero while the request is in flight.
+type IdempotencyRecord struct {
+	Fingerprint string // hash of the request body
+	Status      int
+	Header      map[string]string
+	Body        []byte
+}
+
+// idempotent makes retries of a request with the same Idempotency-Key header
+// safe. The first request is served as usual and its response stored; later
+// requests with the same key and body get the stored response. It must run
+// after authenticated, as keys are scoped to the identity. Without a store,
+// or while it fails, requests are served as usual.
+func (a *API) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if a.Idempotency == nil || key == "" {
+			next(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			err := fmt.Errorf("idempotency key of %d bytes", len(key))
+			a.respondError(w, r, http.StatusBadRequest, err, "Idempotency key too long")
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			a.respondError(w, r, http.StatusBadRequest, err, "Could not read request body")
+			return
+		}
+		r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		fingerprint := fingerprint(body)
+
+		log := LoggerFrom(r.Context())
+		info, _ := r.Context().Value(requestInfoKey{}).(*requestInfo)
+		scope := identity(r.Context())
+		if scope == "" {
+			scope = "ip:" + a.clientIP(r)
+		}
+		storeKey := fmt.Sprintf("%s:%s:%s", info.route, scope, key)
+
+		prev, err := a.Idempotency.Reserve(r.Context(), storeKey, fingerprint, idempotencyLockTTL)
+		if err != nil {
+			log.Error("Could not reserve idempotency key, serving without it", "error", err.Error())
+			next(w, r)
+			return
+		}
+		if prev != nil {
+			a.replay(w, r, prev, fingerprint)
+			return
+		}
+
+		rec := &idempotencyRecorder{ResponseWriter: w}
+		next(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		// The outcome must be recorded even if the client went away meanwhile;
+		// it is likely to retry.
+		ctx := context.WithoutCancel(r.Context())
+		if rec.status >= http.StatusInternalServerError {
+			// Let the client retry requests that failed on our side.
+			if err := a.Idempotency.Release(ctx, storeKey); err != nil {
+				log.Error("Could not release idempotency key", "error", err.Error())
+			}
+			return
+		}
+		stored := IdempotencyRecord{
+			Fingerprint: fingerprint,
+			Status:      rec.status,
+			Header:      make(map[string]string),
+			Body:        rec.body.Bytes(),
+		}
+		for _, h := range replayedHeaders {
+			if v := w.Header().Get(h); v != "" {
+				stored.Header[h] = v
+			}
+		}
+		ttl := a.IdempotencyTTL
+		if ttl == 0 {
+			ttl = defaultIdempotencyTTL
+		}
+		if err := a.Idempotency.Save(ctx, storeKey, stored, ttl); err != nil {
+			log.Error("Could not store idempotent response", "error", err.Error())
+		}
+	}
+}
+
+// fingerprint identifies a request body.
+func fingerprint(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// replay responds to a request whose idempotency key was used before.
+func (a *API) replay(w http.ResponseWriter, r *http.Request, prev *IdempotencyRecord, fingerprint string) {
+	switch {
+	case prev.Fingerprint != fingerprint:
+		err := errors.New("idempotency key reused with a different body")
+		a.respondError(w, r, http.StatusUnprocessableEntity, err, "Idempotency key was used for a different request")
+	case prev.Status == 0:
+		w.Header().Set("Retry-After", "1")
+		err := errors.New("request with the same idempotency key in flight")
+		a.respondError(w, r, http.StatusConflict, err, "A request with this idempotency key is in progress")
+	default:
+		LoggerFrom(r.Context()).Info("Replaying idempotent response", "status", prev.Status)
+		for k, v := range prev.Header {
+			w.Header().Set(k, v)
+		}
+		w.Header().Set(idempotencyReplayedHeader, "true")
+		w.WriteHeader(prev.Status)
+		w.Write(prev.Body)
+	}
+}
+
+// An idempotencyRecorder captures the response to store it.
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *idempotencyRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *idempotencyRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/neilotoole/slogt"
+)
+
+func TestAPI_idempotent(t *testing.T) {
+	var inserts atomic.Int32
+	var fail atomic.Bool
+	store := &testidempotency{records: map[string]IdempotencyRecord{}}
+	api := &API{
+		Logger: slogt.New(t),
+		DB: &testdb{
+			T: t,
+			insertMessage: func(t *testing.T, msg Message) (Message, error) {
+				if fail.Load() {
+					return Message{}, errors.New("insert failed")
+				}
+				n := inserts.Add(1)
+				msg.ID = fmt.Sprint(n)
+				msg.CreatedAt = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+				return msg, nil
+			},
+		},
+		Cache: &testcache{
+			T: t,
+			insertMessage: func(t *testing.T, msg Message) error {
+				return nil
+			},
+		},
+		Validate:    &MockValidator{},
+		Idempotency: store,
+	}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	post := func(key, body string) (*http.Response, string) {
+		t.Helper()
+		req, _ := http.NewRequest("POST", srv.URL+"/messages", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(idempotencyKeyHeader, key)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp, string(b)
+	}
+	const body = `{"text": "hello", "user_id": "test"}`
+
+	t.Run("Retry", func(t *testing.T) {
+		inserts.Store(0)
+		first, firstBody := post("retry", body)
+		checkStatus(t, first.StatusCode, http.StatusCreated)
+		retry, retryBody := post("retry", body)
+		checkStatus(t, retry.StatusCode, http.StatusCreated)
+		if retryBody != firstBody {
+			t.Errorf("Got replayed body %s, want %s", retryBody, firstBody)
+		}
+		if retry.Header.Get(idempotencyReplayedHeader) != "true" {
+			t.Errorf("Replayed response is missing the %s header", idempotencyReplayedHeader)
+		}
+		if got := retry.Header.Get("Content-Type"); got != first.Header.Get("Content-Type") {
+			t.Errorf("Got replayed Content-Type %q", got)
+		}
+		if n := inserts.Load(); n != 1 {
+			t.Errorf("Inserted %d messages, want 1", n)
+		}
+	})
+
+	t.Run("DifferentBody", func(t *testing.T) {
+		post("changed", body)
+		resp, respBody := post("changed", `{"text": "bye", "user_id": "test"}`)
+		checkStatus(t, resp.StatusCode, http.StatusUnprocessableEntity)
+		if want := "Idempotency key was used for a different request"; !strings.Contains(respBody, want) {
+			t.Errorf("Got body %s, want %q", respBody, want)
+		}
+	})
+
+	t.Run("InFlight", func(t *testing.T) {
+		store.records["POST /messages:ip:127.0.0.1:inflight"] = IdempotencyRecord{Fingerprint: fingerprint([]byte(body))}
+		resp, _ := post("inflight", body)
+		checkStatus(t, resp.StatusCode, http.StatusConflict)
+		if resp.Header.Get("Retry-After") == "" {
+			t.Error("409 response without Retry-After header")
+		}
+	})
+
+	t.Run("ServerErrorReleasesKey", func(t *testing.T) {
+		inserts.Store(0)
+		fail.Store(true)
+		resp, _ := post("flaky", body)
+		checkStatus(t, resp.StatusCode, http.StatusInternalServerError)
+		fail.Store(false)
+		resp, _ = post("flaky", body)
+		checkStatus(t, resp.StatusCode, http.StatusCreated)
+		if n := inserts.Load(); n != 1 {
+			t.Errorf("Inserted %d messages, want 1", n)
+		}
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		inserts.Store(0)
+		var wg sync.WaitGroup
+		statuses := make([]int, 10)
+		for i := range statuses {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				resp, _ := post("concurrent", body)
+				statuses[i] = resp.StatusCode
+			}()
+		}
+		wg.Wait()
+		if n := inserts.Load(); n != 1 {
+			t.Errorf("Inserted %d messages, want 1", n)
+		}
+		for _, s := range statuses {
+			if s != http.StatusCreated && s != http.StatusConflict {
+				t.Errorf("Got status %d, want 201 or 409", s)
+			}
+		}
+	})
+
+	t.Run("NoKey", func(t *testing.T) {
+		inserts.Store(0)
+		post("", body)
+		post("", body)
+		if n := inserts.Load(); n != 2 {
+			t.Errorf("Inserted %d messages, want 2", n)
+		}
+	})
+}
+
+// testidempotency is an in-memory IdempotencyStore.
+type testidempotency struct {
+	mu      sync.Mutex
+	records map[string]IdempotencyRecord
+}
+
+func (s *testidempotency) Reserve(_ context.Context, key, fingerprint string, _ time.Duration) (*IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rec, ok := s.records[key]; ok {
+		return &rec, nil
+	}
+	s.records[key] = IdempotencyRecord{Fingerprint: fingerprint}
+	return nil, nil
+}
+
+func (s *testidempotency) Save(_ context.Context, key string, rec IdempotencyRecord, _ time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[key] = rec
+	return nil
+}
+
+func (s *testidempotency) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
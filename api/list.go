@@ -0,0 +1,75 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// reactionTypes are the valid types of reactions.
+var reactionTypes = []string{"like", "love", "laugh", "sad", "clap", "wow"}
+
+// parseListQuery reads the page, filters and order of a message list from
+// the query string. Its errors are meant for the client.
+func parseListQuery(r *http.Request) (ListQuery, error) {
+	params := r.URL.Query()
+	page, err := strconv.Atoi(params.Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	q := ListQuery{
+		Offset: (page - 1) * pageSize,
+		UserID: params.Get("user_id"),
+	}
+
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{
+		{"since", &q.Since},
+		{"until", &q.Until},
+	} {
+		v := params.Get(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return ListQuery{}, fmt.Errorf("Invalid %s, want an RFC 3339 time", p.name)
+		}
+		*p.dst = t
+	}
+
+	if v := params.Get("has_reactions"); v != "" {
+		has, err := strconv.ParseBool(v)
+		if err != nil {
+			return ListQuery{}, errors.New("Invalid has_reactions, want true or false")
+		}
+		q.HasReactions = &has
+	}
+	if v := params.Get("reaction"); v != "" {
+		if !slices.Contains(reactionTypes, v) {
+			return ListQuery{}, fmt.Errorf("Invalid reaction, want one of %v", reactionTypes)
+		}
+		q.ReactionType = v
+	}
+
+	switch v := params.Get("sort"); v {
+	case "", SortCreatedAt:
+	case "top":
+		q.Sort = SortScore
+	default:
+		return ListQuery{}, errors.New("Invalid sort, want created_at or top")
+	}
+	switch v := params.Get("order"); v {
+	case "", "desc":
+	case "asc":
+		q.Ascending = true
+	default:
+		return ListQuery{}, errors.New("Invalid order, want asc or desc")
+	}
+	return q, nil
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/neilotoole/slogt"
+)
+
+func TestAPI_listMessagesQuery(t *testing.T) {
+	yes := true
+	tests := []struct {
+		name       string
+		query      string
+		wantCache  bool
+		wantQuery  ListQuery
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "Default",
+			query:      "page=1",
+			wantCache:  true,
+			wantQuery:  ListQuery{Limit: pageSize - 1},
+			wantStatus: 200,
+		},
+		{
+			name:       "ExplicitDefaults",
+			query:      "sort=created_at&order=desc",
+			wantCache:  true,
+			wantQuery:  ListQuery{Limit: pageSize - 1},
+			wantStatus: 200,
+		},
+		{
+			name:  "Filters",
+			query: "user_id=alice&since=2024-01-01T00:00:00Z&until=2024-02-01T00:00:00Z&has_reactions=true&reaction=like",
+			wantQuery: ListQuery{
+				Limit:        pageSize,
+				UserID:       "alice",
+				Since:        time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+				Until:        time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+				HasReactions: &yes,
+				ReactionType: "like",
+			},
+			wantStatus: 200,
+		},
+		{
+			name:       "Ascending",
+			query:      "order=asc",
+			wantQuery:  ListQuery{Limit: pageSize, Ascending: true},
+			wantStatus: 200,
+		},
+		{
+			name:       "Top",
+			query:      "sort=top&page=3",
+			wantQuery:  ListQuery{Limit: pageSize, Offset: 2 * pageSize, Sort: SortScore},
+			wantStatus: 200,
+		},
+		{
+			name:       "InvalidUntil",
+			query:      "until=tomorrow",
+			wantStatus: 400,
+			wantBody:   `{"error": "Invalid until, want an RFC 3339 time"}`,
+		},
+		{
+			name:       "InvalidHasReactions",
+			query:      "has_reactions=maybe",
+			wantStatus: 400,
+			wantBody:   `{"error": "Invalid has_reactions, want true or false"}`,
+		},
+		{
+			name:       "InvalidReaction",
+			query:      "reaction=thumbs_down",
+			wantStatus: 400,
+			wantBody:   `{"error": "Invalid reaction, want one of [like love laugh sad clap wow]"}`,
+		},
+		{
+			name:       "InvalidSort",
+			query:      "sort=random",
+			wantStatus: 400,
+			wantBody:   `{"error": "Invalid sort, want created_at or top"}`,
+		},
+		{
+			name:       "InvalidOrder",
+			query:      "order=up",
+			wantStatus: 400,
+			wantBody:   `{"error": "Invalid order, want asc or desc"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cacheUsed bool
+			api := &API{
+				Logger: slogt.New(t),
+				DB: &testdb{
+					T: t,
+					listMessages: func(t *testing.T, excludeMsgIDs ...string) ([]Message, error) {
+						return nil, nil
+					},
+					listQuery: func(t *testing.T, q ListQuery) {
+						if diff := cmp.Diff(tt.wantQuery, q); diff != "" {
+							t.Errorf("ListMessages() query mismatch (-want +got):\n%s", diff)
+						}
+					},
+				},
+				Cache: &testcache{
+					T: t,
+					listMessages: func(t *testing.T) ([]Message, error) {
+						cacheUsed = true
+						return []Message{{ID: "1"}}, nil
+					},
+				},
+			}
+			srv := httptest.NewServer(api)
+			defer srv.Close()
+
+			resp, err := http.Get(srv.URL + "/messages?" + tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkStatus(t, resp.StatusCode, tt.wantStatus)
+			if tt.wantBody != "" {
+				checkBody(t, resp, tt.wantBody)
+			}
+			if cacheUsed != tt.wantCache {
+				t.Errorf("Cache used: %v, want %v", cacheUsed, tt.wantCache)
+			}
+		})
+	}
+}
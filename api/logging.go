@@ -0,0 +1,94 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// requestIDHeader carries the request ID. It is accepted from callers, so a
+// request can be followed across services, and echoed in every response.
+const requestIDHeader = "X-Request-ID"
+
+const maxRequestIDLength = 128
+
+type (
+	loggerKey      struct{}
+	requestInfoKey struct{}
+)
+
+// WithLogger returns a copy of ctx that carries logger.
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// LoggerFrom returns the logger carried by ctx. Inside a request it is tagged
+// with the request ID. Outside of one, slog.Default() is returned.
+func LoggerFrom(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// requestInfo collects details about a request that handlers learn while
+// serving it and the access log reports afterwards.
+type requestInfo struct {
+	route  string
+	user   string
+	apiKey string
+}
+
+// setUser records the user a request acts on behalf of for the access log.
+func setUser(ctx context.Context, user string) {
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		info.user = user
+	}
+}
+
+// setAPIKey records the ID of the API key a request was authenticated with
+// for the access log.
+func setAPIKey(ctx context.Context, id string) {
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		info.apiKey = id
+	}
+}
+
+// requestID returns the caller's request ID if it is safe to log and echo,
+// or a new one otherwise.
+func requestID(r *http.Request) string {
+	id := r.Header.Get(requestIDHeader)
+	if id == "" || len(id) > maxRequestIDLength {
+		return newID()
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return newID()
+		}
+	}
+	return id
+}
+
+// logRequest writes the access log line for a finished request.
+func logRequest(ctx context.Context, r *http.Request, route string, rec *responseRecorder, info *requestInfo, d time.Duration) {
+	attrs := []any{
+		"method", r.Method,
+		"path", r.URL.Path,
+		"route", route,
+		"status", rec.status,
+		"bytes", rec.bytes,
+		"duration", d,
+		"remote_addr", r.RemoteAddr,
+	}
+	if info.user != "" {
+		attrs = append(attrs, "user", info.user)
+	}
+	if info.apiKey != "" {
+		attrs = append(attrs, "api_key", info.apiKey)
+	}
+	LoggerFrom(ctx).Info("Request", attrs...)
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestAPI_requestID(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		wantID string // empty means a generated ID
+	}{
+		{name: "Generated"},
+		{name: "Accepted", header: "abc-123_x.y:z", wantID: "abc-123_x.y:z"},
+		{name: "InvalidCharacters", header: "abc\" injected=1"},
+		{name: "TooLong", header: strings.Repeat("a", maxRequestIDLength+1)},
+	}
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			api := &API{
+				Logger: slog.New(slog.NewTextHandler(buf, nil)),
+				DB: &testdb{
+					T: t,
+					insertMessage: func(t *testing.T, msg Message) (Message, error) {
+						msg.ID = "1"
+						return msg, nil
+					},
+				},
+				Cache: &testcache{
+					T: t,
+					insertMessage: func(t *testing.T, msg Message) error {
+						return errors.New("cache down")
+					},
+				},
+				Validate: &MockValidator{},
+			}
+			srv := httptest.NewServer(api)
+			defer srv.Close()
+
+			req, _ := http.NewRequest("POST", srv.URL+"/messages", strings.NewReader(`{"text": "hello", "user_id": "alice"}`))
+			if tt.header != "" {
+				req.Header.Set(requestIDHeader, tt.header)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkStatus(t, resp.StatusCode, http.StatusCreated)
+
+			id := resp.Header.Get(requestIDHeader)
+			if tt.wantID != "" && id != tt.wantID {
+				t.Errorf("Got request ID %q, want %q", id, tt.wantID)
+			}
+			if tt.wantID == "" && !uuid.MatchString(id) {
+				t.Errorf("Got request ID %q, want a generated UUID", id)
+			}
+
+			// Handler logs and the access log carry the request ID.
+			logs := buf.String()
+			handlerLog := logLine(t, logs, "Could not cache message")
+			checkContains(t, handlerLog, "request_id="+id)
+			accessLog := logLine(t, logs, "msg=Request ")
+			for _, want := range []string{
+				"request_id=" + id,
+				"method=POST",
+				`route="POST /messages"`,
+				"status=201",
+				"bytes=",
+				"duration=",
+				"user=alice",
+			} {
+				checkContains(t, accessLog, want)
+			}
+		})
+	}
+}
+
+func TestLoggerFrom_Default(t *testing.T) {
+	if got := LoggerFrom(context.Background()); got != slog.Default() {
+		t.Errorf("Got %v, want slog.Default()", got)
+	}
+}
+
+func logLine(t *testing.T, logs, contains string) string {
+	t.Helper()
+	for _, line := range strings.Split(logs, "\n") {
+		if strings.Contains(line, contains) {
+			return line
+		}
+	}
+	t.Fatalf("No log line contains %q:\n%s", contains, logs)
+	return ""
+}
+
+func checkContains(t *testing.T, s, want string) {
+	t.Helper()
+	if !strings.Contains(s, want) {
+		t.Errorf("%q does not contain %q", s, want)
+	}
+}
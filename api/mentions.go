@@ -0,0 +1,174 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxMentions bounds the users notified of a single message.
+const maxMentions = 50
+
+// mentionPattern matches an @ followed by a user ID of letters, digits, _, .
+// and -. The @ must not follow such a character, so e-mail addresses are not
+// mentions.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\pL\pN_@.-])@([\pL\pN_][\pL\pN_.-]*)`)
+
+// mention represents a mention in the message DTO. Offset and Length are in
+// characters, and cover the user ID with its @.
+type mention struct {
+	UserID string `json:"user_id"`
+	Offset int    `json:"offset"`
+	Length int    `json:"length"`
+}
+
+// parseMentions returns the @user mentions in text, in order.
+func parseMentions(text string) []mention {
+	var out []mention
+	for _, m := range mentionPattern.FindAllStringSubmatchIndex(text, -1) {
+		start, end := m[2]-1, m[3] // include the @
+		// Punctuation ending a sentence isn't part of the ID.
+		userID := strings.TrimRight(text[m[2]:end], ".-")
+		if len(userID) > 255 {
+			continue
+		}
+		out = append(out, mention{
+			UserID: userID,
+			Offset: utf8.RuneCountInString(text[:start]),
+			Length: utf8.RuneCountInString(userID) + 1,
+		})
+	}
+	return out
+}
+
+// messageMentions returns the mentions in the text of a message of the users
+// it notified. Shadowed messages notify no one, so they have none.
+func messageMentions(msg Message) []mention {
+	var out []mention
+	for _, m := range parseMentions(msg.Text) {
+		if slices.Contains(msg.Mentions, m.UserID) {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// mentionedUsers returns the unique users mentioned in text, up to
+// maxMentions of them.
+func mentionedUsers(text string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, m := range parseMentions(text) {
+		if seen[m.UserID] {
+			continue
+		}
+		if len(out) == maxMentions {
+			break
+		}
+		seen[m.UserID] = true
+		out = append(out, m.UserID)
+	}
+	return out
+}
+
+// userMention represents the mention DTO listed to the mentioned user.
+type userMention struct {
+	Message   message `json:"message"`
+	CreatedAt string  `json:"created_at"`
+	Read      bool    `json:"read"`
+}
+
+func (a *API) listMentions(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Mentions []userMention `json:"mentions"`
+	}
+
+	log := LoggerFrom(r.Context())
+	userID, ok := a.authorizeAccount(w, r, r.PathValue("userID"), ScopeAdmin)
+	if !ok {
+		return
+	}
+	params := r.URL.Query()
+	page, err := strconv.Atoi(params.Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	q := MentionQuery{
+		UserID: userID,
+		Limit:  pageSize,
+		Offset: (page - 1) * pageSize,
+	}
+	if v := params.Get("unread"); v != "" {
+		unread, err := strconv.ParseBool(v)
+		if err != nil {
+			a.respondError(w, r, http.StatusBadRequest, err, "Invalid unread, want true or false")
+			return
+		}
+		q.Unread = unread
+	}
+
+	mentions, err := a.DB.ListMentions(r.Context(), q)
+	if err != nil {
+		log.Error("Error listing mentions from DB", "error", err.Error())
+		a.respondError(w, r, http.StatusInternalServerError, err, "Could not list mentions")
+		return
+	}
+	log.Info("Got mentions from DB", "count", len(mentions))
+
+	res := response{Mentions: make([]userMention, len(mentions))}
+	for i, m := range mentions {
+		res.Mentions[i] = userMention{
+			Message:   toMessage([]Message{m.Message})[0],
+			CreatedAt: m.CreatedAt.Format(time.RFC1123),
+			Read:      m.Read,
+		}
+	}
+	a.respond(w, http.StatusOK, res)
+}
+
+// markMentionsRead clears the unread flag of the mentions in the messages
+// given in the body, or of all mentions without a body.
+func (a *API) markMentionsRead(w http.ResponseWriter, r *http.Request) {
+	type (
+		request struct {
+			MessageIDs []string `json:"message_ids" validate:"max=100,dive,required"`
+		}
+		response struct {
+			Marked int `json:"marked"`
+		}
+	)
+
+	log := LoggerFrom(r.Context())
+	userID, ok := a.authorizeAccount(w, r, r.PathValue("userID"), ScopeAdmin)
+	if !ok {
+		return
+	}
+	var body request
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		log.Warn("Error decoding request body", "error", err.Error())
+		a.respondError(w, r, http.StatusBadRequest, err, "Could not decode request body")
+		return
+	}
+	r.Body.Close()
+	if err := a.Validate.Struct(body); err != nil {
+		a.respondError(w, r, http.StatusBadRequest, err, "Validation failed")
+		return
+	}
+	setUser(r.Context(), userID)
+
+	n, err := a.DB.MarkMentionsRead(r.Context(), userID, body.MessageIDs...)
+	if err != nil {
+		log.Error("Error marking mentions read in DB", "error", err.Error())
+		a.respondError(w, r, http.StatusInternalServerError, err, "Could not mark mentions read")
+		return
+	}
+	log.Info("Marked mentions read", "count", n)
+	a.respond(w, http.StatusOK, response{Marked: n})
+}
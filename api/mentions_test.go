@@ -0,0 +1,270 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/neilotoole/slogt"
+)
+
+func TestParseMentions(t *testing.T) {
+	tests := []struct {
+		text string
+		want []mention
+	}{
+		{text: "hello", want: nil},
+		{text: "@alice", want: []mention{{UserID: "alice", Offset: 0, Length: 6}}},
+		{
+			text: "hi @alice and @bob.smith.",
+			want: []mention{
+				{UserID: "alice", Offset: 3, Length: 6},
+				{UserID: "bob.smith", Offset: 14, Length: 10},
+			},
+		},
+		{text: "héllo @zoë!", want: []mention{{UserID: "zoë", Offset: 6, Length: 4}}},
+		{text: "mail alice@example.com", want: nil},
+		{text: "(@alice,@bob)", want: []mention{{UserID: "alice", Offset: 1, Length: 6}, {UserID: "bob", Offset: 8, Length: 4}}},
+		{text: "@ alone and @@double", want: nil},
+	}
+	for _, tt := range tests {
+		if diff := cmp.Diff(tt.want, parseMentions(tt.text), cmp.AllowUnexported(mention{})); diff != "" {
+			t.Errorf("parseMentions(%q) mismatch (-want +got):\n%s", tt.text, diff)
+		}
+	}
+}
+
+func TestMentionedUsers(t *testing.T) {
+	text := "@bob @alice @bob"
+	for i := range maxMentions {
+		text += fmt.Sprintf(" @user%d", i)
+	}
+	got := mentionedUsers(text)
+	if len(got) != maxMentions {
+		t.Fatalf("Got %d users, want %d", len(got), maxMentions)
+	}
+	if diff := cmp.Diff([]string{"bob", "alice", "user0"}, got[:3]); diff != "" {
+		t.Errorf("mentionedUsers() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestAPI_createMessageMentions(t *testing.T) {
+	api := &API{
+		Logger:   slogt.New(t),
+		Validate: &MockValidator{},
+		DB: &testdb{
+			T: t,
+			insertMessage: func(t *testing.T, msg Message) (Message, error) {
+				if diff := cmp.Diff([]string{"bob"}, msg.Mentions); diff != "" {
+					t.Errorf("Mentions mismatch (-want +got):\n%s", diff)
+				}
+				msg.ID = "1"
+				msg.CreatedAt = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+				return msg, nil
+			},
+		},
+		Cache: &testcache{
+			T:             t,
+			insertMessage: func(t *testing.T, msg Message) error { return nil },
+		},
+	}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	resp := doWithKey(t, "POST", srv.URL+"/messages", "", `{"text": "hi @bob", "user_id": "alice"}`)
+	checkStatus(t, resp.StatusCode, 201)
+	checkBody(t, resp, `{
+		"id": "1",
+		"text": "hi @bob",
+		"user_id": "alice",
+		"created_at": "Mon, 01 Jan 2024 00:00:00 UTC",
+		"mentions": [{"user_id": "bob", "offset": 3, "length": 4}]
+	}`)
+}
+
+func TestAPI_listMentions(t *testing.T) {
+	mentions := []Mention{
+		{
+			Message: Message{
+				ID:                    "1",
+				Text:                  "hi @bob",
+				UserID:                "alice",
+				CreatedAt:             time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+				MessageReactionCounts: []MessageReactionCount{{Type: "like", Count: 1}},
+				Mentions:              []string{"bob"},
+			},
+			UserID:    "bob",
+			CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			Read:      true,
+		},
+	}
+	tests := []struct {
+		name       string
+		path       string
+		token      string
+		scopes     []string // of an API key to send instead of a token
+		wantQuery  MentionQuery
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "OK",
+			path:       "/users/bob/mentions",
+			token:      "bob-token",
+			wantQuery:  MentionQuery{UserID: "bob", Limit: pageSize},
+			wantStatus: 200,
+			wantBody: `{
+				"mentions": [
+					{
+						"message": {
+							"id": "1",
+							"text": "hi @bob",
+							"user_id": "alice",
+							"created_at": "Mon, 01 Jan 2024 00:00:00 UTC",
+							"message_reactions": [{"type": "like", "count": 1}],
+							"mentions": [{"user_id": "bob", "offset": 3, "length": 4}]
+						},
+						"created_at": "Mon, 01 Jan 2024 00:00:00 UTC",
+						"read": true
+					}
+				]
+			}`,
+		},
+		{
+			name:       "UnreadPage",
+			path:       "/users/bob/mentions?unread=true&page=2",
+			token:      "bob-token",
+			wantQuery:  MentionQuery{UserID: "bob", Unread: true, Limit: pageSize, Offset: pageSize},
+			wantStatus: 200,
+		},
+		{
+			name:       "InvalidUnread",
+			path:       "/users/bob/mentions?unread=maybe",
+			token:      "bob-token",
+			wantStatus: 400,
+			wantBody:   `{"error": "Invalid unread, want true or false"}`,
+		},
+		{
+			name:       "Unauthenticated",
+			path:       "/users/bob/mentions",
+			wantStatus: 401,
+		},
+		{
+			name:       "OtherUser",
+			path:       "/users/bob/mentions",
+			token:      "alice-token",
+			wantStatus: 403,
+			wantBody:   `{"error": "Cannot act on behalf of another user"}`,
+		},
+		{
+			name:       "APIKeyWithoutAdmin",
+			path:       "/users/bob/mentions",
+			scopes:     []string{ScopeReactionsWrite},
+			wantStatus: 403,
+			wantBody:   `{"error": "Missing scope admin"}`,
+		},
+		{
+			name:       "AdminAPIKey",
+			path:       "/users/bob/mentions",
+			scopes:     []string{ScopeAdmin},
+			wantQuery:  MentionQuery{UserID: "bob", Limit: pageSize},
+			wantStatus: 200,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys := newTestKeys()
+			api := &API{
+				Logger: slogt.New(t),
+				DB: &testdb{
+					T: t,
+					listMentions: func(t *testing.T, q MentionQuery) ([]Mention, error) {
+						if diff := cmp.Diff(tt.wantQuery, q); diff != "" {
+							t.Errorf("ListMentions() query mismatch (-want +got):\n%s", diff)
+						}
+						return mentions, nil
+					},
+				},
+				Auth:    testauth{"alice-token": "alice", "bob-token": "bob"},
+				APIKeys: keys,
+			}
+			srv := httptest.NewServer(api)
+			defer srv.Close()
+
+			req, _ := http.NewRequest("GET", srv.URL+tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			if tt.scopes != nil {
+				req.Header.Set(apiKeyHeader, keys.add(t, tt.scopes, nil))
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			checkStatus(t, resp.StatusCode, tt.wantStatus)
+			if tt.wantBody != "" {
+				checkBody(t, resp, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestAPI_markMentionsRead(t *testing.T) {
+	tests := []struct {
+		name       string
+		req        string
+		wantIDs    []string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "All",
+			wantStatus: 200,
+			wantBody:   `{"marked": 2}`,
+		},
+		{
+			name:       "Messages",
+			req:        `{"message_ids": ["1"]}`,
+			wantIDs:    []string{"1"},
+			wantStatus: 200,
+			wantBody:   `{"marked": 2}`,
+		},
+		{
+			name:       "InvalidJSON",
+			req:        `not json`,
+			wantStatus: 400,
+			wantBody:   `{"error": "Could not decode request body"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &API{
+				Logger:   slogt.New(t),
+				Validate: &MockValidator{},
+				DB: &testdb{
+					T: t,
+					markMentions: func(t *testing.T, userID string, msgIDs ...string) (int, error) {
+						if userID != "bob" {
+							t.Errorf("Got user %q, want bob", userID)
+						}
+						if diff := cmp.Diff(tt.wantIDs, msgIDs); diff != "" {
+							t.Errorf("MarkMentionsRead() IDs mismatch (-want +got):\n%s", diff)
+						}
+						return 2, nil
+					},
+				},
+			}
+			srv := httptest.NewServer(api)
+			defer srv.Close()
+
+			resp := doWithKey(t, "POST", srv.URL+"/users/bob/mentions/read", "", tt.req)
+			checkStatus(t, resp.StatusCode, tt.wantStatus)
+			checkBody(t, resp, tt.wantBody)
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/metrics"
+)
+
+// Metrics holds the application metrics. A nil *Metrics records nothing.
+type Metrics struct {
+	reg             *metrics.Registry
+	requests        *metrics.Counter
+	requestDuration *metrics.Histogram
+	cacheLookups    *metrics.Counter
+	messagesListed  *metrics.Counter
+	dbDuration      *metrics.Histogram
+	reactions       *metrics.Counter
+}
+
+// NewMetrics registers the application metrics in reg.
+func NewMetrics(reg *metrics.Registry) *Metrics {
+	return &Metrics{
+		reg: reg,
+		requests: reg.NewCounter("http_requests_total",
+			"HTTP requests by route and status code.", "route", "status"),
+		requestDuration: reg.NewHistogram("http_request_duration_seconds",
+			"HTTP request latency by route and status code.", metrics.DefBuckets, "route", "status"),
+		cacheLookups: reg.NewCounter("message_cache_lookups_total",
+			"Message list cache lookups. A hit means the page was served from the cache alone.", "result"),
+		messagesListed: reg.NewCounter("messages_listed_total",
+			"Messages returned by the list endpoint, by the source they were read from.", "source"),
+		dbDuration: reg.NewHistogram("db_query_duration_seconds",
+			"DB call latency by method.", metrics.DefBuckets, "method"),
+		reactions: reg.NewCounter("reactions_created_total",
+			"Reactions created, by reaction type.", "type"),
+	}
+}
+
+func (m *Metrics) observeRequest(route string, status int, d time.Duration) {
+	if m == nil {
+		return
+	}
+	if route == "" {
+		route = "unmatched"
+	}
+	code := strconv.Itoa(status)
+	m.requests.Inc(route, code)
+	m.requestDuration.Observe(d.Seconds(), route, code)
+}
+
+func (m *Metrics) observeList(fromCache, fromDB int) {
+	if m == nil {
+		return
+	}
+	if fromDB == 0 && fromCache > 0 {
+		m.cacheLookups.Inc("hit")
+	} else {
+		m.cacheLookups.Inc("miss")
+	}
+	m.messagesListed.Add(float64(fromCache), "cache")
+	m.messagesListed.Add(float64(fromDB), "db")
+}
+
+func (m *Metrics) observeReaction(reactionType string) {
+	if m == nil {
+		return
+	}
+	m.reactions.Inc(reactionType)
+}
+
+func (m *Metrics) observeDB(method string, start time.Time) {
+	if m == nil {
+		return
+	}
+	m.dbDuration.Observe(time.Since(start).Seconds(), method)
+}
+
+// InstrumentDB returns db with the latency of every call recorded in m.
+func InstrumentDB(db DB, m *Metrics) DB {
+	return &instrumentedDB{db: db, m: m}
+}
+
+type instrumentedDB struct {
+	db DB
+	m  *Metrics
+}
+
+func (i *instrumentedDB) ListMessages(ctx context.Context, q ListQuery, excludeMsgIDs ...string) ([]Message, error) {
+	defer i.m.observeDB("ListMessages", time.Now())
+	return i.db.ListMessages(ctx, q, excludeMsgIDs...)
+}
+
+func (i *instrumentedDB) InsertMessage(ctx context.Context, msg Message) (Message, error) {
+	defer i.m.observeDB("InsertMessage", time.Now())
+	return i.db.InsertMessage(ctx, msg)
+}
+
+func (i *instrumentedDB) InsertReaction(ctx context.Context, reaction Reaction) (Reaction, error) {
+	defer i.m.observeDB("InsertReaction", time.Now())
+	return i.db.InsertReaction(ctx, reaction)
+}
+
+func (i *instrumentedDB) SearchMessages(ctx context.Context, q SearchQuery) ([]SearchResult, error) {
+	defer i.m.observeDB("SearchMessages", time.Now())
+	return i.db.SearchMessages(ctx, q)
+}
+
+func (i *instrumentedDB) ListMentions(ctx context.Context, q MentionQuery) ([]Mention, error) {
+	defer i.m.observeDB("ListMentions", time.Now())
+	return i.db.ListMentions(ctx, q)
+}
+
+func (i *instrumentedDB) MarkMentionsRead(ctx context.Context, userID string, msgIDs ...string) (int, error) {
+	defer i.m.observeDB("MarkMentionsRead", time.Now())
+	return i.db.MarkMentionsRead(ctx, userID, msgIDs...)
+}
+
+func (i *instrumentedDB) MarkRead(ctx context.Context, userID, messageID string) (ReadMarker, error) {
+	defer i.m.observeDB("MarkRead", time.Now())
+	return i.db.MarkRead(ctx, userID, messageID)
+}
+
+func (i *instrumentedDB) GetReadMarker(ctx context.Context, userID string) (*ReadMarker, error) {
+	defer i.m.observeDB("GetReadMarker", time.Now())
+	return i.db.GetReadMarker(ctx, userID)
+}
+
+func (i *instrumentedDB) CountUnread(ctx context.Context, userID string, marker *ReadMarker) (UnreadCounts, error) {
+	defer i.m.observeDB("CountUnread", time.Now())
+	return i.db.CountUnread(ctx, userID, marker)
+}
+
+func (i *instrumentedDB) PinMessage(ctx context.Context, messageID, userID string) (Pin, error) {
+	defer i.m.observeDB("PinMessage", time.Now())
+	return i.db.PinMessage(ctx, messageID, userID)
+}
+
+func (i *instrumentedDB) UnpinMessage(ctx context.Context, messageID string) error {
+	defer i.m.observeDB("UnpinMessage", time.Now())
+	return i.db.UnpinMessage(ctx, messageID)
+}
+
+func (i *instrumentedDB) ListPins(ctx context.Context) ([]Pin, error) {
+	defer i.m.observeDB("ListPins", time.Now())
+	return i.db.ListPins(ctx)
+}
+
+func (i *instrumentedDB) InsertAttachment(ctx context.Context, attachment Attachment) (Attachment, error) {
+	defer i.m.observeDB("InsertAttachment", time.Now())
+	return i.db.InsertAttachment(ctx, attachment)
+}
+
+func (i *instrumentedDB) GetAttachment(ctx context.Context, id string) (*Attachment, error) {
+	defer i.m.observeDB("GetAttachment", time.Now())
+	return i.db.GetAttachment(ctx, id)
+}
+
+func (i *instrumentedDB) FlagMessage(ctx context.Context, flag Flag, hideAfter int) (FlagResult, error) {
+	defer i.m.observeDB("FlagMessage", time.Now())
+	return i.db.FlagMessage(ctx, flag, hideAfter)
+}
+
+func (i *instrumentedDB) ListFlaggedMessages(ctx context.Context, q FlagQuery) ([]FlaggedMessage, error) {
+	defer i.m.observeDB("ListFlaggedMessages", time.Now())
+	return i.db.ListFlaggedMessages(ctx, q)
+}
+
+func (i *instrumentedDB) ReviewMessage(ctx context.Context, messageID, moderatorID, decision string) (Message, error) {
+	defer i.m.observeDB("ReviewMessage", time.Now())
+	return i.db.ReviewMessage(ctx, messageID, moderatorID, decision)
+}
+
+// A responseRecorder captures the status code and size of a response.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+// Unwrap lets an http.ResponseController reach the underlying writer, to
+// flush streamed responses.
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
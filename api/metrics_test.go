@@ -0,0 +1,81 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/metrics"
+	"github.com/neilotoole/slogt"
+)
+
+func TestAPI_metrics(t *testing.T) {
+	db := &testdb{
+		listMessages: func(t *testing.T, excludeMsgIDs ...string) ([]Message, error) {
+			return []Message{{ID: "2", CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}}, nil
+		},
+		insertReaction: func(t *testing.T, reaction Reaction) (Reaction, error) {
+			return reaction, nil
+		},
+	}
+	cache := &testcache{
+		listMessages: func(t *testing.T) ([]Message, error) {
+			return []Message{{ID: "1", CreatedAt: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)}}, nil
+		},
+		getMessage: func(t *testing.T, id string) (*Message, error) {
+			return nil, ErrMessageNotFoundInCache
+		},
+	}
+	db.T, cache.T = t, t
+
+	m := NewMetrics(metrics.NewRegistry())
+	api := &API{
+		Logger:   slogt.New(t),
+		DB:       InstrumentDB(db, m),
+		Cache:    cache,
+		Validate: &MockValidator{},
+		Metrics:  m,
+	}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	if _, err := http.Get(srv.URL + "/messages"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := http.Post(srv.URL+"/messages/1/reactions", "application/json", strings.NewReader(`{"type": "like", "user_id": "test"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := http.Get(srv.URL + "/nope"); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	body := string(b)
+
+	for _, want := range []string{
+		`http_requests_total{route="GET /messages",status="200"} 1`,
+		`http_requests_total{route="POST /messages/{messageID}/reactions",status="201"} 1`,
+		`http_requests_total{route="unmatched",status="404"} 1`,
+		`http_request_duration_seconds_count{route="GET /messages",status="200"} 1`,
+		`message_cache_lookups_total{result="miss"} 1`,
+		`messages_listed_total{source="cache"} 1`,
+		`messages_listed_total{source="db"} 1`,
+		`db_query_duration_seconds_count{method="ListMessages"} 1`,
+		`db_query_duration_seconds_count{method="InsertReaction"} 1`,
+		`reactions_created_total{type="like"} 1`,
+	} {
+		if !strings.Contains(body, want+"\n") {
+			t.Errorf("Metrics do not contain %s", want)
+		}
+	}
+	if t.Failed() {
+		t.Logf("Metrics:\n%s", body)
+	}
+}
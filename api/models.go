@@ -9,6 +9,100 @@ type Message struct {
 	UserID                string
 	CreatedAt             time.Time
 	MessageReactionCounts []MessageReactionCount
+	Mentions              []string // IDs of the users mentioned in Text, set when it is created
+	Format                string   // FormatMarkdown, or empty for plain text
+	Moderation            string   // the last moderation action taken on the message, if any
+	Pinned                bool
+	Attachments           []Attachment
+}
+
+// Formats of the text of a message.
+const (
+	FormatText     = "text"
+	FormatMarkdown = "markdown"
+)
+
+// Actions a moderation rule takes on the messages that break it, from the
+// most lenient to the strictest. Flagged messages are published and kept for
+// review; shadowed ones are stored but never listed, without telling their
+// author; blocked ones are rejected.
+const (
+	ModerationAllow  = "allow"
+	ModerationFlag   = "flag"
+	ModerationShadow = "shadow"
+	ModerationBlock  = "block"
+)
+
+// Actions moderators take on messages. Hidden messages are not listed until
+// they are reviewed; removed ones are never listed again.
+const (
+	ModerationHide   = "hide"
+	ModerationRemove = "remove"
+)
+
+// Decisions of a moderator reviewing a message. Approving a message clears
+// its moderation, making it visible again.
+const (
+	ReviewApprove = "approve"
+	ReviewRemove  = "remove"
+)
+
+// A Flag is a user's report of an abusive message. It is pending until a
+// moderator reviews the message.
+type Flag struct {
+	MessageID string
+	UserID    string
+	Reason    string
+	CreatedAt time.Time
+}
+
+// A FlagResult is the outcome of flagging a message.
+type FlagResult struct {
+	Flag    Flag
+	Created bool // false if the user had flagged the message already
+	Hidden  bool // whether this flag hid the message
+}
+
+// A FlaggedMessage is a message awaiting review, with its pending flags,
+// oldest first.
+type FlaggedMessage struct {
+	Message Message
+	Flags   []Flag
+}
+
+// FlagQuery selects a page of the messages awaiting review.
+type FlagQuery struct {
+	Limit  int
+	Offset int
+}
+
+// Kinds of moderation rules.
+const (
+	RuleBlocklist = "blocklist" // Words, matched as whole words after undoing leetspeak
+	RuleRegex     = "regex"     // Pattern, a regular expression
+	RuleLinks     = "links"     // more than Limit links
+	RuleRepeat    = "repeat"    // the same character more than Limit times in a row
+)
+
+// A ModerationRule is checked against the text of new messages.
+type ModerationRule struct {
+	ID        string
+	Name      string
+	Kind      string
+	Words     []string
+	Pattern   string
+	Limit     int
+	Action    string
+	Enabled   bool
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// A ModerationVerdict is the outcome of moderating a text: the strictest
+// action of the rules it breaks, and why each of them was broken.
+type ModerationVerdict struct {
+	Action  string
+	Reasons []string
 }
 
 // MessageReactionCount represents the reaction and count read from DB
@@ -26,3 +120,273 @@ type Reaction struct {
 	UserID    string
 	CreatedAt time.Time
 }
+
+// A QueuedWrite is a message or reaction that was accepted while the DB was
+// unavailable. Exactly one of Message and Reaction is set.
+type QueuedWrite struct {
+	ID       string // assigned by the Queue
+	Message  *Message
+	Reaction *Reaction
+}
+
+// An APIKey lets a backend service call the API without a user token. Only
+// the SHA-256 hash of the secret is stored.
+type APIKey struct {
+	ID        string
+	Name      string
+	Prefix    string // first characters of the secret, to tell keys apart
+	Hash      string
+	Scopes    []string
+	CreatedAt time.Time
+	ExpiresAt *time.Time
+	RevokedAt *time.Time
+}
+
+// Active reports whether the key may be used at t.
+func (k APIKey) Active(t time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || t.Before(*k.ExpiresAt))
+}
+
+// Kinds of bans, from the strictest.
+const (
+	BanBan    = "ban"    // no messages, reactions or flags
+	BanMute   = "mute"   // no messages
+	BanShadow = "shadow" // messages are only listed to their author
+)
+
+// A Ban restricts what a user may do until it expires or a moderator lifts
+// it. Messages are not in channels, so bans apply everywhere.
+type Ban struct {
+	ID        string
+	UserID    string
+	Kind      string // BanBan, BanMute or BanShadow
+	Reason    string
+	CreatedBy string // the moderator
+	CreatedAt time.Time
+	ExpiresAt *time.Time
+	LiftedAt  *time.Time
+}
+
+// Active reports whether the ban applies at t.
+func (b Ban) Active(t time.Time) bool {
+	return b.LiftedAt == nil && (b.ExpiresAt == nil || t.Before(*b.ExpiresAt))
+}
+
+// A Block hides the messages of BlockedUserID from UserID.
+type Block struct {
+	UserID        string
+	BlockedUserID string
+	CreatedAt     time.Time
+}
+
+// A User is the profile of a user, who is known by ID everywhere else and
+// may not have one.
+type User struct {
+	ID          string
+	Name        string // display name
+	AvatarURL   string
+	Deactivated bool // no longer writes messages, reactions, flags or profile edits
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// A UserDataRecord is one message or reaction of an export. Exactly one of
+// Message and Reaction is set.
+type UserDataRecord struct {
+	Message  *Message
+	Reaction *Reaction
+}
+
+// Modes of erasure.
+const (
+	// ErasureAnonymize blanks the user's messages and hands them and the
+	// user's reactions to a pseudonym, keeping conversations whole.
+	ErasureAnonymize = "anonymize"
+	// ErasureDelete deletes the user's messages, with everything on them,
+	// and the user's reactions.
+	ErasureDelete = "delete"
+)
+
+// Statuses of erasure jobs.
+const (
+	ErasurePending = "pending"
+	ErasureRunning = "running"
+	ErasureDone    = "done"
+)
+
+// An ErasureJob erases the messages, attachments, reactions, mentions, flags,
+// bans, blocks, read marker and profile of a user.
+type ErasureJob struct {
+	ID          string
+	UserID      string
+	Mode        string // ErasureAnonymize or ErasureDelete
+	RequestedBy string // who asked, as "user:" and the user ID or "key:" and the API key ID
+	// Pseudonym is the random user ID anonymized messages and reactions are
+	// handed to. It is distinct per job, so the reactions of two erased
+	// users to the same message don't collide, and forgotten once the job is
+	// done, so it can't be traced back to the user.
+	Pseudonym   string
+	Status      string
+	Messages    int // erased so far
+	Attachments int
+	Reactions   int
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	CompletedAt *time.Time
+}
+
+// An ErasureBatch is what one step of an ErasureJob erased.
+type ErasureBatch struct {
+	Messages    int
+	Attachments int
+	Reactions   int
+	// MessageIDs are the messages that were erased or lost reactions, whose
+	// cached copies are stale.
+	MessageIDs []string
+	// BlobKeys are the contents of the erased attachments and their
+	// thumbnails.
+	BlobKeys []string
+	// UserIDs are the users whose cached profile or blocked users are
+	// stale: the erased user and those who had blocked them.
+	UserIDs []string
+	Done    bool // nothing is left to erase
+}
+
+// A SearchQuery selects messages matching a full-text query, best matches
+// first.
+type SearchQuery struct {
+	Text   string
+	UserID string        // optional
+	Since  time.Time     // optional, inclusive
+	Until  time.Time     // optional, exclusive
+	After  *SearchCursor // optional, continues after a previous result
+	Limit  int
+}
+
+// A SearchCursor is the position of a result in the search order: by rank,
+// then newest first.
+type SearchCursor struct {
+	Rank      float32
+	CreatedAt time.Time
+	ID        string
+}
+
+// A SearchResult is a message matching a search. The snippet shows where it
+// matched, with matches between HighlightStart and HighlightEnd.
+type SearchResult struct {
+	Message
+	Rank    float32
+	Snippet string
+}
+
+// Delimiters of the matches in SearchResult.Snippet. They are control
+// characters, which don't appear in text messages.
+const (
+	HighlightStart = "\x02"
+	HighlightEnd   = "\x03"
+)
+
+// Orders messages can be listed in.
+const (
+	SortCreatedAt = "created_at"
+	SortScore     = "score" // sum of the reaction scores
+)
+
+// A ListQuery selects and orders messages. The zero value lists all
+// messages, newest first.
+type ListQuery struct {
+	Limit        int // zero means no limit
+	Offset       int
+	UserID       string
+	Since        time.Time // inclusive
+	Until        time.Time // exclusive
+	HasReactions *bool
+	ReactionType string // only messages with a reaction of this type
+	Sort         string // SortCreatedAt, the default, or SortScore
+	Ascending    bool
+	Viewer       string // also lists the viewer's own shadowed messages
+	// ExcludeUserIDs leaves out the messages of these authors, such as those
+	// the viewer blocked. The cache is shared, so it doesn't make q Filtered.
+	ExcludeUserIDs []string
+}
+
+// Filtered reports whether q selects or orders messages differently from the
+// default, newest first, which is what the cache holds.
+func (q ListQuery) Filtered() bool {
+	return q.UserID != "" ||
+		!q.Since.IsZero() ||
+		!q.Until.IsZero() ||
+		q.HasReactions != nil ||
+		q.ReactionType != "" ||
+		(q.Sort != "" && q.Sort != SortCreatedAt) ||
+		q.Ascending
+}
+
+// A Mention records that a message mentioned a user.
+type Mention struct {
+	Message   Message
+	UserID    string
+	CreatedAt time.Time
+	Read      bool
+}
+
+// A MentionQuery selects the mentions of a user, newest first.
+type MentionQuery struct {
+	UserID string
+	Unread bool // only mentions that were not read
+	Limit  int
+	Offset int
+}
+
+// A ReadMarker is how far a user has read the messages: up to and including
+// a message.
+type ReadMarker struct {
+	UserID           string
+	MessageID        string
+	MessageCreatedAt time.Time // with the ID, the position of the message
+	UpdatedAt        time.Time
+}
+
+// UnreadCounts are the messages a user has not read, not counting their own,
+// and the mentions of the user not marked read.
+type UnreadCounts struct {
+	Messages int
+	Mentions int
+}
+
+// A Pin is a message pinned above the others.
+type Pin struct {
+	Message  Message
+	PinnedBy string
+	PinnedAt time.Time
+}
+
+// An Attachment is a file uploaded to be sent with a message. Its content is
+// kept in a BlobStore under Key.
+type Attachment struct {
+	ID          string
+	MessageID   string // empty until it is sent
+	UserID      string // who uploaded it, the only one who can send it
+	FileName    string
+	ContentType string
+	Size        int64
+	Key         string
+	CreatedAt   time.Time
+	Thumbnails  []Thumbnail // of images, once they are generated
+}
+
+// A Thumbnail is a scaled down copy of an image attachment, kept in a
+// BlobStore under Key. Size is the longest side it was scaled to fit.
+type Thumbnail struct {
+	Size        int
+	Width       int
+	Height      int
+	ContentType string
+	Key         string
+}
+
+// A ThumbnailJob is the pending generation of an attachment's thumbnails.
+type ThumbnailJob struct {
+	Attachment Attachment
+	Attempts   int // including the current one
+}
@@ -0,0 +1,186 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// moderate runs text past the Moderator, allowing everything without one.
+// Every rule the text breaks is logged, even those that allow it.
+func (a *API) moderate(ctx context.Context, text string) ModerationVerdict {
+	if a.Moderator == nil {
+		return ModerationVerdict{Action: ModerationAllow}
+	}
+	v := a.Moderator.Moderate(text)
+	if len(v.Reasons) > 0 {
+		LoggerFrom(ctx).Info("Moderated message", "action", v.Action, "reasons", v.Reasons)
+	}
+	return v
+}
+
+// moderationRule represents the moderation rule DTO.
+type moderationRule struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Kind      string   `json:"kind"`
+	Words     []string `json:"words,omitempty"`
+	Pattern   string   `json:"pattern,omitempty"`
+	Limit     int      `json:"limit,omitempty"`
+	Action    string   `json:"action"`
+	Enabled   bool     `json:"enabled"`
+	CreatedAt string   `json:"created_at"`
+	UpdatedAt string   `json:"updated_at"`
+}
+
+func toModerationRule(rule ModerationRule) moderationRule {
+	return moderationRule{
+		ID:        rule.ID,
+		Name:      rule.Name,
+		Kind:      rule.Kind,
+		Words:     rule.Words,
+		Pattern:   rule.Pattern,
+		Limit:     rule.Limit,
+		Action:    rule.Action,
+		Enabled:   rule.Enabled,
+		CreatedAt: rule.CreatedAt.Format(time.RFC1123),
+		UpdatedAt: rule.UpdatedAt.Format(time.RFC1123),
+	}
+}
+
+// decodeModerationRule reads a rule from the request body, checking it with
+// the Moderator, and responds with an error if it is not valid.
+func (a *API) decodeModerationRule(w http.ResponseWriter, r *http.Request) (ModerationRule, bool) {
+	type request struct {
+		Name    string   `json:"name" validate:"required,max=255"`
+		Kind    string   `json:"kind" validate:"required,oneof=blocklist regex links repeat"`
+		Words   []string `json:"words" validate:"max=10000,dive,required,max=255"`
+		Pattern string   `json:"pattern" validate:"max=1000"`
+		Limit   int      `json:"limit" validate:"min=0"`
+		Action  string   `json:"action" validate:"required,oneof=allow flag shadow block"`
+		Enabled *bool    `json:"enabled"` // defaults to true
+	}
+
+	var body request
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		LoggerFrom(r.Context()).Warn("Error decoding request body", "error", err.Error())
+		a.respondError(w, r, http.StatusBadRequest, err, "Could not decode request body")
+		return ModerationRule{}, false
+	}
+	r.Body.Close()
+
+	if err := a.Validate.Struct(body); err != nil {
+		a.respondError(w, r, http.StatusBadRequest, err, "Validation failed")
+		return ModerationRule{}, false
+	}
+	rule := ModerationRule{
+		Name:    body.Name,
+		Kind:    body.Kind,
+		Words:   body.Words,
+		Pattern: body.Pattern,
+		Limit:   body.Limit,
+		Action:  body.Action,
+		Enabled: body.Enabled == nil || *body.Enabled,
+	}
+	if a.Moderator != nil {
+		if err := a.Moderator.CheckRule(rule); err != nil {
+			a.respondError(w, r, http.StatusBadRequest, err, "Invalid rule: "+err.Error())
+			return ModerationRule{}, false
+		}
+	}
+	return rule, true
+}
+
+func (a *API) createModerationRule(w http.ResponseWriter, r *http.Request) {
+	if !a.requireScope(w, r, ScopeAdmin) {
+		return
+	}
+	rule, ok := a.decodeModerationRule(w, r)
+	if !ok {
+		return
+	}
+	log := LoggerFrom(r.Context())
+	rule, err := a.ModerationRules.InsertModerationRule(r.Context(), rule)
+	if err != nil {
+		log.Error("Error creating moderation rule in DB", "error", err.Error())
+		a.respondError(w, r, http.StatusInternalServerError, err, "Could not create moderation rule")
+		return
+	}
+	log.Info("Created moderation rule", "rule_id", rule.ID, "kind", rule.Kind, "action", rule.Action)
+	a.respond(w, http.StatusCreated, toModerationRule(rule))
+}
+
+func (a *API) listModerationRules(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Rules []moderationRule `json:"rules"`
+	}
+
+	if !a.requireScope(w, r, ScopeAdmin) {
+		return
+	}
+	rules, err := a.ModerationRules.ListModerationRules(r.Context())
+	if err != nil {
+		LoggerFrom(r.Context()).Error("Error listing moderation rules from DB", "error", err.Error())
+		a.respondError(w, r, http.StatusInternalServerError, err, "Could not list moderation rules")
+		return
+	}
+
+	res := response{Rules: make([]moderationRule, len(rules))}
+	for i, rule := range rules {
+		res.Rules[i] = toModerationRule(rule)
+	}
+	a.respond(w, http.StatusOK, res)
+}
+
+func (a *API) updateModerationRule(w http.ResponseWriter, r *http.Request) {
+	if !a.requireScope(w, r, ScopeAdmin) {
+		return
+	}
+	rule, ok := a.decodeModerationRule(w, r)
+	if !ok {
+		return
+	}
+	rule.ID = r.PathValue("ruleID")
+	log := LoggerFrom(r.Context())
+	rule, err := a.ModerationRules.UpdateModerationRule(r.Context(), rule)
+	if errors.Is(err, ErrModerationRuleNotFound) {
+		a.respondError(w, r, http.StatusNotFound, err, "Moderation rule not found")
+		return
+	}
+	if err != nil {
+		log.Error("Error updating moderation rule in DB", "error", err.Error())
+		a.respondError(w, r, http.StatusInternalServerError, err, "Could not update moderation rule")
+		return
+	}
+	log.Info("Updated moderation rule", "rule_id", rule.ID, "kind", rule.Kind, "action", rule.Action)
+	a.respond(w, http.StatusOK, toModerationRule(rule))
+}
+
+func (a *API) deleteModerationRule(w http.ResponseWriter, r *http.Request) {
+	if !a.requireScope(w, r, ScopeAdmin) {
+		return
+	}
+	log := LoggerFrom(r.Context())
+	id := r.PathValue("ruleID")
+	err := a.ModerationRules.DeleteModerationRule(r.Context(), id)
+	if errors.Is(err, ErrModerationRuleNotFound) {
+		a.respondError(w, r, http.StatusNotFound, err, "Moderation rule not found")
+		return
+	}
+	if err != nil {
+		log.Error("Error deleting moderation rule in DB", "error", err.Error())
+		a.respondError(w, r, http.StatusInternalServerError, err, "Could not delete moderation rule")
+		return
+	}
+	log.Info("Deleted moderation rule", "rule_id", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// blockedError describes why a message was blocked, for the logs.
+func blockedError(v ModerationVerdict) error {
+	return fmt.Errorf("blocked by moderation: %s", strings.Join(v.Reasons, "; "))
+}
@@ -0,0 +1,252 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neilotoole/slogt"
+)
+
+func TestAPI_createMessageModeration(t *testing.T) {
+	tests := []struct {
+		name           string
+		verdict        ModerationVerdict
+		wantStatus     int
+		wantModeration string
+		wantMentions   bool
+		wantCached     bool
+	}{
+		{
+			name:         "Allow",
+			verdict:      ModerationVerdict{Action: ModerationAllow},
+			wantStatus:   201,
+			wantMentions: true,
+			wantCached:   true,
+		},
+		{
+			name:         "AllowWithReasons",
+			verdict:      ModerationVerdict{Action: ModerationAllow, Reasons: []string{"trial: contains \"spam\""}},
+			wantStatus:   201,
+			wantMentions: true,
+			wantCached:   true,
+		},
+		{
+			name:           "Flag",
+			verdict:        ModerationVerdict{Action: ModerationFlag, Reasons: []string{"links: has more than 0 links"}},
+			wantStatus:     201,
+			wantModeration: ModerationFlag,
+			wantMentions:   true,
+			wantCached:     true,
+		},
+		{
+			name:           "Shadow",
+			verdict:        ModerationVerdict{Action: ModerationShadow, Reasons: []string{"spam: contains \"spam\""}},
+			wantStatus:     201,
+			wantModeration: ModerationShadow,
+		},
+		{
+			name:       "Block",
+			verdict:    ModerationVerdict{Action: ModerationBlock, Reasons: []string{"slurs: contains \"slur\""}},
+			wantStatus: 422,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stored *Message
+			cached := false
+			api := &API{
+				Logger: slogt.New(t),
+				DB: &testdb{
+					T: t,
+					insertMessage: func(t *testing.T, msg Message) (Message, error) {
+						stored = &msg
+						msg.ID = "1"
+						return msg, nil
+					},
+				},
+				Cache: &testcache{
+					T: t,
+					insertMessage: func(t *testing.T, msg Message) error {
+						cached = true
+						return nil
+					},
+				},
+				Validate:  &MockValidator{},
+				Moderator: testmoderator{verdict: tt.verdict},
+			}
+			srv := httptest.NewServer(api)
+			defer srv.Close()
+
+			resp, err := http.Post(srv.URL+"/messages", "application/json",
+				strings.NewReader(`{"text": "hi @bob", "user_id": "alice"}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			checkStatus(t, resp.StatusCode, tt.wantStatus)
+			if tt.wantStatus != 201 {
+				checkBody(t, resp, `{"error": "Message was blocked by moderation"}`)
+				if stored != nil {
+					t.Error("Blocked message was stored")
+				}
+				return
+			}
+			if stored == nil {
+				t.Fatal("Message was not stored")
+			}
+			if stored.Moderation != tt.wantModeration {
+				t.Errorf("Got moderation %q, want %q", stored.Moderation, tt.wantModeration)
+			}
+			if got := len(stored.Mentions) > 0; got != tt.wantMentions {
+				t.Errorf("Got mentions %v, want them %t", stored.Mentions, tt.wantMentions)
+			}
+			// The response reports the mentions that were stored.
+			var res struct {
+				Mentions []mention `json:"mentions"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+				t.Fatal(err)
+			}
+			if got := len(res.Mentions) > 0; got != tt.wantMentions {
+				t.Errorf("Got mentions %+v in the response, want them %t", res.Mentions, tt.wantMentions)
+			}
+			if cached != tt.wantCached {
+				t.Errorf("Got cached %t, want %t", cached, tt.wantCached)
+			}
+		})
+	}
+}
+
+func TestAPI_moderationRules(t *testing.T) {
+	keys := newTestKeys()
+	admin := keys.add(t, []string{ScopeAdmin}, nil)
+	writer := keys.add(t, []string{ScopeMessagesWrite}, nil)
+	store := &testrules{}
+	api := &API{
+		Logger:          slogt.New(t),
+		Validate:        &MockValidator{},
+		APIKeys:         keys,
+		Moderator:       testmoderator{},
+		ModerationRules: store,
+	}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	resp := doWithKey(t, "POST", srv.URL+"/admin/moderation/rules", writer, `{}`)
+	checkStatus(t, resp.StatusCode, http.StatusForbidden)
+
+	resp = doWithKey(t, "POST", srv.URL+"/admin/moderation/rules", admin,
+		`{"name": "bad", "kind": "regex", "pattern": "(", "action": "block"}`)
+	checkStatus(t, resp.StatusCode, http.StatusBadRequest)
+	checkBody(t, resp, `{"error": "Invalid rule: pattern does not compile"}`)
+
+	resp = doWithKey(t, "POST", srv.URL+"/admin/moderation/rules", admin,
+		`{"name": "spam", "kind": "blocklist", "words": ["spam"], "action": "shadow"}`)
+	checkStatus(t, resp.StatusCode, http.StatusCreated)
+	checkBody(t, resp, `{
+		"id": "1",
+		"name": "spam",
+		"kind": "blocklist",
+		"words": ["spam"],
+		"action": "shadow",
+		"enabled": true,
+		"created_at": "Mon, 01 Jan 2024 00:00:00 UTC",
+		"updated_at": "Mon, 01 Jan 2024 00:00:00 UTC"
+	}`)
+
+	resp = doWithKey(t, "PUT", srv.URL+"/admin/moderation/rules/1", admin,
+		`{"name": "spam", "kind": "blocklist", "words": ["spam", "scam"], "action": "block", "enabled": false}`)
+	checkStatus(t, resp.StatusCode, http.StatusOK)
+	if r := store.rules[0]; r.Action != ModerationBlock || r.Enabled || len(r.Words) != 2 {
+		t.Errorf("Got updated rule %+v", r)
+	}
+
+	resp = doWithKey(t, "PUT", srv.URL+"/admin/moderation/rules/2", admin,
+		`{"name": "x", "kind": "links", "action": "flag"}`)
+	checkStatus(t, resp.StatusCode, http.StatusNotFound)
+
+	resp = doWithKey(t, "GET", srv.URL+"/admin/moderation/rules", admin, "")
+	checkStatus(t, resp.StatusCode, http.StatusOK)
+	checkBody(t, resp, `{"rules": [{
+		"id": "1",
+		"name": "spam",
+		"kind": "blocklist",
+		"words": ["spam", "scam"],
+		"action": "block",
+		"enabled": false,
+		"created_at": "Mon, 01 Jan 2024 00:00:00 UTC",
+		"updated_at": "Mon, 01 Jan 2024 00:00:00 UTC"
+	}]}`)
+
+	resp = doWithKey(t, "DELETE", srv.URL+"/admin/moderation/rules/1", admin, "")
+	checkStatus(t, resp.StatusCode, http.StatusNoContent)
+	resp = doWithKey(t, "DELETE", srv.URL+"/admin/moderation/rules/1", admin, "")
+	checkStatus(t, resp.StatusCode, http.StatusNotFound)
+}
+
+// testmoderator returns the same verdict for every text, and rejects rules
+// with "(" as their pattern.
+type testmoderator struct {
+	verdict ModerationVerdict
+}
+
+func (m testmoderator) Moderate(string) ModerationVerdict {
+	if m.verdict.Action == "" {
+		return ModerationVerdict{Action: ModerationAllow}
+	}
+	return m.verdict
+}
+
+func (testmoderator) CheckRule(rule ModerationRule) error {
+	if rule.Pattern == "(" {
+		return errors.New("pattern does not compile")
+	}
+	return nil
+}
+
+// testrules is an in-memory ModerationRuleStore numbering rules from 1.
+type testrules struct {
+	rules []ModerationRule
+	next  int
+}
+
+func (s *testrules) ListModerationRules(context.Context) ([]ModerationRule, error) {
+	return s.rules, nil
+}
+
+func (s *testrules) InsertModerationRule(_ context.Context, rule ModerationRule) (ModerationRule, error) {
+	s.next++
+	rule.ID = strconv.Itoa(s.next)
+	rule.CreatedAt = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	rule.UpdatedAt = rule.CreatedAt
+	s.rules = append(s.rules, rule)
+	return rule, nil
+}
+
+func (s *testrules) UpdateModerationRule(_ context.Context, rule ModerationRule) (ModerationRule, error) {
+	for i, r := range s.rules {
+		if r.ID == rule.ID {
+			rule.CreatedAt, rule.UpdatedAt = r.CreatedAt, r.UpdatedAt
+			s.rules[i] = rule
+			return rule, nil
+		}
+	}
+	return ModerationRule{}, ErrModerationRuleNotFound
+}
+
+func (s *testrules) DeleteModerationRule(_ context.Context, id string) error {
+	for i, r := range s.rules {
+		if r.ID == id {
+			s.rules = append(s.rules[:i], s.rules[i+1:]...)
+			return nil
+		}
+	}
+	return ErrModerationRuleNotFound
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// pin represents the pinned message DTO.
+type pin struct {
+	MessageID string `json:"message_id"`
+	Text      string `json:"text"`
+	UserID    string `json:"user_id"`
+	CreatedAt string `json:"created_at"`
+	PinnedBy  string `json:"pinned_by"`
+	PinnedAt  string `json:"pinned_at"`
+	Format    string `json:"format,omitempty"`
+	HTML      string `json:"html,omitempty"`
+}
+
+func toPin(p Pin) pin {
+	return pin{
+		MessageID: p.Message.ID,
+		Text:      p.Message.Text,
+		UserID:    p.Message.UserID,
+		CreatedAt: p.Message.CreatedAt.Format(time.RFC1123),
+		PinnedBy:  p.PinnedBy,
+		PinnedAt:  p.PinnedAt.Format(time.RFC1123),
+		Format:    p.Message.Format,
+		HTML:      messageHTML(p.Message),
+	}
+}
+
+func (a *API) pinMessage(w http.ResponseWriter, r *http.Request) {
+	type request struct {
+		UserID string `json:"user_id" validate:"required"`
+	}
+
+	if !a.requireScope(w, r, ScopeMessagesWrite) {
+		return
+	}
+	log := LoggerFrom(r.Context())
+	var body request
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		log.Warn("Error decoding request body", "error", err.Error())
+		a.respondError(w, r, http.StatusBadRequest, err, "Could not decode request body")
+		return
+	}
+	r.Body.Close()
+	userID, ok := a.authorizeUser(w, r, body.UserID)
+	if !ok {
+		return
+	}
+	body.UserID = userID
+	if err := a.Validate.Struct(body); err != nil {
+		a.respondError(w, r, http.StatusBadRequest, err, "Validation failed")
+		return
+	}
+	setUser(r.Context(), body.UserID)
+
+	p, err := a.DB.PinMessage(r.Context(), r.PathValue("messageID"), body.UserID)
+	if errors.Is(err, ErrMessageNotFound) {
+		a.respondError(w, r, http.StatusNotFound, err, "Message not found")
+		return
+	}
+	if err != nil {
+		log.Error("Error pinning message in DB", "error", err.Error())
+		a.respondError(w, r, http.StatusInternalServerError, err, "Could not pin message")
+		return
+	}
+	a.refreshPins(r.Context())
+	a.respond(w, http.StatusOK, toPin(p))
+}
+
+func (a *API) unpinMessage(w http.ResponseWriter, r *http.Request) {
+	if !a.requireScope(w, r, ScopeMessagesWrite) {
+		return
+	}
+	log := LoggerFrom(r.Context())
+	err := a.DB.UnpinMessage(r.Context(), r.PathValue("messageID"))
+	if errors.Is(err, ErrPinNotFound) {
+		a.respondError(w, r, http.StatusNotFound, err, "Message is not pinned")
+		return
+	}
+	if err != nil {
+		log.Error("Error unpinning message in DB", "error", err.Error())
+		a.respondError(w, r, http.StatusInternalServerError, err, "Could not unpin message")
+		return
+	}
+	a.refreshPins(r.Context())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *API) listPins(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Pins []pin `json:"pins"`
+	}
+
+	pins, err := a.pins(r.Context())
+	if err != nil {
+		LoggerFrom(r.Context()).Error("Error listing pins", "error", err.Error())
+		a.respondError(w, r, http.StatusInternalServerError, err, "Could not list pins")
+		return
+	}
+	res := response{Pins: make([]pin, len(pins))}
+	for i, p := range pins {
+		res.Pins[i] = toPin(p)
+	}
+	a.respond(w, http.StatusOK, res)
+}
+
+// pins returns the pinned messages, trying the cache first.
+func (a *API) pins(ctx context.Context) ([]Pin, error) {
+	log := LoggerFrom(ctx)
+	if a.Pins != nil {
+		pins, err := a.Pins.ListPins(ctx)
+		if err == nil {
+			return pins, nil
+		}
+		if !errors.Is(err, ErrPinsNotFoundInCache) {
+			log.Warn("Error getting pins from cache, trying database", "error", err.Error())
+		}
+	}
+
+	pins, err := a.DB.ListPins(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if a.Pins != nil {
+		if err := a.Pins.SetPins(ctx, pins); err != nil {
+			log.Warn("Could not cache pins", "error", err.Error())
+		}
+	}
+	return pins, nil
+}
+
+// refreshPins replaces the cached pins with those in the DB after a change.
+// The pins are few, so this is cheaper than keeping the cache in step.
+func (a *API) refreshPins(ctx context.Context) {
+	if a.Pins == nil {
+		return
+	}
+	log := LoggerFrom(ctx)
+	pins, err := a.DB.ListPins(ctx)
+	if err != nil {
+		log.Error("Could not list pins to cache", "error", err.Error())
+		return
+	}
+	if err := a.Pins.SetPins(ctx, pins); err != nil {
+		log.Error("Could not cache pins", "error", err.Error())
+	}
+}
+
+// pinnedIDs returns the set of pinned message IDs. Messages are listed
+// without the flag rather than failing when the pins can't be read.
+func (a *API) pinnedIDs(ctx context.Context) map[string]bool {
+	pins, err := a.pins(ctx)
+	if err != nil {
+		LoggerFrom(ctx).Warn("Could not get pins, not flagging pinned messages", "error", err.Error())
+		return nil
+	}
+	out := make(map[string]bool, len(pins))
+	for _, p := range pins {
+		out[p.Message.ID] = true
+	}
+	return out
+}
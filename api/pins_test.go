@@ -0,0 +1,226 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/neilotoole/slogt"
+)
+
+func TestAPI_pins(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	stored := []Pin{
+		{
+			Message:  Message{ID: "1", Text: "hello", UserID: "alice", CreatedAt: created, Pinned: true},
+			PinnedBy: "bob",
+			PinnedAt: created.Add(time.Hour),
+		},
+	}
+	pinBody := `{
+		"message_id": "1",
+		"text": "hello",
+		"user_id": "alice",
+		"created_at": "Mon, 01 Jan 2024 00:00:00 UTC",
+		"pinned_by": "bob",
+		"pinned_at": "Mon, 01 Jan 2024 01:00:00 UTC"
+	}`
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		req        string
+		pinErr     error
+		cached     []Pin
+		wantStatus int
+		wantBody   string
+		wantCached bool
+	}{
+		{
+			name:       "Pin",
+			method:     "POST",
+			path:       "/messages/1/pin",
+			req:        `{"user_id": "bob"}`,
+			wantStatus: 200,
+			wantBody:   pinBody,
+			wantCached: true,
+		},
+		{
+			name:       "PinNotFound",
+			method:     "POST",
+			path:       "/messages/1/pin",
+			req:        `{"user_id": "bob"}`,
+			pinErr:     ErrMessageNotFound,
+			wantStatus: 404,
+			wantBody:   `{"error": "Message not found"}`,
+		},
+		{
+			name:       "Unpin",
+			method:     "DELETE",
+			path:       "/messages/1/pin",
+			wantStatus: 204,
+			wantCached: true,
+		},
+		{
+			name:       "UnpinNotPinned",
+			method:     "DELETE",
+			path:       "/messages/1/pin",
+			pinErr:     ErrPinNotFound,
+			wantStatus: 404,
+			wantBody:   `{"error": "Message is not pinned"}`,
+		},
+		{
+			name:       "ListFromDB",
+			method:     "GET",
+			path:       "/pins",
+			wantStatus: 200,
+			wantBody:   `{"pins": [` + pinBody + `]}`,
+			wantCached: true,
+		},
+		{
+			name:       "ListFromCache",
+			method:     "GET",
+			path:       "/pins",
+			cached:     []Pin{},
+			wantStatus: 200,
+			wantBody:   `{"pins": []}`,
+			wantCached: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := &testpins{pins: tt.cached}
+			api := &API{
+				Logger:   slogt.New(t),
+				Validate: &MockValidator{},
+				DB: &testdb{
+					T: t,
+					pinMessage: func(t *testing.T, messageID, userID string) (Pin, error) {
+						if messageID != "1" || userID != "bob" {
+							t.Errorf("Got PinMessage(%q, %q), want 1 and bob", messageID, userID)
+						}
+						return stored[0], tt.pinErr
+					},
+					unpinMessage: func(t *testing.T, messageID string) error {
+						if messageID != "1" {
+							t.Errorf("Got UnpinMessage(%q), want 1", messageID)
+						}
+						return tt.pinErr
+					},
+					listPins: func(t *testing.T) ([]Pin, error) {
+						if tt.cached != nil {
+							t.Error("Listed pins from DB, want them from cache")
+						}
+						return stored, nil
+					},
+				},
+				Pins: cache,
+			}
+			srv := httptest.NewServer(api)
+			defer srv.Close()
+
+			resp := doWithKey(t, tt.method, srv.URL+tt.path, "", tt.req)
+			checkStatus(t, resp.StatusCode, tt.wantStatus)
+			if tt.wantBody != "" {
+				checkBody(t, resp, tt.wantBody)
+			}
+			if got := cache.pins != nil; got != tt.wantCached {
+				t.Errorf("Got pins cached %t, want %t", got, tt.wantCached)
+			}
+		})
+	}
+}
+
+func TestAPI_listMessagesPinned(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		pins     *testpins
+		wantBody string
+	}{
+		{
+			name: "Pinned",
+			pins: &testpins{pins: []Pin{{Message: Message{ID: "1"}}}},
+			wantBody: `{"messages": [{
+				"id": "1",
+				"text": "hello",
+				"user_id": "alice",
+				"created_at": "Mon, 01 Jan 2024 00:00:00 UTC",
+				"message_reactions": [],
+				"pinned": true
+			}]}`,
+		},
+		{
+			name: "PinsUnavailable",
+			pins: &testpins{err: errors.New("connection refused")},
+			wantBody: `{"messages": [{
+				"id": "1",
+				"text": "hello",
+				"user_id": "alice",
+				"created_at": "Mon, 01 Jan 2024 00:00:00 UTC",
+				"message_reactions": []
+			}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &API{
+				Logger: slogt.New(t),
+				Cache: &testcache{
+					T: t,
+					listMessages: func(t *testing.T) ([]Message, error) {
+						return []Message{{ID: "1", Text: "hello", UserID: "alice", CreatedAt: created}}, nil
+					},
+				},
+				DB: &testdb{
+					T: t,
+					listMessages: func(t *testing.T, excludeMsgIDs ...string) ([]Message, error) {
+						return nil, nil
+					},
+					listPins: func(t *testing.T) ([]Pin, error) {
+						return nil, errors.New("connection refused")
+					},
+				},
+				Pins: tt.pins,
+			}
+			srv := httptest.NewServer(api)
+			defer srv.Close()
+
+			resp, err := http.Get(srv.URL + "/messages")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			checkStatus(t, resp.StatusCode, 200)
+			checkBody(t, resp, tt.wantBody)
+		})
+	}
+}
+
+// testpins is a PinCache, which has nothing cached while pins is nil.
+type testpins struct {
+	pins []Pin
+	err  error
+}
+
+func (c *testpins) ListPins(context.Context) ([]Pin, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	if c.pins == nil {
+		return nil, ErrPinsNotFoundInCache
+	}
+	return c.pins, nil
+}
+
+func (c *testpins) SetPins(_ context.Context, pins []Pin) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.pins = pins
+	return nil
+}
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A RateLimit allows Requests per Window, in bursts of up to Requests. The
+// zero value allows everything.
+type RateLimit struct {
+	Requests int
+	Window   time.Duration
+}
+
+func (l RateLimit) String() string {
+	return fmt.Sprintf("%d/%s", l.Requests, l.Window)
+}
+
+// A RateLimitRule limits the requests to a route per identity, the user or
+// API key a request is authenticated as, and per client IP.
+type RateLimitRule struct {
+	PerIdentity RateLimit
+	PerIP       RateLimit
+}
+
+// A RateLimitResult is the outcome of a RateLimiter taking a request.
+type RateLimitResult struct {
+	Allowed    bool
+	Remaining  int
+	RetryAfter time.Duration // until the next request is allowed, if not Allowed
+	Reset      time.Duration // until the limit is fully replenished
+}
+
+// rateLimitCheck is a limit applied to a request under a key.
+type rateLimitCheck struct {
+	key   string
+	limit RateLimit
+}
+
+// rateLimited applies the rule for the route, if any, before calling next. It
+// must run after authenticated so requests are limited by their identity.
+// When the RateLimiter fails, requests are let through.
+func (a *API) rateLimited(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		info, _ := r.Context().Value(requestInfoKey{}).(*requestInfo)
+		if a.RateLimiter == nil || info == nil {
+			next(w, r)
+			return
+		}
+		rule, ok := a.RateLimits[info.route]
+		if !ok {
+			next(w, r)
+			return
+		}
+
+		var checks []rateLimitCheck
+		if id := identity(r.Context()); id != "" && rule.PerIdentity.Requests > 0 {
+			checks = append(checks, rateLimitCheck{key: info.route + ":" + id, limit: rule.PerIdentity})
+		}
+		if rule.PerIP.Requests > 0 {
+			checks = append(checks, rateLimitCheck{key: info.route + ":ip:" + a.clientIP(r), limit: rule.PerIP})
+		}
+
+		for _, c := range checks {
+			res, err := a.RateLimiter.Allow(r.Context(), c.key, c.limit)
+			if err != nil {
+				LoggerFrom(r.Context()).Error("Could not check rate limit, allowing request", "error", err.Error())
+				continue
+			}
+			setRateLimitHeaders(w, c.limit, res)
+			if !res.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+				err := fmt.Errorf("rate limit %s exceeded for %s", c.limit, c.key)
+				a.respondError(w, r, http.StatusTooManyRequests, err, "Rate limit exceeded")
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// setRateLimitHeaders reports the limit. When several apply, the one closest
+// to being exceeded is reported.
+func setRateLimitHeaders(w http.ResponseWriter, limit RateLimit, res RateLimitResult) {
+	h := w.Header()
+	if prev, err := strconv.Atoi(h.Get("X-RateLimit-Remaining")); err == nil && prev <= res.Remaining {
+		return
+	}
+	h.Set("X-RateLimit-Limit", strconv.Itoa(limit.Requests))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	h.Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// identity returns who an authenticated request acts as, or "" if it was let
+// through without credentials.
+func identity(ctx context.Context) string {
+	if subject, ok := ctx.Value(subjectKey{}).(string); ok {
+		return "user:" + subject
+	}
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok && info.apiKey != "" {
+		return "key:" + info.apiKey
+	}
+	return ""
+}
+
+// clientIP returns the IP of the client. Behind a trusted proxy that is the
+// last address in X-Forwarded-For, the one the proxy added; any before it are
+// supplied by the client.
+func (a *API) clientIP(r *http.Request) string {
+	if a.TrustForwardedFor {
+		if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+			addrs := strings.Split(xff[len(xff)-1], ",")
+			if ip := strings.TrimSpace(addrs[len(addrs)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ParseRateLimits parses rate limit rules by route, such as
+//
+//	POST /messages=user:30/1m,ip:120/1m;POST /messages/{messageID}/reactions=user:120/1m
+//
+// where "user" limits each identity and "ip" each client IP.
+func ParseRateLimits(s string) (map[string]RateLimitRule, error) {
+	rules := make(map[string]RateLimitRule)
+	for _, spec := range strings.Split(s, ";") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		route, limits, ok := strings.Cut(spec, "=")
+		if !ok {
+			return nil, fmt.Errorf("rate limit %q: missing '='", spec)
+		}
+		var rule RateLimitRule
+		for _, l := range strings.Split(limits, ",") {
+			kind, value, ok := strings.Cut(strings.TrimSpace(l), ":")
+			if !ok {
+				return nil, fmt.Errorf("rate limit %q: missing ':' in %q", spec, l)
+			}
+			limit, err := parseRateLimit(value)
+			if err != nil {
+				return nil, fmt.Errorf("rate limit %q: %w", spec, err)
+			}
+			switch kind {
+			case "user":
+				rule.PerIdentity = limit
+			case "ip":
+				rule.PerIP = limit
+			default:
+				return nil, fmt.Errorf("rate limit %q: unknown kind %q", spec, kind)
+			}
+		}
+		rules[strings.TrimSpace(route)] = rule
+	}
+	return rules, nil
+}
+
+func parseRateLimit(s string) (RateLimit, error) {
+	n, window, ok := strings.Cut(s, "/")
+	if !ok {
+		return RateLimit{}, errors.New("limit must be requests/window")
+	}
+	requests, err := strconv.Atoi(n)
+	if err != nil || requests < 1 {
+		return RateLimit{}, fmt.Errorf("invalid number of requests %q", n)
+	}
+	d, err := time.ParseDuration(window)
+	if err != nil || d <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid window %q", window)
+	}
+	return RateLimit{Requests: requests, Window: d}, nil
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/neilotoole/slogt"
+)
+
+func TestAPI_rateLimited(t *testing.T) {
+	limiter := &testlimiter{taken: map[string]int{}}
+	api := &API{
+		Logger: slogt.New(t),
+		DB: &testdb{
+			T: t,
+			insertMessage: func(t *testing.T, msg Message) (Message, error) {
+				msg.ID = "1"
+				return msg, nil
+			},
+		},
+		Cache: &testcache{
+			T: t,
+			insertMessage: func(t *testing.T, msg Message) error {
+				return nil
+			},
+		},
+		Validate:    &MockValidator{},
+		Auth:        testauth{"alice-token": "alice", "bob-token": "bob"},
+		RateLimiter: limiter,
+		RateLimits: map[string]RateLimitRule{
+			"POST /messages": {
+				PerIdentity: RateLimit{Requests: 2, Window: time.Minute},
+				PerIP:       RateLimit{Requests: 3, Window: time.Minute},
+			},
+		},
+	}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	post := func(token string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest("POST", srv.URL+"/messages", strings.NewReader(`{"text": "hello"}`))
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	resp := post("alice-token")
+	checkStatus(t, resp.StatusCode, http.StatusCreated)
+	checkHeaders(t, resp, map[string]string{
+		"X-RateLimit-Limit":     "2",
+		"X-RateLimit-Remaining": "1",
+		"X-RateLimit-Reset":     "30",
+	})
+	post("alice-token")
+
+	resp = post("alice-token")
+	checkStatus(t, resp.StatusCode, http.StatusTooManyRequests)
+	checkHeaders(t, resp, map[string]string{
+		"Retry-After":           "30",
+		"X-RateLimit-Limit":     "2",
+		"X-RateLimit-Remaining": "0",
+	})
+
+	// Bob has a separate user limit, but shares the IP limit with Alice. The
+	// limit closest to being exceeded is reported.
+	resp = post("bob-token")
+	checkStatus(t, resp.StatusCode, http.StatusCreated)
+	checkHeaders(t, resp, map[string]string{
+		"X-RateLimit-Limit":     "3",
+		"X-RateLimit-Remaining": "0",
+	})
+	resp = post("bob-token")
+	checkStatus(t, resp.StatusCode, http.StatusTooManyRequests)
+
+	// Requests are let through when the limiter fails.
+	limiter.err = errors.New("connection refused")
+	resp = post("bob-token")
+	checkStatus(t, resp.StatusCode, http.StatusCreated)
+}
+
+func TestAPI_clientIP(t *testing.T) {
+	tests := []struct {
+		name  string
+		trust bool
+		xff   []string
+		want  string
+	}{
+		{
+			name: "RemoteAddr",
+			xff:  []string{"10.0.0.1"},
+			want: "192.0.2.1",
+		},
+		{
+			name:  "Proxy",
+			trust: true,
+			xff:   []string{"10.0.0.1", "203.0.113.5, 198.51.100.7"},
+			want:  "198.51.100.7",
+		},
+		{
+			name:  "NoHeader",
+			trust: true,
+			want:  "192.0.2.1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &API{TrustForwardedFor: tt.trust}
+			r := httptest.NewRequest("GET", "/", nil)
+			for _, v := range tt.xff {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if got := a.clientIP(r); got != tt.want {
+				t.Errorf("Got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRateLimits(t *testing.T) {
+	got, err := ParseRateLimits("POST /messages=user:30/1m,ip:120/1m; POST /messages/{messageID}/reactions=ip:5/1s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]RateLimitRule{
+		"POST /messages": {
+			PerIdentity: RateLimit{Requests: 30, Window: time.Minute},
+			PerIP:       RateLimit{Requests: 120, Window: time.Minute},
+		},
+		"POST /messages/{messageID}/reactions": {
+			PerIP: RateLimit{Requests: 5, Window: time.Second},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ParseRateLimits() mismatch (-want +got):\n%s", diff)
+	}
+
+	for _, s := range []string{
+		"POST /messages",
+		"POST /messages=user",
+		"POST /messages=user:30",
+		"POST /messages=user:0/1m",
+		"POST /messages=user:30/soon",
+		"POST /messages=group:30/1m",
+	} {
+		if _, err := ParseRateLimits(s); err == nil {
+			t.Errorf("ParseRateLimits(%q) succeeded, want error", s)
+		}
+	}
+}
+
+// testlimiter allows limit.Requests per key and reports half the window until
+// the next request.
+type testlimiter struct {
+	taken map[string]int
+	err   error
+}
+
+func (l *testlimiter) Allow(_ context.Context, key string, limit RateLimit) (RateLimitResult, error) {
+	if l.err != nil {
+		return RateLimitResult{}, l.err
+	}
+	l.taken[key]++
+	return RateLimitResult{
+		Allowed:    l.taken[key] <= limit.Requests,
+		Remaining:  max(limit.Requests-l.taken[key], 0),
+		RetryAfter: limit.Window / 2,
+		Reset:      limit.Window / 2,
+	}, nil
+}
+
+func checkHeaders(t *testing.T, resp *http.Response, want map[string]string) {
+	t.Helper()
+	for k, v := range want {
+		if got := resp.Header.Get(k); got != v {
+			t.Errorf("Got %s %q, want %q", k, got, v)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// readMarker represents the read marker DTO.
+type readMarker struct {
+	UserID    string `json:"user_id"`
+	MessageID string `json:"message_id"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+// markRead records that a user read the messages up to the one in the path.
+func (a *API) markRead(w http.ResponseWriter, r *http.Request) {
+	type request struct {
+		UserID string `json:"user_id" validate:"required"`
+	}
+
+	log := LoggerFrom(r.Context())
+	var body request
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		log.Warn("Error decoding request body", "error", err.Error())
+		a.respondError(w, r, http.StatusBadRequest, err, "Could not decode request body")
+		return
+	}
+	r.Body.Close()
+	userID, ok := a.authorizeAccount(w, r, body.UserID, ScopeAdmin)
+	if !ok {
+		return
+	}
+	body.UserID = userID
+	if err := a.Validate.Struct(body); err != nil {
+		a.respondError(w, r, http.StatusBadRequest, err, "Validation failed")
+		return
+	}
+	setUser(r.Context(), body.UserID)
+
+	marker, err := a.DB.MarkRead(r.Context(), body.UserID, r.PathValue("messageID"))
+	if errors.Is(err, ErrMessageNotFound) {
+		a.respondError(w, r, http.StatusNotFound, err, "Message not found")
+		return
+	}
+	if err != nil {
+		log.Error("Error marking message read in DB", "error", err.Error())
+		a.respondError(w, r, http.StatusInternalServerError, err, "Could not mark message read")
+		return
+	}
+	if a.ReadMarkers != nil {
+		if err := a.ReadMarkers.SetReadMarker(r.Context(), marker); err != nil {
+			log.Warn("Could not cache read marker", "error", err.Error())
+		}
+	}
+
+	a.respond(w, http.StatusOK, readMarker{
+		UserID:    marker.UserID,
+		MessageID: marker.MessageID,
+		UpdatedAt: marker.UpdatedAt.Format(time.RFC1123),
+	})
+}
+
+// unreadCounts responds with the number of messages and mentions a user has
+// not read.
+func (a *API) unreadCounts(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Messages      int    `json:"messages"`
+		Mentions      int    `json:"mentions"`
+		LastReadMsgID string `json:"last_read_message_id,omitempty"`
+	}
+
+	log := LoggerFrom(r.Context())
+	userID, ok := a.authorizeAccount(w, r, r.PathValue("userID"), ScopeAdmin)
+	if !ok {
+		return
+	}
+
+	marker, err := a.readMarker(r.Context(), userID)
+	if err != nil {
+		log.Error("Error getting read marker", "error", err.Error())
+		a.respondError(w, r, http.StatusInternalServerError, err, "Could not count unread messages")
+		return
+	}
+	counts, err := a.DB.CountUnread(r.Context(), userID, marker)
+	if err != nil {
+		log.Error("Error counting unread messages in DB", "error", err.Error())
+		a.respondError(w, r, http.StatusInternalServerError, err, "Could not count unread messages")
+		return
+	}
+
+	res := response{
+		Messages: counts.Messages,
+		Mentions: counts.Mentions,
+	}
+	if marker != nil {
+		res.LastReadMsgID = marker.MessageID
+	}
+	a.respond(w, http.StatusOK, res)
+}
+
+// readMarker returns the read marker of a user, trying the cache first, or
+// nil if they never read a message.
+func (a *API) readMarker(ctx context.Context, userID string) (*ReadMarker, error) {
+	log := LoggerFrom(ctx)
+	if a.ReadMarkers != nil {
+		marker, err := a.ReadMarkers.GetReadMarker(ctx, userID)
+		if err == nil {
+			return marker, nil
+		}
+		if !errors.Is(err, ErrReadMarkerNotFoundInCache) {
+			log.Warn("Error getting read marker from cache, trying database", "error", err.Error())
+		}
+	}
+
+	marker, err := a.DB.GetReadMarker(ctx, userID)
+	if errors.Is(err, ErrReadMarkerNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if a.ReadMarkers != nil {
+		if err := a.ReadMarkers.SetReadMarker(ctx, *marker); err != nil {
+			log.Warn("Could not cache read marker", "error", err.Error())
+		}
+	}
+	return marker, nil
+}
@@ -0,0 +1,259 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/neilotoole/slogt"
+)
+
+func TestAPI_markRead(t *testing.T) {
+	marker := ReadMarker{
+		UserID:           "bob",
+		MessageID:        "2",
+		MessageCreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		UpdatedAt:        time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+	}
+	tests := []struct {
+		name       string
+		path       string
+		req        string
+		scopes     []string // of an API key to send
+		err        error
+		wantStatus int
+		wantBody   string
+		wantCached bool
+	}{
+		{
+			name:       "OK",
+			path:       "/messages/1/read",
+			req:        `{"user_id": "bob"}`,
+			wantStatus: 200,
+			wantBody: `{
+				"user_id": "bob",
+				"message_id": "2",
+				"updated_at": "Tue, 02 Jan 2024 00:00:00 UTC"
+			}`,
+			wantCached: true,
+		},
+		{
+			name:       "NotFound",
+			path:       "/messages/1/read",
+			req:        `{"user_id": "bob"}`,
+			err:        ErrMessageNotFound,
+			wantStatus: 404,
+			wantBody:   `{"error": "Message not found"}`,
+		},
+		{
+			name:       "DBError",
+			path:       "/messages/1/read",
+			req:        `{"user_id": "bob"}`,
+			err:        errors.New("something went wrong"),
+			wantStatus: 500,
+			wantBody:   `{"error": "Could not mark message read"}`,
+		},
+		{
+			name:       "InvalidJSON",
+			path:       "/messages/1/read",
+			req:        `not json`,
+			wantStatus: 400,
+			wantBody:   `{"error": "Could not decode request body"}`,
+		},
+		{
+			name:       "APIKeyWithoutAdmin",
+			path:       "/messages/1/read",
+			req:        `{"user_id": "bob"}`,
+			scopes:     []string{ScopeMessagesWrite},
+			wantStatus: 403,
+			wantBody:   `{"error": "Missing scope admin"}`,
+		},
+		{
+			name:       "AdminAPIKey",
+			path:       "/messages/1/read",
+			req:        `{"user_id": "bob"}`,
+			scopes:     []string{ScopeAdmin},
+			wantStatus: 200,
+			wantBody: `{
+				"user_id": "bob",
+				"message_id": "2",
+				"updated_at": "Tue, 02 Jan 2024 00:00:00 UTC"
+			}`,
+			wantCached: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := testmarkers{}
+			keys := newTestKeys()
+			api := &API{
+				Logger:   slogt.New(t),
+				Validate: &MockValidator{},
+				DB: &testdb{
+					T: t,
+					markRead: func(t *testing.T, userID, messageID string) (ReadMarker, error) {
+						if userID != "bob" || messageID != "1" {
+							t.Errorf("Got MarkRead(%q, %q), want bob and 1", userID, messageID)
+						}
+						return marker, tt.err
+					},
+				},
+				ReadMarkers: cache,
+				APIKeys:     keys,
+			}
+			srv := httptest.NewServer(api)
+			defer srv.Close()
+
+			var key string
+			if tt.scopes != nil {
+				key = keys.add(t, tt.scopes, nil)
+			}
+			resp := doWithKey(t, "POST", srv.URL+tt.path, key, tt.req)
+			checkStatus(t, resp.StatusCode, tt.wantStatus)
+			checkBody(t, resp, tt.wantBody)
+			if _, ok := cache["bob"]; ok != tt.wantCached {
+				t.Errorf("Got marker cached %t, want %t", ok, tt.wantCached)
+			}
+		})
+	}
+}
+
+func TestAPI_unreadCounts(t *testing.T) {
+	marker := &ReadMarker{
+		UserID:           "bob",
+		MessageID:        "2",
+		MessageCreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	tests := []struct {
+		name       string
+		cached     *ReadMarker
+		stored     *ReadMarker
+		token      string
+		scopes     []string // of an API key to send instead of a token
+		wantMarker *ReadMarker
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "Cached",
+			cached:     marker,
+			token:      "bob-token",
+			wantMarker: marker,
+			wantStatus: 200,
+			wantBody:   `{"messages": 3, "mentions": 1, "last_read_message_id": "2"}`,
+		},
+		{
+			name:       "Stored",
+			stored:     marker,
+			token:      "bob-token",
+			wantMarker: marker,
+			wantStatus: 200,
+			wantBody:   `{"messages": 3, "mentions": 1, "last_read_message_id": "2"}`,
+		},
+		{
+			name:       "NeverRead",
+			token:      "bob-token",
+			wantStatus: 200,
+			wantBody:   `{"messages": 3, "mentions": 1}`,
+		},
+		{
+			name:       "OtherUser",
+			token:      "alice-token",
+			wantStatus: 403,
+			wantBody:   `{"error": "Cannot act on behalf of another user"}`,
+		},
+		{
+			name:       "APIKeyWithoutAdmin",
+			scopes:     []string{ScopeReactionsWrite},
+			wantStatus: 403,
+			wantBody:   `{"error": "Missing scope admin"}`,
+		},
+		{
+			name:       "AdminAPIKey",
+			stored:     marker,
+			scopes:     []string{ScopeAdmin},
+			wantMarker: marker,
+			wantStatus: 200,
+			wantBody:   `{"messages": 3, "mentions": 1, "last_read_message_id": "2"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys := newTestKeys()
+			cache := testmarkers{}
+			if tt.cached != nil {
+				cache["bob"] = *tt.cached
+			}
+			api := &API{
+				Logger: slogt.New(t),
+				DB: &testdb{
+					T: t,
+					getReadMarker: func(t *testing.T, userID string) (*ReadMarker, error) {
+						if tt.cached != nil {
+							t.Error("Got read marker from DB, want it from cache")
+						}
+						if tt.stored == nil {
+							return nil, ErrReadMarkerNotFound
+						}
+						return tt.stored, nil
+					},
+					countUnread: func(t *testing.T, userID string, marker *ReadMarker) (UnreadCounts, error) {
+						if diff := cmp.Diff(tt.wantMarker, marker); diff != "" {
+							t.Errorf("CountUnread() marker mismatch (-want +got):\n%s", diff)
+						}
+						return UnreadCounts{Messages: 3, Mentions: 1}, nil
+					},
+				},
+				ReadMarkers: cache,
+				Auth:        testauth{"alice-token": "alice", "bob-token": "bob"},
+				APIKeys:     keys,
+			}
+			srv := httptest.NewServer(api)
+			defer srv.Close()
+
+			req, _ := http.NewRequest("GET", srv.URL+"/users/bob/unread", nil)
+			if tt.scopes != nil {
+				req.Header.Set(apiKeyHeader, keys.add(t, tt.scopes, nil))
+			} else {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			checkStatus(t, resp.StatusCode, tt.wantStatus)
+			checkBody(t, resp, tt.wantBody)
+			if tt.stored != nil {
+				if _, ok := cache["bob"]; !ok {
+					t.Error("Stored marker was not cached")
+				}
+			}
+		})
+	}
+}
+
+// testmarkers is a ReadMarkerCache keyed by user.
+type testmarkers map[string]ReadMarker
+
+func (c testmarkers) GetReadMarker(_ context.Context, userID string) (*ReadMarker, error) {
+	m, ok := c[userID]
+	if !ok {
+		return nil, ErrReadMarkerNotFoundInCache
+	}
+	return &m, nil
+}
+
+func (c testmarkers) SetReadMarker(_ context.Context, marker ReadMarker) error {
+	c[marker.UserID] = marker
+	return nil
+}
+
+func (c testmarkers) DeleteReadMarker(_ context.Context, userID string) error {
+	delete(c, userID)
+	return nil
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const replayBatchSize = 100
+
+// A Replayer moves writes buffered in a Queue into the DB once it is
+// reachable again. Writes are applied in the order they were queued; a write
+// the DB cannot take because it is still unavailable stays at the head of
+// the queue and is retried on the next tick.
+type Replayer struct {
+	Logger   *slog.Logger
+	DB       DB
+	Queue    Queue
+	Interval time.Duration
+}
+
+// Run replays queued writes every Interval until ctx is cancelled.
+func (r *Replayer) Run(ctx context.Context) {
+	t := time.NewTicker(r.Interval)
+	defer t.Stop()
+	for {
+		if err := r.Replay(ctx); err != nil {
+			r.Logger.Warn("Could not replay queued writes", "error", err.Error())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Replay applies pending writes until the queue is drained or the DB becomes
+// unavailable. Writes the DB rejects for any other reason, such as a
+// duplicate reaction, are logged and dropped.
+func (r *Replayer) Replay(ctx context.Context) error {
+	for {
+		writes, err := r.Queue.Pending(ctx, replayBatchSize)
+		if err != nil {
+			return fmt.Errorf("pending: %w", err)
+		}
+		if len(writes) == 0 {
+			return nil
+		}
+		for _, w := range writes {
+			if err := r.apply(ctx, w); err != nil {
+				if errors.Is(err, ErrDBUnavailable) || ctx.Err() != nil {
+					return err
+				}
+				r.Logger.Error("Dropping queued write", "id", w.ID, "error", err.Error())
+			}
+			if err := r.Queue.Ack(ctx, w.ID); err != nil {
+				return fmt.Errorf("ack: %w", err)
+			}
+		}
+		r.Logger.Info("Replayed queued writes", "count", len(writes))
+	}
+}
+
+func (r *Replayer) apply(ctx context.Context, w QueuedWrite) error {
+	switch {
+	case w.Message != nil:
+		_, err := r.DB.InsertMessage(ctx, *w.Message)
+		return err
+	case w.Reaction != nil:
+		_, err := r.DB.InsertReaction(ctx, *w.Reaction)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/neilotoole/slogt"
+)
+
+func TestReplayer_Replay(t *testing.T) {
+	tests := []struct {
+		name      string
+		queued    []QueuedWrite
+		insertErr map[string]error // by message or reaction ID
+		wantErr   error
+		wantAcked []string
+		wantDB    []string
+	}{
+		{
+			name: "Empty",
+		},
+		{
+			name: "InOrder",
+			queued: []QueuedWrite{
+				{ID: "1-0", Message: &Message{ID: "m1"}},
+				{ID: "2-0", Reaction: &Reaction{ID: "r1", MessageID: "m1"}},
+				{ID: "3-0", Message: &Message{ID: "m2"}},
+			},
+			wantAcked: []string{"1-0", "2-0", "3-0"},
+			wantDB:    []string{"m1", "r1", "m2"},
+		},
+		{
+			name: "StopsWhenUnavailable",
+			queued: []QueuedWrite{
+				{ID: "1-0", Message: &Message{ID: "m1"}},
+				{ID: "2-0", Message: &Message{ID: "m2"}},
+				{ID: "3-0", Message: &Message{ID: "m3"}},
+			},
+			insertErr: map[string]error{
+				"m2": fmt.Errorf("insert: %w", ErrDBUnavailable),
+			},
+			wantErr:   ErrDBUnavailable,
+			wantAcked: []string{"1-0"},
+			wantDB:    []string{"m1"},
+		},
+		{
+			name: "DropsRejected",
+			queued: []QueuedWrite{
+				{ID: "1-0", Reaction: &Reaction{ID: "r1"}},
+				{ID: "2-0", Message: &Message{ID: "m1"}},
+			},
+			insertErr: map[string]error{
+				"r1": errors.New("duplicate reaction"),
+			},
+			wantAcked: []string{"1-0", "2-0"},
+			wantDB:    []string{"m1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queued := tt.queued
+			var acked, inserted []string
+			insert := func(id string) error {
+				if err := tt.insertErr[id]; err != nil {
+					return err
+				}
+				inserted = append(inserted, id)
+				return nil
+			}
+			r := &Replayer{
+				Logger: slogt.New(t),
+				DB: &testdb{
+					T: t,
+					insertMessage: func(t *testing.T, msg Message) (Message, error) {
+						return msg, insert(msg.ID)
+					},
+					insertReaction: func(t *testing.T, reaction Reaction) (Reaction, error) {
+						return reaction, insert(reaction.ID)
+					},
+				},
+				Queue: &testqueue{
+					T: t,
+					pending: func(t *testing.T, count int) ([]QueuedWrite, error) {
+						return queued[:min(count, len(queued))], nil
+					},
+					ack: func(t *testing.T, id string) error {
+						if queued[0].ID != id {
+							t.Fatalf("Acked %q, want head of queue %q", id, queued[0].ID)
+						}
+						queued = queued[1:]
+						acked = append(acked, id)
+						return nil
+					},
+				},
+			}
+
+			err := r.Replay(context.Background())
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Got error %v, want %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(acked, tt.wantAcked); diff != "" {
+				t.Errorf("Acked diff (-got +want)\n%s", diff)
+			}
+			if diff := cmp.Diff(inserted, tt.wantDB); diff != "" {
+				t.Errorf("Inserted diff (-got +want)\n%s", diff)
+			}
+		})
+	}
+}
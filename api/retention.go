@@ -0,0 +1,219 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+const (
+	defaultRetentionBatchSize = 100
+	defaultArchiveSize        = 10000
+)
+
+// A Retainer deletes the messages older than MaxAge in the background, a
+// small batch per transaction so deletes don't hold locks for long. With
+// Archive, the messages are first written to Blobs as gzipped NDJSON, one
+// message per line, and only deleted once their archive is stored. A run
+// that fails between the two archives the messages left again on the next
+// one, so a message may be in two archives but is never lost.
+//
+// Archives record the users whose messages or mentions they hold, and an
+// Eraser rewrites them when it erases one of those users. Archives are kept
+// until deleted from Blobs.
+//
+// Messages have no channel, so there are no per-channel overrides: MaxAge
+// applies to every message.
+type Retainer struct {
+	Logger      *slog.Logger
+	Store       RetentionStore
+	Cache       Cache
+	Pins        PinCache      // optional, refreshed from DB when messages are deleted
+	DB          DB            // lists the pins to cache, required with Pins
+	Blobs       BlobStore     // holds the contents of attachments and, with Archive, the archives
+	MaxAge      time.Duration // how long messages are kept
+	Archive     bool          // archive messages to Blobs before deleting them
+	Interval    time.Duration // how often to look for expired messages
+	BatchSize   int           // messages deleted per transaction, defaults to 100
+	ArchiveSize int           // messages per archive, defaults to 10000
+}
+
+// Run deletes expired messages every Interval until ctx is cancelled.
+func (r *Retainer) Run(ctx context.Context) {
+	tick := time.NewTicker(r.Interval)
+	defer tick.Stop()
+	for {
+		if err := r.Process(ctx); err != nil {
+			r.Logger.Warn("Could not enforce message retention", "error", err.Error())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+// Process deletes, and archives first if enabled, the messages that are
+// older than MaxAge now until none are left.
+func (r *Retainer) Process(ctx context.Context) error {
+	cutoff := time.Now().Add(-r.MaxAge)
+	size := r.BatchSize
+	if size == 0 {
+		size = defaultRetentionBatchSize
+	}
+	archiveSize := r.ArchiveSize
+	if archiveSize == 0 {
+		archiveSize = defaultArchiveSize
+	}
+	if !r.Archive {
+		archiveSize = size
+	}
+
+	for {
+		msgs, err := r.expired(ctx, cutoff, size, archiveSize)
+		if err != nil {
+			return err
+		}
+		if len(msgs) == 0 {
+			return nil
+		}
+		if r.Archive {
+			if err := r.archive(ctx, msgs); err != nil {
+				return err
+			}
+		}
+		for i := 0; i < len(msgs); i += size {
+			batch := msgs[i:min(i+size, len(msgs))]
+			ids := make([]string, len(batch))
+			for j, m := range batch {
+				ids[j] = m.ID
+			}
+			keys, err := r.Store.DeleteMessages(ctx, ids)
+			if err != nil {
+				return fmt.Errorf("delete: %w", err)
+			}
+			purger{cache: r.Cache, pins: r.Pins, db: r.DB, blobs: r.Blobs}.purge(ctx, r.Logger, ids, keys)
+		}
+		r.Logger.Info("Deleted expired messages", "messages", len(msgs), "cutoff", cutoff)
+		if len(msgs) < archiveSize {
+			return nil
+		}
+	}
+}
+
+// expired returns up to limit of the oldest messages created before cutoff,
+// reading them a batch at a time.
+func (r *Retainer) expired(ctx context.Context, cutoff time.Time, size, limit int) ([]Message, error) {
+	var msgs []Message
+	for len(msgs) < limit {
+		var after *Message
+		if len(msgs) > 0 {
+			after = &msgs[len(msgs)-1]
+		}
+		n := min(size, limit-len(msgs))
+		page, err := r.Store.ExpiredMessages(ctx, cutoff, after, n)
+		if err != nil {
+			return nil, fmt.Errorf("list expired: %w", err)
+		}
+		msgs = append(msgs, page...)
+		if len(page) < n {
+			break
+		}
+	}
+	return msgs, nil
+}
+
+// archive stores the messages in one archive, named after the first of them
+// so that archives sort by age, and records whose data it holds.
+func (r *Retainer) archive(ctx context.Context, msgs []Message) error {
+	first := msgs[0]
+	key := fmt.Sprintf("archives/messages/%s_%s.ndjson.gz", first.CreatedAt.UTC().Format("20060102T150405Z"), first.ID)
+	if err := putArchive(ctx, r.Blobs, key, toMessage(msgs)); err != nil {
+		return err
+	}
+	var users []string
+	for _, m := range msgs {
+		users = append(users, m.UserID)
+		users = append(users, m.Mentions...)
+	}
+	slices.Sort(users)
+	if err := r.Store.InsertArchive(ctx, key, slices.Compact(users)); err != nil {
+		return fmt.Errorf("record archive %s: %w", key, err)
+	}
+	r.Logger.Info("Archived expired messages", "key", key, "messages", len(msgs))
+	return nil
+}
+
+// putArchive stores the messages under key as gzipped NDJSON.
+func putArchive(ctx context.Context, blobs BlobStore, key string, msgs []message) error {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	enc := json.NewEncoder(zw)
+	for _, m := range msgs {
+		if err := enc.Encode(m); err != nil {
+			return fmt.Errorf("encode: %w", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("compress: %w", err)
+	}
+	if err := blobs.Put(ctx, key, &buf, int64(buf.Len()), "application/gzip"); err != nil {
+		return fmt.Errorf("store archive %s: %w", key, err)
+	}
+	return nil
+}
+
+// eraseArchive rewrites the archive under key the way the job erases the
+// database: the messages of the job's user are deleted, or blanked and handed
+// to the pseudonym, and their mentions dropped. An archive left empty is
+// deleted.
+func eraseArchive(ctx context.Context, blobs BlobStore, key string, job ErasureJob) error {
+	rc, err := blobs.Get(ctx, key)
+	if errors.Is(err, ErrBlobNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("get: %w", err)
+	}
+	defer rc.Close()
+	zr, err := gzip.NewReader(rc)
+	if err != nil {
+		return fmt.Errorf("decompress: %w", err)
+	}
+	var msgs []message
+	dec := json.NewDecoder(zr)
+	for {
+		var m message
+		err := dec.Decode(&m)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("decode: %w", err)
+		}
+		if m.UserID == job.UserID {
+			if job.Mode == ErasureDelete {
+				continue
+			}
+			m.Text, m.Format, m.HTML = "", "", ""
+			m.UserID = job.Pseudonym
+			m.Mentions, m.Attachments = nil, nil
+		}
+		m.Mentions = slices.DeleteFunc(m.Mentions, func(mn mention) bool {
+			return mn.UserID == job.UserID
+		})
+		msgs = append(msgs, m)
+	}
+	if len(msgs) == 0 {
+		return blobs.Delete(ctx, key)
+	}
+	return putArchive(ctx, blobs, key, msgs)
+}
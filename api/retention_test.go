@@ -0,0 +1,218 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/neilotoole/slogt"
+)
+
+func TestRetainer_Process(t *testing.T) {
+	old := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name         string
+		archive      bool
+		wantArchives map[string][]string // message IDs by key
+		wantUsers    map[string][]string // users recorded by key
+	}{
+		{
+			name: "Delete",
+		},
+		{
+			name:    "Archive",
+			archive: true,
+			wantArchives: map[string][]string{
+				"archives/messages/20240101T000000Z_1.ndjson.gz": {"1", "2", "3"},
+				"archives/messages/20240101T000300Z_4.ndjson.gz": {"4", "5"},
+			},
+			wantUsers: map[string][]string{
+				"archives/messages/20240101T000000Z_1.ndjson.gz": {"alice", "bob"},
+				"archives/messages/20240101T000300Z_4.ndjson.gz": {"alice"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &testretention{}
+			for i := range 5 {
+				store.msgs = append(store.msgs, Message{
+					ID:        strconv.Itoa(i + 1),
+					Text:      "old",
+					UserID:    "alice",
+					CreatedAt: old.Add(time.Duration(i) * time.Minute),
+				})
+			}
+			store.msgs[0].Attachments = []Attachment{{ID: "a1", Key: "attachments/a1"}}
+			store.msgs[1].Text = "old @bob"
+			store.msgs[1].Mentions = []string{"bob"}
+			store.msgs = append(store.msgs, Message{ID: "6", Text: "new", UserID: "alice", CreatedAt: time.Now()})
+			blobs := testblobs{"attachments/a1": []byte("a")}
+			var evicted []string
+			r := &Retainer{
+				Logger: slogt.New(t),
+				Store:  store,
+				Cache: &testcache{
+					T: t,
+					deleteMessage: func(t *testing.T, id string) error {
+						evicted = append(evicted, id)
+						return nil
+					},
+				},
+				Blobs:       blobs,
+				MaxAge:      24 * time.Hour,
+				Archive:     tt.archive,
+				BatchSize:   2,
+				ArchiveSize: 3,
+			}
+
+			if err := r.Process(context.Background()); err != nil {
+				t.Fatalf("Process: %v", err)
+			}
+			if len(store.msgs) != 1 || store.msgs[0].ID != "6" {
+				t.Errorf("Got messages %+v left, want only the new one", store.msgs)
+			}
+			for _, b := range store.deleted {
+				if len(b) > 2 {
+					t.Errorf("Got batch %v, want at most 2 messages per batch", b)
+				}
+			}
+			if want := []string{"1", "2", "3", "4", "5"}; !slices.Equal(evicted, want) {
+				t.Errorf("Got evicted %v, want %v", evicted, want)
+			}
+			if _, ok := blobs["attachments/a1"]; ok {
+				t.Error("Kept the contents of a deleted attachment")
+			}
+
+			archives := map[string][]string{}
+			for key, data := range blobs {
+				archives[key] = readArchive(t, data)
+			}
+			if len(tt.wantArchives) == 0 && len(archives) != 0 {
+				t.Errorf("Got archives %v, want none", archives)
+			}
+			for key, want := range tt.wantArchives {
+				if got := archives[key]; !slices.Equal(got, want) {
+					t.Errorf("Got %s with %v, want %v", key, got, want)
+				}
+			}
+			if diff := cmp.Diff(tt.wantUsers, store.archives); diff != "" {
+				t.Errorf("Archive users mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRetainer_Process_archiveError(t *testing.T) {
+	// Messages are only deleted once their archive is stored.
+	store := &testretention{msgs: []Message{{ID: "1", CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}}}
+	r := &Retainer{
+		Logger:  slogt.New(t),
+		Store:   store,
+		Cache:   &testcache{T: t},
+		Blobs:   failingblobs{},
+		MaxAge:  time.Hour,
+		Archive: true,
+	}
+	if err := r.Process(context.Background()); err == nil {
+		t.Fatal("Process succeeded, want the archive error")
+	}
+	if len(store.msgs) != 1 {
+		t.Errorf("Got %d messages left, want the message kept", len(store.msgs))
+	}
+}
+
+// readArchive returns the IDs of the messages in a gzipped NDJSON archive.
+func readArchive(t *testing.T, data []byte) []string {
+	t.Helper()
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Archive is not gzipped: %v", err)
+	}
+	var ids []string
+	sc := bufio.NewScanner(zr)
+	for sc.Scan() {
+		var m message
+		if err := json.Unmarshal(sc.Bytes(), &m); err != nil {
+			t.Fatalf("Archive line %q is not a message: %v", sc.Text(), err)
+		}
+		ids = append(ids, m.ID)
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+// testretention is a RetentionStore of messages kept in a slice, oldest
+// first, recording the batches it deleted.
+type testretention struct {
+	msgs     []Message
+	deleted  [][]string
+	archives map[string][]string // users by archive key
+}
+
+func (s *testretention) ExpiredMessages(_ context.Context, cutoff time.Time, after *Message, limit int) ([]Message, error) {
+	start := 0
+	if after != nil {
+		start = sort.Search(len(s.msgs), func(i int) bool {
+			return s.msgs[i].CreatedAt.After(after.CreatedAt)
+		})
+	}
+	var out []Message
+	for _, m := range s.msgs[start:] {
+		if len(out) == limit || !m.CreatedAt.Before(cutoff) {
+			break
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+func (s *testretention) DeleteMessages(_ context.Context, ids []string) ([]string, error) {
+	s.deleted = append(s.deleted, ids)
+	var keys []string
+	s.msgs = slices.DeleteFunc(s.msgs, func(m Message) bool {
+		if !slices.Contains(ids, m.ID) {
+			return false
+		}
+		for _, a := range m.Attachments {
+			keys = append(keys, a.Key)
+		}
+		return true
+	})
+	return keys, nil
+}
+
+func (s *testretention) InsertArchive(_ context.Context, key string, userIDs []string) error {
+	if s.archives == nil {
+		s.archives = map[string][]string{}
+	}
+	s.archives[key] = append(s.archives[key], userIDs...)
+	return nil
+}
+
+// failingblobs is a BlobStore that can't store anything.
+type failingblobs struct{}
+
+func (failingblobs) Put(context.Context, string, io.Reader, int64, string) error {
+	return errors.New("disk full")
+}
+
+func (failingblobs) Get(context.Context, string) (io.ReadCloser, error) {
+	return nil, ErrBlobNotFound
+}
+
+func (failingblobs) Delete(context.Context, string) error {
+	return nil
+}
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxSearchLimit = 100
+
+// searchResult represents the search result DTO.
+type searchResult struct {
+	message
+	Rank    float32 `json:"rank"`
+	Snippet string  `json:"snippet"` // HTML, with the matches in <mark> elements
+}
+
+func (a *API) searchMessages(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Results    []searchResult `json:"results"`
+		NextCursor string         `json:"next_cursor,omitempty"`
+	}
+
+	log := LoggerFrom(r.Context())
+	q, err := parseSearchQuery(r)
+	if err != nil {
+		a.respondError(w, r, http.StatusBadRequest, err, err.Error())
+		return
+	}
+
+	// Ask for one more than a page to know whether there is a next one.
+	limit := q.Limit
+	q.Limit++
+	results, err := a.DB.SearchMessages(r.Context(), q)
+	if err != nil {
+		log.Error("Error searching messages in DB", "error", err.Error())
+		a.respondError(w, r, http.StatusInternalServerError, err, "Could not search messages")
+		return
+	}
+	log.Info("Searched messages", "count", len(results))
+
+	var res response
+	if len(results) > limit {
+		results = results[:limit]
+		last := results[limit-1]
+		res.NextCursor = encodeSearchCursor(SearchCursor{
+			Rank:      last.Rank,
+			CreatedAt: last.CreatedAt,
+			ID:        last.ID,
+		})
+	}
+	pinned := a.pinnedIDs(r.Context())
+	authors := make([]string, len(results))
+	for i, result := range results {
+		authors[i] = result.UserID
+	}
+	users := a.loadUsers(r.Context(), authors)
+	res.Results = make([]searchResult, len(results))
+	for i, result := range results {
+		result.Pinned = pinned[result.ID]
+		res.Results[i] = searchResult{
+			message: toMessage([]Message{result.Message})[0],
+			Rank:    result.Rank,
+			Snippet: highlight(result.Snippet),
+		}
+		res.Results[i].User = toUser(users[result.UserID])
+	}
+	a.respond(w, http.StatusOK, res)
+}
+
+// parseSearchQuery reads the search from the query string. Its errors are
+// meant for the client.
+func parseSearchQuery(r *http.Request) (SearchQuery, error) {
+	params := r.URL.Query()
+	q := SearchQuery{
+		Text:   strings.TrimSpace(params.Get("q")),
+		UserID: params.Get("user_id"),
+		Limit:  pageSize,
+	}
+	if q.Text == "" {
+		return SearchQuery{}, errors.New("Missing search query")
+	}
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{
+		{"since", &q.Since},
+		{"until", &q.Until},
+	} {
+		v := params.Get(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return SearchQuery{}, fmt.Errorf("Invalid %s, want an RFC 3339 time", p.name)
+		}
+		*p.dst = t
+	}
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxSearchLimit {
+			return SearchQuery{}, fmt.Errorf("Invalid limit, want 1 to %d", maxSearchLimit)
+		}
+		q.Limit = limit
+	}
+	if v := params.Get("cursor"); v != "" {
+		c, err := decodeSearchCursor(v)
+		if err != nil {
+			return SearchQuery{}, errors.New("Invalid cursor")
+		}
+		q.After = &c
+	}
+	return q, nil
+}
+
+// searchCursor is the encoded form of a SearchCursor.
+type searchCursor struct {
+	Rank      float32   `json:"r"`
+	CreatedAt time.Time `json:"t"`
+	ID        string    `json:"id"`
+}
+
+func encodeSearchCursor(c SearchCursor) string {
+	b, _ := json.Marshal(searchCursor(c))
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeSearchCursor(s string) (SearchCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return SearchCursor{}, err
+	}
+	var c searchCursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return SearchCursor{}, err
+	}
+	if c.ID == "" {
+		return SearchCursor{}, errors.New("cursor without id")
+	}
+	return SearchCursor(c), nil
+}
+
+// highlight turns a snippet into HTML, marking up the matches.
+func highlight(snippet string) string {
+	return strings.NewReplacer(
+		HighlightStart, "<mark>",
+		HighlightEnd, "</mark>",
+	).Replace(html.EscapeString(snippet))
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/neilotoole/slogt"
+)
+
+func TestAPI_searchMessages(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	results := []SearchResult{
+		{
+			Message: Message{ID: "1", Text: "<b>hello</b> world", UserID: "alice", CreatedAt: created},
+			Rank:    0.5,
+			Snippet: "<b>" + HighlightStart + "hello" + HighlightEnd + "</b> world",
+		},
+		{
+			Message: Message{ID: "2", Text: "hello again", UserID: "alice", CreatedAt: created},
+			Rank:    0.25,
+			Snippet: HighlightStart + "hello" + HighlightEnd + " again",
+		},
+	}
+	cursor := encodeSearchCursor(SearchCursor{Rank: 0.5, CreatedAt: created, ID: "1"})
+
+	tests := []struct {
+		name       string
+		query      string
+		results    []SearchResult
+		wantQuery  SearchQuery
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "MissingQuery",
+			query:      "q=+",
+			wantStatus: 400,
+			wantBody:   `{"error": "Missing search query"}`,
+		},
+		{
+			name:       "InvalidSince",
+			query:      "q=hello&since=yesterday",
+			wantStatus: 400,
+			wantBody:   `{"error": "Invalid since, want an RFC 3339 time"}`,
+		},
+		{
+			name:       "InvalidLimit",
+			query:      "q=hello&limit=1000",
+			wantStatus: 400,
+			wantBody:   `{"error": "Invalid limit, want 1 to 100"}`,
+		},
+		{
+			name:       "InvalidCursor",
+			query:      "q=hello&cursor=abc",
+			wantStatus: 400,
+			wantBody:   `{"error": "Invalid cursor"}`,
+		},
+		{
+			name:    "LastPage",
+			query:   "q=hello&user_id=alice&since=2024-01-01T00:00:00Z&until=2024-02-01T00:00:00Z",
+			results: results[1:],
+			wantQuery: SearchQuery{
+				Text:   "hello",
+				UserID: "alice",
+				Since:  created,
+				Until:  created.AddDate(0, 1, 0),
+				Limit:  pageSize + 1,
+			},
+			wantStatus: 200,
+			wantBody: `{
+				"results": [
+					{
+						"id": "2",
+						"text": "hello again",
+						"user_id": "alice",
+						"created_at": "Mon, 01 Jan 2024 00:00:00 UTC",
+						"message_reactions": [],
+						"rank": 0.25,
+						"snippet": "\u003cmark\u003ehello\u003c/mark\u003e again"
+					}
+				]
+			}`,
+		},
+		{
+			name:       "NextPage",
+			query:      "q=hello&limit=1",
+			results:    results,
+			wantQuery:  SearchQuery{Text: "hello", Limit: 2},
+			wantStatus: 200,
+			wantBody: `{
+				"results": [
+					{
+						"id": "1",
+						"text": "\u003cb\u003ehello\u003c/b\u003e world",
+						"user_id": "alice",
+						"created_at": "Mon, 01 Jan 2024 00:00:00 UTC",
+						"message_reactions": [],
+						"rank": 0.5,
+						"snippet": "\u0026lt;b\u0026gt;\u003cmark\u003ehello\u003c/mark\u003e\u0026lt;/b\u0026gt; world"
+					}
+				],
+				"next_cursor": "` + cursor + `"
+			}`,
+		},
+		{
+			name:       "Cursor",
+			query:      "q=hello&cursor=" + cursor,
+			results:    results[1:],
+			wantQuery:  SearchQuery{Text: "hello", Limit: pageSize + 1, After: &SearchCursor{Rank: 0.5, CreatedAt: created, ID: "1"}},
+			wantStatus: 200,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &API{
+				Logger: slogt.New(t),
+				DB: &testdb{
+					T: t,
+					searchMessages: func(t *testing.T, q SearchQuery) ([]SearchResult, error) {
+						if diff := cmp.Diff(tt.wantQuery, q); diff != "" {
+							t.Errorf("SearchMessages() query mismatch (-want +got):\n%s", diff)
+						}
+						return tt.results, nil
+					},
+				},
+			}
+			srv := httptest.NewServer(api)
+			defer srv.Close()
+
+			u, _ := url.Parse(srv.URL + "/messages/search")
+			u.RawQuery = tt.query
+			resp, err := http.Get(u.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkStatus(t, resp.StatusCode, tt.wantStatus)
+			if tt.wantBody != "" {
+				checkBody(t, resp, tt.wantBody)
+			}
+		})
+	}
+}
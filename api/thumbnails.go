@@ -0,0 +1,256 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // registered for image.Decode
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log/slog"
+	"mime"
+	"time"
+)
+
+const (
+	thumbnailBatchSize = 10
+	// thumbnailLease is how long a claimed job has to finish before another
+	// worker may claim it.
+	thumbnailLease = 5 * time.Minute
+	// maxThumbnailPixels bounds the images that are decoded, since a small
+	// file can claim to be a huge image.
+	maxThumbnailPixels = 50_000_000
+	thumbnailQuality   = 85
+)
+
+var defaultThumbnailSizes = []int{160, 480}
+
+// errBadImage is returned for images that can't be decoded, which retrying
+// won't fix.
+var errBadImage = errors.New("bad image")
+
+// canThumbnail reports whether thumbnails can be generated for a type.
+func canThumbnail(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "image/png", "image/jpeg", "image/gif":
+		return true
+	}
+	return false
+}
+
+// A Thumbnailer generates the thumbnails of uploaded images in the
+// background. Each one is stored next to the original, under its key
+// followed by the size. Jobs that fail are retried with a growing delay,
+// except for images that can't be decoded.
+type Thumbnailer struct {
+	Logger      *slog.Logger
+	Store       ThumbnailStore
+	Blobs       BlobStore
+	Cache       Cache         // optional, cached messages get the thumbnails too
+	Sizes       []int         // longest side of each thumbnail, defaults to 160 and 480 pixels
+	Interval    time.Duration // how often to look for jobs
+	MaxAttempts int           // defaults to 5
+}
+
+// Run processes thumbnail jobs every Interval until ctx is cancelled.
+func (t *Thumbnailer) Run(ctx context.Context) {
+	tick := time.NewTicker(t.Interval)
+	defer tick.Stop()
+	for {
+		if err := t.Process(ctx); err != nil {
+			t.Logger.Warn("Could not process thumbnail jobs", "error", err.Error())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+// Process runs the jobs that are due until none are left.
+func (t *Thumbnailer) Process(ctx context.Context) error {
+	for {
+		jobs, err := t.Store.ClaimThumbnailJobs(ctx, thumbnailBatchSize, thumbnailLease)
+		if err != nil {
+			return fmt.Errorf("claim: %w", err)
+		}
+		if len(jobs) == 0 {
+			return nil
+		}
+		for _, job := range jobs {
+			if err := t.process(ctx, job); err != nil {
+				if ctx.Err() != nil {
+					// The job is claimed again once its lease runs out.
+					return ctx.Err()
+				}
+				t.fail(ctx, job, err)
+			}
+		}
+	}
+}
+
+func (t *Thumbnailer) process(ctx context.Context, job ThumbnailJob) error {
+	thumbs, err := t.generate(ctx, job.Attachment)
+	if err != nil {
+		return err
+	}
+	att, err := t.Store.CompleteThumbnailJob(ctx, job.Attachment.ID, thumbs)
+	if err != nil {
+		return fmt.Errorf("complete: %w", err)
+	}
+	t.Logger.Info("Generated thumbnails", "attachment_id", att.ID, "count", len(thumbs))
+	if att.MessageID != "" && t.Cache != nil {
+		t.updateCache(ctx, att)
+	}
+	return nil
+}
+
+func (t *Thumbnailer) fail(ctx context.Context, job ThumbnailJob, jobErr error) {
+	maxAttempts := t.MaxAttempts
+	if maxAttempts == 0 {
+		maxAttempts = 5
+	}
+	log := t.Logger.With("attachment_id", job.Attachment.ID, "attempts", job.Attempts, "error", jobErr.Error())
+	var retryAfter time.Duration
+	if errors.Is(jobErr, errBadImage) || errors.Is(jobErr, ErrBlobNotFound) || job.Attempts >= maxAttempts {
+		log.Error("Giving up on thumbnails")
+	} else {
+		retryAfter = min(time.Minute<<(job.Attempts-1), time.Hour)
+		log.Warn("Could not generate thumbnails, will retry", "retry_after", retryAfter.String())
+	}
+	if err := t.Store.FailThumbnailJob(ctx, job.Attachment.ID, jobErr, retryAfter); err != nil {
+		log.Error("Could not record failed thumbnail job", "store_error", err.Error())
+	}
+}
+
+// generate stores a thumbnail of att for each size smaller than the image.
+func (t *Thumbnailer) generate(ctx context.Context, att Attachment) ([]Thumbnail, error) {
+	body, err := t.Blobs.Get(ctx, att.Key)
+	if err != nil {
+		return nil, fmt.Errorf("get: %w", err)
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("read: %w", err)
+	}
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errBadImage, err)
+	}
+	if cfg.Width*cfg.Height > maxThumbnailPixels {
+		return nil, fmt.Errorf("%w: %dx%d is too large", errBadImage, cfg.Width, cfg.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errBadImage, err)
+	}
+
+	sizes := t.Sizes
+	if sizes == nil {
+		sizes = defaultThumbnailSizes
+	}
+	var thumbs []Thumbnail
+	for _, size := range sizes {
+		if size >= max(cfg.Width, cfg.Height) {
+			// The original is small enough.
+			continue
+		}
+		scaled := scale(img, size)
+		var buf bytes.Buffer
+		contentType, err := encodeThumbnail(&buf, scaled, format)
+		if err != nil {
+			return nil, fmt.Errorf("encode: %w", err)
+		}
+		th := Thumbnail{
+			Size:        size,
+			Width:       scaled.Bounds().Dx(),
+			Height:      scaled.Bounds().Dy(),
+			ContentType: contentType,
+			Key:         fmt.Sprintf("%s_%d", att.Key, size),
+		}
+		if err := t.Blobs.Put(ctx, th.Key, &buf, int64(buf.Len()), th.ContentType); err != nil {
+			return nil, fmt.Errorf("put: %w", err)
+		}
+		thumbs = append(thumbs, th)
+	}
+	return thumbs, nil
+}
+
+// updateCache adds the thumbnails to the cached message att was sent with.
+func (t *Thumbnailer) updateCache(ctx context.Context, att Attachment) {
+	log := t.Logger.With("message_id", att.MessageID)
+	m, err := t.Cache.GetMessage(ctx, att.MessageID)
+	if errors.Is(err, ErrMessageNotFoundInCache) {
+		return
+	}
+	if err != nil {
+		log.Warn("Could not get cached message", "error", err.Error())
+		return
+	}
+	for i := range m.Attachments {
+		if m.Attachments[i].ID == att.ID {
+			m.Attachments[i].Thumbnails = att.Thumbnails
+		}
+	}
+	if err := t.Cache.InsertMessage(ctx, *m); err != nil {
+		log.Warn("Could not cache message", "error", err.Error())
+	}
+}
+
+// encodeThumbnail encodes JPEG photos as JPEG, and anything else as PNG to
+// keep transparency. It returns the content type.
+func encodeThumbnail(w io.Writer, img image.Image, format string) (string, error) {
+	if format == "jpeg" {
+		return "image/jpeg", jpeg.Encode(w, img, &jpeg.Options{Quality: thumbnailQuality})
+	}
+	return "image/png", png.Encode(w, img)
+}
+
+// scale shrinks img so that its longest side is size pixels. Each pixel is
+// the average of those it covers in img.
+func scale(img image.Image, size int) *image.NRGBA {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	tw, th := size, size
+	if w >= h {
+		th = max(1, h*size/w)
+	} else {
+		tw = max(1, w*size/h)
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, tw, th))
+	for y := range th {
+		y0, y1 := b.Min.Y+y*h/th, b.Min.Y+(y+1)*h/th
+		for x := range tw {
+			x0, x1 := b.Min.X+x*w/tw, b.Min.X+(x+1)*w/tw
+			// Sum the alpha-premultiplied colors, so transparent pixels
+			// don't darken the average.
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			if a == 0 {
+				continue
+			}
+			dst.SetNRGBA(x, y, color.NRGBA{
+				R: uint8(r * 0xff / a),
+				G: uint8(g * 0xff / a),
+				B: uint8(bl * 0xff / a),
+				A: uint8(a / n >> 8),
+			})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,320 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/neilotoole/slogt"
+)
+
+func TestScale(t *testing.T) {
+	red := color.NRGBA{R: 0xff, A: 0xff}
+	src := image.NewNRGBA(image.Rect(0, 0, 4, 2))
+	for y := range 2 {
+		for x := range 2 {
+			src.SetNRGBA(x, y, red)
+		}
+	}
+
+	got := scale(src, 2)
+	if got.Bounds() != image.Rect(0, 0, 2, 1) {
+		t.Fatalf("Got bounds %v, want 2x1", got.Bounds())
+	}
+	if c := got.NRGBAAt(0, 0); c != red {
+		t.Errorf("Got opaque half %v, want %v", c, red)
+	}
+	if c := got.NRGBAAt(1, 0); c != (color.NRGBA{}) {
+		t.Errorf("Got transparent half %v, want transparent", c)
+	}
+
+	// Transparent pixels make the average more transparent, not darker.
+	got = scale(src, 1)
+	if c := got.NRGBAAt(0, 0); c != (color.NRGBA{R: 0xff, A: 0x7f}) {
+		t.Errorf("Got average %v, want half transparent red", c)
+	}
+}
+
+func TestThumbnailer_Process(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     []byte
+		attempts    int
+		completeErr error
+		wantThumbs  []Thumbnail
+		wantRetry   *time.Duration
+	}{
+		{
+			name:    "PNG",
+			content: encodeTestImage(t, "png", 640, 320),
+			wantThumbs: []Thumbnail{
+				{Size: 160, Width: 160, Height: 80, ContentType: "image/png", Key: "attachments/a1_160"},
+				{Size: 480, Width: 480, Height: 240, ContentType: "image/png", Key: "attachments/a1_480"},
+			},
+		},
+		{
+			name:    "JPEG",
+			content: encodeTestImage(t, "jpeg", 300, 600),
+			wantThumbs: []Thumbnail{
+				{Size: 160, Width: 80, Height: 160, ContentType: "image/jpeg", Key: "attachments/a1_160"},
+				{Size: 480, Width: 240, Height: 480, ContentType: "image/jpeg", Key: "attachments/a1_480"},
+			},
+		},
+		{
+			name:    "Small",
+			content: encodeTestImage(t, "png", 100, 100),
+		},
+		{
+			name:      "NotAnImage",
+			content:   []byte("hello"),
+			wantRetry: ptr(time.Duration(0)),
+		},
+		{
+			name:      "MissingBlob",
+			wantRetry: ptr(time.Duration(0)),
+		},
+		{
+			name:        "Retry",
+			content:     encodeTestImage(t, "png", 100, 100),
+			attempts:    2,
+			completeErr: errors.New("connection refused"),
+			wantRetry:   ptr(2 * time.Minute),
+		},
+		{
+			name:        "LastAttempt",
+			content:     encodeTestImage(t, "png", 100, 100),
+			attempts:    5,
+			completeErr: errors.New("connection refused"),
+			wantRetry:   ptr(time.Duration(0)),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blobs := testblobs{}
+			if tt.content != nil {
+				blobs["attachments/a1"] = tt.content
+			}
+			attempts := tt.attempts
+			if attempts == 0 {
+				attempts = 1
+			}
+			store := &testthumbs{
+				jobs: []ThumbnailJob{{
+					Attachment: Attachment{ID: "a1", Key: "attachments/a1", ContentType: "image/png"},
+					Attempts:   attempts,
+				}},
+				messageID:   "m1",
+				completeErr: tt.completeErr,
+			}
+			var cached *Message
+			th := &Thumbnailer{
+				Logger: slogt.New(t),
+				Store:  store,
+				Blobs:  blobs,
+				Cache: &testcache{
+					T: t,
+					getMessage: func(t *testing.T, id string) (*Message, error) {
+						return &Message{ID: id, Attachments: []Attachment{{ID: "a1"}}}, nil
+					},
+					insertMessage: func(t *testing.T, msg Message) error {
+						cached = &msg
+						return nil
+					},
+				},
+				Sizes: []int{160, 480, 1000},
+			}
+			if err := th.Process(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.wantRetry != nil {
+				retry, ok := store.failed["a1"]
+				if !ok {
+					t.Fatal("Job did not fail")
+				}
+				if retry != *tt.wantRetry {
+					t.Errorf("Got retry after %s, want %s", retry, *tt.wantRetry)
+				}
+				return
+			}
+			if diff := cmp.Diff(tt.wantThumbs, store.done["a1"]); diff != "" {
+				t.Errorf("Thumbnails mismatch (-want +got):\n%s", diff)
+			}
+			for _, th := range tt.wantThumbs {
+				img, _, err := image.Decode(bytes.NewReader(blobs[th.Key]))
+				if err != nil {
+					t.Fatalf("Decode %s: %v", th.Key, err)
+				}
+				if got := img.Bounds().Size(); got != image.Pt(th.Width, th.Height) {
+					t.Errorf("Got %s of size %v, want %dx%d", th.Key, got, th.Width, th.Height)
+				}
+			}
+			if cached == nil || len(cached.Attachments) != 1 || len(cached.Attachments[0].Thumbnails) != len(tt.wantThumbs) {
+				t.Errorf("Got cached message %+v, want it with the thumbnails", cached)
+			}
+		})
+	}
+}
+
+func TestAPI_downloadThumbnail(t *testing.T) {
+	att := &Attachment{
+		ID:          "1",
+		MessageID:   "m1",
+		UserID:      "alice",
+		FileName:    "cat.png",
+		ContentType: "image/png",
+		Key:         "attachments/1",
+		Thumbnails: []Thumbnail{
+			{Size: 160, Width: 160, Height: 80, ContentType: "image/png", Key: "attachments/1_160"},
+		},
+	}
+	tests := []struct {
+		path       string
+		wantStatus int
+	}{
+		{path: "/uploads/1/thumbnails/160", wantStatus: 200},
+		{path: "/uploads/1/thumbnails/480", wantStatus: 404},
+		{path: "/uploads/1/thumbnails/big", wantStatus: 404},
+		{path: "/uploads/2/thumbnails/160", wantStatus: 404},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			api := &API{
+				Logger: slogt.New(t),
+				DB: &testdb{
+					T: t,
+					getAttach: func(t *testing.T, id string) (*Attachment, error) {
+						if id != att.ID {
+							return nil, ErrAttachmentNotFound
+						}
+						return att, nil
+					},
+				},
+				Blobs: testblobs{"attachments/1_160": []byte("thumb")},
+			}
+			srv := httptest.NewServer(api)
+			defer srv.Close()
+
+			resp, err := http.Get(srv.URL + tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			checkStatus(t, resp.StatusCode, tt.wantStatus)
+			if tt.wantStatus != 200 {
+				return
+			}
+			if got := resp.Header.Get("Content-Disposition"); got != "inline; filename=cat.png" {
+				t.Errorf("Got Content-Disposition %q, want inline", got)
+			}
+		})
+	}
+}
+
+func TestAPI_uploadEnqueuesThumbnails(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      []byte
+		wantEnqueued bool
+	}{
+		{name: "Image", content: pngHeader, wantEnqueued: true},
+		{name: "Text", content: []byte("hello"), wantEnqueued: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &testthumbs{}
+			api := &API{
+				Logger: slogt.New(t),
+				DB: &testdb{
+					T: t,
+					insertAttach: func(t *testing.T, a Attachment) (Attachment, error) {
+						return a, nil
+					},
+				},
+				Blobs:      testblobs{},
+				Thumbnails: store,
+			}
+			srv := httptest.NewServer(api)
+			defer srv.Close()
+
+			resp := postFile(t, srv.URL+"/uploads", "alice", "file", tt.content)
+			checkStatus(t, resp.StatusCode, 201)
+			if got := len(store.enqueued) == 1; got != tt.wantEnqueued {
+				t.Errorf("Got thumbnails queued %t, want %t", got, tt.wantEnqueued)
+			}
+		})
+	}
+}
+
+func encodeTestImage(t *testing.T, format string, w, h int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 0x80, A: 0xff})
+		}
+	}
+	var buf bytes.Buffer
+	var err error
+	if format == "jpeg" {
+		err = jpeg.Encode(&buf, img, nil)
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// testthumbs is a ThumbnailStore that hands out jobs once.
+type testthumbs struct {
+	jobs        []ThumbnailJob
+	messageID   string // of the completed attachments
+	completeErr error
+	enqueued    []string
+	done        map[string][]Thumbnail
+	failed      map[string]time.Duration // retry after, by attachment
+}
+
+func (s *testthumbs) EnqueueThumbnails(_ context.Context, attachmentID string) error {
+	s.enqueued = append(s.enqueued, attachmentID)
+	return nil
+}
+
+func (s *testthumbs) ClaimThumbnailJobs(context.Context, int, time.Duration) ([]ThumbnailJob, error) {
+	jobs := s.jobs
+	s.jobs = nil
+	return jobs, nil
+}
+
+func (s *testthumbs) CompleteThumbnailJob(_ context.Context, attachmentID string, thumbs []Thumbnail) (Attachment, error) {
+	if s.completeErr != nil {
+		return Attachment{}, s.completeErr
+	}
+	if s.done == nil {
+		s.done = make(map[string][]Thumbnail)
+	}
+	s.done[attachmentID] = thumbs
+	return Attachment{ID: attachmentID, MessageID: s.messageID, Thumbnails: thumbs}, nil
+}
+
+func (s *testthumbs) FailThumbnailJob(_ context.Context, attachmentID string, _ error, retryAfter time.Duration) error {
+	if s.failed == nil {
+		s.failed = make(map[string]time.Duration)
+	}
+	s.failed[attachmentID] = retryAfter
+	return nil
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// startSpan starts the server span for a request, continuing the trace from
+// the caller's traceparent header if there is one. route is the pattern the
+// request matched, such as "GET /messages".
+func (a *API) startSpan(r *http.Request, route string) (context.Context, trace.Span) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+	name := route
+	if name == "" {
+		name = r.Method
+	}
+	attrs := []attribute.KeyValue{
+		attribute.String("http.request.method", r.Method),
+		attribute.String("url.path", r.URL.Path),
+	}
+	if _, path, ok := strings.Cut(route, " "); ok {
+		attrs = append(attrs, attribute.String("http.route", path))
+	}
+	return a.tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+// endSpan records the response status on the span. Only server errors mark
+// the span as failed; client errors are the caller's problem.
+func endSpan(span trace.Span, status int) {
+	span.SetAttributes(attribute.Int("http.response.status_code", status))
+	if status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/neilotoole/slogt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestAPI_tracing(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	tests := []struct {
+		name        string
+		dbErr       error
+		traceparent string
+		wantName    string
+		wantStatus  codes.Code
+		wantParent  string // trace ID
+	}{
+		{
+			name:     "NewTrace",
+			wantName: "GET /messages",
+		},
+		{
+			name:        "ContinuesTrace",
+			traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			wantName:    "GET /messages",
+			wantParent:  "4bf92f3577b34da6a3ce929d0e0e4736",
+		},
+		{
+			name:       "ServerError",
+			dbErr:      errors.New("something went wrong"),
+			wantName:   "GET /messages",
+			wantStatus: codes.Error,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exp := tracetest.NewInMemoryExporter()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+
+			var dbSpan trace.SpanContext
+			api := &API{
+				Logger: slogt.New(t),
+				DB: &testdb{
+					T: t,
+					listMessages: func(t *testing.T, excludeMsgIDs ...string) ([]Message, error) {
+						return nil, tt.dbErr
+					},
+				},
+				Cache: &testcache{
+					T: t,
+					listMessages: func(t *testing.T) ([]Message, error) {
+						return nil, nil
+					},
+				},
+				TracerProvider: tp,
+			}
+			// Capture the span the DB sees through the request context.
+			db := api.DB.(*testdb)
+			db.listMessagesCtx = func(sc trace.SpanContext) { dbSpan = sc }
+
+			srv := httptest.NewServer(api)
+			defer srv.Close()
+
+			req, _ := http.NewRequest("GET", srv.URL+"/messages", nil)
+			if tt.traceparent != "" {
+				req.Header.Set("traceparent", tt.traceparent)
+			}
+			if _, err := http.DefaultClient.Do(req); err != nil {
+				t.Fatal(err)
+			}
+
+			spans := exp.GetSpans()
+			if len(spans) != 1 {
+				t.Fatalf("Got %d spans, want 1", len(spans))
+			}
+			span := spans[0]
+			if span.Name != tt.wantName {
+				t.Errorf("Got span name %q, want %q", span.Name, tt.wantName)
+			}
+			if span.SpanKind != trace.SpanKindServer {
+				t.Errorf("Got span kind %s, want server", span.SpanKind)
+			}
+			if span.Status.Code != tt.wantStatus {
+				t.Errorf("Got span status %s, want %s", span.Status.Code, tt.wantStatus)
+			}
+			if tt.wantParent != "" && span.Parent.TraceID().String() != tt.wantParent {
+				t.Errorf("Got parent trace %s, want %s", span.Parent.TraceID(), tt.wantParent)
+			}
+			if dbSpan.SpanID() != span.SpanContext.SpanID() {
+				t.Errorf("DB call did not get the request span in its context")
+			}
+			if !hasAttr(span.Attributes, attribute.String("http.route", "/messages")) {
+				t.Errorf("Span attributes %v do not contain the route", span.Attributes)
+			}
+		})
+	}
+}
+
+func hasAttr(attrs []attribute.KeyValue, want attribute.KeyValue) bool {
+	for _, a := range attrs {
+		if a == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,290 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+const (
+	defaultMaxUploadSize = 10 << 20
+	// multipartOverhead is allowed on top of the file for the rest of the
+	// form.
+	multipartOverhead = 64 << 10
+	// uploadMemory is how much of a form is kept in memory, the rest goes to
+	// temporary files.
+	uploadMemory = 1 << 20
+	maxFileName  = 255
+)
+
+// defaultUploadTypes are the MIME types accepted by default.
+var defaultUploadTypes = []string{
+	"image/png",
+	"image/jpeg",
+	"image/gif",
+	"image/webp",
+	"application/pdf",
+	"text/plain",
+}
+
+// attachment represents the attachment DTO.
+type attachment struct {
+	ID          string      `json:"id"`
+	FileName    string      `json:"file_name"`
+	ContentType string      `json:"content_type"`
+	Size        int64       `json:"size"`
+	URL         string      `json:"url"`
+	Thumbnails  []thumbnail `json:"thumbnails,omitempty"`
+}
+
+// thumbnail represents the thumbnail DTO.
+type thumbnail struct {
+	Size   int    `json:"size"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	URL    string `json:"url"`
+}
+
+func toAttachments(attachments []Attachment) []attachment {
+	if len(attachments) == 0 {
+		return nil
+	}
+	out := make([]attachment, len(attachments))
+	for i, a := range attachments {
+		out[i] = attachment{
+			ID:          a.ID,
+			FileName:    a.FileName,
+			ContentType: a.ContentType,
+			Size:        a.Size,
+			URL:         "/uploads/" + a.ID,
+		}
+		for _, t := range a.Thumbnails {
+			out[i].Thumbnails = append(out[i].Thumbnails, thumbnail{
+				Size:   t.Size,
+				Width:  t.Width,
+				Height: t.Height,
+				URL:    fmt.Sprintf("/uploads/%s/thumbnails/%d", a.ID, t.Size),
+			})
+		}
+	}
+	return out
+}
+
+// upload stores the file in the "file" field of a multipart form, to be sent
+// as an attachment. The type is detected from the content, the one claimed by
+// the client is ignored.
+func (a *API) upload(w http.ResponseWriter, r *http.Request) {
+	if !a.requireScope(w, r, ScopeMessagesWrite) {
+		return
+	}
+	log := LoggerFrom(r.Context())
+	maxSize := a.MaxUploadSize
+	if maxSize == 0 {
+		maxSize = defaultMaxUploadSize
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+multipartOverhead)
+	if err := r.ParseMultipartForm(uploadMemory); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			a.respondError(w, r, http.StatusRequestEntityTooLarge, err, fmt.Sprintf("File larger than %d bytes", maxSize))
+			return
+		}
+		a.respondError(w, r, http.StatusBadRequest, err, "Could not parse multipart form")
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	userID, ok := a.authorizeUser(w, r, r.FormValue("user_id"))
+	if !ok {
+		return
+	}
+	if userID == "" {
+		a.respondError(w, r, http.StatusBadRequest, errors.New("missing user_id"), "Missing user_id")
+		return
+	}
+	setUser(r.Context(), userID)
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		a.respondError(w, r, http.StatusBadRequest, err, "Missing file")
+		return
+	}
+	defer file.Close()
+	switch {
+	case header.Size == 0:
+		a.respondError(w, r, http.StatusBadRequest, errors.New("empty file"), "Empty file")
+		return
+	case header.Size > maxSize:
+		err := fmt.Errorf("file of %d bytes", header.Size)
+		a.respondError(w, r, http.StatusRequestEntityTooLarge, err, fmt.Sprintf("File larger than %d bytes", maxSize))
+		return
+	}
+
+	mtype, err := mimetype.DetectReader(file)
+	if err != nil {
+		a.respondError(w, r, http.StatusInternalServerError, err, "Could not read file")
+		return
+	}
+	if !a.uploadAllowed(mtype) {
+		err := fmt.Errorf("file of type %s", mtype)
+		a.respondError(w, r, http.StatusUnsupportedMediaType, err, "File type not allowed")
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		a.respondError(w, r, http.StatusInternalServerError, err, "Could not read file")
+		return
+	}
+
+	att := Attachment{
+		ID:          newID(),
+		UserID:      userID,
+		FileName:    fileName(header.Filename),
+		ContentType: mtype.String(),
+		Size:        header.Size,
+		CreatedAt:   time.Now(),
+	}
+	att.Key = "attachments/" + att.ID
+	if err := a.Blobs.Put(r.Context(), att.Key, file, att.Size, att.ContentType); err != nil {
+		log.Error("Error storing upload", "error", err.Error())
+		a.respondError(w, r, http.StatusInternalServerError, err, "Could not store file")
+		return
+	}
+	stored, err := a.DB.InsertAttachment(r.Context(), att)
+	if err != nil {
+		log.Error("Error creating attachment in DB", "error", err.Error())
+		if err := a.Blobs.Delete(r.Context(), att.Key); err != nil {
+			log.Error("Could not delete orphaned upload", "key", att.Key, "error", err.Error())
+		}
+		a.respondError(w, r, http.StatusInternalServerError, err, "Could not store file")
+		return
+	}
+	log.Info("Stored upload", "attachment_id", stored.ID, "content_type", stored.ContentType, "size", stored.Size)
+	if a.Thumbnails != nil && canThumbnail(stored.ContentType) {
+		// The upload is usable without thumbnails, so this doesn't fail it.
+		if err := a.Thumbnails.EnqueueThumbnails(r.Context(), stored.ID); err != nil {
+			log.Error("Could not queue thumbnails", "attachment_id", stored.ID, "error", err.Error())
+		}
+	}
+	a.respond(w, http.StatusCreated, toAttachments([]Attachment{stored})[0])
+}
+
+func (a *API) uploadAllowed(mtype *mimetype.MIME) bool {
+	allowed := a.UploadTypes
+	if allowed == nil {
+		allowed = defaultUploadTypes
+	}
+	for _, t := range allowed {
+		if mtype.Is(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// fileName returns the base name of an uploaded file, which is used in
+// Content-Disposition headers.
+func fileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, `\`, "/"))
+	if name == "." || name == "/" {
+		name = "file"
+	}
+	if len(name) > maxFileName {
+		// Cut on a rune boundary, so the name stays valid UTF-8.
+		n := maxFileName
+		for n > 0 && !utf8.RuneStart(name[n]) {
+			n--
+		}
+		name = name[:n]
+	}
+	return name
+}
+
+// download serves the content of an attachment.
+func (a *API) download(w http.ResponseWriter, r *http.Request) {
+	att, ok := a.getAttachment(w, r)
+	if !ok {
+		return
+	}
+	// Only images are shown inline; anything else, even text, is downloaded
+	// so it can't run in the API's origin.
+	disposition := "attachment"
+	if strings.HasPrefix(att.ContentType, "image/") {
+		disposition = "inline"
+	}
+	a.serveBlob(w, r, att.Key, att.ContentType, att.Size, disposition, att.FileName)
+}
+
+// downloadThumbnail serves a thumbnail of an image attachment.
+func (a *API) downloadThumbnail(w http.ResponseWriter, r *http.Request) {
+	att, ok := a.getAttachment(w, r)
+	if !ok {
+		return
+	}
+	size, err := strconv.Atoi(r.PathValue("size"))
+	if err != nil {
+		a.respondError(w, r, http.StatusNotFound, err, "Thumbnail not found")
+		return
+	}
+	for _, t := range att.Thumbnails {
+		if t.Size == size {
+			a.serveBlob(w, r, t.Key, t.ContentType, 0, "inline", att.FileName)
+			return
+		}
+	}
+	a.respondError(w, r, http.StatusNotFound, fmt.Errorf("no thumbnail of size %d", size), "Thumbnail not found")
+}
+
+// getAttachment returns the attachment in the path, or responds with an
+// error if it can't. Attachments that were not sent yet are only found by
+// their uploader, as the viewer listing messages.
+func (a *API) getAttachment(w http.ResponseWriter, r *http.Request) (*Attachment, bool) {
+	att, err := a.DB.GetAttachment(r.Context(), r.PathValue("attachmentID"))
+	if err == nil && att.MessageID == "" && att.UserID != a.viewer(r) {
+		err = fmt.Errorf("attachment %s is not sent: %w", att.ID, ErrAttachmentNotFound)
+	}
+	if errors.Is(err, ErrAttachmentNotFound) {
+		a.respondError(w, r, http.StatusNotFound, err, "Attachment not found")
+		return nil, false
+	}
+	if err != nil {
+		LoggerFrom(r.Context()).Error("Error getting attachment from DB", "error", err.Error())
+		a.respondError(w, r, http.StatusInternalServerError, err, "Could not get attachment")
+		return nil, false
+	}
+	return att, true
+}
+
+// serveBlob copies a blob to the response. A size of 0 means it is not known.
+func (a *API) serveBlob(w http.ResponseWriter, r *http.Request, key, contentType string, size int64, disposition, fileName string) {
+	log := LoggerFrom(r.Context())
+	body, err := a.Blobs.Get(r.Context(), key)
+	if errors.Is(err, ErrBlobNotFound) {
+		a.respondError(w, r, http.StatusNotFound, err, "Attachment not found")
+		return
+	}
+	if err != nil {
+		log.Error("Error getting upload", "error", err.Error())
+		a.respondError(w, r, http.StatusInternalServerError, err, "Could not get attachment")
+		return
+	}
+	defer body.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	if size > 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	}
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": fileName}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if _, err := io.Copy(w, body); err != nil {
+		log.Warn("Error sending attachment", "error", err.Error())
+	}
+}
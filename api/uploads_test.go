@@ -0,0 +1,350 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/neilotoole/slogt"
+)
+
+// pngHeader is the start of a PNG file, enough to detect its type.
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00")
+
+func TestAPI_upload(t *testing.T) {
+	tests := []struct {
+		name       string
+		userID     string
+		fileName   string
+		content    []byte
+		dbErr      error
+		wantStatus int
+		wantBody   string
+		wantStored bool
+	}{
+		{
+			name:       "OK",
+			userID:     "alice",
+			fileName:   `C:\photos\cat.png`,
+			content:    pngHeader,
+			wantStatus: 201,
+			wantStored: true,
+		},
+		{
+			name:       "TypeFromContent",
+			userID:     "alice",
+			fileName:   "cat.png",
+			content:    []byte("<html><script>alert(1)</script></html>"),
+			wantStatus: 415,
+			wantBody:   `{"error": "File type not allowed"}`,
+		},
+		{
+			name:       "TooLarge",
+			userID:     "alice",
+			fileName:   "big.txt",
+			content:    bytes.Repeat([]byte("a"), 2048),
+			wantStatus: 413,
+			wantBody:   `{"error": "File larger than 1024 bytes"}`,
+		},
+		{
+			name:       "Empty",
+			userID:     "alice",
+			fileName:   "empty.txt",
+			content:    []byte{},
+			wantStatus: 400,
+			wantBody:   `{"error": "Empty file"}`,
+		},
+		{
+			name:       "MissingUser",
+			fileName:   "cat.png",
+			content:    pngHeader,
+			wantStatus: 400,
+			wantBody:   `{"error": "Missing user_id"}`,
+		},
+		{
+			name:       "DBError",
+			userID:     "alice",
+			fileName:   "cat.png",
+			content:    pngHeader,
+			dbErr:      errors.New("something went wrong"),
+			wantStatus: 500,
+			wantBody:   `{"error": "Could not store file"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blobs := testblobs{}
+			api := &API{
+				Logger: slogt.New(t),
+				DB: &testdb{
+					T: t,
+					insertAttach: func(t *testing.T, a Attachment) (Attachment, error) {
+						want := Attachment{
+							ID:          a.ID,
+							UserID:      "alice",
+							FileName:    "cat.png",
+							ContentType: "image/png",
+							Size:        int64(len(pngHeader)),
+							Key:         "attachments/" + a.ID,
+							CreatedAt:   a.CreatedAt,
+						}
+						if diff := cmp.Diff(want, a); diff != "" {
+							t.Errorf("InsertAttachment() mismatch (-want +got):\n%s", diff)
+						}
+						return a, tt.dbErr
+					},
+				},
+				Blobs:         blobs,
+				MaxUploadSize: 1024,
+			}
+			srv := httptest.NewServer(api)
+			defer srv.Close()
+
+			resp := postFile(t, srv.URL+"/uploads", tt.userID, tt.fileName, tt.content)
+			checkStatus(t, resp.StatusCode, tt.wantStatus)
+			if tt.wantBody != "" {
+				checkBody(t, resp, tt.wantBody)
+			}
+			if got := len(blobs) > 0; got != tt.wantStored {
+				t.Errorf("Got blob stored %t, want %t", got, tt.wantStored)
+			}
+		})
+	}
+}
+
+func TestAPI_download(t *testing.T) {
+	attachments := map[string]*Attachment{
+		"1": {ID: "1", MessageID: "m1", UserID: "alice", FileName: "cat.png", ContentType: "image/png", Size: 5, Key: "attachments/1"},
+		"2": {ID: "2", MessageID: "m1", UserID: "alice", FileName: "notes.txt", ContentType: "text/plain; charset=utf-8", Size: 5, Key: "attachments/2"},
+		"3": {ID: "3", MessageID: "m1", UserID: "alice", FileName: "gone.txt", ContentType: "text/plain", Size: 5, Key: "attachments/3"},
+		"5": {ID: "5", UserID: "alice", FileName: "draft.png", ContentType: "image/png", Size: 5, Key: "attachments/5"},
+	}
+	tests := []struct {
+		name            string
+		id              string
+		viewer          string
+		wantStatus      int
+		wantType        string
+		wantDisposition string
+	}{
+		{name: "Image", id: "1", wantStatus: 200, wantType: "image/png", wantDisposition: `inline; filename=cat.png`},
+		{name: "Text", id: "2", wantStatus: 200, wantType: "text/plain; charset=utf-8", wantDisposition: `attachment; filename=notes.txt`},
+		{name: "BlobMissing", id: "3", wantStatus: 404},
+		{name: "Unknown", id: "4", wantStatus: 404},
+		{name: "UnsentByUploader", id: "5", viewer: "alice", wantStatus: 200, wantType: "image/png", wantDisposition: `inline; filename=draft.png`},
+		{name: "UnsentByOther", id: "5", viewer: "bob", wantStatus: 404},
+		{name: "UnsentAnonymous", id: "5", wantStatus: 404},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &API{
+				Logger: slogt.New(t),
+				DB: &testdb{
+					T: t,
+					getAttach: func(t *testing.T, id string) (*Attachment, error) {
+						if a, ok := attachments[id]; ok {
+							return a, nil
+						}
+						return nil, ErrAttachmentNotFound
+					},
+				},
+				Blobs: testblobs{"attachments/1": []byte("hello"), "attachments/2": []byte("hello"), "attachments/5": []byte("hello")},
+			}
+			srv := httptest.NewServer(api)
+			defer srv.Close()
+
+			resp, err := http.Get(srv.URL + "/uploads/" + tt.id + "?viewer=" + tt.viewer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			checkStatus(t, resp.StatusCode, tt.wantStatus)
+			if tt.wantStatus != 200 {
+				return
+			}
+			if got := resp.Header.Get("Content-Type"); got != tt.wantType {
+				t.Errorf("Got Content-Type %q, want %q", got, tt.wantType)
+			}
+			if got := resp.Header.Get("Content-Disposition"); got != tt.wantDisposition {
+				t.Errorf("Got Content-Disposition %q, want %q", got, tt.wantDisposition)
+			}
+			if got := resp.Header.Get("X-Content-Type-Options"); got != "nosniff" {
+				t.Errorf("Got X-Content-Type-Options %q, want nosniff", got)
+			}
+			if b, _ := io.ReadAll(resp.Body); string(b) != "hello" {
+				t.Errorf("Got body %q, want hello", b)
+			}
+		})
+	}
+}
+
+func TestFileName(t *testing.T) {
+	long := strings.Repeat("a", maxFileName-1) + "é.png"
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: `C:\photos\cat.png`, want: "cat.png"},
+		{name: "/", want: "file"},
+		{name: strings.Repeat("a", 300), want: strings.Repeat("a", maxFileName)},
+		// The é would be cut in half.
+		{name: long, want: strings.Repeat("a", maxFileName-1)},
+	}
+	for _, tt := range tests {
+		got := fileName(tt.name)
+		if got != tt.want {
+			t.Errorf("fileName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("fileName(%q) = %q, want valid UTF-8", tt.name, got)
+		}
+	}
+}
+
+func TestAPI_createMessageAttachments(t *testing.T) {
+	tests := []struct {
+		name       string
+		dbErr      error
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "OK",
+			wantStatus: 201,
+			wantBody: `{
+				"id": "1",
+				"text": "look",
+				"user_id": "alice",
+				"created_at": "Mon, 01 Jan 2024 00:00:00 UTC",
+				"attachments": [{
+					"id": "a1",
+					"file_name": "cat.png",
+					"content_type": "image/png",
+					"size": 5,
+					"url": "/uploads/a1",
+					"thumbnails": [{
+						"size": 160,
+						"width": 160,
+						"height": 80,
+						"url": "/uploads/a1/thumbnails/160"
+					}]
+				}]
+			}`,
+		},
+		{
+			name:       "UnknownAttachment",
+			dbErr:      ErrAttachmentNotFound,
+			wantStatus: 400,
+			wantBody:   `{"error": "Unknown attachment"}`,
+		},
+		{
+			name:       "NotQueued",
+			dbErr:      ErrDBUnavailable,
+			wantStatus: 500,
+			wantBody:   `{"error": "Could not insert message"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &API{
+				Logger:   slogt.New(t),
+				Validate: &MockValidator{},
+				DB: &testdb{
+					T: t,
+					insertMessage: func(t *testing.T, msg Message) (Message, error) {
+						if diff := cmp.Diff([]Attachment{{ID: "a1"}}, msg.Attachments); diff != "" {
+							t.Errorf("Attachments mismatch (-want +got):\n%s", diff)
+						}
+						if tt.dbErr != nil {
+							return Message{}, tt.dbErr
+						}
+						msg.ID = "1"
+						msg.CreatedAt = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+						msg.Attachments = []Attachment{{
+							ID:          "a1",
+							MessageID:   "1",
+							FileName:    "cat.png",
+							ContentType: "image/png",
+							Size:        5,
+							Thumbnails:  []Thumbnail{{Size: 160, Width: 160, Height: 80, Key: "attachments/a1_160"}},
+						}}
+						return msg, nil
+					},
+				},
+				Cache: &testcache{
+					T:             t,
+					insertMessage: func(t *testing.T, msg Message) error { return nil },
+				},
+				Queue: &testqueue{
+					T: t,
+					enqueue: func(t *testing.T, w QueuedWrite) error {
+						t.Error("Queued a message with attachments")
+						return nil
+					},
+				},
+			}
+			srv := httptest.NewServer(api)
+			defer srv.Close()
+
+			resp := doWithKey(t, "POST", srv.URL+"/messages", "", `{"text": "look", "user_id": "alice", "attachment_ids": ["a1"]}`)
+			checkStatus(t, resp.StatusCode, tt.wantStatus)
+			checkBody(t, resp, tt.wantBody)
+		})
+	}
+}
+
+// postFile uploads content in a multipart form, with a user_id field unless
+// userID is empty.
+func postFile(t *testing.T, url, userID, fileName string, content []byte) *http.Response {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	if userID != "" {
+		mw.WriteField("user_id", userID)
+	}
+	fw, _ := mw.CreateFormFile("file", fileName)
+	fw.Write(content)
+	mw.Close()
+	resp, err := http.Post(url, mw.FormDataContentType(), &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// testblobs is a BlobStore in memory.
+type testblobs map[string][]byte
+
+func (b testblobs) Put(_ context.Context, key string, r io.Reader, size int64, _ string) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) != size {
+		return errors.New("size mismatch")
+	}
+	b[key] = data
+	return nil
+}
+
+func (b testblobs) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	data, ok := b[key]
+	if !ok {
+		return nil, ErrBlobNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (b testblobs) Delete(_ context.Context, key string) error {
+	delete(b, key)
+	return nil
+}
@@ -0,0 +1,256 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"time"
+)
+
+// exportFlushEvery is how many records are written between flushes of an
+// export.
+const exportFlushEvery = 100
+
+// reaction represents the reaction DTO in exports.
+type reaction struct {
+	ID        string `json:"id"`
+	MessageID string `json:"message_id"`
+	Type      string `json:"type"`
+	Score     int    `json:"score"`
+	UserID    string `json:"user_id"`
+	CreatedAt string `json:"created_at"`
+}
+
+func toReaction(r Reaction) reaction {
+	return reaction{
+		ID:        r.ID,
+		MessageID: r.MessageID,
+		Type:      r.Type,
+		Score:     r.Score,
+		UserID:    r.UserID,
+		CreatedAt: r.CreatedAt.Format(time.RFC1123),
+	}
+}
+
+// An exportWriter streams the data of a user as one JSON object, with the
+// messages and then the reactions in arrays, or as NDJSON, one record per
+// line. Nothing is written before the first record, so an export that fails
+// right away can still be answered with an error.
+type exportWriter struct {
+	w         http.ResponseWriter
+	rc        *http.ResponseController
+	userID    string
+	ndjson    bool
+	started   bool
+	messages  int
+	reactions int
+}
+
+func (e *exportWriter) start() error {
+	if e.started {
+		return nil
+	}
+	e.started = true
+	contentType, ext := "application/json", "json"
+	if e.ndjson {
+		contentType, ext = "application/x-ndjson", "ndjson"
+	}
+	e.w.Header().Set("Content-Type", contentType)
+	e.w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": e.userID + "." + ext,
+	}))
+	e.w.WriteHeader(http.StatusOK)
+	if e.ndjson {
+		return nil
+	}
+	userID, _ := json.Marshal(e.userID)
+	_, err := fmt.Fprintf(e.w, `{"user_id":%s,"messages":[`, userID)
+	return err
+}
+
+// write adds a record, which must not be a message once reactions were
+// written.
+func (e *exportWriter) write(rec UserDataRecord) error {
+	if err := e.start(); err != nil {
+		return err
+	}
+	var (
+		kind  string
+		value any
+		n     *int
+	)
+	if rec.Message != nil {
+		kind, value, n = "message", toMessage([]Message{*rec.Message})[0], &e.messages
+	} else {
+		kind, value, n = "reaction", toReaction(*rec.Reaction), &e.reactions
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case e.ndjson:
+		b = fmt.Appendf(nil, `{"type":%q,%q:%s}`+"\n", kind, kind, b)
+	case kind == "reaction" && e.reactions == 0:
+		b = append([]byte(`],"reactions":[`), b...)
+	case *n > 0:
+		b = append([]byte(","), b...)
+	}
+	if _, err := e.w.Write(b); err != nil {
+		return err
+	}
+	*n++
+	if (e.messages+e.reactions)%exportFlushEvery == 0 {
+		// Not every writer can flush, which only delays the export.
+		_ = e.rc.Flush()
+	}
+	return nil
+}
+
+// close ends the export.
+func (e *exportWriter) close() error {
+	if err := e.start(); err != nil {
+		return err
+	}
+	if e.ndjson {
+		return nil
+	}
+	end := "]}\n"
+	if e.reactions == 0 {
+		end = `],"reactions":[]}` + "\n"
+	}
+	_, err := e.w.Write([]byte(end))
+	return err
+}
+
+// exportUserData streams all messages and reactions of a user, as JSON or,
+// with format=ndjson, as NDJSON.
+func (a *API) exportUserData(w http.ResponseWriter, r *http.Request) {
+	log := LoggerFrom(r.Context())
+	userID, ok := a.authorizeAccount(w, r, r.PathValue("userID"), ScopePrivacy)
+	if !ok {
+		return
+	}
+	setUser(r.Context(), userID)
+	e := &exportWriter{w: w, rc: http.NewResponseController(w), userID: userID}
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+	case "ndjson":
+		e.ndjson = true
+	default:
+		err := fmt.Errorf("unknown format %q", format)
+		a.respondError(w, r, http.StatusBadRequest, err, "Invalid format, want json or ndjson")
+		return
+	}
+
+	err := a.UserData.ExportUserData(r.Context(), userID, e.write)
+	if err == nil {
+		err = e.close()
+	}
+	if err != nil && !e.started {
+		log.Error("Error exporting user data", "error", err.Error())
+		a.respondError(w, r, http.StatusInternalServerError, err, "Could not export user data")
+		return
+	}
+	if err != nil {
+		// The response is under way; cutting it short leaves the client
+		// with a truncated export rather than a complete-looking one.
+		log.Error("Error exporting user data, export is truncated", "error", err.Error())
+		return
+	}
+	log.Info("Exported user data", "messages", e.messages, "reactions", e.reactions)
+}
+
+// erasureJob represents the erasure job DTO.
+type erasureJob struct {
+	ID          string `json:"id"`
+	UserID      string `json:"user_id"`
+	Mode        string `json:"mode"`
+	Status      string `json:"status"`
+	Messages    int    `json:"messages"`
+	Attachments int    `json:"attachments"`
+	Reactions   int    `json:"reactions"`
+	CreatedAt   string `json:"created_at"`
+	UpdatedAt   string `json:"updated_at"`
+	CompletedAt string `json:"completed_at,omitempty"`
+}
+
+func toErasureJob(j ErasureJob) erasureJob {
+	out := erasureJob{
+		ID:          j.ID,
+		UserID:      j.UserID,
+		Mode:        j.Mode,
+		Status:      j.Status,
+		Messages:    j.Messages,
+		Attachments: j.Attachments,
+		Reactions:   j.Reactions,
+		CreatedAt:   j.CreatedAt.Format(time.RFC1123),
+		UpdatedAt:   j.UpdatedAt.Format(time.RFC1123),
+	}
+	if j.CompletedAt != nil {
+		out.CompletedAt = j.CompletedAt.Format(time.RFC1123)
+	}
+	return out
+}
+
+// eraseUserData queues the erasure of the user's data, anonymizing it or,
+// with mode=delete, deleting it, and responds with the job to follow.
+func (a *API) eraseUserData(w http.ResponseWriter, r *http.Request) {
+	log := LoggerFrom(r.Context())
+	userID, ok := a.authorizeAccount(w, r, r.PathValue("userID"), ScopePrivacy)
+	if !ok {
+		return
+	}
+	setUser(r.Context(), userID)
+	mode := r.URL.Query().Get("mode")
+	switch mode {
+	case "":
+		mode = ErasureAnonymize
+	case ErasureAnonymize, ErasureDelete:
+	default:
+		err := fmt.Errorf("unknown mode %q", mode)
+		a.respondError(w, r, http.StatusBadRequest, err, "Invalid mode, want anonymize or delete")
+		return
+	}
+
+	job, err := a.UserData.InsertErasureJob(r.Context(), ErasureJob{
+		UserID:      userID,
+		Mode:        mode,
+		RequestedBy: identity(r.Context()),
+		Status:      ErasurePending,
+		CreatedAt:   time.Now(),
+	})
+	if err != nil {
+		log.Error("Error creating erasure job in DB", "error", err.Error())
+		a.respondError(w, r, http.StatusInternalServerError, err, "Could not erase user data")
+		return
+	}
+	log.Info("Queued erasure of user data", "erasure_job_id", job.ID, "mode", mode)
+	w.Header().Set("Location", "/users/"+userID+"/data/erasures/"+job.ID)
+	a.respond(w, http.StatusAccepted, toErasureJob(job))
+}
+
+func (a *API) getErasureJob(w http.ResponseWriter, r *http.Request) {
+	userID, ok := a.authorizeAccount(w, r, r.PathValue("userID"), ScopePrivacy)
+	if !ok {
+		return
+	}
+	job, err := a.UserData.GetErasureJob(r.Context(), r.PathValue("jobID"))
+	if err == nil && job.UserID != userID {
+		// Other users' jobs are not found, rather than forbidden.
+		err = ErrErasureJobNotFound
+	}
+	if errors.Is(err, ErrErasureJobNotFound) {
+		a.respondError(w, r, http.StatusNotFound, err, "Erasure job not found")
+		return
+	}
+	if err != nil {
+		LoggerFrom(r.Context()).Error("Error getting erasure job from DB", "error", err.Error())
+		a.respondError(w, r, http.StatusInternalServerError, err, "Could not get erasure job")
+		return
+	}
+	a.respond(w, http.StatusOK, toErasureJob(*job))
+}
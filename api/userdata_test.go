@@ -0,0 +1,315 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/neilotoole/slogt"
+)
+
+func TestAPI_exportUserData(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := &testuserdata{records: []UserDataRecord{
+		{Message: &Message{ID: "1", Text: "Hi", UserID: "alice", CreatedAt: created}},
+		{Reaction: &Reaction{ID: "r1", MessageID: "2", Type: "like", Score: 1, UserID: "alice", CreatedAt: created}},
+	}}
+	keys := newTestKeys()
+	key := keys.add(t, []string{ScopePrivacy}, nil)
+	api := &API{
+		Logger:   slogt.New(t),
+		Validate: &MockValidator{},
+		APIKeys:  keys,
+		UserData: store,
+	}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	resp := doWithKey(t, "GET", srv.URL+"/users/alice/export", key, "")
+	checkStatus(t, resp.StatusCode, http.StatusOK)
+	if got := resp.Header.Get("Content-Disposition"); got != "attachment; filename=alice.json" {
+		t.Errorf("Got Content-Disposition %q, want alice.json attached", got)
+	}
+	checkBody(t, resp, `{
+		"user_id": "alice",
+		"messages": [
+			{
+				"id": "1",
+				"text": "Hi",
+				"user_id": "alice",
+				"created_at": "Mon, 01 Jan 2024 00:00:00 UTC",
+				"message_reactions": []
+			}
+		],
+		"reactions": [
+			{
+				"id": "r1",
+				"message_id": "2",
+				"type": "like",
+				"score": 1,
+				"user_id": "alice",
+				"created_at": "Mon, 01 Jan 2024 00:00:00 UTC"
+			}
+		]
+	}`)
+
+	resp = doWithKey(t, "GET", srv.URL+"/users/alice/export?format=ndjson", key, "")
+	checkStatus(t, resp.StatusCode, http.StatusOK)
+	if got := resp.Header.Get("Content-Type"); got != "application/x-ndjson" {
+		t.Errorf("Got Content-Type %q, want NDJSON", got)
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"type":"message","message":{"id":"1","text":"Hi","user_id":"alice","created_at":"Mon, 01 Jan 2024 00:00:00 UTC","message_reactions":[]}}` + "\n" +
+		`{"type":"reaction","reaction":{"id":"r1","message_id":"2","type":"like","score":1,"user_id":"alice","created_at":"Mon, 01 Jan 2024 00:00:00 UTC"}}` + "\n"
+	if string(b) != want {
+		t.Errorf("Got NDJSON\n%s\nwant\n%s", b, want)
+	}
+
+	// Users without data get an empty export.
+	resp = doWithKey(t, "GET", srv.URL+"/users/bob/export", key, "")
+	checkStatus(t, resp.StatusCode, http.StatusOK)
+	checkBody(t, resp, `{"user_id": "bob", "messages": [], "reactions": []}`)
+
+	resp = doWithKey(t, "GET", srv.URL+"/users/alice/export?format=csv", key, "")
+	checkStatus(t, resp.StatusCode, http.StatusBadRequest)
+
+	// Failing before anything is written is still an error.
+	store.err = errors.New("connection refused")
+	resp = doWithKey(t, "GET", srv.URL+"/users/alice/export", key, "")
+	checkStatus(t, resp.StatusCode, http.StatusInternalServerError)
+}
+
+func TestAPI_eraseUserData(t *testing.T) {
+	store := &testuserdata{}
+	keys := newTestKeys()
+	key := keys.add(t, []string{ScopePrivacy}, nil)
+	api := &API{
+		Logger:   slogt.New(t),
+		Validate: &MockValidator{},
+		Auth:     testauth{"alice-token": "alice"},
+		APIKeys:  keys,
+		UserData: store,
+	}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	resp := doWithKey(t, "DELETE", srv.URL+"/users/alice/data?mode=shred", key, "")
+	checkStatus(t, resp.StatusCode, http.StatusBadRequest)
+
+	resp = doWithKey(t, "DELETE", srv.URL+"/users/alice/data", key, "")
+	checkStatus(t, resp.StatusCode, http.StatusAccepted)
+	if got := resp.Header.Get("Location"); got != "/users/alice/data/erasures/1" {
+		t.Errorf("Got Location %q, want the job", got)
+	}
+	checkBody(t, resp, `{
+		"id": "1",
+		"user_id": "alice",
+		"mode": "anonymize",
+		"status": "pending",
+		"messages": 0,
+		"attachments": 0,
+		"reactions": 0,
+		"created_at": "Mon, 01 Jan 2024 00:00:00 UTC",
+		"updated_at": "Mon, 01 Jan 2024 00:00:00 UTC"
+	}`)
+
+	resp = doWithKey(t, "DELETE", srv.URL+"/users/alice/data?mode=delete", key, "")
+	checkStatus(t, resp.StatusCode, http.StatusAccepted)
+	if got, want := store.jobs[1], "key:1"; got.Mode != ErasureDelete || got.RequestedBy != want {
+		t.Errorf("Got job %+v, want deletion requested by %s", got, want)
+	}
+
+	// The user may erase their own data.
+	req, _ := http.NewRequest("DELETE", srv.URL+"/users/alice/data", nil)
+	req.Header.Set("Authorization", "Bearer alice-token")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	checkStatus(t, resp.StatusCode, http.StatusAccepted)
+	if got := store.jobs[2].RequestedBy; got != "user:alice" {
+		t.Errorf("Got job requested by %q, want user:alice", got)
+	}
+
+	completed := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	store.jobs[0].Status = ErasureDone
+	store.jobs[0].Messages = 3
+	store.jobs[0].CompletedAt = &completed
+	resp = doWithKey(t, "GET", srv.URL+"/users/alice/data/erasures/1", key, "")
+	checkStatus(t, resp.StatusCode, http.StatusOK)
+	checkBody(t, resp, `{
+		"id": "1",
+		"user_id": "alice",
+		"mode": "anonymize",
+		"status": "done",
+		"messages": 3,
+		"attachments": 0,
+		"reactions": 0,
+		"created_at": "Mon, 01 Jan 2024 00:00:00 UTC",
+		"updated_at": "Mon, 01 Jan 2024 00:00:00 UTC",
+		"completed_at": "Tue, 02 Jan 2024 00:00:00 UTC"
+	}`)
+
+	// Others can't see the job.
+	resp = doWithKey(t, "GET", srv.URL+"/users/bob/data/erasures/1", key, "")
+	checkStatus(t, resp.StatusCode, http.StatusNotFound)
+	resp = doWithKey(t, "GET", srv.URL+"/users/alice/data/erasures/9", key, "")
+	checkStatus(t, resp.StatusCode, http.StatusNotFound)
+}
+
+func TestAPI_userData_authorization(t *testing.T) {
+	tests := []struct {
+		name       string
+		token      string
+		scopes     []string // of an API key to send instead of a token
+		noAuth     bool     // without an Authenticator
+		wantStatus int
+	}{
+		{name: "Owner", token: "alice-token", wantStatus: http.StatusOK},
+		{name: "OtherUser", token: "bob-token", wantStatus: http.StatusForbidden},
+		{name: "APIKeyWithoutPrivacy", scopes: []string{ScopeMessagesWrite, ScopeModerate}, wantStatus: http.StatusForbidden},
+		{name: "PrivacyAPIKey", scopes: []string{ScopePrivacy}, wantStatus: http.StatusOK},
+		{name: "AdminAPIKey", scopes: []string{ScopeAdmin}, wantStatus: http.StatusOK},
+		{name: "NoCredentialsWithoutAuthenticator", noAuth: true, wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys := newTestKeys()
+			api := &API{
+				Logger:   slogt.New(t),
+				Validate: &MockValidator{},
+				APIKeys:  keys,
+				UserData: &testuserdata{},
+			}
+			if !tt.noAuth {
+				api.Auth = testauth{"alice-token": "alice", "bob-token": "bob"}
+			}
+			srv := httptest.NewServer(api)
+			defer srv.Close()
+
+			steps := []struct {
+				method, path string
+				okStatus     int
+			}{
+				{"GET", "/users/alice/export", http.StatusOK},
+				{"DELETE", "/users/alice/data", http.StatusAccepted},
+				{"GET", "/users/alice/data/erasures/1", http.StatusOK},
+			}
+			for _, s := range steps {
+				req, _ := http.NewRequest(s.method, srv.URL+s.path, nil)
+				switch {
+				case tt.scopes != nil:
+					req.Header.Set(apiKeyHeader, keys.add(t, tt.scopes, nil))
+				case tt.token != "":
+					req.Header.Set("Authorization", "Bearer "+tt.token)
+				}
+				resp, err := http.DefaultClient.Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp.Body.Close()
+				want := tt.wantStatus
+				if want == http.StatusOK {
+					want = s.okStatus
+				}
+				if resp.StatusCode != want {
+					t.Errorf("%s %s: got status %d, want %d", s.method, s.path, resp.StatusCode, want)
+				}
+			}
+		})
+	}
+}
+
+// testuserdata is a UserDataStore exporting records of whichever user is
+// asked for, keeping erasure jobs in a slice and erasing the batches in
+// order.
+type testuserdata struct {
+	records  []UserDataRecord
+	err      error
+	jobs     []ErasureJob
+	batches  []ErasureBatch
+	erased   []string            // IDs of the jobs each batch was erased for
+	archives map[string][]string // keys of the archives holding each user's data
+}
+
+func (s *testuserdata) ExportUserData(_ context.Context, userID string, fn func(UserDataRecord) error) error {
+	if s.err != nil {
+		return s.err
+	}
+	for _, rec := range s.records {
+		if (rec.Message != nil && rec.Message.UserID != userID) || (rec.Reaction != nil && rec.Reaction.UserID != userID) {
+			continue
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *testuserdata) InsertErasureJob(_ context.Context, job ErasureJob) (ErasureJob, error) {
+	job.ID = strconv.Itoa(len(s.jobs) + 1)
+	job.CreatedAt = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	job.UpdatedAt = job.CreatedAt
+	s.jobs = append(s.jobs, job)
+	return job, nil
+}
+
+func (s *testuserdata) GetErasureJob(_ context.Context, id string) (*ErasureJob, error) {
+	for _, j := range s.jobs {
+		if j.ID == id {
+			return &j, nil
+		}
+	}
+	return nil, ErrErasureJobNotFound
+}
+
+func (s *testuserdata) ClaimErasureJobs(_ context.Context, limit int, _ time.Duration) ([]ErasureJob, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	var out []ErasureJob
+	for i := range s.jobs {
+		if len(out) < limit && s.jobs[i].Status == ErasurePending {
+			s.jobs[i].Status = ErasureRunning
+			out = append(out, s.jobs[i])
+		}
+	}
+	return out, nil
+}
+
+func (s *testuserdata) EraseUserData(_ context.Context, job ErasureJob, _ int) (ErasureBatch, error) {
+	if len(s.batches) == 0 {
+		return ErasureBatch{}, errors.New("no batches left")
+	}
+	batch := s.batches[0]
+	s.batches = s.batches[1:]
+	s.erased = append(s.erased, job.ID)
+	if batch.Done {
+		for i := range s.jobs {
+			if s.jobs[i].ID == job.ID {
+				s.jobs[i].Status = ErasureDone
+			}
+		}
+	}
+	return batch, nil
+}
+
+func (s *testuserdata) ListUserArchives(_ context.Context, userID string) ([]string, error) {
+	return s.archives[userID], nil
+}
+
+func (s *testuserdata) DeleteArchiveUser(_ context.Context, key, userID string) error {
+	s.archives[userID] = slices.DeleteFunc(s.archives[userID], func(k string) bool { return k == key })
+	return nil
+}
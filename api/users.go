@@ -0,0 +1,254 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// loadUsers returns the profiles of the users, keyed by ID, with one cache
+// lookup and at most one database query however many there are. Users
+// without a profile map to nil, or are left out when their profiles could
+// not be loaded, which leaves messages without authors rather than failing.
+func (a *API) loadUsers(ctx context.Context, ids []string) map[string]*User {
+	if a.Users == nil || len(ids) == 0 {
+		return nil
+	}
+	log := LoggerFrom(ctx)
+	ids = slices.Clone(ids)
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+	users := make(map[string]*User, len(ids))
+	if a.UserCache != nil {
+		cached, err := a.UserCache.GetUsers(ctx, ids)
+		if err != nil {
+			log.Warn("Error getting users from cache, trying database", "error", err.Error())
+		}
+		maps.Copy(users, cached)
+	}
+
+	var missing []string
+	for _, id := range ids {
+		if _, ok := users[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) == 0 {
+		return users
+	}
+	found, err := a.Users.GetUsers(ctx, missing)
+	if err != nil {
+		log.Error("Error getting users from DB, leaving them out", "error", err.Error())
+		return users
+	}
+	loaded := make(map[string]*User, len(missing))
+	for _, id := range missing {
+		loaded[id] = nil
+	}
+	for i := range found {
+		loaded[found[i].ID] = &found[i]
+	}
+	if a.UserCache != nil {
+		if err := a.UserCache.SetUsers(ctx, loaded); err != nil {
+			log.Warn("Could not cache users", "error", err.Error())
+		}
+	}
+	maps.Copy(users, loaded)
+	return users
+}
+
+// evictUser drops the cached profile of a user after it changed.
+func (a *API) evictUser(ctx context.Context, id string) {
+	if a.UserCache == nil {
+		return
+	}
+	if err := a.UserCache.DeleteUser(ctx, id); err != nil {
+		// The cached profile expires on its own, but until then messages
+		// show the old one.
+		LoggerFrom(ctx).Error("Could not evict user from cache", "error", err.Error())
+	}
+}
+
+// requireActive responds 403 and returns false if the user deactivated their
+// profile. Deactivated users can no longer write, as if they were banned.
+func (a *API) requireActive(w http.ResponseWriter, r *http.Request, userID string) bool {
+	u := a.loadUsers(r.Context(), []string{userID})[userID]
+	if u == nil || !u.Deactivated {
+		return true
+	}
+	err := fmt.Errorf("user %s is deactivated", userID)
+	a.respondError(w, r, http.StatusForbidden, err, "User is deactivated")
+	return false
+}
+
+// user represents the user DTO.
+type user struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+	Deactivated bool   `json:"deactivated,omitempty"`
+	CreatedAt   string `json:"created_at"`
+	UpdatedAt   string `json:"updated_at"`
+}
+
+// toUser converts a profile to the DTO, or nil for users without one.
+func toUser(u *User) *user {
+	if u == nil {
+		return nil
+	}
+	return &user{
+		ID:          u.ID,
+		Name:        u.Name,
+		AvatarURL:   u.AvatarURL,
+		Deactivated: u.Deactivated,
+		CreatedAt:   u.CreatedAt.Format(time.RFC1123),
+		UpdatedAt:   u.UpdatedAt.Format(time.RFC1123),
+	}
+}
+
+func (a *API) createUser(w http.ResponseWriter, r *http.Request) {
+	type request struct {
+		UserID    string `json:"user_id" validate:"required,max=255"`
+		Name      string `json:"name" validate:"required,max=100"`
+		AvatarURL string `json:"avatar_url" validate:"omitempty,max=2048,http_url"`
+	}
+
+	log := LoggerFrom(r.Context())
+	var body request
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		log.Warn("Error decoding request body", "error", err.Error())
+		a.respondError(w, r, http.StatusBadRequest, err, "Could not decode request body")
+		return
+	}
+	r.Body.Close()
+	userID, ok := a.authorizeAccount(w, r, body.UserID, ScopeAdmin)
+	if !ok {
+		return
+	}
+	body.UserID = userID
+	if err := a.Validate.Struct(body); err != nil {
+		a.respondError(w, r, http.StatusBadRequest, err, "Validation failed")
+		return
+	}
+	setUser(r.Context(), body.UserID)
+
+	u, err := a.Users.InsertUser(r.Context(), User{
+		ID:        body.UserID,
+		Name:      body.Name,
+		AvatarURL: body.AvatarURL,
+		CreatedAt: time.Now(),
+	})
+	if errors.Is(err, ErrUserExists) {
+		a.respondError(w, r, http.StatusConflict, err, "User already exists")
+		return
+	}
+	if err != nil {
+		log.Error("Error creating user in DB", "error", err.Error())
+		a.respondError(w, r, http.StatusInternalServerError, err, "Could not create user")
+		return
+	}
+	log.Info("Created user")
+	// The cache may remember that the user had no profile.
+	a.evictUser(r.Context(), u.ID)
+	a.respond(w, http.StatusCreated, toUser(&u))
+}
+
+func (a *API) getUser(w http.ResponseWriter, r *http.Request) {
+	u, err := a.Users.GetUser(r.Context(), r.PathValue("userID"))
+	if errors.Is(err, ErrUserNotFound) {
+		a.respondError(w, r, http.StatusNotFound, err, "User not found")
+		return
+	}
+	if err != nil {
+		LoggerFrom(r.Context()).Error("Error getting user from DB", "error", err.Error())
+		a.respondError(w, r, http.StatusInternalServerError, err, "Could not get user")
+		return
+	}
+	a.respond(w, http.StatusOK, toUser(u))
+}
+
+// updateUser changes the fields given in the body, leaving the others as
+// they are. An empty avatar_url removes the avatar.
+func (a *API) updateUser(w http.ResponseWriter, r *http.Request) {
+	type request struct {
+		Name      *string `json:"name" validate:"omitnil,min=1,max=100"`
+		AvatarURL *string `json:"avatar_url" validate:"omitnil,omitempty,max=2048,http_url"`
+	}
+
+	log := LoggerFrom(r.Context())
+	userID, ok := a.authorizeAccount(w, r, r.PathValue("userID"), ScopeAdmin)
+	if !ok {
+		return
+	}
+	var body request
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		log.Warn("Error decoding request body", "error", err.Error())
+		a.respondError(w, r, http.StatusBadRequest, err, "Could not decode request body")
+		return
+	}
+	r.Body.Close()
+	if err := a.Validate.Struct(body); err != nil {
+		a.respondError(w, r, http.StatusBadRequest, err, "Validation failed")
+		return
+	}
+	setUser(r.Context(), userID)
+
+	u, err := a.Users.GetUser(r.Context(), userID)
+	if err == nil && u.Deactivated {
+		err := fmt.Errorf("user %s is deactivated", userID)
+		a.respondError(w, r, http.StatusForbidden, err, "User is deactivated")
+		return
+	}
+	if err == nil {
+		if body.Name != nil {
+			u.Name = *body.Name
+		}
+		if body.AvatarURL != nil {
+			u.AvatarURL = *body.AvatarURL
+		}
+		var updated User
+		updated, err = a.Users.UpdateUser(r.Context(), *u)
+		u = &updated
+	}
+	if errors.Is(err, ErrUserNotFound) {
+		a.respondError(w, r, http.StatusNotFound, err, "User not found")
+		return
+	}
+	if err != nil {
+		log.Error("Error updating user in DB", "error", err.Error())
+		a.respondError(w, r, http.StatusInternalServerError, err, "Could not update user")
+		return
+	}
+	log.Info("Updated user")
+	a.evictUser(r.Context(), userID)
+	a.respond(w, http.StatusOK, toUser(u))
+}
+
+// deactivateUser marks the profile deactivated. It is kept, as the user's
+// messages are, but the user can no longer write.
+func (a *API) deactivateUser(w http.ResponseWriter, r *http.Request) {
+	log := LoggerFrom(r.Context())
+	userID, ok := a.authorizeAccount(w, r, r.PathValue("userID"), ScopeAdmin)
+	if !ok {
+		return
+	}
+	setUser(r.Context(), userID)
+	_, err := a.Users.DeactivateUser(r.Context(), userID)
+	if errors.Is(err, ErrUserNotFound) {
+		a.respondError(w, r, http.StatusNotFound, err, "User not found")
+		return
+	}
+	if err != nil {
+		log.Error("Error deactivating user in DB", "error", err.Error())
+		a.respondError(w, r, http.StatusInternalServerError, err, "Could not deactivate user")
+		return
+	}
+	log.Info("Deactivated user")
+	a.evictUser(r.Context(), userID)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,383 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/neilotoole/slogt"
+)
+
+func TestAPI_listMessages_users(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := &testusers{users: map[string]User{
+		"bob": {ID: "bob", Name: "Bob", CreatedAt: created, UpdatedAt: created},
+	}}
+	cache := &testusercache{users: map[string]*User{
+		"alice": {ID: "alice", Name: "Alice", AvatarURL: "https://example.com/a.png", CreatedAt: created, UpdatedAt: created},
+	}}
+	api := &API{
+		Logger: slogt.New(t),
+		DB: &testdb{
+			T: t,
+			listMessages: func(t *testing.T, excludeMsgIDs ...string) ([]Message, error) {
+				return nil, nil
+			},
+		},
+		Cache: &testcache{
+			T: t,
+			listMessages: func(t *testing.T) ([]Message, error) {
+				return []Message{
+					{ID: "1", Text: "Hi", UserID: "alice", CreatedAt: created},
+					{ID: "2", Text: "Hey", UserID: "bob", CreatedAt: created},
+					{ID: "3", Text: "Yo", UserID: "carol", CreatedAt: created},
+					{ID: "4", Text: "Bye", UserID: "bob", CreatedAt: created},
+				}, nil
+			},
+		},
+		Validate:  &MockValidator{},
+		Users:     store,
+		UserCache: cache,
+	}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	resp := doWithKey(t, "GET", srv.URL+"/messages", "", "")
+	checkStatus(t, resp.StatusCode, http.StatusOK)
+	checkBody(t, resp, `{
+		"messages": [
+			{
+				"id": "1",
+				"text": "Hi",
+				"user_id": "alice",
+				"created_at": "Mon, 01 Jan 2024 00:00:00 UTC",
+				"message_reactions": [],
+				"user": {
+					"id": "alice",
+					"name": "Alice",
+					"avatar_url": "https://example.com/a.png",
+					"created_at": "Mon, 01 Jan 2024 00:00:00 UTC",
+					"updated_at": "Mon, 01 Jan 2024 00:00:00 UTC"
+				}
+			},
+			{
+				"id": "2",
+				"text": "Hey",
+				"user_id": "bob",
+				"created_at": "Mon, 01 Jan 2024 00:00:00 UTC",
+				"message_reactions": [],
+				"user": {
+					"id": "bob",
+					"name": "Bob",
+					"created_at": "Mon, 01 Jan 2024 00:00:00 UTC",
+					"updated_at": "Mon, 01 Jan 2024 00:00:00 UTC"
+				}
+			},
+			{
+				"id": "3",
+				"text": "Yo",
+				"user_id": "carol",
+				"created_at": "Mon, 01 Jan 2024 00:00:00 UTC",
+				"message_reactions": []
+			},
+			{
+				"id": "4",
+				"text": "Bye",
+				"user_id": "bob",
+				"created_at": "Mon, 01 Jan 2024 00:00:00 UTC",
+				"message_reactions": [],
+				"user": {
+					"id": "bob",
+					"name": "Bob",
+					"created_at": "Mon, 01 Jan 2024 00:00:00 UTC",
+					"updated_at": "Mon, 01 Jan 2024 00:00:00 UTC"
+				}
+			}
+		]
+	}`)
+
+	// The authors missing from the cache are loaded at once, and cached,
+	// including that carol has no profile.
+	if len(store.batches) != 1 || !slices.Equal(store.batches[0], []string{"bob", "carol"}) {
+		t.Errorf("Got batches %v, want bob and carol at once", store.batches)
+	}
+	if u, ok := cache.users["carol"]; !ok || u != nil {
+		t.Errorf("Got cached carol %+v, %t, want no profile cached", u, ok)
+	}
+
+	// The second time, everything is cached.
+	resp = doWithKey(t, "GET", srv.URL+"/messages", "", "")
+	checkStatus(t, resp.StatusCode, http.StatusOK)
+	if len(store.batches) != 1 {
+		t.Errorf("Got %d batches, want the profiles cached", len(store.batches))
+	}
+}
+
+func TestAPI_users(t *testing.T) {
+	store := &testusers{users: map[string]User{}}
+	cache := &testusercache{users: map[string]*User{"alice": nil}}
+	api := &API{
+		Logger:    slogt.New(t),
+		Validate:  &MockValidator{},
+		Users:     store,
+		UserCache: cache,
+	}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	resp := doWithKey(t, "GET", srv.URL+"/users/alice", "", "")
+	checkStatus(t, resp.StatusCode, http.StatusNotFound)
+
+	resp = doWithKey(t, "POST", srv.URL+"/users", "", `{"user_id": "alice", "name": "Alice"}`)
+	checkStatus(t, resp.StatusCode, http.StatusCreated)
+	checkBody(t, resp, `{
+		"id": "alice",
+		"name": "Alice",
+		"created_at": "Mon, 01 Jan 2024 00:00:00 UTC",
+		"updated_at": "Mon, 01 Jan 2024 00:00:00 UTC"
+	}`)
+	if _, ok := cache.users["alice"]; ok {
+		t.Error("Kept caching that alice has no profile")
+	}
+	resp = doWithKey(t, "POST", srv.URL+"/users", "", `{"user_id": "alice", "name": "Alice"}`)
+	checkStatus(t, resp.StatusCode, http.StatusConflict)
+
+	cache.users["alice"] = &User{ID: "alice", Name: "Alice"}
+	resp = doWithKey(t, "PATCH", srv.URL+"/users/alice", "", `{"avatar_url": "https://example.com/a.png"}`)
+	checkStatus(t, resp.StatusCode, http.StatusOK)
+	checkBody(t, resp, `{
+		"id": "alice",
+		"name": "Alice",
+		"avatar_url": "https://example.com/a.png",
+		"created_at": "Mon, 01 Jan 2024 00:00:00 UTC",
+		"updated_at": "Mon, 01 Jan 2024 00:00:00 UTC"
+	}`)
+	if _, ok := cache.users["alice"]; ok {
+		t.Error("Kept the cached profile after updating it")
+	}
+
+	resp = doWithKey(t, "DELETE", srv.URL+"/users/alice", "", "")
+	checkStatus(t, resp.StatusCode, http.StatusNoContent)
+	resp = doWithKey(t, "GET", srv.URL+"/users/alice", "", "")
+	checkStatus(t, resp.StatusCode, http.StatusOK)
+	checkBody(t, resp, `{
+		"id": "alice",
+		"name": "Alice",
+		"avatar_url": "https://example.com/a.png",
+		"deactivated": true,
+		"created_at": "Mon, 01 Jan 2024 00:00:00 UTC",
+		"updated_at": "Mon, 01 Jan 2024 00:00:00 UTC"
+	}`)
+	resp = doWithKey(t, "PATCH", srv.URL+"/users/alice", "", `{"name": "Al"}`)
+	checkStatus(t, resp.StatusCode, http.StatusForbidden)
+	checkBody(t, resp, `{"error": "User is deactivated"}`)
+	resp = doWithKey(t, "PATCH", srv.URL+"/users/bob", "", `{"name": "Bob"}`)
+	checkStatus(t, resp.StatusCode, http.StatusNotFound)
+}
+
+func TestAPI_users_avatarURL(t *testing.T) {
+	tests := []struct {
+		name       string
+		url        string
+		wantStatus int
+	}{
+		{name: "HTTPS", url: "https://example.com/a.png", wantStatus: http.StatusCreated},
+		{name: "HTTP", url: "http://example.com/a.png", wantStatus: http.StatusCreated},
+		{name: "JavaScript", url: "javascript:alert(1)", wantStatus: http.StatusBadRequest},
+		{name: "Data", url: "data:image/png;base64,AAAA", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &API{
+				Logger:   slogt.New(t),
+				Validate: validator.New(),
+				Users:    &testusers{users: map[string]User{"bob": {ID: "bob", Name: "Bob"}}},
+			}
+			srv := httptest.NewServer(api)
+			defer srv.Close()
+
+			resp := doWithKey(t, "POST", srv.URL+"/users", "",
+				`{"user_id": "alice", "name": "Alice", "avatar_url": "`+tt.url+`"}`)
+			checkStatus(t, resp.StatusCode, tt.wantStatus)
+			want := tt.wantStatus
+			if want == http.StatusCreated {
+				want = http.StatusOK
+			}
+			resp = doWithKey(t, "PATCH", srv.URL+"/users/bob", "", `{"avatar_url": "`+tt.url+`"}`)
+			checkStatus(t, resp.StatusCode, want)
+		})
+	}
+}
+
+func TestAPI_deactivatedWrites(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		req  string
+	}{
+		{name: "Message", path: "/messages", req: `{"text": "hello", "user_id": "alice"}`},
+		{name: "Reaction", path: "/messages/m1/reactions", req: `{"type": "like", "user_id": "alice"}`},
+		{name: "Flag", path: "/messages/m1/flag", req: `{"user_id": "alice", "reason": "spam"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &API{
+				Logger:   slogt.New(t),
+				DB:       &testdb{T: t},
+				Cache:    &testcache{T: t},
+				Validate: &MockValidator{},
+				Users: &testusers{users: map[string]User{
+					"alice": {ID: "alice", Name: "Alice", Deactivated: true},
+				}},
+			}
+			srv := httptest.NewServer(api)
+			defer srv.Close()
+
+			resp := doWithKey(t, "POST", srv.URL+tt.path, "", tt.req)
+			checkStatus(t, resp.StatusCode, http.StatusForbidden)
+			checkBody(t, resp, `{"error": "User is deactivated"}`)
+		})
+	}
+}
+
+func TestAPI_users_authorization(t *testing.T) {
+	tests := []struct {
+		name       string
+		token      string
+		scopes     []string // of an API key to send instead of a token
+		wantStatus int
+	}{
+		{name: "Owner", token: "alice-token", wantStatus: http.StatusOK},
+		{name: "OtherUser", token: "bob-token", wantStatus: http.StatusForbidden},
+		{name: "APIKeyWithoutAdmin", scopes: []string{ScopeMessagesWrite}, wantStatus: http.StatusForbidden},
+		{name: "AdminAPIKey", scopes: []string{ScopeAdmin}, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys := newTestKeys()
+			api := &API{
+				Logger:   slogt.New(t),
+				Validate: &MockValidator{},
+				Auth:     testauth{"alice-token": "alice", "bob-token": "bob"},
+				APIKeys:  keys,
+				Users:    &testusers{users: map[string]User{"alice": {ID: "alice", Name: "Alice"}}},
+			}
+			srv := httptest.NewServer(api)
+			defer srv.Close()
+
+			steps := []struct {
+				method, path, body string
+				okStatus           int
+			}{
+				{"POST", "/users", `{"user_id": "alice", "name": "Alice"}`, http.StatusConflict},
+				{"PATCH", "/users/alice", `{"name": "Al"}`, http.StatusOK},
+				{"DELETE", "/users/alice", "", http.StatusNoContent},
+			}
+			for _, s := range steps {
+				req, _ := http.NewRequest(s.method, srv.URL+s.path, strings.NewReader(s.body))
+				if tt.scopes != nil {
+					req.Header.Set(apiKeyHeader, keys.add(t, tt.scopes, nil))
+				} else {
+					req.Header.Set("Authorization", "Bearer "+tt.token)
+				}
+				resp, err := http.DefaultClient.Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp.Body.Close()
+				want := tt.wantStatus
+				if want == http.StatusOK {
+					want = s.okStatus
+				}
+				if resp.StatusCode != want {
+					t.Errorf("%s %s: got status %d, want %d", s.method, s.path, resp.StatusCode, want)
+				}
+			}
+		})
+	}
+}
+
+// testusers is a UserStore of profiles kept in a map, recording the batches
+// of profiles it was asked for.
+type testusers struct {
+	users   map[string]User
+	batches [][]string
+}
+
+func (s *testusers) InsertUser(_ context.Context, user User) (User, error) {
+	if _, ok := s.users[user.ID]; ok {
+		return User{}, ErrUserExists
+	}
+	user.CreatedAt = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	user.UpdatedAt = user.CreatedAt
+	s.users[user.ID] = user
+	return user, nil
+}
+
+func (s *testusers) GetUser(_ context.Context, id string) (*User, error) {
+	u, ok := s.users[id]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return &u, nil
+}
+
+func (s *testusers) GetUsers(_ context.Context, ids []string) ([]User, error) {
+	s.batches = append(s.batches, ids)
+	var out []User
+	for _, id := range ids {
+		if u, ok := s.users[id]; ok {
+			out = append(out, u)
+		}
+	}
+	return out, nil
+}
+
+func (s *testusers) UpdateUser(_ context.Context, user User) (User, error) {
+	if _, ok := s.users[user.ID]; !ok {
+		return User{}, ErrUserNotFound
+	}
+	s.users[user.ID] = user
+	return user, nil
+}
+
+func (s *testusers) DeactivateUser(_ context.Context, id string) (*User, error) {
+	u, ok := s.users[id]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	u.Deactivated = true
+	s.users[id] = u
+	return &u, nil
+}
+
+type testusercache struct {
+	users map[string]*User
+}
+
+func (c *testusercache) GetUsers(_ context.Context, ids []string) (map[string]*User, error) {
+	out := make(map[string]*User)
+	for _, id := range ids {
+		if u, ok := c.users[id]; ok {
+			out[id] = u
+		}
+	}
+	return out, nil
+}
+
+func (c *testusercache) SetUsers(_ context.Context, users map[string]*User) error {
+	for id, u := range users {
+		c.users[id] = u
+	}
+	return nil
+}
+
+func (c *testusercache) DeleteUser(_ context.Context, id string) error {
+	delete(c.users, id)
+	return nil
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// jwk is a single key in a JSON Web Key Set (RFC 7517). Only RSA ("RSA")
+// and symmetric ("oct") keys are supported.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	K   string `json:"k"`
+}
+
+func parseJWKS(b []byte) (map[string]key, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, fmt.Errorf("parse jwks: %w", err)
+	}
+
+	keys := make(map[string]key, len(set.Keys))
+	for i, k := range set.Keys {
+		if k.Kid == "" {
+			return nil, fmt.Errorf("jwks key %d: missing kid", i)
+		}
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		parsed, err := k.parse()
+		if err != nil {
+			return nil, fmt.Errorf("jwks key %q: %w", k.Kid, err)
+		}
+		keys[k.Kid] = parsed
+	}
+	return keys, nil
+}
+
+func (k jwk) parse() (key, error) {
+	switch k.Kty {
+	case "oct":
+		if k.Alg != "" && k.Alg != "HS256" {
+			return key{}, fmt.Errorf("unsupported algorithm %q", k.Alg)
+		}
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil || len(secret) == 0 {
+			return key{}, errors.New("invalid k")
+		}
+		return key{alg: "HS256", secret: secret}, nil
+	case "RSA":
+		if k.Alg != "" && k.Alg != "RS256" {
+			return key{}, fmt.Errorf("unsupported algorithm %q", k.Alg)
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil || len(n) == 0 {
+			return key{}, errors.New("invalid n")
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return key{}, errors.New("invalid e")
+		}
+		return key{alg: "RS256", rsa: &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}}, nil
+	}
+	return key{}, fmt.Errorf("unsupported key type %q", k.Kty)
+}
@@ -0,0 +1,288 @@
+// Package auth verifies the credentials API clients present.
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInvalidToken is returned for tokens that are malformed, signed with
+	// an unknown key or carry a bad signature.
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrExpired is returned for tokens outside their validity period.
+	ErrExpired = errors.New("token expired")
+)
+
+// Config configures the keys and claims a Verifier accepts. Tokens with a
+// "kid" header are checked against the JWKS file; tokens without one against
+// the static HS256 secret or RSA key.
+type Config struct {
+	HS256Secret  []byte
+	RSAPublicKey *rsa.PublicKey
+	JWKSFile     string
+	Issuer       string        // required "iss", if set
+	Audience     string        // required "aud", if set
+	Leeway       time.Duration // allowed clock skew for "exp" and "nbf"
+}
+
+// A Verifier verifies HS256 and RS256 signed JWTs.
+type Verifier struct {
+	cfg    Config
+	logger *slog.Logger
+	now    func() time.Time
+
+	mu       sync.RWMutex
+	jwks     map[string]key // by kid
+	jwksTime time.Time      // modification time of the loaded JWKS file
+}
+
+// A key is either an HMAC secret or an RSA public key.
+type key struct {
+	alg    string
+	secret []byte
+	rsa    *rsa.PublicKey
+}
+
+// NewVerifier returns a verifier for cfg, loading the JWKS file if one is
+// configured.
+func NewVerifier(cfg Config, logger *slog.Logger) (*Verifier, error) {
+	if cfg.HS256Secret == nil && cfg.RSAPublicKey == nil && cfg.JWKSFile == "" {
+		return nil, errors.New("no keys configured")
+	}
+	v := &Verifier{
+		cfg:    cfg,
+		logger: logger,
+		now:    time.Now,
+	}
+	if cfg.JWKSFile != "" {
+		if err := v.reload(); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// Watch reloads the JWKS file whenever it changes, checking every interval
+// until ctx is cancelled. This lets keys be rotated without a restart: add
+// the new key, start issuing tokens with it, then remove the old key once
+// its tokens have expired.
+func (v *Verifier) Watch(ctx context.Context, interval time.Duration) {
+	if v.cfg.JWKSFile == "" {
+		return
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if err := v.reload(); err != nil {
+			v.logger.Error("Could not reload JWKS, keeping previous keys", "error", err.Error())
+		}
+	}
+}
+
+func (v *Verifier) reload() error {
+	fi, err := os.Stat(v.cfg.JWKSFile)
+	if err != nil {
+		return fmt.Errorf("stat jwks: %w", err)
+	}
+	v.mu.RLock()
+	unchanged := fi.ModTime().Equal(v.jwksTime)
+	v.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	b, err := os.ReadFile(v.cfg.JWKSFile)
+	if err != nil {
+		return fmt.Errorf("read jwks: %w", err)
+	}
+	keys, err := parseJWKS(b)
+	if err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	v.jwks = keys
+	v.jwksTime = fi.ModTime()
+	v.mu.Unlock()
+	v.logger.Info("Loaded JWKS", "keys", len(keys))
+	return nil
+}
+
+// Authenticate verifies the token and returns its subject.
+func (v *Verifier) Authenticate(_ context.Context, token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("%w: malformed", ErrInvalidToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return "", fmt.Errorf("%w: header: %w", ErrInvalidToken, err)
+	}
+	k, err := v.key(header.Alg, header.Kid)
+	if err != nil {
+		return "", err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", fmt.Errorf("%w: signature: %w", ErrInvalidToken, err)
+	}
+	if !k.verify(parts[0]+"."+parts[1], sig) {
+		return "", fmt.Errorf("%w: bad signature", ErrInvalidToken)
+	}
+
+	var c claims
+	if err := decodeSegment(parts[1], &c); err != nil {
+		return "", fmt.Errorf("%w: claims: %w", ErrInvalidToken, err)
+	}
+	if err := v.validate(c); err != nil {
+		return "", err
+	}
+	return c.Subject, nil
+}
+
+// key returns the key for the token header. The key type must match the
+// algorithm, so an RSA public key can never be used as an HMAC secret.
+func (v *Verifier) key(alg, kid string) (key, error) {
+	if kid != "" {
+		v.mu.RLock()
+		k, ok := v.jwks[kid]
+		v.mu.RUnlock()
+		if !ok {
+			return key{}, fmt.Errorf("%w: unknown key %q", ErrInvalidToken, kid)
+		}
+		if k.alg != alg {
+			return key{}, fmt.Errorf("%w: key %q is not for %s", ErrInvalidToken, kid, alg)
+		}
+		return k, nil
+	}
+
+	switch {
+	case alg == "HS256" && v.cfg.HS256Secret != nil:
+		return key{alg: alg, secret: v.cfg.HS256Secret}, nil
+	case alg == "RS256" && v.cfg.RSAPublicKey != nil:
+		return key{alg: alg, rsa: v.cfg.RSAPublicKey}, nil
+	}
+	return key{}, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, alg)
+}
+
+func (k key) verify(signed string, sig []byte) bool {
+	switch k.alg {
+	case "HS256":
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write([]byte(signed))
+		return hmac.Equal(sig, mac.Sum(nil))
+	case "RS256":
+		sum := sha256.Sum256([]byte(signed))
+		return rsa.VerifyPKCS1v15(k.rsa, crypto.SHA256, sum[:], sig) == nil
+	}
+	return false
+}
+
+type claims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	ExpiresAt *int64   `json:"exp"`
+	NotBefore *int64   `json:"nbf"`
+}
+
+func (v *Verifier) validate(c claims) error {
+	now := v.now()
+	if c.Subject == "" {
+		return fmt.Errorf("%w: missing subject", ErrInvalidToken)
+	}
+	if c.ExpiresAt == nil {
+		return fmt.Errorf("%w: missing expiry", ErrInvalidToken)
+	}
+	if now.Add(-v.cfg.Leeway).After(time.Unix(*c.ExpiresAt, 0)) {
+		return ErrExpired
+	}
+	if c.NotBefore != nil && now.Add(v.cfg.Leeway).Before(time.Unix(*c.NotBefore, 0)) {
+		return fmt.Errorf("%w: not valid yet", ErrExpired)
+	}
+	if v.cfg.Issuer != "" && c.Issuer != v.cfg.Issuer {
+		return fmt.Errorf("%w: issuer %q", ErrInvalidToken, c.Issuer)
+	}
+	if v.cfg.Audience != "" && !c.Audience.contains(v.cfg.Audience) {
+		return fmt.Errorf("%w: audience %v", ErrInvalidToken, []string(c.Audience))
+	}
+	return nil
+}
+
+// audience is the "aud" claim, which may be a single string or a list.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*a = audience{s}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(a))
+}
+
+func (a audience) contains(s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeSegment(seg string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// LoadRSAPublicKey reads a PEM encoded RSA public key, either PKIX
+// ("PUBLIC KEY") or PKCS #1 ("RSA PUBLIC KEY").
+func LoadRSAPublicKey(path string) (*rsa.PublicKey, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read key: %w", err)
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("no PEM block in key file")
+	}
+	if block.Type == "RSA PUBLIC KEY" {
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse key: %w", err)
+	}
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("key is %T, not RSA", pub)
+	}
+	return rsaPub, nil
+}
@@ -0,0 +1,298 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/neilotoole/slogt"
+)
+
+var now = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestVerifier_Authenticate(t *testing.T) {
+	secret := []byte("secret")
+	rsaKey := generateRSAKey(t)
+	otherRSAKey := generateRSAKey(t)
+
+	valid := map[string]any{"sub": "alice", "aud": "messages", "exp": now.Add(time.Hour).Unix()}
+	with := func(extra map[string]any) map[string]any {
+		c := map[string]any{}
+		for k, v := range valid {
+			c[k] = v
+		}
+		for k, v := range extra {
+			c[k] = v
+		}
+		return c
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		want    string
+		wantErr error
+	}{
+		{
+			name:  "HS256",
+			token: signHS256(t, secret, "", valid),
+			want:  "alice",
+		},
+		{
+			name:  "RS256",
+			token: signRS256(t, rsaKey, "", valid),
+			want:  "alice",
+		},
+		{
+			name:  "AudienceList",
+			token: signHS256(t, secret, "", with(map[string]any{"aud": []string{"other", "messages"}})),
+			want:  "alice",
+		},
+		{
+			name:    "WrongSecret",
+			token:   signHS256(t, []byte("wrong"), "", valid),
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "WrongRSAKey",
+			token:   signRS256(t, otherRSAKey, "", valid),
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "AlgNone",
+			token:   segment(t, map[string]any{"alg": "none"}) + "." + segment(t, valid) + ".",
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "Malformed",
+			token:   "not-a-jwt",
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "Expired",
+			token:   signHS256(t, secret, "", with(map[string]any{"exp": now.Add(-time.Minute).Unix()})),
+			wantErr: ErrExpired,
+		},
+		{
+			name:  "ExpiredWithinLeeway",
+			token: signHS256(t, secret, "", with(map[string]any{"exp": now.Add(-time.Second).Unix()})),
+			want:  "alice",
+		},
+		{
+			name:    "NotYetValid",
+			token:   signHS256(t, secret, "", with(map[string]any{"nbf": now.Add(time.Minute).Unix()})),
+			wantErr: ErrExpired,
+		},
+		{
+			name:    "MissingExpiry",
+			token:   signHS256(t, secret, "", map[string]any{"sub": "alice", "aud": "messages"}),
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "MissingSubject",
+			token:   signHS256(t, secret, "", map[string]any{"aud": "messages", "exp": now.Add(time.Hour).Unix()}),
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "WrongAudience",
+			token:   signHS256(t, secret, "", with(map[string]any{"aud": "other"})),
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "UnknownKid",
+			token:   signHS256(t, secret, "nope", valid),
+			wantErr: ErrInvalidToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewVerifier(Config{
+				HS256Secret:  secret,
+				RSAPublicKey: &rsaKey.PublicKey,
+				Audience:     "messages",
+				Leeway:       5 * time.Second,
+			}, slogt.New(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+			v.now = func() time.Time { return now }
+
+			got, err := v.Authenticate(context.Background(), tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Got error %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Got subject %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifier_JWKSRotation(t *testing.T) {
+	oldKey := generateRSAKey(t)
+	newKey := generateRSAKey(t)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	claims := map[string]any{"sub": "alice", "exp": now.Add(time.Hour).Unix()}
+
+	writeJWKS(t, path, time.Unix(1, 0), map[string]*rsa.PrivateKey{"old": oldKey})
+	v, err := NewVerifier(Config{JWKSFile: path}, slogt.New(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.now = func() time.Time { return now }
+
+	authenticate := func(kid string, key *rsa.PrivateKey) error {
+		_, err := v.Authenticate(context.Background(), signRS256(t, key, kid, claims))
+		return err
+	}
+
+	if err := authenticate("old", oldKey); err != nil {
+		t.Fatalf("Old key rejected: %v", err)
+	}
+	if err := authenticate("new", newKey); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Got %v for new key before rotation, want ErrInvalidToken", err)
+	}
+
+	// Publish the new key next to the old one.
+	writeJWKS(t, path, time.Unix(2, 0), map[string]*rsa.PrivateKey{"old": oldKey, "new": newKey})
+	if err := v.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if err := authenticate("old", oldKey); err != nil {
+		t.Errorf("Old key rejected during rotation: %v", err)
+	}
+	if err := authenticate("new", newKey); err != nil {
+		t.Errorf("New key rejected during rotation: %v", err)
+	}
+
+	// Retire the old key.
+	writeJWKS(t, path, time.Unix(3, 0), map[string]*rsa.PrivateKey{"new": newKey})
+	if err := v.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if err := authenticate("old", oldKey); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Got %v for retired key, want ErrInvalidToken", err)
+	}
+
+	// A broken file keeps the previous keys.
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, time.Unix(4, 0), time.Unix(4, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.reload(); err == nil {
+		t.Error("Expected error for broken JWKS")
+	}
+	if err := authenticate("new", newKey); err != nil {
+		t.Errorf("New key rejected after broken reload: %v", err)
+	}
+}
+
+func TestVerifier_KeyTypeMustMatchAlg(t *testing.T) {
+	rsaKey := generateRSAKey(t)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, time.Unix(1, 0), map[string]*rsa.PrivateKey{"rsa": rsaKey})
+	v, err := NewVerifier(Config{JWKSFile: path}, slogt.New(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An HS256 token "signed" with the RSA key id must not be accepted.
+	token := signHS256(t, rsaKey.PublicKey.N.Bytes(), "rsa", map[string]any{"sub": "mallory", "exp": time.Now().Add(time.Hour).Unix()})
+	if _, err := v.Authenticate(context.Background(), token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Got %v, want ErrInvalidToken", err)
+	}
+}
+
+func generateRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func segment(t *testing.T, v any) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func header(t *testing.T, alg, kid string) string {
+	h := map[string]any{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		h["kid"] = kid
+	}
+	return segment(t, h)
+}
+
+func signHS256(t *testing.T, secret []byte, kid string, claims map[string]any) string {
+	t.Helper()
+	signed := header(t, "HS256", kid) + "." + segment(t, claims)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]any) string {
+	t.Helper()
+	signed := header(t, "RS256", kid) + "." + segment(t, claims)
+	sum := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func writeJWKS(t *testing.T, path string, mtime time.Time, keys map[string]*rsa.PrivateKey) {
+	t.Helper()
+	type jwk struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Alg string `json:"alg"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	for kid, key := range keys {
+		set.Keys = append(set.Keys, jwk{
+			Kty: "RSA",
+			Kid: kid,
+			Alg: "RS256",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		})
+	}
+	b, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// Set the modification time explicitly; writes in quick succession may
+	// otherwise share one.
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,66 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+)
+
+func TestLocal(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	l, err := NewLocal(filepath.Join(dir, "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l.Put(ctx, "attachments/1", strings.NewReader("hello"), 5, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	r, err := l.Get(ctx, "attachments/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(r)
+	r.Close()
+	if string(b) != "hello" {
+		t.Errorf("Got %q, want hello", b)
+	}
+
+	if err := l.Delete(ctx, "attachments/1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Get(ctx, "attachments/1"); !errors.Is(err, api.ErrBlobNotFound) {
+		t.Errorf("Got %v after deleting, want ErrBlobNotFound", err)
+	}
+	if err := l.Delete(ctx, "attachments/1"); err != nil {
+		t.Errorf("Got %v deleting twice, want nil", err)
+	}
+
+	// No temporary files are left behind.
+	entries, err := os.ReadDir(filepath.Join(dir, "blobs", "attachments"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Got %d files left, want none", len(entries))
+	}
+}
+
+func TestLocal_InvalidKey(t *testing.T) {
+	l, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"", "/etc/passwd", "../outside", "a/../../outside"} {
+		if err := l.Put(context.Background(), key, strings.NewReader("x"), 1, ""); err == nil {
+			t.Errorf("Put(%q) succeeded, want an error", key)
+		}
+	}
+}
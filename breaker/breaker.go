@@ -0,0 +1,217 @@
+// Package breaker provides circuit breakers that make calls to an unhealthy
+// dependency fail fast instead of waiting for it to time out.
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ErrOpen is returned instead of calling the dependency while a breaker is
+// open.
+var ErrOpen = errors.New("circuit breaker is open")
+
+// ErrTimeout wraps the error of a call that ran out of the breaker's
+// Timeout. It always counts as a failure.
+var ErrTimeout = errors.New("circuit breaker call timed out")
+
+// State is the state of a Breaker.
+type State int
+
+const (
+	// Closed lets all calls through.
+	Closed State = iota
+	// Open rejects all calls with ErrOpen.
+	Open
+	// HalfOpen lets a single trial call through to probe the dependency.
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// Settings configure when a breaker opens and how it recovers.
+type Settings struct {
+	// Threshold is the number of consecutive failures that opens the
+	// breaker.
+	Threshold int
+	// Cooldown is how long the breaker stays open before letting a trial
+	// call through.
+	Cooldown time.Duration
+	// Timeout bounds each call. Zero means calls only end with the caller's
+	// context.
+	Timeout time.Duration
+}
+
+// A Breaker tracks the failures of a single operation. It opens after
+// Threshold consecutive failures, rejects calls for Cooldown and then lets a
+// single trial call through: if the trial succeeds the breaker closes,
+// otherwise it opens again.
+type Breaker struct {
+	name      string
+	settings  Settings
+	logger    *slog.Logger
+	isFailure func(error) bool
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	trial    bool // a half-open trial call is in flight
+}
+
+// New returns a closed breaker. isFailure decides which errors count
+// against the dependency; errors such as a rejected query should not.
+func New(name string, s Settings, logger *slog.Logger, isFailure func(error) bool) *Breaker {
+	return &Breaker{
+		name:      name,
+		settings:  s,
+		logger:    logger,
+		isFailure: isFailure,
+		now:       time.Now,
+	}
+}
+
+// Name returns the name the breaker was created with.
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// State returns the current state of the breaker.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == Open && b.now().Sub(b.openedAt) >= b.settings.Cooldown {
+		return HalfOpen
+	}
+	return b.state
+}
+
+// Do calls fn unless the breaker is open, and records the outcome. A call
+// that fails after ctx is done, because the caller gave up or ran out of
+// time, says nothing about the dependency and is not recorded. A call that
+// fails after running out of Timeout fails with ErrTimeout.
+func (b *Breaker) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+	callCtx := ctx
+	if b.settings.Timeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, b.settings.Timeout)
+		defer cancel()
+	}
+	err := fn(callCtx)
+	if err != nil && ctx.Err() != nil {
+		b.release()
+		return err
+	}
+	if err != nil && callCtx.Err() != nil {
+		err = fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+	b.record(err != nil && (errors.Is(err, ErrTimeout) || b.isFailure(err)))
+	return err
+}
+
+func (b *Breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case Open:
+		if b.now().Sub(b.openedAt) < b.settings.Cooldown {
+			return ErrOpen
+		}
+		b.setState(HalfOpen)
+		fallthrough
+	case HalfOpen:
+		if b.trial {
+			return ErrOpen
+		}
+		b.trial = true
+	}
+	return nil
+}
+
+func (b *Breaker) record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case Closed:
+		if !failed {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.settings.Threshold {
+			b.open()
+		}
+	case HalfOpen:
+		b.trial = false
+		if failed {
+			b.open()
+			return
+		}
+		b.failures = 0
+		b.setState(Closed)
+	}
+	// Calls that were started before the breaker opened are ignored.
+}
+
+// release ends a call without recording it, letting another trial through
+// if it was the trial.
+func (b *Breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == HalfOpen {
+		b.trial = false
+	}
+}
+
+func (b *Breaker) open() {
+	b.openedAt = b.now()
+	b.setState(Open)
+}
+
+func (b *Breaker) setState(s State) {
+	if b.state == s {
+		return
+	}
+	b.logger.Warn("Circuit breaker state changed", "breaker", b.name, "from", b.state.String(), "to", s.String())
+	b.state = s
+}
+
+// call is Do for functions that return a value.
+func call[T any](ctx context.Context, b *Breaker, fn func(ctx context.Context) (T, error)) (T, error) {
+	var out T
+	err := b.Do(ctx, func(ctx context.Context) error {
+		var err error
+		out, err = fn(ctx)
+		return err
+	})
+	return out, err
+}
+
+// states returns the state of each breaker by name.
+func states(breakers ...*Breaker) map[string]string {
+	out := make(map[string]string, len(breakers))
+	for _, b := range breakers {
+		out[b.Name()] = b.State().String()
+	}
+	return out
+}
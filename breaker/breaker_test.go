@@ -0,0 +1,279 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+	"github.com/google/go-cmp/cmp"
+	"github.com/neilotoole/slogt"
+)
+
+func TestBreaker(t *testing.T) {
+	errDown := errors.New("down")
+	errBadInput := errors.New("bad input")
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := New("test", Settings{Threshold: 2, Cooldown: time.Minute}, slogt.New(t), func(err error) bool {
+		return errors.Is(err, errDown)
+	})
+	b.now = func() time.Time { return now }
+
+	steps := []struct {
+		name      string
+		advance   time.Duration
+		err       error // returned by the call
+		wantErr   error
+		wantState State
+	}{
+		{name: "Success", wantState: Closed},
+		{name: "IgnoredError", err: errBadInput, wantErr: errBadInput, wantState: Closed},
+		{name: "FirstFailure", err: errDown, wantErr: errDown, wantState: Closed},
+		{name: "SecondFailureOpens", err: errDown, wantErr: errDown, wantState: Open},
+		{name: "RejectedWhileOpen", wantErr: ErrOpen, wantState: Open},
+		{name: "TrialFails", advance: time.Minute, err: errDown, wantErr: errDown, wantState: Open},
+		{name: "StillOpen", advance: time.Second, wantErr: ErrOpen, wantState: Open},
+		{name: "TrialSucceeds", advance: time.Minute, wantState: Closed},
+	}
+	for _, s := range steps {
+		now = now.Add(s.advance)
+		called := false
+		err := b.Do(context.Background(), func(ctx context.Context) error {
+			called = true
+			return s.err
+		})
+		if !errors.Is(err, s.wantErr) {
+			t.Errorf("%s: got error %v, want %v", s.name, err, s.wantErr)
+		}
+		if called == errors.Is(err, ErrOpen) {
+			t.Errorf("%s: called %t with error %v", s.name, called, err)
+		}
+		if got := b.State(); got != s.wantState {
+			t.Errorf("%s: got state %s, want %s", s.name, got, s.wantState)
+		}
+	}
+}
+
+func TestBreaker_HalfOpenSingleTrial(t *testing.T) {
+	b := New("test", Settings{Threshold: 1}, slogt.New(t), func(error) bool { return true })
+	_ = b.Do(context.Background(), func(ctx context.Context) error { return errors.New("down") })
+
+	// Cooldown is zero, so the next call is the trial. A concurrent call
+	// made while it is in flight must be rejected.
+	err := b.Do(context.Background(), func(ctx context.Context) error {
+		if err := b.Do(ctx, func(ctx context.Context) error { return nil }); !errors.Is(err, ErrOpen) {
+			t.Errorf("Got error %v during trial, want ErrOpen", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := b.State(); got != Closed {
+		t.Errorf("Got state %s, want closed", got)
+	}
+}
+
+func TestBreaker_CallerCancelled(t *testing.T) {
+	b := New("test", Settings{Threshold: 1}, slogt.New(t), func(error) bool { return true })
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// A caller that went away doesn't make the dependency unhealthy.
+	err := b.Do(ctx, func(ctx context.Context) error { return ctx.Err() })
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Got error %v, want context.Canceled", err)
+	}
+	if got := b.State(); got != Closed {
+		t.Errorf("Got state %s after the caller cancelled, want closed", got)
+	}
+
+	// Nor does it close the breaker, or hold up the next trial, when it was
+	// the trial.
+	_ = b.Do(context.Background(), func(ctx context.Context) error { return errors.New("down") })
+	_ = b.Do(ctx, func(ctx context.Context) error { return ctx.Err() })
+	if got := b.State(); got != HalfOpen {
+		t.Errorf("Got state %s after a cancelled trial, want half-open", got)
+	}
+	if err := b.Do(context.Background(), func(ctx context.Context) error { return nil }); err != nil {
+		t.Errorf("Got error %v for the next trial, want it let through", err)
+	}
+	if got := b.State(); got != Closed {
+		t.Errorf("Got state %s, want closed", got)
+	}
+}
+
+func TestBreaker_Timeout(t *testing.T) {
+	// Timeouts count against the dependency even if its errors don't.
+	b := New("test", Settings{Threshold: 1, Cooldown: time.Hour, Timeout: time.Millisecond}, slogt.New(t), func(error) bool { return false })
+	err := b.Do(context.Background(), func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if !errors.Is(err, ErrTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Got error %v, want ErrTimeout", err)
+	}
+	if got := b.State(); got != Open {
+		t.Errorf("Got state %s after a timeout, want open", got)
+	}
+	if err := dbErr(err); !errors.Is(err, api.ErrDBUnavailable) {
+		t.Errorf("Got DB error %v, want ErrDBUnavailable", err)
+	}
+	if err := cacheErr(err); !errors.Is(err, api.ErrCacheUnavailable) {
+		t.Errorf("Got cache error %v, want ErrCacheUnavailable", err)
+	}
+}
+
+func TestDB(t *testing.T) {
+	fail := errors.New("not found")
+	db := NewDB(&testdb{err: fmt.Errorf("dial: %w", api.ErrDBUnavailable)}, Settings{Threshold: 1, Cooldown: time.Hour}, slogt.New(t))
+
+	if _, err := db.InsertMessage(context.Background(), api.Message{}); !errors.Is(err, api.ErrDBUnavailable) {
+		t.Fatalf("Got error %v, want ErrDBUnavailable", err)
+	}
+	_, err := db.InsertMessage(context.Background(), api.Message{})
+	if !errors.Is(err, api.ErrDBUnavailable) || !errors.Is(err, ErrOpen) {
+		t.Errorf("Got error %v, want ErrDBUnavailable and ErrOpen", err)
+	}
+
+	// Other operations have their own breakers.
+	db.db = &testdb{err: fail}
+	if _, err := db.ListMessages(context.Background(), api.ListQuery{Limit: 10}); !errors.Is(err, fail) {
+		t.Errorf("Got error %v from ListMessages, want %v", err, fail)
+	}
+
+	want := map[string]string{
+		"db.ListMessages":        "closed",
+		"db.InsertMessage":       "open",
+		"db.InsertReaction":      "closed",
+		"db.SearchMessages":      "closed",
+		"db.ListMentions":        "closed",
+		"db.MarkMentionsRead":    "closed",
+		"db.MarkRead":            "closed",
+		"db.GetReadMarker":       "closed",
+		"db.CountUnread":         "closed",
+		"db.PinMessage":          "closed",
+		"db.UnpinMessage":        "closed",
+		"db.ListPins":            "closed",
+		"db.InsertAttachment":    "closed",
+		"db.GetAttachment":       "closed",
+		"db.FlagMessage":         "closed",
+		"db.ListFlaggedMessages": "closed",
+		"db.ReviewMessage":       "closed",
+	}
+	if diff := cmp.Diff(db.States(), want); diff != "" {
+		t.Errorf("States diff (-got +want)\n%s", diff)
+	}
+}
+
+func TestCache(t *testing.T) {
+	cache := NewCache(&testcache{err: api.ErrMessageNotFoundInCache}, Settings{Threshold: 1, Cooldown: time.Hour}, slogt.New(t))
+
+	// Misses don't open the breaker.
+	for range 2 {
+		if _, err := cache.GetMessage(context.Background(), "1"); !errors.Is(err, api.ErrMessageNotFoundInCache) {
+			t.Fatalf("Got error %v, want ErrMessageNotFoundInCache", err)
+		}
+	}
+
+	cache.cache = &testcache{err: errors.New("connection refused")}
+	_, _ = cache.GetMessage(context.Background(), "1")
+	if _, err := cache.GetMessage(context.Background(), "1"); !errors.Is(err, api.ErrCacheUnavailable) {
+		t.Errorf("Got error %v, want ErrCacheUnavailable", err)
+	}
+}
+
+type testdb struct {
+	err error
+}
+
+func (db *testdb) ListMessages(context.Context, api.ListQuery, ...string) ([]api.Message, error) {
+	return nil, db.err
+}
+
+func (db *testdb) InsertMessage(_ context.Context, msg api.Message) (api.Message, error) {
+	return msg, db.err
+}
+
+func (db *testdb) InsertReaction(_ context.Context, reaction api.Reaction) (api.Reaction, error) {
+	return reaction, db.err
+}
+
+func (db *testdb) SearchMessages(context.Context, api.SearchQuery) ([]api.SearchResult, error) {
+	return nil, db.err
+}
+
+func (db *testdb) ListMentions(context.Context, api.MentionQuery) ([]api.Mention, error) {
+	return nil, db.err
+}
+
+func (db *testdb) MarkMentionsRead(context.Context, string, ...string) (int, error) {
+	return 0, db.err
+}
+
+func (db *testdb) MarkRead(context.Context, string, string) (api.ReadMarker, error) {
+	return api.ReadMarker{}, db.err
+}
+
+func (db *testdb) GetReadMarker(context.Context, string) (*api.ReadMarker, error) {
+	return nil, db.err
+}
+
+func (db *testdb) CountUnread(context.Context, string, *api.ReadMarker) (api.UnreadCounts, error) {
+	return api.UnreadCounts{}, db.err
+}
+
+func (db *testdb) PinMessage(context.Context, string, string) (api.Pin, error) {
+	return api.Pin{}, db.err
+}
+
+func (db *testdb) UnpinMessage(context.Context, string) error {
+	return db.err
+}
+
+func (db *testdb) ListPins(context.Context) ([]api.Pin, error) {
+	return nil, db.err
+}
+
+func (db *testdb) InsertAttachment(_ context.Context, attachment api.Attachment) (api.Attachment, error) {
+	return attachment, db.err
+}
+
+func (db *testdb) GetAttachment(context.Context, string) (*api.Attachment, error) {
+	return nil, db.err
+}
+
+func (db *testdb) FlagMessage(context.Context, api.Flag, int) (api.FlagResult, error) {
+	return api.FlagResult{}, db.err
+}
+
+func (db *testdb) ListFlaggedMessages(context.Context, api.FlagQuery) ([]api.FlaggedMessage, error) {
+	return nil, db.err
+}
+
+func (db *testdb) ReviewMessage(context.Context, string, string, string) (api.Message, error) {
+	return api.Message{}, db.err
+}
+
+type testcache struct {
+	err error
+}
+
+func (c *testcache) ListMessages(context.Context) ([]api.Message, error) {
+	return nil, c.err
+}
+
+func (c *testcache) InsertMessage(context.Context, api.Message) error {
+	return c.err
+}
+
+func (c *testcache) GetMessage(context.Context, string) (*api.Message, error) {
+	return nil, c.err
+}
+
+func (c *testcache) DeleteMessage(context.Context, string) error {
+	return c.err
+}
@@ -0,0 +1,80 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+)
+
+// Cache wraps an api.Cache with a breaker per operation. While a breaker is
+// open, calls fail with an error wrapping both api.ErrCacheUnavailable and
+// ErrOpen, and calls that time out with one wrapping it and ErrTimeout.
+type Cache struct {
+	cache         api.Cache
+	listMessages  *Breaker
+	insertMessage *Breaker
+	getMessage    *Breaker
+	deleteMessage *Breaker
+}
+
+// NewCache returns cache guarded by circuit breakers. A cache miss does not
+// count as a failure.
+func NewCache(cache api.Cache, s Settings, logger *slog.Logger) *Cache {
+	isFailure := func(err error) bool {
+		return !errors.Is(err, api.ErrMessageNotFoundInCache)
+	}
+	return &Cache{
+		cache:         cache,
+		listMessages:  New("cache.ListMessages", s, logger, isFailure),
+		insertMessage: New("cache.InsertMessage", s, logger, isFailure),
+		getMessage:    New("cache.GetMessage", s, logger, isFailure),
+		deleteMessage: New("cache.DeleteMessage", s, logger, isFailure),
+	}
+}
+
+// ListMessages calls ListMessages on the wrapped cache.
+func (c *Cache) ListMessages(ctx context.Context) ([]api.Message, error) {
+	msgs, err := call(ctx, c.listMessages, func(ctx context.Context) ([]api.Message, error) {
+		return c.cache.ListMessages(ctx)
+	})
+	return msgs, cacheErr(err)
+}
+
+// InsertMessage calls InsertMessage on the wrapped cache.
+func (c *Cache) InsertMessage(ctx context.Context, msg api.Message) error {
+	err := c.insertMessage.Do(ctx, func(ctx context.Context) error {
+		return c.cache.InsertMessage(ctx, msg)
+	})
+	return cacheErr(err)
+}
+
+// GetMessage calls GetMessage on the wrapped cache.
+func (c *Cache) GetMessage(ctx context.Context, messageID string) (*api.Message, error) {
+	msg, err := call(ctx, c.getMessage, func(ctx context.Context) (*api.Message, error) {
+		return c.cache.GetMessage(ctx, messageID)
+	})
+	return msg, cacheErr(err)
+}
+
+// DeleteMessage calls DeleteMessage on the wrapped cache.
+func (c *Cache) DeleteMessage(ctx context.Context, messageID string) error {
+	err := c.deleteMessage.Do(ctx, func(ctx context.Context) error {
+		return c.cache.DeleteMessage(ctx, messageID)
+	})
+	return cacheErr(err)
+}
+
+// States returns the state of each breaker by operation.
+func (c *Cache) States() map[string]string {
+	return states(c.listMessages, c.insertMessage, c.getMessage, c.deleteMessage)
+}
+
+func cacheErr(err error) error {
+	if errors.Is(err, ErrOpen) || errors.Is(err, ErrTimeout) {
+		return fmt.Errorf("%w: %w", api.ErrCacheUnavailable, err)
+	}
+	return err
+}
@@ -0,0 +1,214 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+)
+
+// DB wraps an api.DB with a breaker per operation. While a breaker is open,
+// calls fail with an error wrapping both api.ErrDBUnavailable and ErrOpen,
+// and calls that time out with one wrapping it and ErrTimeout.
+type DB struct {
+	db             api.DB
+	listMessages   *Breaker
+	insertMessage  *Breaker
+	insertReaction *Breaker
+	searchMessages *Breaker
+	listMentions   *Breaker
+	markMentions   *Breaker
+	markRead       *Breaker
+	getReadMarker  *Breaker
+	countUnread    *Breaker
+	pinMessage     *Breaker
+	unpinMessage   *Breaker
+	listPins       *Breaker
+	insertAttach   *Breaker
+	getAttach      *Breaker
+	flagMessage    *Breaker
+	listFlagged    *Breaker
+	reviewMessage  *Breaker
+}
+
+// NewDB returns db guarded by circuit breakers. Only errors that indicate
+// the database is unreachable or slow count as failures.
+func NewDB(db api.DB, s Settings, logger *slog.Logger) *DB {
+	isFailure := func(err error) bool {
+		return errors.Is(err, api.ErrDBUnavailable) || errors.Is(err, context.DeadlineExceeded)
+	}
+	return &DB{
+		db:             db,
+		listMessages:   New("db.ListMessages", s, logger, isFailure),
+		insertMessage:  New("db.InsertMessage", s, logger, isFailure),
+		insertReaction: New("db.InsertReaction", s, logger, isFailure),
+		searchMessages: New("db.SearchMessages", s, logger, isFailure),
+		listMentions:   New("db.ListMentions", s, logger, isFailure),
+		markMentions:   New("db.MarkMentionsRead", s, logger, isFailure),
+		markRead:       New("db.MarkRead", s, logger, isFailure),
+		getReadMarker:  New("db.GetReadMarker", s, logger, isFailure),
+		countUnread:    New("db.CountUnread", s, logger, isFailure),
+		pinMessage:     New("db.PinMessage", s, logger, isFailure),
+		unpinMessage:   New("db.UnpinMessage", s, logger, isFailure),
+		listPins:       New("db.ListPins", s, logger, isFailure),
+		insertAttach:   New("db.InsertAttachment", s, logger, isFailure),
+		getAttach:      New("db.GetAttachment", s, logger, isFailure),
+		flagMessage:    New("db.FlagMessage", s, logger, isFailure),
+		listFlagged:    New("db.ListFlaggedMessages", s, logger, isFailure),
+		reviewMessage:  New("db.ReviewMessage", s, logger, isFailure),
+	}
+}
+
+// ListMessages calls ListMessages on the wrapped DB.
+func (d *DB) ListMessages(ctx context.Context, q api.ListQuery, excludeMsgIDs ...string) ([]api.Message, error) {
+	msgs, err := call(ctx, d.listMessages, func(ctx context.Context) ([]api.Message, error) {
+		return d.db.ListMessages(ctx, q, excludeMsgIDs...)
+	})
+	return msgs, dbErr(err)
+}
+
+// InsertMessage calls InsertMessage on the wrapped DB.
+func (d *DB) InsertMessage(ctx context.Context, msg api.Message) (api.Message, error) {
+	msg, err := call(ctx, d.insertMessage, func(ctx context.Context) (api.Message, error) {
+		return d.db.InsertMessage(ctx, msg)
+	})
+	return msg, dbErr(err)
+}
+
+// InsertReaction calls InsertReaction on the wrapped DB.
+func (d *DB) InsertReaction(ctx context.Context, reaction api.Reaction) (api.Reaction, error) {
+	reaction, err := call(ctx, d.insertReaction, func(ctx context.Context) (api.Reaction, error) {
+		return d.db.InsertReaction(ctx, reaction)
+	})
+	return reaction, dbErr(err)
+}
+
+// SearchMessages calls SearchMessages on the wrapped DB.
+func (d *DB) SearchMessages(ctx context.Context, q api.SearchQuery) ([]api.SearchResult, error) {
+	results, err := call(ctx, d.searchMessages, func(ctx context.Context) ([]api.SearchResult, error) {
+		return d.db.SearchMessages(ctx, q)
+	})
+	return results, dbErr(err)
+}
+
+// ListMentions calls ListMentions on the wrapped DB.
+func (d *DB) ListMentions(ctx context.Context, q api.MentionQuery) ([]api.Mention, error) {
+	mentions, err := call(ctx, d.listMentions, func(ctx context.Context) ([]api.Mention, error) {
+		return d.db.ListMentions(ctx, q)
+	})
+	return mentions, dbErr(err)
+}
+
+// MarkMentionsRead calls MarkMentionsRead on the wrapped DB.
+func (d *DB) MarkMentionsRead(ctx context.Context, userID string, msgIDs ...string) (int, error) {
+	n, err := call(ctx, d.markMentions, func(ctx context.Context) (int, error) {
+		return d.db.MarkMentionsRead(ctx, userID, msgIDs...)
+	})
+	return n, dbErr(err)
+}
+
+// MarkRead calls MarkRead on the wrapped DB.
+func (d *DB) MarkRead(ctx context.Context, userID, messageID string) (api.ReadMarker, error) {
+	marker, err := call(ctx, d.markRead, func(ctx context.Context) (api.ReadMarker, error) {
+		return d.db.MarkRead(ctx, userID, messageID)
+	})
+	return marker, dbErr(err)
+}
+
+// GetReadMarker calls GetReadMarker on the wrapped DB.
+func (d *DB) GetReadMarker(ctx context.Context, userID string) (*api.ReadMarker, error) {
+	marker, err := call(ctx, d.getReadMarker, func(ctx context.Context) (*api.ReadMarker, error) {
+		return d.db.GetReadMarker(ctx, userID)
+	})
+	return marker, dbErr(err)
+}
+
+// CountUnread calls CountUnread on the wrapped DB.
+func (d *DB) CountUnread(ctx context.Context, userID string, marker *api.ReadMarker) (api.UnreadCounts, error) {
+	counts, err := call(ctx, d.countUnread, func(ctx context.Context) (api.UnreadCounts, error) {
+		return d.db.CountUnread(ctx, userID, marker)
+	})
+	return counts, dbErr(err)
+}
+
+// PinMessage calls PinMessage on the wrapped DB.
+func (d *DB) PinMessage(ctx context.Context, messageID, userID string) (api.Pin, error) {
+	pin, err := call(ctx, d.pinMessage, func(ctx context.Context) (api.Pin, error) {
+		return d.db.PinMessage(ctx, messageID, userID)
+	})
+	return pin, dbErr(err)
+}
+
+// UnpinMessage calls UnpinMessage on the wrapped DB.
+func (d *DB) UnpinMessage(ctx context.Context, messageID string) error {
+	err := d.unpinMessage.Do(ctx, func(ctx context.Context) error {
+		return d.db.UnpinMessage(ctx, messageID)
+	})
+	return dbErr(err)
+}
+
+// ListPins calls ListPins on the wrapped DB.
+func (d *DB) ListPins(ctx context.Context) ([]api.Pin, error) {
+	pins, err := call(ctx, d.listPins, func(ctx context.Context) ([]api.Pin, error) {
+		return d.db.ListPins(ctx)
+	})
+	return pins, dbErr(err)
+}
+
+// InsertAttachment calls InsertAttachment on the wrapped DB.
+func (d *DB) InsertAttachment(ctx context.Context, attachment api.Attachment) (api.Attachment, error) {
+	attachment, err := call(ctx, d.insertAttach, func(ctx context.Context) (api.Attachment, error) {
+		return d.db.InsertAttachment(ctx, attachment)
+	})
+	return attachment, dbErr(err)
+}
+
+// GetAttachment calls GetAttachment on the wrapped DB.
+func (d *DB) GetAttachment(ctx context.Context, id string) (*api.Attachment, error) {
+	attachment, err := call(ctx, d.getAttach, func(ctx context.Context) (*api.Attachment, error) {
+		return d.db.GetAttachment(ctx, id)
+	})
+	return attachment, dbErr(err)
+}
+
+// FlagMessage calls FlagMessage on the wrapped DB.
+func (d *DB) FlagMessage(ctx context.Context, flag api.Flag, hideAfter int) (api.FlagResult, error) {
+	res, err := call(ctx, d.flagMessage, func(ctx context.Context) (api.FlagResult, error) {
+		return d.db.FlagMessage(ctx, flag, hideAfter)
+	})
+	return res, dbErr(err)
+}
+
+// ListFlaggedMessages calls ListFlaggedMessages on the wrapped DB.
+func (d *DB) ListFlaggedMessages(ctx context.Context, q api.FlagQuery) ([]api.FlaggedMessage, error) {
+	flagged, err := call(ctx, d.listFlagged, func(ctx context.Context) ([]api.FlaggedMessage, error) {
+		return d.db.ListFlaggedMessages(ctx, q)
+	})
+	return flagged, dbErr(err)
+}
+
+// ReviewMessage calls ReviewMessage on the wrapped DB.
+func (d *DB) ReviewMessage(ctx context.Context, messageID, moderatorID, decision string) (api.Message, error) {
+	msg, err := call(ctx, d.reviewMessage, func(ctx context.Context) (api.Message, error) {
+		return d.db.ReviewMessage(ctx, messageID, moderatorID, decision)
+	})
+	return msg, dbErr(err)
+}
+
+// States returns the state of each breaker by operation.
+func (d *DB) States() map[string]string {
+	return states(d.listMessages, d.insertMessage, d.insertReaction, d.searchMessages, d.listMentions, d.markMentions,
+		d.markRead, d.getReadMarker, d.countUnread,
+		d.pinMessage, d.unpinMessage, d.listPins,
+		d.insertAttach, d.getAttach,
+		d.flagMessage, d.listFlagged, d.reviewMessage)
+}
+
+func dbErr(err error) error {
+	if errors.Is(err, ErrOpen) || errors.Is(err, ErrTimeout) {
+		return fmt.Errorf("%w: %w", api.ErrDBUnavailable, err)
+	}
+	return err
+}
@@ -0,0 +1,37 @@
+package breaker
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+)
+
+// RateLimiter wraps an api.RateLimiter with a breaker, so a fallback limiter
+// takes over at once instead of after every call timed out.
+type RateLimiter struct {
+	limiter api.RateLimiter
+	allow   *Breaker
+}
+
+// NewRateLimiter returns limiter guarded by a circuit breaker. Every error
+// counts as a failure.
+func NewRateLimiter(limiter api.RateLimiter, s Settings, logger *slog.Logger) *RateLimiter {
+	isFailure := func(err error) bool { return true }
+	return &RateLimiter{
+		limiter: limiter,
+		allow:   New("ratelimit.Allow", s, logger, isFailure),
+	}
+}
+
+// Allow calls Allow on the wrapped limiter.
+func (l *RateLimiter) Allow(ctx context.Context, key string, limit api.RateLimit) (api.RateLimitResult, error) {
+	return call(ctx, l.allow, func(ctx context.Context) (api.RateLimitResult, error) {
+		return l.limiter.Allow(ctx, key, limit)
+	})
+}
+
+// States returns the state of the breaker.
+func (l *RateLimiter) States() map[string]string {
+	return states(l.allow)
+}
@@ -0,0 +1,467 @@
+// Package markdown renders a safe subset of Markdown as HTML: paragraphs,
+// bold, italic, inline and fenced code, links, and bulleted and numbered
+// lists.
+//
+// Raw HTML is not supported. All text is escaped, so the output only holds
+// the tags written by the renderer, and links only go to http, https and
+// mailto URLs.
+package markdown
+
+import (
+	"html"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// maxDepth bounds the nesting of emphasis and links.
+	maxDepth = 8
+	// maxLinkLabel and maxLinkDest bound how far a link is looked for, so
+	// unclosed brackets can't make rendering quadratic.
+	maxLinkLabel = 1000
+	maxLinkDest  = 2048
+)
+
+var linkSchemes = map[string]bool{
+	"http":   true,
+	"https":  true,
+	"mailto": true,
+}
+
+// ToHTML renders src as HTML.
+func ToHTML(src string) string {
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	src = strings.ReplaceAll(src, "\r", "\n")
+	src = strings.ReplaceAll(src, "\x00", "\uFFFD")
+	var b strings.Builder
+	renderBlocks(&b, strings.Split(src, "\n"))
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func renderBlocks(b *strings.Builder, lines []string) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		if isBlank(line) {
+			i++
+			continue
+		}
+		if fence, ok := codeFence(line); ok {
+			i = renderCodeBlock(b, lines, i+1, fence)
+			continue
+		}
+		if item, ok := parseListItem(line); ok {
+			i = renderList(b, lines, i, item)
+			continue
+		}
+
+		// A paragraph runs until a blank line or another block.
+		start := i
+		for i++; i < len(lines); i++ {
+			if isBlank(lines[i]) {
+				break
+			}
+			if _, ok := codeFence(lines[i]); ok {
+				break
+			}
+			if _, ok := parseListItem(lines[i]); ok {
+				break
+			}
+		}
+		b.WriteString("<p>")
+		renderInline(b, strings.TrimSpace(strings.Join(lines[start:i], "\n")), 0, false)
+		b.WriteString("</p>\n")
+	}
+}
+
+// renderCodeBlock writes the lines from start to the closing fence, or the
+// end, as a code block, and returns the index of the line after it.
+func renderCodeBlock(b *strings.Builder, lines []string, start int, fence string) int {
+	end := start
+	for end < len(lines) && !closesFence(lines[end], fence) {
+		end++
+	}
+	b.WriteString("<pre><code>")
+	for _, line := range lines[start:end] {
+		b.WriteString(html.EscapeString(line))
+		b.WriteByte('\n')
+	}
+	b.WriteString("</code></pre>\n")
+	if end < len(lines) {
+		end++ // the closing fence
+	}
+	return end
+}
+
+// codeFence returns the fence opening a code block, three or more backticks
+// or tildes.
+func codeFence(line string) (string, bool) {
+	line = trimIndent(line)
+	if len(line) < 3 || (line[0] != '`' && line[0] != '~') {
+		return "", false
+	}
+	n := countRun(line, 0, line[0])
+	if n < 3 {
+		return "", false
+	}
+	if line[0] == '`' && strings.IndexByte(line[n:], '`') >= 0 {
+		// An inline code span.
+		return "", false
+	}
+	return line[:n], true
+}
+
+func closesFence(line, fence string) bool {
+	line = strings.TrimRight(trimIndent(line), " \t")
+	return countRun(line, 0, fence[0]) >= len(fence) && strings.Trim(line, fence[:1]) == ""
+}
+
+// A listItem is a line starting with a list marker.
+type listItem struct {
+	ordered bool
+	marker  byte // '-', '*' or '+' for bullets, '.' or ')' after numbers
+	number  int
+	text    string
+}
+
+func parseListItem(line string) (listItem, bool) {
+	line = trimIndent(line)
+	if line == "" {
+		return listItem{}, false
+	}
+	var item listItem
+	n := 0
+	switch c := line[0]; {
+	case c == '-' || c == '*' || c == '+':
+		item.marker = c
+		n = 1
+	case c >= '0' && c <= '9':
+		for n < len(line) && n < 9 && line[n] >= '0' && line[n] <= '9' {
+			n++
+		}
+		if n == len(line) || (line[n] != '.' && line[n] != ')') {
+			return listItem{}, false
+		}
+		item.ordered = true
+		item.number, _ = strconv.Atoi(line[:n])
+		item.marker = line[n]
+		n++
+	default:
+		return listItem{}, false
+	}
+	if n == len(line) || (line[n] != ' ' && line[n] != '\t') {
+		return listItem{}, false
+	}
+	item.text = strings.TrimSpace(line[n:])
+	return item, true
+}
+
+// renderList writes the items starting at lines[start] with the same kind
+// of marker as first, and returns the index of the line after them.
+func renderList(b *strings.Builder, lines []string, start int, first listItem) int {
+	tag := "ul"
+	if first.ordered {
+		tag = "ol"
+	}
+	b.WriteString("<" + tag)
+	if first.ordered && first.number != 1 {
+		b.WriteString(` start="` + strconv.Itoa(first.number) + `"`)
+	}
+	b.WriteString(">\n")
+	i := start
+	for ; i < len(lines); i++ {
+		item, ok := parseListItem(lines[i])
+		if !ok || item.ordered != first.ordered || item.marker != first.marker {
+			break
+		}
+		b.WriteString("<li>")
+		renderInline(b, item.text, 0, false)
+		b.WriteString("</li>\n")
+	}
+	b.WriteString("</" + tag + ">\n")
+	return i
+}
+
+// renderInline writes the text of a block with its emphasis, code and
+// links. Those nested deeper than maxDepth, and links within links, are
+// written as text.
+func renderInline(b *strings.Builder, s string, depth int, inLink bool) {
+	// Delimiters that have no closer in the rest of s, which saves looking
+	// again for each opener.
+	unclosed := make(map[string]bool)
+	text := 0 // start of the text not written yet
+	flush := func(end int) {
+		writeText(b, s[text:end])
+	}
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch c {
+		case '\\':
+			if i+1 < len(s) && isASCIIPunct(s[i+1]) {
+				flush(i)
+				b.WriteString(html.EscapeString(s[i+1 : i+2]))
+				i += 2
+				text = i
+				continue
+			}
+		case '`':
+			n := countRun(s, i, '`')
+			delim := s[i : i+n]
+			if !unclosed[delim] {
+				if end := findCodeClose(s, i+n, n); end >= 0 {
+					flush(i)
+					b.WriteString("<code>")
+					b.WriteString(html.EscapeString(codeSpan(s[i+n : end])))
+					b.WriteString("</code>")
+					i = end + n
+					text = i
+					continue
+				}
+				unclosed[delim] = true
+			}
+			// The whole run is text.
+			i += n
+			continue
+		case '*', '_':
+			n := 1
+			if i+1 < len(s) && s[i+1] == c {
+				n = 2
+			}
+			delim := s[i : i+n]
+			if depth < maxDepth && !unclosed[delim] && canOpen(s, i, delim) {
+				if end := findEmphasisClose(s, i+n, delim); end >= 0 {
+					flush(i)
+					tag := "em"
+					if n == 2 {
+						tag = "strong"
+					}
+					b.WriteString("<" + tag + ">")
+					renderInline(b, s[i+n:end], depth+1, inLink)
+					b.WriteString("</" + tag + ">")
+					i = end + n
+					text = i
+					continue
+				}
+				unclosed[delim] = true
+			}
+			i += n
+			continue
+		case '[':
+			if !unclosed["["] && strings.IndexByte(s[i:], ']') < 0 {
+				unclosed["["] = true
+			}
+			if depth < maxDepth && !inLink && !unclosed["["] {
+				if label, dest, end, ok := parseLink(s, i); ok {
+					flush(i)
+					b.WriteString(`<a href="`)
+					b.WriteString(html.EscapeString(dest))
+					b.WriteString(`" rel="nofollow noopener noreferrer">`)
+					renderInline(b, label, depth+1, true)
+					b.WriteString("</a>")
+					i = end
+					text = i
+					continue
+				}
+			}
+		}
+		i++
+	}
+	flush(len(s))
+}
+
+// writeText escapes text and breaks its lines.
+func writeText(b *strings.Builder, s string) {
+	for {
+		line, rest, found := strings.Cut(s, "\n")
+		b.WriteString(html.EscapeString(line))
+		if !found {
+			return
+		}
+		b.WriteString("<br>\n")
+		s = rest
+	}
+}
+
+// findCodeClose returns the index of the next run of exactly n backticks
+// from i, or -1.
+func findCodeClose(s string, i, n int) int {
+	for i < len(s) {
+		j := strings.IndexByte(s[i:], '`')
+		if j < 0 {
+			return -1
+		}
+		i += j
+		m := countRun(s, i, '`')
+		if m == n {
+			return i
+		}
+		i += m
+	}
+	return -1
+}
+
+// codeSpan returns the content of a code span, with its lines joined and
+// one space stripped from both ends, which allows spans starting or ending
+// with a backtick.
+func codeSpan(s string) string {
+	s = strings.ReplaceAll(s, "\n", " ")
+	if len(s) >= 2 && s[0] == ' ' && s[len(s)-1] == ' ' && strings.Trim(s, " ") != "" {
+		s = s[1 : len(s)-1]
+	}
+	return s
+}
+
+// canOpen reports whether the delimiter at i opens emphasis: it must be
+// followed by text, and underscores must not be within a word, as in
+// snake_case.
+func canOpen(s string, i int, delim string) bool {
+	next, _ := utf8.DecodeRuneInString(s[i+len(delim):])
+	if i+len(delim) == len(s) || unicode.IsSpace(next) {
+		return false
+	}
+	if delim[0] == '_' && i > 0 {
+		prev, _ := utf8.DecodeLastRuneInString(s[:i])
+		return !isWordRune(prev)
+	}
+	return true
+}
+
+// findEmphasisClose returns the index of the delimiter closing emphasis
+// opened before i, or -1. Code spans and escaped characters are skipped.
+func findEmphasisClose(s string, i int, delim string) int {
+	start := i
+	for i < len(s) {
+		switch s[i] {
+		case '\\':
+			i += 2
+			continue
+		case '`':
+			n := countRun(s, i, '`')
+			if end := findCodeClose(s, i+n, n); end >= 0 {
+				i = end + n
+				continue
+			}
+			i += n
+			continue
+		case delim[0]:
+			// A run of three can close either, as in "**a *b***", and
+			// the closer is its end.
+			n := countRun(s, i, delim[0])
+			if i > start && (n == len(delim) || n >= 3) && canClose(s, i, n, delim) {
+				return i + n - len(delim)
+			}
+			i += n
+			continue
+		}
+		i++
+	}
+	return -1
+}
+
+// canClose reports whether the run of n delimiter characters at i closes
+// emphasis: it must follow text, and underscores must not be within a word.
+func canClose(s string, i, n int, delim string) bool {
+	prev, _ := utf8.DecodeLastRuneInString(s[:i])
+	if unicode.IsSpace(prev) {
+		return false
+	}
+	if delim[0] == '_' && i+n < len(s) {
+		next, _ := utf8.DecodeRuneInString(s[i+n:])
+		return !isWordRune(next)
+	}
+	return true
+}
+
+// parseLink parses a link, [label](destination), at i, and returns the
+// index after it. ok is false for links that are malformed or go to a
+// scheme that isn't allowed; those are written as text.
+func parseLink(s string, i int) (label, dest string, end int, ok bool) {
+	// Find the matching bracket, skipping escaped ones and code spans.
+	nested := 0
+	j := i + 1
+	for ; j < len(s) && j-i <= maxLinkLabel; j++ {
+		switch s[j] {
+		case '\\':
+			j++
+			continue
+		case '`':
+			n := countRun(s, j, '`')
+			if close := findCodeClose(s, j+n, n); close >= 0 {
+				j = close + n - 1
+			} else {
+				j += n - 1
+			}
+			continue
+		case '[':
+			nested++
+			continue
+		case ']':
+			if nested > 0 {
+				nested--
+				continue
+			}
+		default:
+			continue
+		}
+		break
+	}
+	if j >= len(s) || s[j] != ']' {
+		return "", "", 0, false
+	}
+	label = s[i+1 : j]
+	if j+1 >= len(s) || s[j+1] != '(' {
+		return "", "", 0, false
+	}
+	k := j + 2
+	for k < len(s) && k-j <= maxLinkDest && s[k] != ')' && s[k] > ' ' {
+		k++
+	}
+	if k >= len(s) || s[k] != ')' {
+		return "", "", 0, false
+	}
+	dest = s[j+2 : k]
+	if label == "" || !allowedURL(dest) {
+		return "", "", 0, false
+	}
+	return label, dest, k + 1, true
+}
+
+// allowedURL reports whether a link may go to dest.
+func allowedURL(dest string) bool {
+	u, err := url.Parse(dest)
+	if err != nil {
+		return false
+	}
+	scheme := strings.ToLower(u.Scheme)
+	return linkSchemes[scheme] && (scheme == "mailto" || u.Host != "")
+}
+
+func countRun(s string, i int, c byte) int {
+	n := 0
+	for i+n < len(s) && s[i+n] == c {
+		n++
+	}
+	return n
+}
+
+// trimIndent removes up to three spaces of indentation.
+func trimIndent(line string) string {
+	for i := 0; i < 3 && strings.HasPrefix(line, " "); i++ {
+		line = line[1:]
+	}
+	return line
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+func isASCIIPunct(c byte) bool {
+	return c < utf8.RuneSelf && unicode.IsPunct(rune(c)) || strings.IndexByte("$+<=>^`|~", c) >= 0
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
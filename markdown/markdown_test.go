@@ -0,0 +1,222 @@
+package markdown
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+func TestToHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "Text",
+			src:  "hello",
+			want: "<p>hello</p>",
+		},
+		{
+			name: "Paragraphs",
+			src:  "one\ntwo\r\n\r\nthree",
+			want: "<p>one<br>\ntwo</p>\n<p>three</p>",
+		},
+		{
+			name: "Emphasis",
+			src:  "**bold** *italic* __bold__ _italic_",
+			want: "<p><strong>bold</strong> <em>italic</em> <strong>bold</strong> <em>italic</em></p>",
+		},
+		{
+			name: "Nested",
+			src:  "**bold *and italic***",
+			want: "<p><strong>bold <em>and italic</em></strong></p>",
+		},
+		{
+			name: "Unclosed",
+			src:  "2 * 3 = 6 and **half",
+			want: "<p>2 * 3 = 6 and **half</p>",
+		},
+		{
+			name: "IntrawordUnderscore",
+			src:  "snake_case_name",
+			want: "<p>snake_case_name</p>",
+		},
+		{
+			name: "Code",
+			src:  "run `rm -rf *` or `` a`b ``",
+			want: "<p>run <code>rm -rf *</code> or <code>a`b</code></p>",
+		},
+		{
+			name: "CodeBlock",
+			src:  "```go\nif a < b {\n\t**x**\n}\n```\nafter",
+			want: "<pre><code>if a &lt; b {\n\t**x**\n}\n</code></pre>\n<p>after</p>",
+		},
+		{
+			name: "UnclosedCodeBlock",
+			src:  "~~~\n<b>",
+			want: "<pre><code>&lt;b&gt;\n</code></pre>",
+		},
+		{
+			name: "Link",
+			src:  "see [the **docs**](https://example.com/a?b=1&c=\"2\")",
+			want: `<p>see <a href="https://example.com/a?b=1&amp;c=&#34;2&#34;" rel="nofollow noopener noreferrer">the <strong>docs</strong></a></p>`,
+		},
+		{
+			name: "Mailto",
+			src:  "[mail](mailto:a@example.com)",
+			want: `<p><a href="mailto:a@example.com" rel="nofollow noopener noreferrer">mail</a></p>`,
+		},
+		{
+			name: "JavaScriptLink",
+			src:  "[x](javascript:alert(1)) [y](JaVaScRiPt:alert(1)) [z](data:text/html,hi)",
+			want: "<p>[x](javascript:alert(1)) [y](JaVaScRiPt:alert(1)) [z](data:text/html,hi)</p>",
+		},
+		{
+			name: "RelativeLink",
+			src:  "[x](/admin) [y](//evil.example)",
+			want: "<p>[x](/admin) [y](//evil.example)</p>",
+		},
+		{
+			name: "NestedBrackets",
+			src:  "[a [b](http://x.example)",
+			want: `<p>[a <a href="http://x.example" rel="nofollow noopener noreferrer">b</a></p>`,
+		},
+		{
+			name: "LinkInLink",
+			src:  "[[a](http://x.example)](http://y.example)",
+			want: `<p><a href="http://y.example" rel="nofollow noopener noreferrer">[a](http://x.example)</a></p>`,
+		},
+		{
+			name: "HTML",
+			src:  "<script>alert(1)</script> <img src=x onerror=alert(1)> &amp;",
+			want: "<p>&lt;script&gt;alert(1)&lt;/script&gt; &lt;img src=x onerror=alert(1)&gt; &amp;amp;</p>",
+		},
+		{
+			name: "Escapes",
+			src:  `\*not italic\* \[not a link](http://x.example) \a`,
+			want: `<p>*not italic* [not a link](http://x.example) \a</p>`,
+		},
+		{
+			name: "Lists",
+			src:  "Shopping:\n- milk\n- **eggs**\n\n3. three\n4. four\n1) other",
+			want: "<p>Shopping:</p>\n<ul>\n<li>milk</li>\n<li><strong>eggs</strong></li>\n</ul>\n" +
+				"<ol start=\"3\">\n<li>three</li>\n<li>four</li>\n</ol>\n<ol>\n<li>other</li>\n</ol>",
+		},
+		{
+			name: "NotAList",
+			src:  "-1 and *bold*\n2024.",
+			want: "<p>-1 and <em>bold</em><br>\n2024.</p>",
+		},
+		{
+			name: "Unicode",
+			src:  "_zoë_ **日本**",
+			want: "<p><em>zoë</em> <strong>日本</strong></p>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ToHTML(tt.src); got != tt.want {
+				t.Errorf("ToHTML(%q)\n got %q\nwant %q", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToHTML_Pathological(t *testing.T) {
+	for _, src := range []string{
+		strings.Repeat("*a ", 50000),
+		strings.Repeat("[", 100000),
+		strings.Repeat("[a", 50000) + strings.Repeat("]", 50000),
+		strings.Repeat("`", 100000),
+		strings.Repeat("` ``", 30000),
+		strings.Repeat("**", 50000),
+		strings.Repeat("_a", 50000),
+	} {
+		start := time.Now()
+		ToHTML(src)
+		if d := time.Since(start); d > 2*time.Second {
+			t.Errorf("ToHTML(%q...) took %s", src[:10], d)
+		}
+	}
+}
+
+// allowedAttrs are the attributes each tag the renderer writes may have.
+var allowedAttrs = map[string]map[string]bool{
+	"p":      {},
+	"br":     {},
+	"strong": {},
+	"em":     {},
+	"code":   {},
+	"pre":    {},
+	"ul":     {},
+	"ol":     {"start": true},
+	"li":     {},
+	"a":      {"href": true, "rel": true},
+}
+
+// FuzzToHTML checks that whatever the input, the output only holds the tags
+// and attributes of the subset, balanced, and links to allowed schemes.
+func FuzzToHTML(f *testing.F) {
+	for _, s := range []string{
+		"**bold** *italic* `code`",
+		"[link](https://example.com)",
+		"- a\n- b\n\n1. c",
+		"```\n<script>\n```",
+		"<img src=x onerror=alert(1)>",
+		"[x](javascript:alert(1))",
+		"[a](http://x.example\" onclick=\"alert(1))",
+		"***a** b*",
+		"\x00\r\n\xff",
+	} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, src string) {
+		out := ToHTML(src)
+		z := html.NewTokenizer(strings.NewReader(out))
+		var open []string
+		for {
+			tt := z.Next()
+			switch tt {
+			case html.ErrorToken:
+				if len(open) > 0 {
+					t.Fatalf("Unclosed %v in %q", open, out)
+				}
+				return
+			case html.TextToken:
+				continue
+			case html.StartTagToken, html.SelfClosingTagToken:
+				tok := z.Token()
+				attrs, ok := allowedAttrs[tok.Data]
+				if !ok {
+					t.Fatalf("Tag %q in %q", tok.Data, out)
+				}
+				for _, a := range tok.Attr {
+					if !attrs[a.Key] {
+						t.Fatalf("Attribute %q of %q in %q", a.Key, tok.Data, out)
+					}
+					if a.Key == "href" {
+						u, err := url.Parse(a.Val)
+						if err != nil || !linkSchemes[strings.ToLower(u.Scheme)] {
+							t.Fatalf("Link to %q in %q", a.Val, out)
+						}
+					}
+				}
+				if tok.Data != "br" && tt == html.StartTagToken {
+					open = append(open, tok.Data)
+				}
+			case html.EndTagToken:
+				tok := z.Token()
+				if len(open) == 0 || open[len(open)-1] != tok.Data {
+					t.Fatalf("Unexpected </%s> with %v open in %q", tok.Data, open, out)
+				}
+				open = open[:len(open)-1]
+			default:
+				t.Fatalf("Token %v in %q", z.Token(), out)
+			}
+		}
+	})
+}
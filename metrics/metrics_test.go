@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistry_WriteTo(t *testing.T) {
+	reg := NewRegistry()
+	c := reg.NewCounter("requests_total", "Requests by route.\nSecond line.", "route", "status")
+	c.Inc("GET /messages", "200")
+	c.Inc("GET /messages", "200")
+	c.Add(3, `POST /a "b"`, "500")
+
+	h := reg.NewHistogram("duration_seconds", "Latency.", []float64{1, 0.1}, "route")
+	h.Observe(0.05, "x")
+	h.Observe(0.5, "x")
+	h.Observe(2, "x")
+
+	reg.NewGaugeFunc("pool_connections", "Connections.", []string{"state"}, func(emit EmitFunc) {
+		emit(3, "idle")
+		emit(2, "in_use")
+	})
+	reg.NewCounterFunc("waits_total", "Waits.", nil, func(emit EmitFunc) {
+		emit(7)
+	})
+
+	var sb strings.Builder
+	if _, err := reg.WriteTo(&sb); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# HELP requests_total Requests by route.\nSecond line.
+# TYPE requests_total counter
+requests_total{route="GET /messages",status="200"} 2
+requests_total{route="POST /a \"b\"",status="500"} 3
+# HELP duration_seconds Latency.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{route="x",le="0.1"} 1
+duration_seconds_bucket{route="x",le="1"} 2
+duration_seconds_bucket{route="x",le="+Inf"} 3
+duration_seconds_sum{route="x"} 2.55
+duration_seconds_count{route="x"} 3
+# HELP pool_connections Connections.
+# TYPE pool_connections gauge
+pool_connections{state="idle"} 3
+pool_connections{state="in_use"} 2
+# HELP waits_total Waits.
+# TYPE waits_total counter
+waits_total 7
+`
+	if got := sb.String(); got != want {
+		t.Errorf("Got\n%s\nWant\n%s", got, want)
+	}
+}
+
+func TestRegistry_ServeHTTP(t *testing.T) {
+	reg := NewRegistry()
+	reg.NewCounter("up_total", "Up.").Inc()
+
+	rec := httptest.NewRecorder()
+	reg.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Got Content-Type %q", ct)
+	}
+	body, _ := io.ReadAll(rec.Body)
+	if !strings.Contains(string(body), "up_total 1\n") {
+		t.Errorf("Body does not contain the counter:\n%s", body)
+	}
+}
+
+func TestCounter_WrongLabels(t *testing.T) {
+	c := NewRegistry().NewCounter("c_total", "C.", "a")
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected panic for missing label value")
+		}
+	}()
+	c.Inc()
+}
@@ -0,0 +1,187 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// A Counter is a monotonically increasing value, partitioned by labels.
+type Counter struct {
+	desc
+	mu     sync.Mutex
+	series map[string]*counterSeries
+}
+
+type counterSeries struct {
+	values []string
+	v      float64
+}
+
+// NewCounter registers a counter with the given label names.
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{
+		desc:   desc{name: name, help: help, typ: "counter", labels: labels},
+		series: make(map[string]*counterSeries),
+	}
+	r.register(c)
+	return c
+}
+
+// Inc adds one to the series with the given label values.
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds v, which must not be negative, to the series with the given
+// label values.
+func (c *Counter) Add(v float64, values ...string) {
+	if v < 0 {
+		panic(fmt.Sprintf("metrics: counter %s cannot decrease", c.name))
+	}
+	key := c.key(values)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.series[key]
+	if !ok {
+		s = &counterSeries{values: slices.Clone(values)}
+		c.series[key] = s
+	}
+	s.v += v
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.writeHeader(w)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range sortedKeys(c.series) {
+		s := c.series[key]
+		writeSample(w, c.name, c.labels, s.values, "", s.v)
+	}
+}
+
+// A Histogram counts observations, such as latencies, in buckets,
+// partitioned by labels.
+type Histogram struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	values []string
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram registers a histogram with the given upper bucket bounds and
+// label names. The +Inf bucket is implicit.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	buckets = slices.Clone(buckets)
+	slices.Sort(buckets)
+	h := &Histogram{
+		desc:    desc{name: name, help: help, typ: "histogram", labels: labels},
+		buckets: buckets,
+		series:  make(map[string]*histogramSeries),
+	}
+	r.register(h)
+	return h
+}
+
+// Observe records v in the series with the given label values.
+func (h *Histogram) Observe(v float64, values ...string) {
+	key := h.key(values)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{
+			values: slices.Clone(values),
+			counts: make([]uint64, len(h.buckets)),
+		}
+		h.series[key] = s
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += v
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.writeHeader(w)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		var cumulative uint64
+		for i, le := range h.buckets {
+			cumulative += s.counts[i]
+			writeSample(w, h.name+"_bucket", h.labels, s.values, fmt.Sprintf(`le="%s"`, formatFloat(le)), float64(cumulative))
+		}
+		writeSample(w, h.name+"_bucket", h.labels, s.values, `le="+Inf"`, float64(s.count))
+		writeSample(w, h.name+"_sum", h.labels, s.values, "", s.sum)
+		writeSample(w, h.name+"_count", h.labels, s.values, "", float64(s.count))
+	}
+}
+
+// An EmitFunc reports the value of one series of a func metric.
+type EmitFunc func(v float64, values ...string)
+
+// funcMetric is a gauge or counter whose values are read from another
+// component, such as a connection pool, every time metrics are scraped.
+type funcMetric struct {
+	desc
+	collect func(emit EmitFunc)
+}
+
+// NewGaugeFunc registers a gauge whose series are reported by collect on
+// every scrape.
+func (r *Registry) NewGaugeFunc(name, help string, labels []string, collect func(emit EmitFunc)) {
+	r.register(&funcMetric{
+		desc:    desc{name: name, help: help, typ: "gauge", labels: labels},
+		collect: collect,
+	})
+}
+
+// NewCounterFunc registers a counter whose series are reported by collect
+// on every scrape. The reported values must never decrease.
+func (r *Registry) NewCounterFunc(name, help string, labels []string, collect func(emit EmitFunc)) {
+	r.register(&funcMetric{
+		desc:    desc{name: name, help: help, typ: "counter", labels: labels},
+		collect: collect,
+	})
+}
+
+func (f *funcMetric) write(w *bufio.Writer) {
+	f.writeHeader(w)
+	type sample struct {
+		values []string
+		v      float64
+	}
+	var samples []sample
+	f.collect(func(v float64, values ...string) {
+		f.key(values) // checks the number of values
+		samples = append(samples, sample{values: slices.Clone(values), v: v})
+	})
+	slices.SortFunc(samples, func(a, b sample) int {
+		return slices.Compare(a.values, b.values)
+	})
+	for _, s := range samples {
+		writeSample(w, f.name, f.labels, s.values, "", s.v)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, strings.Compare)
+	return keys
+}
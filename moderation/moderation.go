@@ -0,0 +1,113 @@
+// Package moderation checks the text of new messages against rules kept in
+// a store, which administrators edit while the application runs.
+package moderation
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+)
+
+// severity ranks actions from the most lenient to the strictest.
+var severity = map[string]int{
+	api.ModerationAllow:  0,
+	api.ModerationFlag:   1,
+	api.ModerationShadow: 2,
+	api.ModerationBlock:  3,
+}
+
+// A Store lists the rules to apply.
+type Store interface {
+	ListModerationRules(ctx context.Context) ([]api.ModerationRule, error)
+}
+
+// A Moderator applies the enabled rules of a Store, reloading them every
+// Interval so edits take effect without a restart. Until the rules are first
+// loaded, every message is allowed.
+type Moderator struct {
+	Logger   *slog.Logger
+	Store    Store
+	Interval time.Duration
+
+	rules atomic.Pointer[[]compiled]
+}
+
+type compiled struct {
+	name   string
+	action string
+	rule   Rule
+}
+
+// Moderate checks text against every rule. The verdict is the strictest
+// action of the rules text breaks, and allow if it breaks none. Rules with
+// the allow action only add their reasons, which lets a rule be tried out
+// before it is enforced.
+func (m *Moderator) Moderate(text string) api.ModerationVerdict {
+	v := api.ModerationVerdict{Action: api.ModerationAllow}
+	rules := m.rules.Load()
+	if rules == nil {
+		return v
+	}
+	for _, c := range *rules {
+		reason := c.rule.Check(text)
+		if reason == "" {
+			continue
+		}
+		v.Reasons = append(v.Reasons, c.name+": "+reason)
+		if severity[c.action] > severity[v.Action] {
+			v.Action = c.action
+		}
+	}
+	return v
+}
+
+// CheckRule reports why rule can't be compiled.
+func (m *Moderator) CheckRule(rule api.ModerationRule) error {
+	_, err := Compile(rule)
+	return err
+}
+
+// Load replaces the rules with the enabled rules of the Store. Rules that
+// don't compile, which can only have been stored bypassing CheckRule, are
+// logged and skipped. If the rules can't be listed, the current ones are
+// kept.
+func (m *Moderator) Load(ctx context.Context) error {
+	rules, err := m.Store.ListModerationRules(ctx)
+	if err != nil {
+		return fmt.Errorf("list rules: %w", err)
+	}
+	out := make([]compiled, 0, len(rules))
+	for _, r := range rules {
+		if !r.Enabled {
+			continue
+		}
+		rule, err := Compile(r)
+		if err != nil {
+			m.Logger.Error("Skipping invalid moderation rule", "rule_id", r.ID, "error", err.Error())
+			continue
+		}
+		out = append(out, compiled{name: r.Name, action: r.Action, rule: rule})
+	}
+	m.rules.Store(&out)
+	return nil
+}
+
+// Run reloads the rules every Interval until ctx is cancelled.
+func (m *Moderator) Run(ctx context.Context) {
+	t := time.NewTicker(m.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if err := m.Load(ctx); err != nil {
+			m.Logger.Warn("Could not reload moderation rules", "error", err.Error())
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package moderation
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+	"github.com/google/go-cmp/cmp"
+	"github.com/neilotoole/slogt"
+)
+
+func TestModerator(t *testing.T) {
+	store := &teststore{rules: []api.ModerationRule{
+		{ID: "1", Name: "trial", Kind: api.RuleRegex, Pattern: "hello", Action: api.ModerationAllow, Enabled: true},
+		{ID: "2", Name: "links", Kind: api.RuleLinks, Limit: 0, Action: api.ModerationFlag, Enabled: true},
+		{ID: "3", Name: "spam", Kind: api.RuleBlocklist, Words: []string{"spam"}, Action: api.ModerationShadow, Enabled: true},
+		{ID: "4", Name: "off", Kind: api.RuleBlocklist, Words: []string{"hello"}, Action: api.ModerationBlock},
+		{ID: "5", Name: "broken", Kind: api.RuleRegex, Pattern: "(", Action: api.ModerationBlock, Enabled: true},
+	}}
+	m := &Moderator{Logger: slogt.New(t), Store: store}
+
+	if got := m.Moderate("spam"); got.Action != api.ModerationAllow {
+		t.Errorf("Got %+v before loading, want allow", got)
+	}
+	if err := m.Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		text string
+		want api.ModerationVerdict
+	}{
+		{
+			text: "good day",
+			want: api.ModerationVerdict{Action: api.ModerationAllow},
+		},
+		{
+			text: "hello",
+			want: api.ModerationVerdict{Action: api.ModerationAllow, Reasons: []string{`trial: matches "hello"`}},
+		},
+		{
+			text: "hello, spam at https://spam.example",
+			want: api.ModerationVerdict{
+				Action: api.ModerationShadow,
+				Reasons: []string{
+					`trial: matches "hello"`,
+					"links: has more than 0 links",
+					`spam: contains "spam"`,
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		if diff := cmp.Diff(tt.want, m.Moderate(tt.text)); diff != "" {
+			t.Errorf("Moderate(%q) mismatch (-want +got):\n%s", tt.text, diff)
+		}
+	}
+
+	// Reloading picks up edits, and a failed reload keeps the rules.
+	store.rules[3].Enabled = true
+	if err := m.Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	store.err = errors.New("connection refused")
+	if err := m.Load(context.Background()); err == nil {
+		t.Error("Load succeeded, want error")
+	}
+	if got := m.Moderate("hello"); got.Action != api.ModerationBlock {
+		t.Errorf("Got %+v after reload, want block", got)
+	}
+}
+
+type teststore struct {
+	rules []api.ModerationRule
+	err   error
+}
+
+func (s *teststore) ListModerationRules(context.Context) ([]api.ModerationRule, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return append([]api.ModerationRule(nil), s.rules...), nil
+}
@@ -0,0 +1,218 @@
+package moderation
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+)
+
+// maxPattern bounds the length of regular expressions. Go's regular
+// expressions run in linear time, so this only bounds their compiled size.
+const maxPattern = 1000
+
+// A Rule checks the text of a message.
+type Rule interface {
+	// Check returns why text breaks the rule, or "" if it does not.
+	Check(text string) string
+}
+
+// Compile builds the Rule that rule describes.
+func Compile(rule api.ModerationRule) (Rule, error) {
+	switch rule.Action {
+	case api.ModerationAllow, api.ModerationFlag, api.ModerationShadow, api.ModerationBlock:
+	default:
+		return nil, fmt.Errorf("unknown action %q", rule.Action)
+	}
+	switch rule.Kind {
+	case api.RuleBlocklist:
+		return newBlocklist(rule.Words)
+	case api.RuleRegex:
+		return newPattern(rule.Pattern)
+	case api.RuleLinks:
+		if rule.Limit < 0 {
+			return nil, errors.New("limit must not be negative")
+		}
+		return links(rule.Limit), nil
+	case api.RuleRepeat:
+		if rule.Limit < 1 {
+			return nil, errors.New("limit must be at least 1")
+		}
+		return repeat(rule.Limit), nil
+	default:
+		return nil, fmt.Errorf("unknown kind %q", rule.Kind)
+	}
+}
+
+// A blocklist is broken by text holding any of its entries as whole words.
+// Entries of several words must appear in a row.
+type blocklist struct {
+	words   map[string]string // normalized to as configured
+	phrases [][]string        // normalized, of more than one word
+	names   []string          // of the phrases, as configured
+}
+
+func newBlocklist(entries []string) (*blocklist, error) {
+	if len(entries) == 0 {
+		return nil, errors.New("words are required")
+	}
+	b := &blocklist{words: make(map[string]string)}
+	for _, e := range entries {
+		switch ws := words(e); len(ws) {
+		case 0:
+			return nil, fmt.Errorf("blocked word %q has no letters", e)
+		case 1:
+			b.words[ws[0]] = e
+		default:
+			b.phrases = append(b.phrases, ws)
+			b.names = append(b.names, e)
+		}
+	}
+	return b, nil
+}
+
+func (b *blocklist) Check(text string) string {
+	ws := words(text)
+	for _, w := range ws {
+		if e, ok := b.words[w]; ok {
+			return fmt.Sprintf("contains %q", e)
+		}
+	}
+	for i, p := range b.phrases {
+		for j := 0; j+len(p) <= len(ws); j++ {
+			if equal(ws[j:j+len(p)], p) {
+				return fmt.Sprintf("contains %q", b.names[i])
+			}
+		}
+	}
+	return ""
+}
+
+func equal(a, b []string) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// leet maps the characters that stand in for letters in leetspeak to them.
+var leet = map[rune]rune{
+	'0': 'o',
+	'1': 'i',
+	'3': 'e',
+	'4': 'a',
+	'5': 's',
+	'7': 't',
+	'8': 'b',
+	'9': 'g',
+	'@': 'a',
+	'$': 's',
+	'!': 'i',
+	'|': 'l',
+	'+': 't',
+}
+
+// words splits text into lowercase words with leetspeak undone, also at
+// their edges, so "$pam" is "spam" and "shi+" is "shit". Symbols on their own
+// are not words, and exclamation marks ending a word end a sentence, so
+// "wow!" is "wow" but "sh!t" is "shit". Letters spelled out one by one, as in
+// "s p a m" or "s.p.a.m", are joined into a word.
+func words(text string) []string {
+	fields := strings.FieldsFunc(text, func(r rune) bool {
+		_, ok := leet[r]
+		return !ok && !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	out := make([]string, 0, len(fields))
+	var spelled strings.Builder
+	flush := func() {
+		if spelled.Len() > 1 {
+			out = append(out, spelled.String())
+		}
+		spelled.Reset()
+	}
+	for _, f := range fields {
+		if !strings.ContainsFunc(f, func(r rune) bool {
+			return unicode.IsLetter(r) || unicode.IsDigit(r)
+		}) {
+			continue
+		}
+		f = strings.TrimRight(f, "!")
+		w := strings.Map(func(r rune) rune {
+			if l, ok := leet[r]; ok {
+				return l
+			}
+			return unicode.ToLower(r)
+		}, f)
+		out = append(out, w)
+		if len([]rune(w)) == 1 {
+			spelled.WriteString(w)
+		} else {
+			flush()
+		}
+	}
+	flush()
+	return out
+}
+
+// A pattern is broken by text matching a regular expression.
+type pattern struct {
+	re *regexp.Regexp
+}
+
+func newPattern(expr string) (*pattern, error) {
+	if expr == "" {
+		return nil, errors.New("pattern is required")
+	}
+	if len(expr) > maxPattern {
+		return nil, fmt.Errorf("pattern is longer than %d characters", maxPattern)
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("pattern: %w", err)
+	}
+	return &pattern{re: re}, nil
+}
+
+func (p *pattern) Check(text string) string {
+	if loc := p.re.FindStringIndex(text); loc != nil {
+		return fmt.Sprintf("matches %q", text[loc[0]:loc[1]])
+	}
+	return ""
+}
+
+var linkRegexp = regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+`)
+
+// links is broken by text with more links than it allows.
+type links int
+
+func (l links) Check(text string) string {
+	if n := len(linkRegexp.FindAllStringIndex(text, int(l)+1)); n > int(l) {
+		return fmt.Sprintf("has more than %d links", l)
+	}
+	return ""
+}
+
+// repeat is broken by text with a character, other than whitespace, repeated
+// more times in a row than it allows.
+type repeat int
+
+func (limit repeat) Check(text string) string {
+	var last rune
+	n := 0
+	for _, r := range text {
+		if r == last {
+			n++
+		} else {
+			last, n = r, 1
+		}
+		if n > int(limit) && !unicode.IsSpace(r) {
+			return fmt.Sprintf("repeats %q more than %d times", r, limit)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,123 @@
+package moderation
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+)
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    api.ModerationRule
+		wantErr string
+	}{
+		{
+			name: "Blocklist",
+			rule: api.ModerationRule{Kind: api.RuleBlocklist, Words: []string{"spam"}, Action: api.ModerationBlock},
+		},
+		{
+			name:    "NoWords",
+			rule:    api.ModerationRule{Kind: api.RuleBlocklist, Action: api.ModerationBlock},
+			wantErr: "words are required",
+		},
+		{
+			name:    "WordWithoutLetters",
+			rule:    api.ModerationRule{Kind: api.RuleBlocklist, Words: []string{"..."}, Action: api.ModerationBlock},
+			wantErr: `blocked word "..." has no letters`,
+		},
+		{
+			name:    "BadPattern",
+			rule:    api.ModerationRule{Kind: api.RuleRegex, Pattern: "(", Action: api.ModerationFlag},
+			wantErr: "pattern: error parsing regexp: missing closing ): `(`",
+		},
+		{
+			name:    "LongPattern",
+			rule:    api.ModerationRule{Kind: api.RuleRegex, Pattern: strings.Repeat("a", 1001), Action: api.ModerationFlag},
+			wantErr: "pattern is longer than 1000 characters",
+		},
+		{
+			name:    "NoRepeatLimit",
+			rule:    api.ModerationRule{Kind: api.RuleRepeat, Action: api.ModerationFlag},
+			wantErr: "limit must be at least 1",
+		},
+		{
+			name:    "UnknownKind",
+			rule:    api.ModerationRule{Kind: "ai", Action: api.ModerationFlag},
+			wantErr: `unknown kind "ai"`,
+		},
+		{
+			name:    "UnknownAction",
+			rule:    api.ModerationRule{Kind: api.RuleLinks, Action: "ban"},
+			wantErr: `unknown action "ban"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Compile(tt.rule)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("Got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRules(t *testing.T) {
+	blocklist, err := newBlocklist([]string{"spam", "Buy Now"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	swears, err := newBlocklist([]string{"spam", "ass", "shit"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pattern, err := newPattern(`(?i)\bfree\s+money\b`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		rule Rule
+		text string
+		want string
+	}{
+		{name: "Word", rule: blocklist, text: "no SPAM please", want: `contains "spam"`},
+		{name: "Leetspeak", rule: blocklist, text: "5p@m!", want: `contains "spam"`},
+		{name: "LeetInside", rule: swears, text: "sp4m", want: `contains "spam"`},
+		{name: "SymbolInside", rule: swears, text: "sh!t", want: `contains "shit"`},
+		{name: "LeadingSymbol", rule: swears, text: "$pam", want: `contains "spam"`},
+		{name: "LeadingAt", rule: swears, text: "what an @ss", want: `contains "ass"`},
+		{name: "TrailingSymbol", rule: swears, text: "oh shi+", want: `contains "shit"`},
+		{name: "Exclamation", rule: swears, text: "wow! pass!", want: ""},
+		{name: "Spelled", rule: blocklist, text: "s.p.a.m", want: `contains "spam"`},
+		{name: "Spaced", rule: blocklist, text: "pure s p a m here", want: `contains "spam"`},
+		{name: "Phrase", rule: blocklist, text: "BUY... n0w!", want: `contains "Buy Now"`},
+		{name: "PartOfWord", rule: blocklist, text: "spammer", want: ""},
+		{name: "PartOfPhrase", rule: blocklist, text: "buy it now", want: ""},
+		{name: "Clean", rule: blocklist, text: "2 + 2 = 4!", want: ""},
+		{name: "Pattern", rule: pattern, text: "Get FREE  money", want: `matches "FREE  money"`},
+		{name: "NoPattern", rule: pattern, text: "money for free", want: ""},
+		{name: "Links", rule: links(1), text: "see https://a.example and www.b.example", want: "has more than 1 links"},
+		{name: "FewLinks", rule: links(1), text: "see https://a.example", want: ""},
+		{name: "NoLinks", rule: links(0), text: "see HTTP://a.example", want: "has more than 0 links"},
+		{name: "Repeat", rule: repeat(3), text: "nooooo", want: `repeats 'o' more than 3 times`},
+		{name: "RepeatUnicode", rule: repeat(3), text: "🎉🎉🎉🎉", want: `repeats '🎉' more than 3 times`},
+		{name: "RepeatSpaces", rule: repeat(3), text: "a      b", want: ""},
+		{name: "FewRepeats", rule: repeat(3), text: "nooo", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.Check(tt.text); got != tt.want {
+				t.Errorf("Check(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+	"github.com/uptrace/bun/driver/pgdriver"
+)
+
+// InsertAPIKey inserts an API key into the database. The returned key holds
+// the generated ID.
+func (pg *Postgres) InsertAPIKey(ctx context.Context, key api.APIKey) (api.APIKey, error) {
+	k := &apiKey{
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		KeyHash:   key.Hash,
+		Scopes:    key.Scopes,
+		CreatedAt: key.CreatedAt,
+		ExpiresAt: key.ExpiresAt,
+	}
+	if _, err := pg.bun.NewInsert().Model(k).Returning("*").Exec(ctx); err != nil {
+		return api.APIKey{}, fmt.Errorf("insert: %w", wrapErr(err))
+	}
+	return k.APIKey(), nil
+}
+
+// ListAPIKeys returns all API keys, including revoked and expired ones, newest
+// first.
+func (pg *Postgres) ListAPIKeys(ctx context.Context) ([]api.APIKey, error) {
+	var keys []apiKey
+	if err := pg.bun.NewSelect().Model(&keys).Order("created_at DESC").Scan(ctx); err != nil {
+		return nil, fmt.Errorf("select: %w", wrapErr(err))
+	}
+	out := make([]api.APIKey, len(keys))
+	for i, k := range keys {
+		out[i] = k.APIKey()
+	}
+	return out, nil
+}
+
+// GetAPIKey returns the API key with the given hash, or api.ErrAPIKeyNotFound.
+func (pg *Postgres) GetAPIKey(ctx context.Context, hash string) (*api.APIKey, error) {
+	var k apiKey
+	err := pg.bun.NewSelect().Model(&k).Where("key_hash = ?", hash).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, api.ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", wrapErr(err))
+	}
+	key := k.APIKey()
+	return &key, nil
+}
+
+// RevokeAPIKey marks the API key revoked and returns it. Revoking a key
+// twice keeps the original revocation time.
+func (pg *Postgres) RevokeAPIKey(ctx context.Context, id string) (*api.APIKey, error) {
+	var k apiKey
+	err := pg.bun.NewUpdate().
+		Model(&k).
+		Set("revoked_at = COALESCE(revoked_at, now())").
+		Where("id = ?", id).
+		Returning("*").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) || isInvalidText(err) {
+		return nil, api.ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("update: %w", wrapErr(err))
+	}
+	key := k.APIKey()
+	return &key, nil
+}
+
+// isInvalidText reports whether err is Postgres rejecting a malformed value,
+// such as an ID that is not a UUID.
+func isInvalidText(err error) bool {
+	var pgErr pgdriver.Error
+	return errors.As(err, &pgErr) && pgErr.Field('C') == "22P02"
+}
@@ -0,0 +1,64 @@
+//go:build integration
+
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+)
+
+func TestPostgres_APIKeys(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	pg := connect(t)
+	if _, err := pg.bun.NewTruncateTable().Model((*apiKey)(nil)).Exec(ctx); err != nil {
+		t.Fatalf("Could not truncate table: %v", err)
+	}
+
+	key, _ := api.NewAPIKey("billing", []string{api.ScopeMessagesWrite, api.ScopeReactionsWrite}, nil)
+	inserted, err := pg.InsertAPIKey(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inserted.ID == "" {
+		t.Error("Returned key has empty ID")
+	}
+
+	got, err := pg.GetAPIKey(ctx, key.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != inserted.ID || got.Name != "billing" || len(got.Scopes) != 2 {
+		t.Errorf("Got key %+v, want %+v", got, inserted)
+	}
+	if !got.Active(time.Now()) {
+		t.Error("New key is not active")
+	}
+	if _, err := pg.GetAPIKey(ctx, "unknown"); !errors.Is(err, api.ErrAPIKeyNotFound) {
+		t.Errorf("Got %v for unknown key, want ErrAPIKeyNotFound", err)
+	}
+
+	keys, err := pg.ListAPIKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 {
+		t.Errorf("Listed %d keys, want 1", len(keys))
+	}
+
+	revoked, err := pg.RevokeAPIKey(ctx, inserted.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked.Hash != key.Hash || revoked.Active(time.Now()) {
+		t.Errorf("Revoked key %+v is still active", revoked)
+	}
+	if _, err := pg.RevokeAPIKey(ctx, "not-a-uuid"); !errors.Is(err, api.ErrAPIKeyNotFound) {
+		t.Errorf("Got %v for malformed ID, want ErrAPIKeyNotFound", err)
+	}
+}
@@ -0,0 +1,151 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+	"github.com/uptrace/bun"
+)
+
+// InsertAttachment inserts an uploaded file, not attached to a message yet.
+func (pg *Postgres) InsertAttachment(ctx context.Context, a api.Attachment) (api.Attachment, error) {
+	row := &attachment{
+		ID:          a.ID,
+		UserID:      a.UserID,
+		FileName:    a.FileName,
+		ContentType: a.ContentType,
+		Size:        a.Size,
+		StorageKey:  a.Key,
+		CreatedAt:   a.CreatedAt,
+	}
+	if _, err := pg.bun.NewInsert().Model(row).Exec(ctx); err != nil {
+		return api.Attachment{}, fmt.Errorf("insert: %w", wrapErr(err))
+	}
+	return row.APIAttachment(), nil
+}
+
+// GetAttachment returns an attachment, or api.ErrAttachmentNotFound, also if
+// its message is hidden by moderation.
+func (pg *Postgres) GetAttachment(ctx context.Context, id string) (*api.Attachment, error) {
+	var row attachment
+	err := pg.bun.NewSelect().
+		Model(&row).
+		Where("attachment.id = ?", id).
+		Where("attachment.message_id IS NULL OR NOT EXISTS (?)", pg.bun.NewSelect().
+			Model((*message)(nil)).
+			ColumnExpr("1").
+			Where("message.id = attachment.message_id").
+			Where("message.moderation IN (?)", hiddenModeration)).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) || isInvalidText(err) {
+		return nil, api.ErrAttachmentNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", wrapErr(err))
+	}
+	thumbs, err := thumbnails(ctx, pg.bun, []string{row.ID})
+	if err != nil {
+		return nil, err
+	}
+	a := row.APIAttachment()
+	a.Thumbnails = thumbs[row.ID]
+	return &a, nil
+}
+
+// attach links the attachments, of which only the IDs are used, to a message
+// being inserted. They must have been uploaded by the message's author and
+// not sent before.
+func attach(ctx context.Context, tx bun.Tx, m *message, attachments []api.Attachment) ([]api.Attachment, error) {
+	if len(attachments) == 0 {
+		return nil, nil
+	}
+	ids := make([]string, len(attachments))
+	for i, a := range attachments {
+		ids[i] = a.ID
+	}
+	ids = uniq(ids)
+	var rows []attachment
+	_, err := tx.NewUpdate().
+		Model((*attachment)(nil)).
+		Set("message_id = ?", m.ID).
+		Where("id IN (?)", bun.In(ids)).
+		Where("user_id = ?", m.UserID).
+		Where("message_id IS NULL").
+		Returning("*").
+		Exec(ctx, &rows)
+	if isInvalidText(err) {
+		return nil, api.ErrAttachmentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) != len(ids) {
+		return nil, api.ErrAttachmentNotFound
+	}
+
+	// Thumbnails may be ready before the attachment is sent.
+	thumbs, err := thumbnails(ctx, tx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the order they were given in.
+	byID := make(map[string]api.Attachment, len(rows))
+	for _, row := range rows {
+		a := row.APIAttachment()
+		a.Thumbnails = thumbs[row.ID]
+		byID[row.ID] = a
+	}
+	out := make([]api.Attachment, 0, len(rows))
+	for _, id := range ids {
+		out = append(out, byID[id])
+	}
+	return out, nil
+}
+
+// attachments returns the attachments of each message, oldest first.
+func (pg *Postgres) attachments(ctx context.Context, msgIDs []string) (map[string][]api.Attachment, error) {
+	out := make(map[string][]api.Attachment, len(msgIDs))
+	if len(msgIDs) == 0 {
+		return out, nil
+	}
+	var rows []attachment
+	err := pg.bun.NewSelect().
+		Model(&rows).
+		Where("message_id IN (?)", bun.In(msgIDs)).
+		OrderExpr("created_at, id").
+		Scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("select attachments: %w", wrapErr(err))
+	}
+	ids := make([]string, len(rows))
+	for i, row := range rows {
+		ids[i] = row.ID
+	}
+	thumbs, err := thumbnails(ctx, pg.bun, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		a := row.APIAttachment()
+		a.Thumbnails = thumbs[row.ID]
+		out[row.MessageID] = append(out[row.MessageID], a)
+	}
+	return out, nil
+}
+
+// uniq returns the distinct strings in s, in order.
+func uniq(s []string) []string {
+	seen := make(map[string]bool, len(s))
+	var out []string
+	for _, v := range s {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
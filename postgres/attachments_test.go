@@ -0,0 +1,91 @@
+//go:build integration
+
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+)
+
+func TestPostgres_Attachments(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	pg := connect(t)
+	stored, err := pg.InsertAttachment(ctx, api.Attachment{
+		ID:          "4b0e6e43-4d3b-4d0f-9c59-6c1a0e3e2a11",
+		UserID:      "alice",
+		FileName:    "cat.png",
+		ContentType: "image/png",
+		Size:        5,
+		Key:         "attachments/4b0e6e43-4d3b-4d0f-9c59-6c1a0e3e2a11",
+		CreatedAt:   time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pg.GetAttachment(ctx, "not-a-uuid"); !errors.Is(err, api.ErrAttachmentNotFound) {
+		t.Errorf("Got error %v for a malformed ID, want ErrAttachmentNotFound", err)
+	}
+
+	// Only the uploader can send it.
+	_, err = pg.InsertMessage(ctx, api.Message{
+		Text:        "mine now",
+		UserID:      "bob",
+		Attachments: []api.Attachment{{ID: stored.ID}},
+	})
+	if !errors.Is(err, api.ErrAttachmentNotFound) {
+		t.Errorf("Got error %v sending another user's attachment, want ErrAttachmentNotFound", err)
+	}
+
+	msg, err := pg.InsertMessage(ctx, api.Message{
+		Text:        "look",
+		UserID:      "alice",
+		Attachments: []api.Attachment{{ID: stored.ID}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msg.Attachments) != 1 || msg.Attachments[0].MessageID != msg.ID || msg.Attachments[0].FileName != "cat.png" {
+		t.Errorf("Got attachments %+v, want cat.png on the message", msg.Attachments)
+	}
+
+	msgs, err := pg.ListMessages(ctx, api.ListQuery{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) == 0 || msgs[0].ID != msg.ID || len(msgs[0].Attachments) != 1 {
+		t.Errorf("Got messages %+v, want the message with its attachment first", msgs)
+	}
+
+	// It can't be sent twice.
+	_, err = pg.InsertMessage(ctx, api.Message{
+		Text:        "again",
+		UserID:      "alice",
+		Attachments: []api.Attachment{{ID: stored.ID}},
+	})
+	if !errors.Is(err, api.ErrAttachmentNotFound) {
+		t.Errorf("Got error %v sending an attachment twice, want ErrAttachmentNotFound", err)
+	}
+
+	// Hiding the message hides its attachment, until it is approved.
+	if _, err := pg.GetAttachment(ctx, stored.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pg.FlagMessage(ctx, api.Flag{MessageID: msg.ID, UserID: "carol", Reason: "spam"}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pg.GetAttachment(ctx, stored.ID); !errors.Is(err, api.ErrAttachmentNotFound) {
+		t.Errorf("Got error %v for the attachment of a hidden message, want ErrAttachmentNotFound", err)
+	}
+	if _, err := pg.ReviewMessage(ctx, msg.ID, "mod", api.ReviewApprove); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pg.GetAttachment(ctx, stored.ID); err != nil {
+		t.Errorf("Got error %v for the attachment of an approved message, want it", err)
+	}
+}
@@ -0,0 +1,91 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+)
+
+// InsertBan inserts a ban into the database. The returned ban holds the
+// generated ID.
+func (pg *Postgres) InsertBan(ctx context.Context, ban api.Ban) (api.Ban, error) {
+	b := &userBan{
+		UserID:    ban.UserID,
+		Kind:      ban.Kind,
+		Reason:    ban.Reason,
+		CreatedBy: ban.CreatedBy,
+		CreatedAt: ban.CreatedAt,
+		ExpiresAt: ban.ExpiresAt,
+	}
+	if _, err := pg.bun.NewInsert().Model(b).Returning("*").Exec(ctx); err != nil {
+		return api.Ban{}, fmt.Errorf("insert: %w", wrapErr(err))
+	}
+	return b.APIBan(), nil
+}
+
+// ListBans returns all bans of a user, including lifted and expired ones,
+// newest first.
+func (pg *Postgres) ListBans(ctx context.Context, userID string) ([]api.Ban, error) {
+	var bans []userBan
+	err := pg.bun.NewSelect().
+		Model(&bans).
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", wrapErr(err))
+	}
+	out := make([]api.Ban, len(bans))
+	for i, b := range bans {
+		out[i] = b.APIBan()
+	}
+	return out, nil
+}
+
+// ActiveBans returns the bans of a user that are neither lifted nor expired.
+func (pg *Postgres) ActiveBans(ctx context.Context, userID string) ([]api.Ban, error) {
+	var bans []userBan
+	err := pg.bun.NewSelect().
+		Model(&bans).
+		Where("user_id = ?", userID).
+		Where("lifted_at IS NULL").
+		Order("created_at DESC").
+		Scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", wrapErr(err))
+	}
+	// Expiry is checked like that of API keys, against the clock of the
+	// caller.
+	now := time.Now()
+	var out []api.Ban
+	for _, b := range bans {
+		if ban := b.APIBan(); ban.Active(now) {
+			out = append(out, ban)
+		}
+	}
+	return out, nil
+}
+
+// LiftBan marks the ban lifted and returns it. Lifting a ban twice keeps the
+// original time it was lifted.
+func (pg *Postgres) LiftBan(ctx context.Context, id string) (*api.Ban, error) {
+	var b userBan
+	err := pg.bun.NewUpdate().
+		Model(&b).
+		Set("lifted_at = COALESCE(lifted_at, now())").
+		Where("id = ?", id).
+		Returning("*").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) || isInvalidText(err) {
+		return nil, api.ErrBanNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("update: %w", wrapErr(err))
+	}
+	ban := b.APIBan()
+	return &ban, nil
+}
@@ -0,0 +1,87 @@
+//go:build integration
+
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+)
+
+func TestPostgres_Bans(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	pg := connect(t)
+	if _, err := pg.bun.NewTruncateTable().Model((*userBan)(nil)).Exec(ctx); err != nil {
+		t.Fatalf("Could not truncate table: %v", err)
+	}
+	past := time.Now().Add(-time.Hour)
+	if _, err := pg.InsertBan(ctx, api.Ban{UserID: "spammer", Kind: api.BanBan, CreatedBy: "mod", ExpiresAt: &past}); err != nil {
+		t.Fatal(err)
+	}
+	ban, err := pg.InsertBan(ctx, api.Ban{UserID: "spammer", Kind: api.BanShadow, Reason: "spam", CreatedBy: "mod"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ban.ID == "" || ban.CreatedAt.IsZero() {
+		t.Errorf("Got ban %+v, want it stored", ban)
+	}
+
+	active, err := pg.ActiveBans(ctx, "spammer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(active) != 1 || active[0].ID != ban.ID {
+		t.Errorf("Got active bans %+v, want the shadow ban", active)
+	}
+	if bans, err := pg.ListBans(ctx, "spammer"); err != nil || len(bans) != 2 {
+		t.Errorf("Got bans %+v, %v, want both", bans, err)
+	}
+
+	lifted, err := pg.LiftBan(ctx, ban.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lifted.LiftedAt == nil {
+		t.Errorf("Got ban %+v, want it lifted", lifted)
+	}
+	if active, err := pg.ActiveBans(ctx, "spammer"); err != nil || len(active) != 0 {
+		t.Errorf("Got active bans %+v, %v after lifting, want none", active, err)
+	}
+	for _, id := range []string{"not-a-uuid", "00000000-0000-4000-8000-000000000000"} {
+		if _, err := pg.LiftBan(ctx, id); !errors.Is(err, api.ErrBanNotFound) {
+			t.Errorf("Got %v lifting %s, want ErrBanNotFound", err, id)
+		}
+	}
+}
+
+func TestPostgres_ShadowedMessagesViewer(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	pg := connect(t)
+	shadowed, err := pg.InsertMessage(ctx, api.Message{Text: "buy now", UserID: "spammer", Moderation: api.ModerationShadow})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pg.InsertMessage(ctx, api.Message{Text: "buy now", UserID: "spammer", Moderation: api.ModerationHide}); err != nil {
+		t.Fatal(err)
+	}
+
+	for viewer, want := range map[string]int{"": 0, "alice": 0, "spammer": 1} {
+		msgs, err := pg.ListMessages(ctx, api.ListQuery{Limit: 10, Viewer: viewer})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(msgs) != want {
+			t.Errorf("Got %d messages for %q, want %d", len(msgs), viewer, want)
+		}
+		if want == 1 && msgs[0].ID != shadowed.ID {
+			t.Errorf("Got message %+v for %q, want the shadowed one", msgs[0], viewer)
+		}
+	}
+}
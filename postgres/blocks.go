@@ -0,0 +1,63 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+)
+
+// BlockUser records that a user blocked another, unless they did already,
+// and returns the block and whether it is new.
+func (pg *Postgres) BlockUser(ctx context.Context, block api.Block) (api.Block, bool, error) {
+	b := &userBlock{
+		UserID:        block.UserID,
+		BlockedUserID: block.BlockedUserID,
+		CreatedAt:     block.CreatedAt,
+	}
+	r, err := pg.bun.NewInsert().Model(b).On("CONFLICT DO NOTHING").Exec(ctx)
+	if err != nil {
+		return api.Block{}, false, fmt.Errorf("insert: %w", wrapErr(err))
+	}
+	if n, err := r.RowsAffected(); err == nil && n > 0 {
+		return b.APIBlock(), true, nil
+	}
+	if err := pg.bun.NewSelect().Model(b).WherePK().Scan(ctx); err != nil {
+		return api.Block{}, false, fmt.Errorf("select: %w", wrapErr(err))
+	}
+	return b.APIBlock(), false, nil
+}
+
+// UnblockUser deletes a block, or returns api.ErrBlockNotFound.
+func (pg *Postgres) UnblockUser(ctx context.Context, userID, blockedUserID string) error {
+	r, err := pg.bun.NewDelete().
+		Model((*userBlock)(nil)).
+		Where("user_id = ?", userID).
+		Where("blocked_user_id = ?", blockedUserID).
+		Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("delete: %w", wrapErr(err))
+	}
+	if n, err := r.RowsAffected(); err == nil && n == 0 {
+		return api.ErrBlockNotFound
+	}
+	return nil
+}
+
+// ListBlocks returns the blocks of a user, newest first.
+func (pg *Postgres) ListBlocks(ctx context.Context, userID string) ([]api.Block, error) {
+	var blocks []userBlock
+	err := pg.bun.NewSelect().
+		Model(&blocks).
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", wrapErr(err))
+	}
+	out := make([]api.Block, len(blocks))
+	for i, b := range blocks {
+		out[i] = b.APIBlock()
+	}
+	return out, nil
+}
@@ -0,0 +1,58 @@
+//go:build integration
+
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+)
+
+func TestPostgres_Blocks(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	pg := connect(t)
+	if _, err := pg.bun.NewTruncateTable().Model((*userBlock)(nil)).Exec(ctx); err != nil {
+		t.Fatalf("Could not truncate table: %v", err)
+	}
+	block := api.Block{UserID: "alice", BlockedUserID: "troll", CreatedAt: time.Now()}
+	if _, created, err := pg.BlockUser(ctx, block); err != nil || !created {
+		t.Fatalf("Got created %t, %v blocking, want a new block", created, err)
+	}
+	if _, created, err := pg.BlockUser(ctx, block); err != nil || created {
+		t.Errorf("Got created %t, %v blocking again, want the same block", created, err)
+	}
+	blocks, err := pg.ListBlocks(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 1 || blocks[0].BlockedUserID != "troll" {
+		t.Errorf("Got blocks %+v, want troll", blocks)
+	}
+
+	if _, err := pg.InsertMessage(ctx, api.Message{Text: "buy now", UserID: "troll"}); err != nil {
+		t.Fatal(err)
+	}
+	hello, err := pg.InsertMessage(ctx, api.Message{Text: "hello", UserID: "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := pg.ListMessages(ctx, api.ListQuery{Limit: 10, ExcludeUserIDs: []string{"troll"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || msgs[0].ID != hello.ID {
+		t.Errorf("Got messages %+v, want only bob's", msgs)
+	}
+
+	if err := pg.UnblockUser(ctx, "alice", "troll"); err != nil {
+		t.Fatal(err)
+	}
+	if err := pg.UnblockUser(ctx, "alice", "troll"); !errors.Is(err, api.ErrBlockNotFound) {
+		t.Errorf("Got %v unblocking again, want ErrBlockNotFound", err)
+	}
+}
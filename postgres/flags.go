@@ -0,0 +1,168 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+	"github.com/uptrace/bun"
+)
+
+// FlagMessage records a user's flag of a message, unless they flagged it
+// already, and hides the message once hideAfter of its flags are pending.
+func (pg *Postgres) FlagMessage(ctx context.Context, flag api.Flag, hideAfter int) (api.FlagResult, error) {
+	var res api.FlagResult
+	err := pg.bun.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		// Locking the message serializes its flags, so only one of them hides
+		// it.
+		var m message
+		if err := tx.NewSelect().Model(&m).Where("id = ?", flag.MessageID).For("UPDATE").Scan(ctx); err != nil {
+			return err
+		}
+		if m.Moderation == api.ModerationRemove {
+			return api.ErrMessageNotFound
+		}
+
+		f := &messageFlag{
+			MessageID: flag.MessageID,
+			UserID:    flag.UserID,
+			Reason:    flag.Reason,
+			CreatedAt: flag.CreatedAt,
+		}
+		r, err := tx.NewInsert().Model(f).On("CONFLICT DO NOTHING").Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if n, err := r.RowsAffected(); err == nil && n == 0 {
+			if err := tx.NewSelect().Model(f).WherePK().Scan(ctx); err != nil {
+				return err
+			}
+		} else {
+			res.Created = true
+		}
+		res.Flag = f.APIFlag()
+
+		if m.Moderation != "" && m.Moderation != api.ModerationFlag {
+			return nil
+		}
+		pending, err := tx.NewSelect().
+			Model((*messageFlag)(nil)).
+			Where("message_id = ?", flag.MessageID).
+			Where("resolved_at IS NULL").
+			Count(ctx)
+		if err != nil || hideAfter <= 0 || pending < hideAfter {
+			return err
+		}
+		_, err = tx.NewUpdate().
+			Model((*message)(nil)).
+			Set("moderation = ?", api.ModerationHide).
+			Where("id = ?", flag.MessageID).
+			Exec(ctx)
+		res.Hidden = err == nil
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) || errors.Is(err, api.ErrMessageNotFound) || isInvalidText(err) {
+		return api.FlagResult{}, api.ErrMessageNotFound
+	}
+	if err != nil {
+		return api.FlagResult{}, fmt.Errorf("flag: %w", wrapErr(err))
+	}
+	return res, nil
+}
+
+// ListFlaggedMessages returns the messages with pending flags, or flagged or
+// hidden by moderation, oldest first, with their pending flags and
+// attachments.
+func (pg *Postgres) ListFlaggedMessages(ctx context.Context, q api.FlagQuery) ([]api.FlaggedMessage, error) {
+	var msgs []message
+	err := pg.bun.NewSelect().
+		Model(&msgs).
+		Where("message.moderation IN (?)", bun.In([]string{api.ModerationFlag, api.ModerationHide})).
+		WhereOr("EXISTS (SELECT 1 FROM message_flags AS f WHERE f.message_id = message.id AND f.resolved_at IS NULL)").
+		OrderExpr("message.created_at, message.id").
+		Offset(q.Offset).
+		Limit(q.Limit).
+		Scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("select messages: %w", wrapErr(err))
+	}
+	if len(msgs) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]string, len(msgs))
+	for i, m := range msgs {
+		ids[i] = m.ID
+	}
+	var flags []messageFlag
+	err = pg.bun.NewSelect().
+		Model(&flags).
+		Where("message_id IN (?)", bun.In(ids)).
+		Where("resolved_at IS NULL").
+		OrderExpr("created_at, user_id").
+		Scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("select flags: %w", wrapErr(err))
+	}
+	byMessage := make(map[string][]api.Flag, len(msgs))
+	for _, f := range flags {
+		byMessage[f.MessageID] = append(byMessage[f.MessageID], f.APIFlag())
+	}
+	attachments, err := pg.attachments(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	mentioned, err := pg.mentionedUsers(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]api.FlaggedMessage, len(msgs))
+	for i, m := range msgs {
+		out[i].Message = m.APIMessage()
+		out[i].Message.Attachments = attachments[m.ID]
+		out[i].Message.Mentions = mentioned[m.ID]
+		out[i].Flags = byMessage[m.ID]
+	}
+	return out, nil
+}
+
+// ReviewMessage resolves the pending flags of a message with a moderator's
+// decision. Approving a message clears its moderation; removing it also
+// unpins it.
+func (pg *Postgres) ReviewMessage(ctx context.Context, messageID, moderatorID, decision string) (api.Message, error) {
+	var m message
+	err := pg.bun.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		q := tx.NewUpdate().Model(&m).Where("id = ?", messageID).Returning("*")
+		if decision == api.ReviewRemove {
+			q = q.Set("moderation = ?", api.ModerationRemove)
+		} else {
+			q = q.Set("moderation = NULL")
+		}
+		if err := q.Scan(ctx); err != nil {
+			return err
+		}
+		_, err := tx.NewUpdate().
+			Model((*messageFlag)(nil)).
+			Set("resolved_at = now()").
+			Set("resolved_by = ?", moderatorID).
+			Set("resolution = ?", decision).
+			Where("message_id = ?", messageID).
+			Where("resolved_at IS NULL").
+			Exec(ctx)
+		if err != nil || decision != api.ReviewRemove {
+			return err
+		}
+		_, err = tx.NewDelete().Model((*messagePin)(nil)).Where("message_id = ?", messageID).Exec(ctx)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) || isInvalidText(err) {
+		return api.Message{}, api.ErrMessageNotFound
+	}
+	if err != nil {
+		return api.Message{}, fmt.Errorf("review: %w", wrapErr(err))
+	}
+	return m.APIMessage(), nil
+}
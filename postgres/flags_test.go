@@ -0,0 +1,89 @@
+//go:build integration
+
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+)
+
+func TestPostgres_Flags(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	pg := connect(t)
+	msg, err := pg.InsertMessage(ctx, api.Message{Text: "buy now", UserID: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pg.PinMessage(ctx, msg.ID, "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	flag := func(userID string) api.FlagResult {
+		t.Helper()
+		res, err := pg.FlagMessage(ctx, api.Flag{MessageID: msg.ID, UserID: userID, Reason: "spam", CreatedAt: time.Now()}, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	if res := flag("bob"); !res.Created || res.Hidden || res.Flag.UserID != "bob" {
+		t.Errorf("Got %+v flagging, want a new flag", res)
+	}
+	if res := flag("bob"); res.Created || res.Hidden {
+		t.Errorf("Got %+v flagging again, want the same flag", res)
+	}
+	if res := flag("carol"); !res.Created || !res.Hidden {
+		t.Errorf("Got %+v from the second user, want the message hidden", res)
+	}
+	if msgs, err := pg.ListMessages(ctx, api.ListQuery{Limit: 10}); err != nil || len(msgs) != 0 {
+		t.Errorf("Got messages %+v, %v, want the hidden message left out", msgs, err)
+	}
+
+	flagged, err := pg.ListFlaggedMessages(ctx, api.FlagQuery{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flagged) != 1 || flagged[0].Message.Moderation != api.ModerationHide || len(flagged[0].Flags) != 2 {
+		t.Fatalf("Got flagged messages %+v, want the hidden message with 2 flags", flagged)
+	}
+
+	approved, err := pg.ReviewMessage(ctx, msg.ID, "mod", api.ReviewApprove)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if approved.Moderation != "" {
+		t.Errorf("Got moderation %q after approving, want none", approved.Moderation)
+	}
+	if flagged, err := pg.ListFlaggedMessages(ctx, api.FlagQuery{Limit: 10}); err != nil || len(flagged) != 0 {
+		t.Errorf("Got flagged messages %+v, %v after approving, want none", flagged, err)
+	}
+
+	// Flags resolved by the review no longer count towards hiding.
+	if res := flag("dave"); res.Hidden {
+		t.Errorf("Got %+v after approving, want the message kept", res)
+	}
+	removed, err := pg.ReviewMessage(ctx, msg.ID, "mod", api.ReviewRemove)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed.Moderation != api.ModerationRemove {
+		t.Errorf("Got moderation %q after removing, want remove", removed.Moderation)
+	}
+	if pins, err := pg.ListPins(ctx); err != nil || len(pins) != 0 {
+		t.Errorf("Got pins %+v, %v after removing, want none", pins, err)
+	}
+	if _, err := pg.FlagMessage(ctx, api.Flag{MessageID: msg.ID, UserID: "erin", Reason: "spam"}, 2); !errors.Is(err, api.ErrMessageNotFound) {
+		t.Errorf("Got %v flagging a removed message, want ErrMessageNotFound", err)
+	}
+	for _, id := range []string{"not-a-uuid", "00000000-0000-4000-8000-000000000000"} {
+		if _, err := pg.ReviewMessage(ctx, id, "mod", api.ReviewApprove); !errors.Is(err, api.ErrMessageNotFound) {
+			t.Errorf("Got %v reviewing %s, want ErrMessageNotFound", err, id)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+	"github.com/uptrace/bun"
+)
+
+// A logHook logs every query with the logger from the query's context, so
+// queries can be tied back to the request that made them.
+type logHook struct{}
+
+func (logHook) BeforeQuery(ctx context.Context, _ *bun.QueryEvent) context.Context {
+	return ctx
+}
+
+func (logHook) AfterQuery(ctx context.Context, e *bun.QueryEvent) {
+	log := api.LoggerFrom(ctx)
+	d := time.Since(e.StartTime)
+	if e.Err != nil && !errors.Is(e.Err, sql.ErrNoRows) {
+		log.Warn("Query failed", "operation", e.Operation(), "duration", d, "error", e.Err.Error())
+		return
+	}
+	log.Debug("Query", "operation", e.Operation(), "duration", d)
+}
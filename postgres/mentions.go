@@ -0,0 +1,130 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+	"github.com/uptrace/bun"
+)
+
+// mentionRow represents a row of the mentions query.
+type mentionRow struct {
+	ID          string     `bun:"id"`
+	MessageText string     `bun:"message_text"`
+	Format      string     `bun:"format"`
+	UserID      string     `bun:"user_id"`
+	CreatedAt   time.Time  `bun:"created_at"`
+	MentionedAt time.Time  `bun:"mentioned_at"`
+	ReadAt      *time.Time `bun:"read_at"`
+}
+
+// ListMentions returns the mentions of a user with the messages they are in,
+// newest first.
+func (pg *Postgres) ListMentions(ctx context.Context, q api.MentionQuery) ([]api.Mention, error) {
+	sq := pg.bun.NewSelect().
+		TableExpr("message_mentions AS mm").
+		Join("JOIN messages AS m ON m.id = mm.message_id").
+		ColumnExpr("m.id, m.message_text, m.format, m.user_id, m.created_at").
+		ColumnExpr("mm.created_at AS mentioned_at, mm.read_at").
+		Where("mm.user_id = ?", q.UserID).
+		Where("COALESCE(m.moderation, '') NOT IN (?)", hiddenModeration).
+		OrderExpr("mm.created_at DESC, mm.message_id DESC").
+		Offset(q.Offset).
+		Limit(q.Limit)
+	if q.Unread {
+		sq = sq.Where("mm.read_at IS NULL")
+	}
+
+	var rows []mentionRow
+	if err := sq.Scan(ctx, &rows); err != nil {
+		return nil, fmt.Errorf("scan: %w", wrapErr(err))
+	}
+
+	ids := make([]string, len(rows))
+	for i, row := range rows {
+		ids[i] = row.ID
+	}
+	counts, err := pg.reactionCounts(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	attachments, err := pg.attachments(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	mentioned, err := pg.mentionedUsers(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]api.Mention, len(rows))
+	for i, row := range rows {
+		out[i] = api.Mention{
+			Message: api.Message{
+				ID:                    row.ID,
+				Text:                  row.MessageText,
+				Format:                row.Format,
+				UserID:                row.UserID,
+				CreatedAt:             row.CreatedAt,
+				MessageReactionCounts: counts[row.ID],
+				Attachments:           attachments[row.ID],
+				Mentions:              mentioned[row.ID],
+			},
+			UserID:    q.UserID,
+			CreatedAt: row.MentionedAt,
+			Read:      row.ReadAt != nil,
+		}
+	}
+	return out, nil
+}
+
+// mentionedUsers returns the users mentioned in each message.
+func (pg *Postgres) mentionedUsers(ctx context.Context, msgIDs []string) (map[string][]string, error) {
+	out := make(map[string][]string, len(msgIDs))
+	if len(msgIDs) == 0 {
+		return out, nil
+	}
+	var rows []messageMention
+	err := pg.bun.NewSelect().
+		Model(&rows).
+		Column("message_id", "user_id").
+		Where("message_id IN (?)", bun.In(msgIDs)).
+		OrderExpr("message_id, user_id").
+		Scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("select mentions: %w", wrapErr(err))
+	}
+	for _, row := range rows {
+		out[row.MessageID] = append(out[row.MessageID], row.UserID)
+	}
+	return out, nil
+}
+
+// MarkMentionsRead marks the unread mentions of a user in the given messages,
+// or in all messages if none are given, as read. It returns how many were
+// marked.
+func (pg *Postgres) MarkMentionsRead(ctx context.Context, userID string, msgIDs ...string) (int, error) {
+	uq := pg.bun.NewUpdate().
+		Model((*messageMention)(nil)).
+		Set("read_at = now()").
+		Where("user_id = ?", userID).
+		Where("read_at IS NULL")
+	if len(msgIDs) > 0 {
+		uq = uq.Where("message_id IN (?)", bun.In(msgIDs))
+	}
+	res, err := uq.Exec(ctx)
+	if isInvalidText(err) {
+		// No message has an ID that is not a UUID.
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("update: %w", wrapErr(err))
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("rows affected: %w", err)
+	}
+	return int(n), nil
+}
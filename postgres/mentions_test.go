@@ -0,0 +1,81 @@
+//go:build integration
+
+package postgres
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+)
+
+func TestPostgres_Mentions(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	pg := connect(t)
+	first, err := pg.InsertMessage(ctx, api.Message{
+		Text:      "hi @bob and @carol",
+		UserID:    "alice",
+		CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Mentions:  []string{"bob", "carol"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := pg.InsertMessage(ctx, api.Message{
+		Text:      "@bob again",
+		UserID:    "alice",
+		CreatedAt: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		Mentions:  []string{"bob"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := pg.ListMentions(ctx, api.MentionQuery{UserID: "bob", Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Message.ID != second.ID || got[1].Message.ID != first.ID {
+		t.Fatalf("Got mentions %+v, want the second then the first message", got)
+	}
+	if !slices.Equal(got[1].Message.Mentions, []string{"bob", "carol"}) {
+		t.Errorf("Got message mentioning %v, want bob and carol", got[1].Message.Mentions)
+	}
+	if got[0].Read || !got[0].CreatedAt.Equal(second.CreatedAt) {
+		t.Errorf("Got mention %+v, want unread at the message's creation", got[0])
+	}
+
+	n, err := pg.MarkMentionsRead(ctx, "bob", second.ID, "not-a-uuid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("Marked %d mentions with a malformed ID, want 0", n)
+	}
+	if n, err = pg.MarkMentionsRead(ctx, "bob", second.ID); err != nil || n != 1 {
+		t.Errorf("Got %d, %v marking the second message, want 1", n, err)
+	}
+	unread, err := pg.ListMentions(ctx, api.MentionQuery{UserID: "bob", Unread: true, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unread) != 1 || unread[0].Message.ID != first.ID {
+		t.Errorf("Got unread mentions %+v, want the first message", unread)
+	}
+	if n, err = pg.MarkMentionsRead(ctx, "bob"); err != nil || n != 1 {
+		t.Errorf("Got %d, %v marking all, want 1", n, err)
+	}
+
+	// Other users' mentions are left alone.
+	carol, err := pg.ListMentions(ctx, api.MentionQuery{UserID: "carol", Unread: true, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(carol) != 1 {
+		t.Errorf("Got %d unread mentions of carol, want 1", len(carol))
+	}
+}
@@ -4,41 +4,27 @@ import (
 	"time"
 
 	"github.com/GetStream/stream-backend-homework-assignment/api"
+	"github.com/uptrace/bun"
 )
 
 // A message represents a message in the database.
 type message struct {
 	ID          string    `bun:",pk,type:uuid,default:uuid_generate_v4()"`
 	MessageText string    `bun:"message_text,notnull"`
+	Format      string    `bun:",nullzero"`
+	Moderation  string    `bun:",nullzero"`
 	UserID      string    `bun:",notnull"`
 	CreatedAt   time.Time `bun:",nullzero,default:now()"`
 }
 
 func (m message) APIMessage() api.Message {
 	return api.Message{
-		ID:        m.ID,
-		Text:      m.MessageText,
-		UserID:    m.UserID,
-		CreatedAt: m.CreatedAt,
-	}
-}
-
-// messageWithReactions represents the query response object
-type messageWithReactions struct {
-	ID            string    `bun:",pk,type:uuid"`
-	MessageText   string    `bun:"message_text,notnull"`
-	UserID        string    `bun:",notnull"`
-	CreatedAt     time.Time `bun:",nullzero,default:now()"`
-	ReactionType  *string   `bun:"column:type"`
-	ReactionCount *int      `bun:"reaction_count"`
-}
-
-func (m messageWithReactions) APIMessage() api.Message {
-	return api.Message{
-		ID:        m.ID,
-		Text:      m.MessageText,
-		UserID:    m.UserID,
-		CreatedAt: m.CreatedAt,
+		ID:         m.ID,
+		Text:       m.MessageText,
+		Format:     m.Format,
+		Moderation: m.Moderation,
+		UserID:     m.UserID,
+		CreatedAt:  m.CreatedAt,
 	}
 }
 
@@ -62,3 +48,311 @@ func (m messageReaction) APIMessageReaction() api.Reaction {
 		CreatedAt: m.CreatedAt,
 	}
 }
+
+// A messageMention records that a message mentioned a user.
+type messageMention struct {
+	bun.BaseModel `bun:"table:message_mentions,alias:message_mention"`
+
+	MessageID string    `bun:",pk,type:uuid"`
+	UserID    string    `bun:",pk"`
+	CreatedAt time.Time `bun:",nullzero,default:now()"`
+	ReadAt    *time.Time
+}
+
+// An attachment represents an uploaded file in the database.
+type attachment struct {
+	bun.BaseModel `bun:"table:attachments,alias:attachment"`
+
+	ID          string    `bun:",pk,type:uuid,default:gen_random_uuid()"`
+	MessageID   string    `bun:",nullzero,type:uuid"`
+	UserID      string    `bun:",notnull"`
+	FileName    string    `bun:",notnull"`
+	ContentType string    `bun:",notnull"`
+	Size        int64     `bun:",notnull"`
+	StorageKey  string    `bun:",notnull"`
+	CreatedAt   time.Time `bun:",nullzero,default:now()"`
+}
+
+func (a attachment) APIAttachment() api.Attachment {
+	return api.Attachment{
+		ID:          a.ID,
+		MessageID:   a.MessageID,
+		UserID:      a.UserID,
+		FileName:    a.FileName,
+		ContentType: a.ContentType,
+		Size:        a.Size,
+		Key:         a.StorageKey,
+		CreatedAt:   a.CreatedAt,
+	}
+}
+
+// An attachmentThumbnail is a scaled down copy of an image attachment.
+type attachmentThumbnail struct {
+	bun.BaseModel `bun:"table:attachment_thumbnails,alias:attachment_thumbnail"`
+
+	AttachmentID string `bun:",pk,type:uuid"`
+	Size         int    `bun:",pk"`
+	Width        int    `bun:",notnull"`
+	Height       int    `bun:",notnull"`
+	ContentType  string `bun:",notnull"`
+	StorageKey   string `bun:",notnull"`
+}
+
+func (t attachmentThumbnail) APIThumbnail() api.Thumbnail {
+	return api.Thumbnail{
+		Size:        t.Size,
+		Width:       t.Width,
+		Height:      t.Height,
+		ContentType: t.ContentType,
+		Key:         t.StorageKey,
+	}
+}
+
+// A thumbnailJob tracks the generation of an attachment's thumbnails.
+type thumbnailJob struct {
+	bun.BaseModel `bun:"table:thumbnail_jobs,alias:thumbnail_job"`
+
+	AttachmentID string    `bun:",pk,type:uuid"`
+	Status       string    `bun:",notnull,default:'pending'"`
+	Attempts     int       `bun:",notnull,default:0"`
+	LastError    string    `bun:",nullzero"`
+	RunAt        time.Time `bun:",nullzero,notnull,default:now()"`
+	UpdatedAt    time.Time `bun:",nullzero,notnull,default:now()"`
+}
+
+// A messagePin records that a message is pinned.
+type messagePin struct {
+	bun.BaseModel `bun:"table:message_pins,alias:message_pin"`
+
+	MessageID string    `bun:",pk,type:uuid"`
+	PinnedBy  string    `bun:",notnull"`
+	PinnedAt  time.Time `bun:",nullzero,default:now()"`
+}
+
+// A messageFlag records a user's flag of a message, and how a moderator
+// resolved it.
+type messageFlag struct {
+	bun.BaseModel `bun:"table:message_flags,alias:message_flag"`
+
+	MessageID  string    `bun:",pk,type:uuid"`
+	UserID     string    `bun:",pk"`
+	Reason     string    `bun:",notnull"`
+	CreatedAt  time.Time `bun:",nullzero,default:now()"`
+	ResolvedAt *time.Time
+	ResolvedBy string `bun:",nullzero"`
+	Resolution string `bun:",nullzero"`
+}
+
+func (f messageFlag) APIFlag() api.Flag {
+	return api.Flag{
+		MessageID: f.MessageID,
+		UserID:    f.UserID,
+		Reason:    f.Reason,
+		CreatedAt: f.CreatedAt,
+	}
+}
+
+// A readMarker records the last message a user read.
+type readMarker struct {
+	bun.BaseModel `bun:"table:read_markers,alias:read_marker"`
+
+	UserID           string    `bun:",pk"`
+	MessageID        string    `bun:",notnull,type:uuid"`
+	MessageCreatedAt time.Time `bun:",notnull"`
+	UpdatedAt        time.Time `bun:",nullzero,default:now()"`
+}
+
+func (m readMarker) APIReadMarker() api.ReadMarker {
+	return api.ReadMarker{
+		UserID:           m.UserID,
+		MessageID:        m.MessageID,
+		MessageCreatedAt: m.MessageCreatedAt,
+		UpdatedAt:        m.UpdatedAt,
+	}
+}
+
+// An apiKey represents an API key in the database.
+type apiKey struct {
+	bun.BaseModel `bun:"table:api_keys,alias:api_key"`
+
+	ID        string    `bun:",pk,type:uuid,default:gen_random_uuid()"`
+	Name      string    `bun:",notnull"`
+	Prefix    string    `bun:",notnull"`
+	KeyHash   string    `bun:",notnull"`
+	Scopes    []string  `bun:",array"`
+	CreatedAt time.Time `bun:",nullzero,default:now()"`
+	ExpiresAt *time.Time
+	RevokedAt *time.Time
+}
+
+func (k apiKey) APIKey() api.APIKey {
+	return api.APIKey{
+		ID:        k.ID,
+		Name:      k.Name,
+		Prefix:    k.Prefix,
+		Hash:      k.KeyHash,
+		Scopes:    k.Scopes,
+		CreatedAt: k.CreatedAt,
+		ExpiresAt: k.ExpiresAt,
+		RevokedAt: k.RevokedAt,
+	}
+}
+
+// A moderationRule represents a moderation rule in the database. Limit is
+// stored as rule_limit, as LIMIT is a keyword.
+type moderationRule struct {
+	bun.BaseModel `bun:"table:moderation_rules,alias:moderation_rule"`
+
+	ID        string    `bun:",pk,type:uuid,default:gen_random_uuid()"`
+	Name      string    `bun:",notnull"`
+	Kind      string    `bun:",notnull"`
+	Words     []string  `bun:",array"`
+	Pattern   string    `bun:",nullzero"`
+	Limit     int       `bun:"rule_limit,notnull"`
+	Action    string    `bun:",notnull"`
+	Enabled   bool      `bun:",notnull"`
+	CreatedAt time.Time `bun:",nullzero,default:now()"`
+	UpdatedAt time.Time `bun:",nullzero,default:now()"`
+}
+
+func (r moderationRule) APIModerationRule() api.ModerationRule {
+	return api.ModerationRule{
+		ID:        r.ID,
+		Name:      r.Name,
+		Kind:      r.Kind,
+		Words:     r.Words,
+		Pattern:   r.Pattern,
+		Limit:     r.Limit,
+		Action:    r.Action,
+		Enabled:   r.Enabled,
+		CreatedAt: r.CreatedAt,
+		UpdatedAt: r.UpdatedAt,
+	}
+}
+
+// A userBan represents a ban in the database.
+type userBan struct {
+	bun.BaseModel `bun:"table:user_bans,alias:user_ban"`
+
+	ID        string    `bun:",pk,type:uuid,default:gen_random_uuid()"`
+	UserID    string    `bun:",notnull"`
+	Kind      string    `bun:",notnull"`
+	Reason    string    `bun:",nullzero"`
+	CreatedBy string    `bun:",notnull"`
+	CreatedAt time.Time `bun:",nullzero,default:now()"`
+	ExpiresAt *time.Time
+	LiftedAt  *time.Time
+}
+
+func (b userBan) APIBan() api.Ban {
+	return api.Ban{
+		ID:        b.ID,
+		UserID:    b.UserID,
+		Kind:      b.Kind,
+		Reason:    b.Reason,
+		CreatedBy: b.CreatedBy,
+		CreatedAt: b.CreatedAt,
+		ExpiresAt: b.ExpiresAt,
+		LiftedAt:  b.LiftedAt,
+	}
+}
+
+// A userBlock represents a block in the database.
+type userBlock struct {
+	bun.BaseModel `bun:"table:user_blocks,alias:user_block"`
+
+	UserID        string    `bun:",pk"`
+	BlockedUserID string    `bun:",pk"`
+	CreatedAt     time.Time `bun:",nullzero,default:now()"`
+}
+
+func (b userBlock) APIBlock() api.Block {
+	return api.Block{
+		UserID:        b.UserID,
+		BlockedUserID: b.BlockedUserID,
+		CreatedAt:     b.CreatedAt,
+	}
+}
+
+// A userProfile represents a user in the database. It is not aliased user,
+// which Postgres reserves.
+type userProfile struct {
+	bun.BaseModel `bun:"table:users,alias:profile"`
+
+	ID          string    `bun:",pk"`
+	Name        string    `bun:",notnull"`
+	AvatarURL   string    `bun:",nullzero"`
+	Deactivated bool      `bun:",notnull"`
+	CreatedAt   time.Time `bun:",nullzero,default:now()"`
+	UpdatedAt   time.Time `bun:",nullzero,default:now()"`
+}
+
+func (u userProfile) APIUser() api.User {
+	return api.User{
+		ID:          u.ID,
+		Name:        u.Name,
+		AvatarURL:   u.AvatarURL,
+		Deactivated: u.Deactivated,
+		CreatedAt:   u.CreatedAt,
+		UpdatedAt:   u.UpdatedAt,
+	}
+}
+
+// An erasureJob represents an erasure job in the database. RunAt is when a
+// pending job is due, or when the lease of a running one runs out.
+type erasureJob struct {
+	bun.BaseModel `bun:"table:erasure_jobs,alias:erasure_job"`
+
+	ID          string    `bun:",pk,type:uuid,default:gen_random_uuid()"`
+	UserID      string    `bun:",notnull"`
+	Mode        string    `bun:",notnull"`
+	RequestedBy string    `bun:",notnull"`
+	Pseudonym   string    `bun:",nullzero"` // random, from the column default
+	Status      string    `bun:",notnull,default:'pending'"`
+	Messages    int       `bun:",notnull,default:0"`
+	Attachments int       `bun:",notnull,default:0"`
+	Reactions   int       `bun:",notnull,default:0"`
+	RunAt       time.Time `bun:",nullzero,notnull,default:now()"`
+	CreatedAt   time.Time `bun:",nullzero,default:now()"`
+	UpdatedAt   time.Time `bun:",nullzero,default:now()"`
+	CompletedAt *time.Time
+}
+
+func (j erasureJob) APIErasureJob() api.ErasureJob {
+	return api.ErasureJob{
+		ID:          j.ID,
+		UserID:      j.UserID,
+		Mode:        j.Mode,
+		RequestedBy: j.RequestedBy,
+		Pseudonym:   j.Pseudonym,
+		Status:      j.Status,
+		Messages:    j.Messages,
+		Attachments: j.Attachments,
+		Reactions:   j.Reactions,
+		CreatedAt:   j.CreatedAt,
+		UpdatedAt:   j.UpdatedAt,
+		CompletedAt: j.CompletedAt,
+	}
+}
+
+// An auditRecord records an action taken on a user's data, to show later
+// that it was.
+type auditRecord struct {
+	bun.BaseModel `bun:"table:audit_records,alias:audit_record"`
+
+	ID        string         `bun:",pk,type:uuid,default:gen_random_uuid()"`
+	Action    string         `bun:",notnull"`
+	Actor     string         `bun:",notnull"`
+	Subject   string         `bun:",notnull"`
+	Details   map[string]any `bun:"type:jsonb"`
+	CreatedAt time.Time      `bun:",nullzero,default:now()"`
+}
+
+// An archiveUser records that an archive of expired messages holds messages or
+// mentions of a user.
+type archiveUser struct {
+	bun.BaseModel `bun:"table:archive_users,alias:archive_user"`
+
+	UserID     string `bun:",pk"`
+	ArchiveKey string `bun:",pk"`
+}
@@ -0,0 +1,87 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+// ListModerationRules returns all moderation rules, oldest first.
+func (pg *Postgres) ListModerationRules(ctx context.Context) ([]api.ModerationRule, error) {
+	var rules []moderationRule
+	if err := pg.bun.NewSelect().Model(&rules).Order("created_at", "id").Scan(ctx); err != nil {
+		return nil, fmt.Errorf("select: %w", wrapErr(err))
+	}
+	out := make([]api.ModerationRule, len(rules))
+	for i, r := range rules {
+		out[i] = r.APIModerationRule()
+	}
+	return out, nil
+}
+
+// InsertModerationRule inserts a moderation rule. The returned rule holds the
+// generated ID.
+func (pg *Postgres) InsertModerationRule(ctx context.Context, rule api.ModerationRule) (api.ModerationRule, error) {
+	r := &moderationRule{
+		Name:    rule.Name,
+		Kind:    rule.Kind,
+		Words:   rule.Words,
+		Pattern: rule.Pattern,
+		Limit:   rule.Limit,
+		Action:  rule.Action,
+		Enabled: rule.Enabled,
+	}
+	if _, err := pg.bun.NewInsert().Model(r).Returning("*").Exec(ctx); err != nil {
+		return api.ModerationRule{}, fmt.Errorf("insert: %w", wrapErr(err))
+	}
+	return r.APIModerationRule(), nil
+}
+
+// UpdateModerationRule replaces the moderation rule with the ID of rule, or
+// returns api.ErrModerationRuleNotFound.
+func (pg *Postgres) UpdateModerationRule(ctx context.Context, rule api.ModerationRule) (api.ModerationRule, error) {
+	var r moderationRule
+	err := pg.bun.NewUpdate().
+		Model(&r).
+		Set("name = ?", rule.Name).
+		Set("kind = ?", rule.Kind).
+		Set("words = ?", pgdialect.Array(rule.Words)).
+		Set("pattern = NULLIF(?, '')", rule.Pattern).
+		Set("rule_limit = ?", rule.Limit).
+		Set("action = ?", rule.Action).
+		Set("enabled = ?", rule.Enabled).
+		Set("updated_at = now()").
+		Where("id = ?", rule.ID).
+		Returning("*").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) || isInvalidText(err) {
+		return api.ModerationRule{}, api.ErrModerationRuleNotFound
+	}
+	if err != nil {
+		return api.ModerationRule{}, fmt.Errorf("update: %w", wrapErr(err))
+	}
+	return r.APIModerationRule(), nil
+}
+
+// DeleteModerationRule deletes a moderation rule, or returns
+// api.ErrModerationRuleNotFound.
+func (pg *Postgres) DeleteModerationRule(ctx context.Context, id string) error {
+	res, err := pg.bun.NewDelete().
+		Model((*moderationRule)(nil)).
+		Where("id = ?", id).
+		Exec(ctx)
+	if isInvalidText(err) {
+		return api.ErrModerationRuleNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("delete: %w", wrapErr(err))
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return api.ErrModerationRuleNotFound
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+//go:build integration
+
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+)
+
+func TestPostgres_ModerationRules(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	pg := connect(t)
+	if _, err := pg.bun.NewTruncateTable().Model((*moderationRule)(nil)).Exec(ctx); err != nil {
+		t.Fatalf("Could not truncate table: %v", err)
+	}
+	rule, err := pg.InsertModerationRule(ctx, api.ModerationRule{
+		Name:    "spam",
+		Kind:    api.RuleBlocklist,
+		Words:   []string{"spam", "buy now"},
+		Action:  api.ModerationShadow,
+		Enabled: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule.ID == "" || rule.CreatedAt.IsZero() || len(rule.Words) != 2 {
+		t.Errorf("Got rule %+v, want it stored", rule)
+	}
+
+	rule.Kind = api.RuleRepeat
+	rule.Words = nil
+	rule.Limit = 5
+	rule.Enabled = false
+	updated, err := pg.UpdateModerationRule(ctx, rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Kind != api.RuleRepeat || updated.Limit != 5 || updated.Enabled || len(updated.Words) != 0 {
+		t.Errorf("Got updated rule %+v", updated)
+	}
+
+	rules, err := pg.ListModerationRules(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 1 || rules[0].ID != rule.ID {
+		t.Errorf("Got rules %+v, want the rule", rules)
+	}
+
+	if err := pg.DeleteModerationRule(ctx, rule.ID); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{rule.ID, "not-a-uuid"} {
+		if err := pg.DeleteModerationRule(ctx, id); !errors.Is(err, api.ErrModerationRuleNotFound) {
+			t.Errorf("Got %v deleting %s, want ErrModerationRuleNotFound", err, id)
+		}
+		if _, err := pg.UpdateModerationRule(ctx, api.ModerationRule{ID: id}); !errors.Is(err, api.ErrModerationRuleNotFound) {
+			t.Errorf("Got %v updating %s, want ErrModerationRuleNotFound", err, id)
+		}
+	}
+}
+
+func TestPostgres_ShadowedMessages(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	pg := connect(t)
+	flagged, err := pg.InsertMessage(ctx, api.Message{Text: "flagged words", UserID: "alice", Moderation: api.ModerationFlag})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pg.InsertMessage(ctx, api.Message{Text: "shadowed words", UserID: "alice", Moderation: api.ModerationShadow}); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs, err := pg.ListMessages(ctx, api.ListQuery{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || msgs[0].ID != flagged.ID || msgs[0].Moderation != api.ModerationFlag {
+		t.Errorf("Got messages %+v, want only the flagged one", msgs)
+	}
+	results, err := pg.SearchMessages(ctx, api.SearchQuery{Text: "words", Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Errorf("Got %d search results, want only the flagged message", len(results))
+	}
+	counts, err := pg.CountUnread(ctx, "bob", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts.Messages != 1 {
+		t.Errorf("Got %d unread messages, want 1", counts.Messages)
+	}
+}
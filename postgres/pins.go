@@ -0,0 +1,133 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/driver/pgdriver"
+)
+
+// pinRow represents a row of the pins query.
+type pinRow struct {
+	ID          string    `bun:"id"`
+	MessageText string    `bun:"message_text"`
+	Format      string    `bun:"format"`
+	UserID      string    `bun:"user_id"`
+	CreatedAt   time.Time `bun:"created_at"`
+	PinnedBy    string    `bun:"pinned_by"`
+	PinnedAt    time.Time `bun:"pinned_at"`
+}
+
+func (row pinRow) APIPin() api.Pin {
+	return api.Pin{
+		Message: api.Message{
+			ID:        row.ID,
+			Text:      row.MessageText,
+			Format:    row.Format,
+			UserID:    row.UserID,
+			CreatedAt: row.CreatedAt,
+			Pinned:    true,
+		},
+		PinnedBy: row.PinnedBy,
+		PinnedAt: row.PinnedAt,
+	}
+}
+
+// PinMessage pins a message, or returns api.ErrMessageNotFound, also for
+// messages hidden by moderation. Pinning a pinned message keeps who pinned it
+// first.
+func (pg *Postgres) PinMessage(ctx context.Context, messageID, userID string) (api.Pin, error) {
+	err := pg.bun.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		// The lock keeps the message from being hidden before the pin is
+		// inserted.
+		n, err := tx.NewSelect().
+			Model((*message)(nil)).
+			Where("id = ?", messageID).
+			Where("COALESCE(moderation, '') NOT IN (?)", hiddenModeration).
+			For("SHARE").
+			Count(ctx)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return api.ErrMessageNotFound
+		}
+		p := &messagePin{MessageID: messageID, PinnedBy: userID}
+		_, err = tx.NewInsert().Model(p).On("CONFLICT DO NOTHING").Exec(ctx)
+		return err
+	})
+	if errors.Is(err, api.ErrMessageNotFound) || isInvalidText(err) || isForeignKeyViolation(err) {
+		return api.Pin{}, api.ErrMessageNotFound
+	}
+	if err != nil {
+		return api.Pin{}, fmt.Errorf("insert: %w", wrapErr(err))
+	}
+
+	pins, err := pg.listPins(ctx, messageID)
+	if err != nil {
+		return api.Pin{}, err
+	}
+	if len(pins) == 0 {
+		// Unpinned meanwhile.
+		return api.Pin{}, api.ErrMessageNotFound
+	}
+	return pins[0], nil
+}
+
+// UnpinMessage unpins a message, or returns api.ErrPinNotFound.
+func (pg *Postgres) UnpinMessage(ctx context.Context, messageID string) error {
+	res, err := pg.bun.NewDelete().
+		Model((*messagePin)(nil)).
+		Where("message_id = ?", messageID).
+		Exec(ctx)
+	if isInvalidText(err) {
+		return api.ErrPinNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("delete: %w", wrapErr(err))
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return api.ErrPinNotFound
+	}
+	return nil
+}
+
+// ListPins returns the pinned messages, most recently pinned first.
+func (pg *Postgres) ListPins(ctx context.Context) ([]api.Pin, error) {
+	return pg.listPins(ctx, "")
+}
+
+// listPins returns the pinned messages, or only the given one if messageID is
+// set. Messages hidden by moderation keep their pins, which show again if a
+// moderator approves them, but are left out.
+func (pg *Postgres) listPins(ctx context.Context, messageID string) ([]api.Pin, error) {
+	sq := pg.bun.NewSelect().
+		TableExpr("message_pins AS p").
+		Join("JOIN messages AS m ON m.id = p.message_id").
+		ColumnExpr("m.id, m.message_text, m.format, m.user_id, m.created_at, p.pinned_by, p.pinned_at").
+		Where("COALESCE(m.moderation, '') NOT IN (?)", hiddenModeration).
+		OrderExpr("p.pinned_at DESC, p.message_id DESC")
+	if messageID != "" {
+		sq = sq.Where("p.message_id = ?", messageID)
+	}
+	var rows []pinRow
+	if err := sq.Scan(ctx, &rows); err != nil {
+		return nil, fmt.Errorf("scan: %w", wrapErr(err))
+	}
+	out := make([]api.Pin, len(rows))
+	for i, row := range rows {
+		out[i] = row.APIPin()
+	}
+	return out, nil
+}
+
+// isForeignKeyViolation reports whether err is Postgres rejecting a reference
+// to a missing row.
+func isForeignKeyViolation(err error) bool {
+	var pgErr pgdriver.Error
+	return errors.As(err, &pgErr) && pgErr.Field('C') == "23503"
+}
@@ -0,0 +1,87 @@
+//go:build integration
+
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+)
+
+func TestPostgres_Pins(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	pg := connect(t)
+	msg, err := pg.InsertMessage(ctx, api.Message{Text: "hello", UserID: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pin, err := pg.PinMessage(ctx, msg.ID, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pin.Message.ID != msg.ID || pin.Message.Text != "hello" || pin.PinnedBy != "bob" || pin.PinnedAt.IsZero() {
+		t.Errorf("Got pin %+v, want message pinned by bob", pin)
+	}
+	again, err := pg.PinMessage(ctx, msg.ID, "carol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.PinnedBy != "bob" {
+		t.Errorf("Got pinned by %q after pinning again, want bob", again.PinnedBy)
+	}
+
+	pins, err := pg.ListPins(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != 1 || pins[0].Message.ID != msg.ID {
+		t.Errorf("Got pins %+v, want the message", pins)
+	}
+
+	// Hiding the message leaves its pin out until it is approved.
+	if _, err := pg.FlagMessage(ctx, api.Flag{MessageID: msg.ID, UserID: "carol", Reason: "spam"}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if pins, err := pg.ListPins(ctx); err != nil || len(pins) != 0 {
+		t.Errorf("Got pins %+v, %v, want the hidden message left out", pins, err)
+	}
+	if _, err := pg.ReviewMessage(ctx, msg.ID, "mod", api.ReviewApprove); err != nil {
+		t.Fatal(err)
+	}
+	if pins, err := pg.ListPins(ctx); err != nil || len(pins) != 1 {
+		t.Errorf("Got pins %+v, %v, want the approved message pinned again", pins, err)
+	}
+
+	if err := pg.UnpinMessage(ctx, msg.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := pg.UnpinMessage(ctx, msg.ID); !errors.Is(err, api.ErrPinNotFound) {
+		t.Errorf("Got %v unpinning twice, want ErrPinNotFound", err)
+	}
+	for _, id := range []string{"not-a-uuid", "00000000-0000-4000-8000-000000000000"} {
+		if _, err := pg.PinMessage(ctx, id, "bob"); !errors.Is(err, api.ErrMessageNotFound) {
+			t.Errorf("Got %v pinning %s, want ErrMessageNotFound", err, id)
+		}
+	}
+
+	// Hidden messages can't be pinned, and aren't once they are approved.
+	hidden, err := pg.InsertMessage(ctx, api.Message{Text: "spam", UserID: "alice", Moderation: api.ModerationHide})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pg.PinMessage(ctx, hidden.ID, "bob"); !errors.Is(err, api.ErrMessageNotFound) {
+		t.Errorf("Got %v pinning a hidden message, want ErrMessageNotFound", err)
+	}
+	if _, err := pg.ReviewMessage(ctx, hidden.ID, "mod", api.ReviewApprove); err != nil {
+		t.Fatal(err)
+	}
+	if pins, err := pg.ListPins(ctx); err != nil || len(pins) != 0 {
+		t.Errorf("Got pins %+v, %v after approving, want none", pins, err)
+	}
+}
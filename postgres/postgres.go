@@ -3,12 +3,17 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 
 	"github.com/GetStream/stream-backend-homework-assignment/api"
 	"github.com/uptrace/bun"
 	"github.com/uptrace/bun/dialect/pgdialect"
 	"github.com/uptrace/bun/driver/pgdriver"
+	"go.opentelemetry.io/otel"
 )
 
 // Postgres provides storage in PostgreSQL.
@@ -24,97 +29,195 @@ func Connect(ctx context.Context, connStr string) (*Postgres, error) {
 		return nil, fmt.Errorf("ping database: %w", err)
 	}
 	db := bun.NewDB(sqlDB, pgdialect.New())
+	db.AddQueryHook(queryHook{
+		tracer: otel.Tracer("github.com/GetStream/stream-backend-homework-assignment/postgres"),
+	})
+	db.AddQueryHook(logHook{})
 	return &Postgres{
 		bun: db,
 	}, nil
 }
 
-// ListMessages returns all messages in the database.
-func (pg *Postgres) ListMessages(ctx context.Context, limit int, offset int, excludeMsgIDs ...string) ([]api.Message, error) {
+// Ping checks that the database is reachable.
+func (pg *Postgres) Ping(ctx context.Context) error {
+	if err := pg.bun.PingContext(ctx); err != nil {
+		return fmt.Errorf("ping database: %w", wrapErr(err))
+	}
+	return nil
+}
+
+// Stats returns connection pool statistics.
+func (pg *Postgres) Stats() sql.DBStats {
+	return pg.bun.Stats()
+}
+
+// hiddenModeration are the moderation actions that keep a message from being
+// listed.
+var hiddenModeration = bun.In([]string{api.ModerationShadow, api.ModerationHide, api.ModerationRemove})
+
+// ListMessages returns the messages selected by q, with their reaction
+// counts.
+func (pg *Postgres) ListMessages(ctx context.Context, q api.ListQuery, excludeMsgIDs ...string) ([]api.Message, error) {
 	var msgs []message
-	q := pg.bun.NewSelect().
+	sq := pg.bun.NewSelect().
 		Model(&msgs).
-		Offset(offset).
-		Limit(limit).
-		Order("message.created_at DESC").
-		Column("message.*")
+		Offset(q.Offset).
+		Limit(q.Limit)
+
+	if q.Viewer != "" {
+		sq = sq.WhereGroup(" AND ", func(sq *bun.SelectQuery) *bun.SelectQuery {
+			return sq.Where("COALESCE(message.moderation, '') NOT IN (?)", hiddenModeration).
+				WhereOr("message.moderation = ? AND message.user_id = ?", api.ModerationShadow, q.Viewer)
+		})
+	} else {
+		sq = sq.Where("COALESCE(message.moderation, '') NOT IN (?)", hiddenModeration)
+	}
+	if q.UserID != "" {
+		sq = sq.Where("message.user_id = ?", q.UserID)
+	}
+	if len(q.ExcludeUserIDs) > 0 {
+		sq = sq.Where("message.user_id NOT IN (?)", bun.In(q.ExcludeUserIDs))
+	}
+	if !q.Since.IsZero() {
+		sq = sq.Where("message.created_at >= ?", q.Since)
+	}
+	if !q.Until.IsZero() {
+		sq = sq.Where("message.created_at < ?", q.Until)
+	}
+	if q.HasReactions != nil {
+		exists := "EXISTS (SELECT 1 FROM message_reactions AS r WHERE r.message_id = message.id)"
+		if !*q.HasReactions {
+			exists = "NOT " + exists
+		}
+		sq = sq.Where(exists)
+	}
+	if q.ReactionType != "" {
+		sq = sq.Where("EXISTS (SELECT 1 FROM message_reactions AS r WHERE r.message_id = message.id AND r.type = ?)", q.ReactionType)
+	}
+	if len(excludeMsgIDs) > 0 {
+		sq = sq.Where("message.id NOT IN (?)", bun.In(excludeMsgIDs))
+	}
 
-	q = q.Join("LEFT JOIN message_reactions AS r ON r.message_id = message.id").
-		ColumnExpr("r.type AS reaction_type, COUNT(r.id) AS reaction_count").
-		Group("message.id", "r.type")
+	dir := "DESC"
+	if q.Ascending {
+		dir = "ASC"
+	}
+	if q.Sort == api.SortScore {
+		sq = sq.OrderExpr("(SELECT COALESCE(SUM(r.score), 0) FROM message_reactions AS r WHERE r.message_id = message.id) " + dir)
+	}
+	// The ID breaks ties so pages don't overlap.
+	sq = sq.OrderExpr("message.created_at " + dir).OrderExpr("message.id " + dir)
 
-	if len(excludeMsgIDs) > 0 {
-		q = q.Where("message.id NOT IN (?)", bun.In(excludeMsgIDs))
+	if err := sq.Scan(ctx); err != nil {
+		return nil, fmt.Errorf("scan: %w", wrapErr(err))
 	}
 
-	var messagesWithReactions []messageWithReactions
-	if err := q.Scan(ctx, &messagesWithReactions); err != nil {
-		return nil, fmt.Errorf("scan: %w", err)
+	ids := make([]string, len(msgs))
+	for i, m := range msgs {
+		ids[i] = m.ID
+	}
+	counts, err := pg.reactionCounts(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	attachments, err := pg.attachments(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	mentioned, err := pg.mentionedUsers(ctx, ids)
+	if err != nil {
+		return nil, err
 	}
 
-	return convertToMessages(messagesWithReactions), nil
+	out := make([]api.Message, len(msgs))
+	for i, m := range msgs {
+		out[i] = m.APIMessage()
+		out[i].MessageReactionCounts = counts[m.ID]
+		out[i].Attachments = attachments[m.ID]
+		out[i].Mentions = mentioned[m.ID]
+	}
+	return out, nil
 }
 
-// InsertMessage inserts a message into the database. The returned message
-// holds auto generated fields, such as the message id.
+// InsertMessage inserts a message into the database, along with its
+// mentions, and attaches the uploads in msg.Attachments, which must be the
+// author's and not sent yet, or api.ErrAttachmentNotFound is returned. The
+// returned message holds auto generated fields, such as the message id. An
+// ID or CreatedAt set on msg is kept, which lets queued messages be replayed
+// as they were accepted.
 func (pg *Postgres) InsertMessage(ctx context.Context, msg api.Message) (api.Message, error) {
 	m := &message{
+		ID:          msg.ID,
 		MessageText: msg.Text,
+		Format:      msg.Format,
+		Moderation:  msg.Moderation,
 		UserID:      msg.UserID,
+		CreatedAt:   msg.CreatedAt,
+	}
+	var attachments []api.Attachment
+	err := pg.bun.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewInsert().Model(m).Exec(ctx); err != nil {
+			return err
+		}
+		if len(msg.Mentions) > 0 {
+			mentions := make([]messageMention, len(msg.Mentions))
+			for i, userID := range msg.Mentions {
+				mentions[i] = messageMention{
+					MessageID: m.ID,
+					UserID:    userID,
+					CreatedAt: m.CreatedAt,
+				}
+			}
+			if _, err := tx.NewInsert().Model(&mentions).On("CONFLICT DO NOTHING").Exec(ctx); err != nil {
+				return err
+			}
+		}
+		var err error
+		attachments, err = attach(ctx, tx, m, msg.Attachments)
+		return err
+	})
+	if errors.Is(err, api.ErrAttachmentNotFound) {
+		return api.Message{}, err
 	}
-	if _, err := pg.bun.NewInsert().Model(m).Exec(ctx); err != nil {
-		return api.Message{}, fmt.Errorf("insert: %w", err)
+	if err != nil {
+		return api.Message{}, fmt.Errorf("insert: %w", wrapErr(err))
 	}
-	return m.APIMessage(), nil
+	out := m.APIMessage()
+	out.Mentions = msg.Mentions
+	out.Attachments = attachments
+	return out, nil
 }
 
 // InsertReaction inserts a reaction into the database. The returned reaction
 // holds auto-generated fields, such as the reaction id.
 func (pg *Postgres) InsertReaction(ctx context.Context, reaction api.Reaction) (api.Reaction, error) {
 	r := &messageReaction{
+		ID:        reaction.ID,
 		MessageID: reaction.MessageID,
 		UserID:    reaction.UserID,
 		Type:      reaction.Type,
 		Score:     reaction.Score,
+		CreatedAt: reaction.CreatedAt,
 	}
 
 	// Insert the reaction into the database
 	if _, err := pg.bun.NewInsert().Model(r).Exec(ctx); err != nil {
-		return api.Reaction{}, fmt.Errorf("insert: %w", err)
+		return api.Reaction{}, fmt.Errorf("insert: %w", wrapErr(err))
 	}
 
 	// Return the inserted reaction, assuming there's a method to convert to API format
 	return r.APIMessageReaction(), nil
 }
 
-// convertToMessages converts the database response object messageWithReactions to api.Message object
-func convertToMessages(messagesWithReactions []messageWithReactions) []api.Message {
-	messageMap := make(map[string]*api.Message)
-
-	for _, mwr := range messagesWithReactions {
-		if _, exists := messageMap[mwr.ID]; !exists {
-			messageMap[mwr.ID] = &api.Message{
-				ID:                    mwr.ID,
-				Text:                  mwr.MessageText,
-				UserID:                mwr.UserID,
-				CreatedAt:             mwr.CreatedAt,
-				MessageReactionCounts: make([]api.MessageReactionCount, 0),
-			}
-		}
-
-		if mwr.ReactionType != nil && mwr.ReactionCount != nil {
-			reaction := api.MessageReactionCount{
-				Type:  *mwr.ReactionType,
-				Count: *mwr.ReactionCount,
-			}
-			messageMap[mwr.ID].MessageReactionCounts = append(messageMap[mwr.ID].MessageReactionCounts, reaction)
-		}
-	}
-
-	messages := make([]api.Message, 0, len(messageMap))
-	for _, msg := range messageMap {
-		messages = append(messages, *msg)
+// wrapErr marks connection failures with api.ErrDBUnavailable so callers can
+// tell an outage apart from a rejected query.
+func wrapErr(err error) error {
+	var netErr net.Error
+	if errors.As(err, &netErr) ||
+		errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: %w", api.ErrDBUnavailable, err)
 	}
-
-	return messages
+	return err
 }
@@ -4,6 +4,7 @@ package postgres
 
 import (
 	"context"
+	"strings"
 	"testing"
 	"time"
 
@@ -96,7 +97,7 @@ func TestPostgres_ListMessages(t *testing.T) {
 				}
 			}
 
-			got, err := pg.ListMessages(ctx, 0, 0)
+			got, err := pg.ListMessages(ctx, api.ListQuery{})
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -174,3 +175,60 @@ func connect(t *testing.T) *Postgres {
 
 	return pg
 }
+
+func TestPostgres_ListMessages_Query(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	pg := connect(t)
+	msgs := []message{
+		{ID: "0e1b4c1a-8f3e-4d2b-9c55-6a7d00000001", MessageText: "one", UserID: "alice", CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{ID: "0e1b4c1a-8f3e-4d2b-9c55-6a7d00000002", MessageText: "two", UserID: "bob", CreatedAt: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{ID: "0e1b4c1a-8f3e-4d2b-9c55-6a7d00000003", MessageText: "three", UserID: "alice", CreatedAt: time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)},
+	}
+	if _, err := pg.bun.NewInsert().Model(&msgs).Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+	reactions := []messageReaction{
+		{MessageID: msgs[0].ID, UserID: "bob", Type: "clap", Score: 10},
+		{MessageID: msgs[1].ID, UserID: "alice", Type: "like", Score: 1},
+		{MessageID: msgs[1].ID, UserID: "carol", Type: "like", Score: 1},
+	}
+	if _, err := pg.bun.NewInsert().Model(&reactions).Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	yes, no := true, false
+	tests := []struct {
+		name string
+		q    api.ListQuery
+		want string
+	}{
+		{name: "Default", q: api.ListQuery{}, want: "three,two,one"},
+		{name: "Ascending", q: api.ListQuery{Ascending: true}, want: "one,two,three"},
+		{name: "Page", q: api.ListQuery{Limit: 1, Offset: 1}, want: "two"},
+		{name: "User", q: api.ListQuery{UserID: "alice"}, want: "three,one"},
+		{name: "Since", q: api.ListQuery{Since: msgs[1].CreatedAt}, want: "three,two"},
+		{name: "Until", q: api.ListQuery{Until: msgs[1].CreatedAt}, want: "one"},
+		{name: "HasReactions", q: api.ListQuery{HasReactions: &yes}, want: "two,one"},
+		{name: "NoReactions", q: api.ListQuery{HasReactions: &no}, want: "three"},
+		{name: "ReactionType", q: api.ListQuery{ReactionType: "like"}, want: "two"},
+		{name: "Top", q: api.ListQuery{Sort: api.SortScore}, want: "one,two,three"},
+		{name: "TopAscending", q: api.ListQuery{Sort: api.SortScore, Ascending: true}, want: "three,two,one"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := pg.ListMessages(ctx, tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var texts []string
+			for _, m := range got {
+				texts = append(texts, m.Text)
+			}
+			if s := strings.Join(texts, ","); s != tt.want {
+				t.Errorf("Got %s, want %s", s, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+	"github.com/uptrace/bun"
+)
+
+// MarkRead moves the read marker of a user forward to a message and marks
+// the mentions of the user up to it read, or returns api.ErrMessageNotFound.
+// A marker already past the message is kept, so receipts arriving out of
+// order don't move it back.
+func (pg *Postgres) MarkRead(ctx context.Context, userID, messageID string) (api.ReadMarker, error) {
+	var m readMarker
+	err := pg.bun.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var msg message
+		err := tx.NewSelect().
+			Model(&msg).
+			Column("id", "created_at").
+			Where("id = ?", messageID).
+			Scan(ctx)
+		if errors.Is(err, sql.ErrNoRows) || isInvalidText(err) {
+			return api.ErrMessageNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		m = readMarker{
+			UserID:           userID,
+			MessageID:        msg.ID,
+			MessageCreatedAt: msg.CreatedAt,
+		}
+		_, err = tx.NewInsert().
+			Model(&m).
+			On("CONFLICT (user_id) DO UPDATE").
+			Set("message_id = EXCLUDED.message_id").
+			Set("message_created_at = EXCLUDED.message_created_at").
+			Set("updated_at = now()").
+			Where("(read_marker.message_created_at, read_marker.message_id) < (EXCLUDED.message_created_at, EXCLUDED.message_id)").
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		// The marker may have been further on already.
+		if err := tx.NewSelect().Model(&m).WherePK().Scan(ctx); err != nil {
+			return err
+		}
+		_, err = tx.NewUpdate().
+			Model((*messageMention)(nil)).
+			Set("read_at = now()").
+			Where("user_id = ?", userID).
+			Where("read_at IS NULL").
+			Where("message_id IN (SELECT id FROM messages WHERE (created_at, id) <= (?, ?::uuid))", m.MessageCreatedAt, m.MessageID).
+			Exec(ctx)
+		return err
+	})
+	if errors.Is(err, api.ErrMessageNotFound) {
+		return api.ReadMarker{}, err
+	}
+	if err != nil {
+		return api.ReadMarker{}, fmt.Errorf("mark read: %w", wrapErr(err))
+	}
+	return m.APIReadMarker(), nil
+}
+
+// GetReadMarker returns the read marker of a user, or
+// api.ErrReadMarkerNotFound.
+func (pg *Postgres) GetReadMarker(ctx context.Context, userID string) (*api.ReadMarker, error) {
+	var m readMarker
+	err := pg.bun.NewSelect().Model(&m).Where("user_id = ?", userID).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, api.ErrReadMarkerNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", wrapErr(err))
+	}
+	marker := m.APIReadMarker()
+	return &marker, nil
+}
+
+// CountUnread counts the messages of others after the marker, or all of them
+// without one, and the unread mentions of a user. Both are counted by one
+// statement, so they agree with each other: a message and its mentions are
+// inserted together. Like listing, neither counts messages hidden by
+// moderation.
+func (pg *Postgres) CountUnread(ctx context.Context, userID string, marker *api.ReadMarker) (api.UnreadCounts, error) {
+	msgs := pg.bun.NewSelect().
+		TableExpr("messages AS m").
+		ColumnExpr("COUNT(*)").
+		Where("m.user_id <> ?", userID).
+		Where("COALESCE(m.moderation, '') NOT IN (?)", hiddenModeration)
+	if marker != nil {
+		msgs = msgs.Where("(m.created_at, m.id) > (?, ?::uuid)", marker.MessageCreatedAt, marker.MessageID)
+	}
+	mentions := pg.bun.NewSelect().
+		TableExpr("message_mentions AS mm").
+		Join("JOIN messages AS m ON m.id = mm.message_id").
+		ColumnExpr("COUNT(*)").
+		Where("mm.user_id = ?", userID).
+		Where("mm.read_at IS NULL").
+		Where("COALESCE(m.moderation, '') NOT IN (?)", hiddenModeration)
+
+	var counts struct {
+		Messages int `bun:"messages"`
+		Mentions int `bun:"mentions"`
+	}
+	err := pg.bun.NewSelect().
+		ColumnExpr("(?) AS messages", msgs).
+		ColumnExpr("(?) AS mentions", mentions).
+		Scan(ctx, &counts)
+	if err != nil {
+		return api.UnreadCounts{}, fmt.Errorf("count: %w", wrapErr(err))
+	}
+	return api.UnreadCounts{Messages: counts.Messages, Mentions: counts.Mentions}, nil
+}
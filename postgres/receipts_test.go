@@ -0,0 +1,94 @@
+//go:build integration
+
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+)
+
+func TestPostgres_ReadMarkers(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	pg := connect(t)
+	if _, err := pg.bun.NewTruncateTable().Model((*readMarker)(nil)).Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var msgs []api.Message
+	for i, m := range []api.Message{
+		{Text: "one @bob", UserID: "alice", Mentions: []string{"bob"}},
+		{Text: "two", UserID: "bob"},
+		{Text: "three @bob", UserID: "alice", Mentions: []string{"bob"}},
+	} {
+		m.CreatedAt = time.Date(2024, 1, i+1, 0, 0, 0, 0, time.UTC)
+		stored, err := pg.InsertMessage(ctx, m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, stored)
+	}
+
+	if _, err := pg.GetReadMarker(ctx, "bob"); !errors.Is(err, api.ErrReadMarkerNotFound) {
+		t.Fatalf("Got %v before reading, want ErrReadMarkerNotFound", err)
+	}
+	checkUnread := func(marker *api.ReadMarker, want api.UnreadCounts) {
+		t.Helper()
+		got, err := pg.CountUnread(ctx, "bob", marker)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("Got unread %+v, want %+v", got, want)
+		}
+	}
+	// Bob's own message doesn't count.
+	checkUnread(nil, api.UnreadCounts{Messages: 2, Mentions: 2})
+
+	marker, err := pg.MarkRead(ctx, "bob", msgs[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if marker.MessageID != msgs[1].ID || !marker.MessageCreatedAt.Equal(msgs[1].CreatedAt) {
+		t.Errorf("Got marker %+v, want at the second message", marker)
+	}
+	checkUnread(&marker, api.UnreadCounts{Messages: 1, Mentions: 1})
+
+	// Reading an older message doesn't move the marker back.
+	older, err := pg.MarkRead(ctx, "bob", msgs[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if older.MessageID != msgs[1].ID {
+		t.Errorf("Got marker at %s, want it kept at %s", older.MessageID, msgs[1].ID)
+	}
+	stored, err := pg.GetReadMarker(ctx, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.MessageID != msgs[1].ID {
+		t.Errorf("Got stored marker at %s, want %s", stored.MessageID, msgs[1].ID)
+	}
+
+	for _, id := range []string{"not-a-uuid", "00000000-0000-4000-8000-000000000000"} {
+		if _, err := pg.MarkRead(ctx, "bob", id); !errors.Is(err, api.ErrMessageNotFound) {
+			t.Errorf("Got %v reading %s, want ErrMessageNotFound", err, id)
+		}
+	}
+
+	// Hidden messages and their mentions are not listed, so they don't count.
+	if _, err := pg.InsertMessage(ctx, api.Message{
+		Text:       "four @bob",
+		UserID:     "alice",
+		Mentions:   []string{"bob"},
+		Moderation: api.ModerationRemove,
+		CreatedAt:  time.Date(2024, 1, 4, 0, 0, 0, 0, time.UTC),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	checkUnread(&marker, api.UnreadCounts{Messages: 1, Mentions: 1})
+}
@@ -0,0 +1,113 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+	"github.com/uptrace/bun"
+)
+
+// ExpiredMessages returns up to limit messages created before cutoff, oldest
+// first, whatever their moderation. After, if not nil, is the last message of
+// the previous page.
+func (pg *Postgres) ExpiredMessages(ctx context.Context, cutoff time.Time, after *api.Message, limit int) ([]api.Message, error) {
+	var msgs []message
+	q := pg.bun.NewSelect().
+		Model(&msgs).
+		Where("created_at < ?", cutoff).
+		OrderExpr("created_at, id").
+		Limit(limit)
+	if after != nil {
+		q = q.Where("(created_at, id) > (?, ?)", after.CreatedAt, after.ID)
+	}
+	if err := q.Scan(ctx); err != nil {
+		return nil, fmt.Errorf("select: %w", wrapErr(err))
+	}
+
+	ids := make([]string, len(msgs))
+	for i, m := range msgs {
+		ids[i] = m.ID
+	}
+	counts, err := pg.reactionCounts(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	attachments, err := pg.attachments(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	mentioned, err := pg.mentionedUsers(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]api.Message, len(msgs))
+	for i, m := range msgs {
+		out[i] = m.APIMessage()
+		out[i].MessageReactionCounts = counts[m.ID]
+		out[i].Attachments = attachments[m.ID]
+		out[i].Mentions = mentioned[m.ID]
+	}
+	return out, nil
+}
+
+// DeleteMessages deletes the messages, which takes their reactions, mentions,
+// pins, flags and attachments with them, and returns the keys of the
+// contents of the attachments and their thumbnails.
+func (pg *Postgres) DeleteMessages(ctx context.Context, ids []string) ([]string, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	var keys []string
+	err := pg.bun.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		keys = nil
+		var atts []attachment
+		err := tx.NewSelect().
+			Model(&atts).
+			Where("message_id IN (?)", bun.In(ids)).
+			For("UPDATE").
+			Scan(ctx)
+		if err != nil {
+			return fmt.Errorf("select attachments: %w", err)
+		}
+		attIDs := make([]string, len(atts))
+		for i, a := range atts {
+			attIDs[i] = a.ID
+		}
+		thumbs, err := thumbnails(ctx, tx, attIDs)
+		if err != nil {
+			return err
+		}
+		for _, a := range atts {
+			keys = append(keys, a.StorageKey)
+			for _, th := range thumbs[a.ID] {
+				keys = append(keys, th.Key)
+			}
+		}
+		if _, err := tx.NewDelete().Model((*message)(nil)).Where("id IN (?)", bun.In(ids)).Exec(ctx); err != nil {
+			return fmt.Errorf("delete messages: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("delete: %w", wrapErr(err))
+	}
+	return keys, nil
+}
+
+// InsertArchive records the users whose messages or mentions the archive
+// under key holds. Users already recorded are left as they are.
+func (pg *Postgres) InsertArchive(ctx context.Context, key string, userIDs []string) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	rows := make([]archiveUser, len(userIDs))
+	for i, id := range userIDs {
+		rows[i] = archiveUser{UserID: id, ArchiveKey: key}
+	}
+	if _, err := pg.bun.NewInsert().Model(&rows).On("CONFLICT DO NOTHING").Exec(ctx); err != nil {
+		return fmt.Errorf("insert: %w", wrapErr(err))
+	}
+	return nil
+}
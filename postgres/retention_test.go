@@ -0,0 +1,131 @@
+//go:build integration
+
+package postgres
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+)
+
+func TestPostgres_Retention(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	pg := connect(t)
+	old := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	att, err := pg.InsertAttachment(ctx, api.Attachment{
+		UserID:      "alice",
+		FileName:    "cat.png",
+		ContentType: "image/png",
+		Size:        5,
+		Key:         "attachments/retention-cat",
+		CreatedAt:   old,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for i := range 3 {
+		msg := api.Message{Text: "old", UserID: "alice", CreatedAt: old.Add(time.Duration(i) * time.Minute)}
+		if i == 0 {
+			msg.Attachments = []api.Attachment{{ID: att.ID}}
+		}
+		// Expired messages are deleted whatever their moderation.
+		if i == 2 {
+			msg.Moderation = api.ModerationShadow
+		}
+		stored, err := pg.InsertMessage(ctx, msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, stored.ID)
+	}
+	if _, err := pg.InsertReaction(ctx, api.Reaction{MessageID: ids[0], Type: "like", Score: 1, UserID: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pg.InsertMessage(ctx, api.Message{Text: "new", UserID: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+
+	cutoff := old.Add(time.Hour)
+	first, err := pg.ExpiredMessages(ctx, cutoff, nil, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 2 || first[0].ID != ids[0] || first[1].ID != ids[1] {
+		t.Fatalf("Got first page %+v, want the two oldest", first)
+	}
+	if len(first[0].Attachments) != 1 || len(first[0].MessageReactionCounts) != 1 {
+		t.Errorf("Got message %+v, want its attachment and reactions", first[0])
+	}
+	rest, err := pg.ExpiredMessages(ctx, cutoff, &first[1], 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rest) != 1 || rest[0].ID != ids[2] {
+		t.Errorf("Got second page %+v, want the shadowed message", rest)
+	}
+
+	keys, err := pg.DeleteMessages(ctx, ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(keys, []string{att.Key}) {
+		t.Errorf("Got keys %v, want %q", keys, att.Key)
+	}
+	left, err := pg.ExpiredMessages(ctx, cutoff, nil, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 0 {
+		t.Errorf("Got %d expired messages after deleting them, want none", len(left))
+	}
+	msgs, err := pg.ListMessages(ctx, api.ListQuery{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || msgs[0].Text != "new" {
+		t.Errorf("Got messages %+v, want only the new one", msgs)
+	}
+}
+
+func TestPostgres_Archives(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	pg := connect(t)
+	userID := "archived-" + time.Now().Format("150405.000000")
+	first := "archives/messages/20240101T000000Z_" + userID + ".ndjson.gz"
+	second := "archives/messages/20240102T000000Z_" + userID + ".ndjson.gz"
+	if err := pg.InsertArchive(ctx, second, []string{userID, "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := pg.InsertArchive(ctx, first, []string{userID}); err != nil {
+		t.Fatal(err)
+	}
+	// Recording an archive again, after a failed run, adds to it.
+	if err := pg.InsertArchive(ctx, first, []string{userID, "bob"}); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := pg.ListUserArchives(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{first, second}; !slices.Equal(keys, want) {
+		t.Errorf("Got archives %v, want %v", keys, want)
+	}
+	if err := pg.DeleteArchiveUser(ctx, first, userID); err != nil {
+		t.Fatal(err)
+	}
+	if keys, err := pg.ListUserArchives(ctx, userID); err != nil || !slices.Equal(keys, []string{second}) {
+		t.Errorf("Got archives %v, %v after forgetting the first, want only the second", keys, err)
+	}
+	if keys, err := pg.ListUserArchives(ctx, "bob"); err != nil || !slices.Contains(keys, first) {
+		t.Errorf("Got archives %v, %v of bob, want the first kept", keys, err)
+	}
+}
@@ -27,3 +27,196 @@ CREATE TABLE IF NOT EXISTS message_reactions (
 -- Indexes
 CREATE INDEX idx_message_reactions_message_id ON message_reactions (message_id);
 CREATE INDEX idx_message_reactions_message_id_type ON message_reactions (message_id, type);
+
+-- API Keys
+CREATE TABLE IF NOT EXISTS api_keys (
+  id UUID DEFAULT gen_random_uuid() PRIMARY KEY,
+  name VARCHAR(255) NOT NULL,
+  prefix VARCHAR(16) NOT NULL,
+  key_hash CHAR(64) NOT NULL,
+  scopes TEXT[] NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  expires_at TIMESTAMP,
+  revoked_at TIMESTAMP,
+  CONSTRAINT unique_key_hash UNIQUE (key_hash)
+);
+
+-- Full-text search
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS search tsvector
+  GENERATED ALWAYS AS (to_tsvector('english', message_text)) STORED;
+CREATE INDEX IF NOT EXISTS idx_messages_search ON messages USING GIN (search);
+
+-- Mentions
+CREATE TABLE IF NOT EXISTS message_mentions (
+  message_id UUID NOT NULL,
+  user_id VARCHAR(255) NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  read_at TIMESTAMP,
+  PRIMARY KEY (message_id, user_id),
+  CONSTRAINT fk_mention_message FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_message_mentions_user_id ON message_mentions (user_id, created_at DESC);
+
+-- Read markers
+CREATE TABLE IF NOT EXISTS read_markers (
+  user_id VARCHAR(255) PRIMARY KEY,
+  message_id UUID NOT NULL,
+  message_created_at TIMESTAMP NOT NULL,
+  updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_messages_created_at_id ON messages (created_at, id);
+CREATE INDEX IF NOT EXISTS idx_message_mentions_unread ON message_mentions (user_id) WHERE read_at IS NULL;
+
+-- Pins
+CREATE TABLE IF NOT EXISTS message_pins (
+  message_id UUID PRIMARY KEY,
+  pinned_by VARCHAR(255) NOT NULL,
+  pinned_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  CONSTRAINT fk_pin_message FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE
+);
+
+-- Attachments
+CREATE TABLE IF NOT EXISTS attachments (
+  id UUID DEFAULT gen_random_uuid() PRIMARY KEY,
+  message_id UUID,
+  user_id VARCHAR(255) NOT NULL,
+  file_name VARCHAR(255) NOT NULL,
+  content_type VARCHAR(255) NOT NULL,
+  size BIGINT NOT NULL,
+  storage_key VARCHAR(1024) NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  CONSTRAINT fk_attachment_message FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_attachments_message_id ON attachments (message_id);
+
+-- Thumbnails
+CREATE TABLE IF NOT EXISTS attachment_thumbnails (
+  attachment_id UUID NOT NULL,
+  size INT NOT NULL,
+  width INT NOT NULL,
+  height INT NOT NULL,
+  content_type VARCHAR(255) NOT NULL,
+  storage_key VARCHAR(1024) NOT NULL,
+  PRIMARY KEY (attachment_id, size),
+  CONSTRAINT fk_thumbnail_attachment FOREIGN KEY (attachment_id) REFERENCES attachments(id) ON DELETE CASCADE
+);
+-- status is pending, running, done or failed. run_at is when a pending job
+-- is due, or when the lease of a running one runs out.
+CREATE TABLE IF NOT EXISTS thumbnail_jobs (
+  attachment_id UUID PRIMARY KEY,
+  status VARCHAR(16) NOT NULL DEFAULT 'pending',
+  attempts INT NOT NULL DEFAULT 0,
+  last_error TEXT,
+  run_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  CONSTRAINT fk_thumbnail_job_attachment FOREIGN KEY (attachment_id) REFERENCES attachments(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_thumbnail_jobs_due ON thumbnail_jobs (run_at) WHERE status IN ('pending', 'running');
+
+-- Formatting, NULL for plain text
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS format VARCHAR(16);
+
+-- Moderation, NULL for allowed messages
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS moderation VARCHAR(16);
+
+CREATE TABLE IF NOT EXISTS moderation_rules (
+  id UUID DEFAULT gen_random_uuid() PRIMARY KEY,
+  name VARCHAR(255) NOT NULL,
+  kind VARCHAR(16) NOT NULL,
+  words TEXT[],
+  pattern TEXT,
+  rule_limit INT NOT NULL DEFAULT 0,
+  action VARCHAR(16) NOT NULL,
+  enabled BOOLEAN NOT NULL DEFAULT true,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Flags, pending until resolved by a moderator
+CREATE TABLE IF NOT EXISTS message_flags (
+  message_id UUID NOT NULL,
+  user_id VARCHAR(255) NOT NULL,
+  reason VARCHAR(500) NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  resolved_at TIMESTAMP,
+  resolved_by VARCHAR(255),
+  resolution VARCHAR(16),
+  PRIMARY KEY (message_id, user_id),
+  CONSTRAINT fk_flag_message FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_message_flags_pending ON message_flags (message_id) WHERE resolved_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_messages_review ON messages (created_at) WHERE moderation IN ('flag', 'hide');
+
+-- Bans, which apply everywhere since messages are not in channels
+CREATE TABLE IF NOT EXISTS user_bans (
+  id UUID DEFAULT gen_random_uuid() PRIMARY KEY,
+  user_id VARCHAR(255) NOT NULL,
+  kind VARCHAR(16) NOT NULL,
+  reason VARCHAR(500),
+  created_by VARCHAR(255) NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  expires_at TIMESTAMP,
+  lifted_at TIMESTAMP
+);
+ALTER TABLE user_bans DROP COLUMN IF EXISTS channel_id;
+CREATE INDEX IF NOT EXISTS idx_user_bans_user_id ON user_bans (user_id, created_at DESC);
+
+-- Blocks, hiding the messages of blocked_user_id from user_id
+CREATE TABLE IF NOT EXISTS user_blocks (
+  user_id VARCHAR(255) NOT NULL,
+  blocked_user_id VARCHAR(255) NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (user_id, blocked_user_id)
+);
+
+-- Profiles, which not every user_id has
+CREATE TABLE IF NOT EXISTS users (
+  id VARCHAR(255) PRIMARY KEY,
+  name VARCHAR(100) NOT NULL,
+  avatar_url VARCHAR(2048),
+  deactivated BOOLEAN NOT NULL DEFAULT false,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Erasure of user data. status is pending, running or done. run_at is when a
+-- pending job is due, or when the lease of a running one runs out.
+CREATE TABLE IF NOT EXISTS erasure_jobs (
+  id UUID DEFAULT gen_random_uuid() PRIMARY KEY,
+  user_id VARCHAR(255) NOT NULL,
+  mode VARCHAR(16) NOT NULL,
+  requested_by VARCHAR(255) NOT NULL,
+  status VARCHAR(16) NOT NULL DEFAULT 'pending',
+  messages INT NOT NULL DEFAULT 0,
+  attachments INT NOT NULL DEFAULT 0,
+  reactions INT NOT NULL DEFAULT 0,
+  run_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  completed_at TIMESTAMP
+);
+-- The pseudonym is random and cleared when the job is done, so that it can't
+-- be traced back to the user
+ALTER TABLE erasure_jobs ADD COLUMN IF NOT EXISTS pseudonym VARCHAR(64) DEFAULT ('erased-' || gen_random_uuid());
+CREATE INDEX IF NOT EXISTS idx_erasure_jobs_due ON erasure_jobs (run_at) WHERE status IN ('pending', 'running');
+CREATE INDEX IF NOT EXISTS idx_message_reactions_user_id ON message_reactions (user_id);
+CREATE INDEX IF NOT EXISTS idx_attachments_user_id ON attachments (user_id);
+CREATE INDEX IF NOT EXISTS idx_message_flags_user_id ON message_flags (user_id);
+
+-- The users whose messages or mentions each archive of expired messages holds
+CREATE TABLE IF NOT EXISTS archive_users (
+  user_id VARCHAR(255) NOT NULL,
+  archive_key VARCHAR(255) NOT NULL,
+  PRIMARY KEY (user_id, archive_key)
+);
+
+-- Audit trail of actions on user data
+CREATE TABLE IF NOT EXISTS audit_records (
+  id UUID DEFAULT gen_random_uuid() PRIMARY KEY,
+  action VARCHAR(64) NOT NULL,
+  actor VARCHAR(255) NOT NULL,
+  subject VARCHAR(255) NOT NULL,
+  details JSONB,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_audit_records_subject ON audit_records (subject, created_at);
@@ -0,0 +1,137 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+	"github.com/uptrace/bun"
+)
+
+// headlineOptions configure the snippets of search results: a couple of
+// fragments around the matches, which are delimited for the API to mark up.
+var headlineOptions = fmt.Sprintf(`StartSel="%s", StopSel="%s", MaxWords=35, MinWords=15, MaxFragments=2`,
+	api.HighlightStart, api.HighlightEnd)
+
+// searchResult represents a row of the search query.
+type searchResult struct {
+	ID          string    `bun:"id"`
+	MessageText string    `bun:"message_text"`
+	Format      string    `bun:"format"`
+	UserID      string    `bun:"user_id"`
+	CreatedAt   time.Time `bun:"created_at"`
+	Rank        float32   `bun:"rank"`
+	Snippet     string    `bun:"snippet"`
+}
+
+// SearchMessages returns the messages matching q.Text, best ranked first and
+// newest first among equal ranks. The query supports the web search syntax:
+// quoted phrases, OR and -exclusions.
+func (pg *Postgres) SearchMessages(ctx context.Context, q api.SearchQuery) ([]api.SearchResult, error) {
+	matches := pg.bun.NewSelect().
+		TableExpr("messages AS m").
+		ColumnExpr("m.id, m.message_text, m.format, m.user_id, m.created_at").
+		ColumnExpr("ts_rank(m.search, query) AS rank").
+		ColumnExpr("ts_headline('english', m.message_text, query, ?) AS snippet", headlineOptions).
+		Join("CROSS JOIN websearch_to_tsquery('english', ?) AS query", q.Text).
+		Where("m.search @@ query").
+		Where("COALESCE(m.moderation, '') NOT IN (?)", hiddenModeration)
+	if q.UserID != "" {
+		matches = matches.Where("m.user_id = ?", q.UserID)
+	}
+	if !q.Since.IsZero() {
+		matches = matches.Where("m.created_at >= ?", q.Since)
+	}
+	if !q.Until.IsZero() {
+		matches = matches.Where("m.created_at < ?", q.Until)
+	}
+
+	// The rank is only known after matching, so the cursor is applied to the
+	// matches in an outer query.
+	sq := pg.bun.NewSelect().
+		TableExpr("(?) AS s", matches).
+		ColumnExpr("s.*").
+		OrderExpr("s.rank DESC, s.created_at DESC, s.id DESC").
+		Limit(q.Limit)
+	if q.After != nil {
+		sq = sq.Where("(s.rank, s.created_at, s.id) < (?::real, ?, ?::uuid)",
+			q.After.Rank, q.After.CreatedAt, q.After.ID)
+	}
+
+	var rows []searchResult
+	if err := sq.Scan(ctx, &rows); err != nil {
+		return nil, fmt.Errorf("search: %w", wrapErr(err))
+	}
+
+	ids := make([]string, len(rows))
+	for i, row := range rows {
+		ids[i] = row.ID
+	}
+	counts, err := pg.reactionCounts(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	attachments, err := pg.attachments(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	mentioned, err := pg.mentionedUsers(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]api.SearchResult, len(rows))
+	for i, row := range rows {
+		out[i] = api.SearchResult{
+			Message: api.Message{
+				ID:                    row.ID,
+				Text:                  row.MessageText,
+				Format:                row.Format,
+				UserID:                row.UserID,
+				CreatedAt:             row.CreatedAt,
+				MessageReactionCounts: counts[row.ID],
+				Attachments:           attachments[row.ID],
+				Mentions:              mentioned[row.ID],
+			},
+			Rank:    row.Rank,
+			Snippet: row.Snippet,
+		}
+	}
+	return out, nil
+}
+
+// reactionCounts returns the reaction counts by type of each message.
+// Messages without reactions get an empty list.
+func (pg *Postgres) reactionCounts(ctx context.Context, msgIDs []string) (map[string][]api.MessageReactionCount, error) {
+	out := make(map[string][]api.MessageReactionCount, len(msgIDs))
+	for _, id := range msgIDs {
+		out[id] = make([]api.MessageReactionCount, 0)
+	}
+	if len(msgIDs) == 0 {
+		return out, nil
+	}
+
+	var rows []struct {
+		MessageID string `bun:"message_id"`
+		Type      string `bun:"type"`
+		Count     int    `bun:"count"`
+	}
+	err := pg.bun.NewSelect().
+		TableExpr("message_reactions").
+		ColumnExpr("message_id, type, COUNT(*) AS count").
+		Where("message_id IN (?)", bun.In(msgIDs)).
+		GroupExpr("message_id, type").
+		OrderExpr("message_id, type").
+		Scan(ctx, &rows)
+	if err != nil {
+		return nil, fmt.Errorf("count reactions: %w", wrapErr(err))
+	}
+	for _, row := range rows {
+		out[row.MessageID] = append(out[row.MessageID], api.MessageReactionCount{
+			Type:  row.Type,
+			Count: row.Count,
+		})
+	}
+	return out, nil
+}
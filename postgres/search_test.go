@@ -0,0 +1,95 @@
+//go:build integration
+
+package postgres
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+)
+
+func TestPostgres_SearchMessages(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	pg := connect(t)
+	msgs := []message{
+		{ID: "9a3b8f0e-54a4-4c4f-8a52-0d3e3f0a0001", MessageText: "deploying the new search service", UserID: "alice", CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{ID: "9a3b8f0e-54a4-4c4f-8a52-0d3e3f0a0002", MessageText: "search search search", UserID: "bob", CreatedAt: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{ID: "9a3b8f0e-54a4-4c4f-8a52-0d3e3f0a0003", MessageText: "lunch?", UserID: "alice", CreatedAt: time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{ID: "9a3b8f0e-54a4-4c4f-8a52-0d3e3f0a0004", MessageText: "searching for the logs", UserID: "alice", CreatedAt: time.Date(2024, 1, 4, 0, 0, 0, 0, time.UTC)},
+	}
+	if _, err := pg.bun.NewInsert().Model(&msgs).Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+	reaction := messageReaction{MessageID: msgs[0].ID, UserID: "bob", Type: "like"}
+	if _, err := pg.bun.NewInsert().Model(&reaction).Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	ids := func(results []api.SearchResult) string {
+		var out []string
+		for _, r := range results {
+			out = append(out, r.ID[len(r.ID)-1:])
+		}
+		return strings.Join(out, ",")
+	}
+
+	t.Run("Ranked", func(t *testing.T) {
+		got, err := pg.SearchMessages(ctx, api.SearchQuery{Text: "search", Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Stemming matches "searching"; the message repeating the word ranks
+		// first.
+		if ids(got) != "2,4,1" && ids(got) != "2,1,4" {
+			t.Errorf("Got messages %s, want 2 first and then 4 and 1", ids(got))
+		}
+		for _, r := range got {
+			if !strings.Contains(r.Snippet, api.HighlightStart) {
+				t.Errorf("Snippet %q of message %s has no highlight", r.Snippet, r.ID)
+			}
+			if r.ID == msgs[0].ID && len(r.MessageReactionCounts) != 1 {
+				t.Errorf("Got reactions %v, want one like", r.MessageReactionCounts)
+			}
+		}
+	})
+
+	t.Run("Filters", func(t *testing.T) {
+		got, err := pg.SearchMessages(ctx, api.SearchQuery{
+			Text:   "search",
+			UserID: "alice",
+			Since:  time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+			Limit:  10,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ids(got) != "4" {
+			t.Errorf("Got messages %s, want 4", ids(got))
+		}
+	})
+
+	t.Run("Cursor", func(t *testing.T) {
+		var all []api.SearchResult
+		q := api.SearchQuery{Text: "search", Limit: 1}
+		for range 4 {
+			page, err := pg.SearchMessages(ctx, q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(page) == 0 {
+				break
+			}
+			all = append(all, page...)
+			last := page[len(page)-1]
+			q.After = &api.SearchCursor{Rank: last.Rank, CreatedAt: last.CreatedAt, ID: last.ID}
+		}
+		if len(all) != 3 {
+			t.Errorf("Paged through %d messages (%s), want 3", len(all), ids(all))
+		}
+	})
+}
@@ -0,0 +1,187 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+	"github.com/uptrace/bun"
+)
+
+// Statuses of thumbnail jobs.
+const (
+	jobPending = "pending"
+	jobRunning = "running"
+	jobDone    = "done"
+	jobFailed  = "failed"
+)
+
+// EnqueueThumbnails adds a job to generate an attachment's thumbnails, or
+// starts its job over if it has one.
+func (pg *Postgres) EnqueueThumbnails(ctx context.Context, attachmentID string) error {
+	job := &thumbnailJob{AttachmentID: attachmentID, Status: jobPending}
+	_, err := pg.bun.NewInsert().
+		Model(job).
+		On("CONFLICT (attachment_id) DO UPDATE").
+		Set("status = EXCLUDED.status").
+		Set("attempts = 0").
+		Set("last_error = NULL").
+		Set("run_at = now()").
+		Set("updated_at = now()").
+		Exec(ctx)
+	if isInvalidText(err) || isForeignKeyViolation(err) {
+		return api.ErrAttachmentNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("insert: %w", wrapErr(err))
+	}
+	return nil
+}
+
+// ClaimThumbnailJobs claims up to limit jobs that are due, oldest first, for
+// lease. Jobs claimed by another worker are skipped rather than waited for.
+func (pg *Postgres) ClaimThumbnailJobs(ctx context.Context, limit int, lease time.Duration) ([]api.ThumbnailJob, error) {
+	due := pg.bun.NewSelect().
+		Model((*thumbnailJob)(nil)).
+		Column("attachment_id").
+		Where("status IN (?)", bun.In([]string{jobPending, jobRunning})).
+		Where("run_at <= now()").
+		OrderExpr("run_at").
+		Limit(limit).
+		For("UPDATE SKIP LOCKED")
+	var jobs []thumbnailJob
+	_, err := pg.bun.NewUpdate().
+		Model((*thumbnailJob)(nil)).
+		Set("status = ?", jobRunning).
+		Set("attempts = attempts + 1").
+		Set("run_at = now() + make_interval(secs => ?)", lease.Seconds()).
+		Set("updated_at = now()").
+		Where("attachment_id IN (?)", due).
+		Returning("attachment_id, attempts").
+		Exec(ctx, &jobs)
+	if err != nil {
+		return nil, fmt.Errorf("update: %w", wrapErr(err))
+	}
+	if len(jobs) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]string, len(jobs))
+	for i, job := range jobs {
+		ids[i] = job.AttachmentID
+	}
+	var rows []attachment
+	if err := pg.bun.NewSelect().Model(&rows).Where("id IN (?)", bun.In(ids)).Scan(ctx); err != nil {
+		return nil, fmt.Errorf("select attachments: %w", wrapErr(err))
+	}
+	byID := make(map[string]api.Attachment, len(rows))
+	for _, row := range rows {
+		byID[row.ID] = row.APIAttachment()
+	}
+	out := make([]api.ThumbnailJob, len(jobs))
+	for i, job := range jobs {
+		out[i] = api.ThumbnailJob{Attachment: byID[job.AttachmentID], Attempts: job.Attempts}
+	}
+	return out, nil
+}
+
+// CompleteThumbnailJob stores the thumbnails of an attachment and marks its
+// job done.
+func (pg *Postgres) CompleteThumbnailJob(ctx context.Context, attachmentID string, thumbs []api.Thumbnail) (api.Attachment, error) {
+	var row attachment
+	var stored []api.Thumbnail
+	err := pg.bun.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if len(thumbs) > 0 {
+			rows := make([]attachmentThumbnail, len(thumbs))
+			for i, t := range thumbs {
+				rows[i] = attachmentThumbnail{
+					AttachmentID: attachmentID,
+					Size:         t.Size,
+					Width:        t.Width,
+					Height:       t.Height,
+					ContentType:  t.ContentType,
+					StorageKey:   t.Key,
+				}
+			}
+			_, err := tx.NewInsert().
+				Model(&rows).
+				On("CONFLICT (attachment_id, size) DO UPDATE").
+				Set("width = EXCLUDED.width").
+				Set("height = EXCLUDED.height").
+				Set("content_type = EXCLUDED.content_type").
+				Set("storage_key = EXCLUDED.storage_key").
+				Exec(ctx)
+			if err != nil {
+				return err
+			}
+		}
+		_, err := tx.NewUpdate().
+			Model((*thumbnailJob)(nil)).
+			Set("status = ?", jobDone).
+			Set("last_error = NULL").
+			Set("updated_at = now()").
+			Where("attachment_id = ?", attachmentID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if err := tx.NewSelect().Model(&row).Where("id = ?", attachmentID).Scan(ctx); err != nil {
+			return err
+		}
+		all, err := thumbnails(ctx, tx, []string{attachmentID})
+		stored = all[attachmentID]
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) || isInvalidText(err) || isForeignKeyViolation(err) {
+		return api.Attachment{}, api.ErrAttachmentNotFound
+	}
+	if err != nil {
+		return api.Attachment{}, fmt.Errorf("complete: %w", wrapErr(err))
+	}
+	a := row.APIAttachment()
+	a.Thumbnails = stored
+	return a, nil
+}
+
+// FailThumbnailJob records why a job failed. It is due again after
+// retryAfter, or never if that is zero.
+func (pg *Postgres) FailThumbnailJob(ctx context.Context, attachmentID string, jobErr error, retryAfter time.Duration) error {
+	q := pg.bun.NewUpdate().
+		Model((*thumbnailJob)(nil)).
+		Set("last_error = ?", jobErr.Error()).
+		Set("updated_at = now()").
+		Where("attachment_id = ?", attachmentID)
+	if retryAfter > 0 {
+		q = q.Set("status = ?", jobPending).Set("run_at = now() + make_interval(secs => ?)", retryAfter.Seconds())
+	} else {
+		q = q.Set("status = ?", jobFailed)
+	}
+	if _, err := q.Exec(ctx); err != nil && !isInvalidText(err) {
+		return fmt.Errorf("update: %w", wrapErr(err))
+	}
+	return nil
+}
+
+// thumbnails returns the thumbnails of each attachment, smallest first.
+func thumbnails(ctx context.Context, db bun.IDB, attachmentIDs []string) (map[string][]api.Thumbnail, error) {
+	out := make(map[string][]api.Thumbnail, len(attachmentIDs))
+	if len(attachmentIDs) == 0 {
+		return out, nil
+	}
+	var rows []attachmentThumbnail
+	err := db.NewSelect().
+		Model(&rows).
+		Where("attachment_id IN (?)", bun.In(attachmentIDs)).
+		OrderExpr("size").
+		Scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("select thumbnails: %w", wrapErr(err))
+	}
+	for _, row := range rows {
+		out[row.AttachmentID] = append(out[row.AttachmentID], row.APIThumbnail())
+	}
+	return out, nil
+}
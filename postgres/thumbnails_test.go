@@ -0,0 +1,97 @@
+//go:build integration
+
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPostgres_ThumbnailJobs(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	pg := connect(t)
+	att, err := pg.InsertAttachment(ctx, api.Attachment{
+		ID:          "9d5c1c0e-8f0b-4c4e-a8a4-1f0f3f7d2b61",
+		UserID:      "alice",
+		FileName:    "cat.png",
+		ContentType: "image/png",
+		Size:        5,
+		Key:         "attachments/9d5c1c0e-8f0b-4c4e-a8a4-1f0f3f7d2b61",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pg.EnqueueThumbnails(ctx, "not-a-uuid"); !errors.Is(err, api.ErrAttachmentNotFound) {
+		t.Errorf("Got error %v queueing a malformed ID, want ErrAttachmentNotFound", err)
+	}
+	if err := pg.EnqueueThumbnails(ctx, att.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, err := pg.ClaimThumbnailJobs(ctx, 10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].Attachment.ID != att.ID || jobs[0].Attachment.Key != att.Key || jobs[0].Attempts != 1 {
+		t.Fatalf("Got jobs %+v, want the attachment's on its first attempt", jobs)
+	}
+	// Leased jobs aren't claimed twice.
+	if jobs, err := pg.ClaimThumbnailJobs(ctx, 10, time.Minute); err != nil || len(jobs) != 0 {
+		t.Errorf("Got %+v, %v claiming again, want no jobs", jobs, err)
+	}
+
+	// A failed job is due again after the delay.
+	if err := pg.FailThumbnailJob(ctx, att.ID, errors.New("connection refused"), time.Microsecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	jobs, err = pg.ClaimThumbnailJobs(ctx, 10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].Attempts != 2 {
+		t.Fatalf("Got jobs %+v, want the retry", jobs)
+	}
+
+	thumbs := []api.Thumbnail{
+		{Size: 160, Width: 160, Height: 80, ContentType: "image/png", Key: att.Key + "_160"},
+	}
+	done, err := pg.CompleteThumbnailJob(ctx, att.ID, thumbs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(thumbs, done.Thumbnails); diff != "" {
+		t.Errorf("CompleteThumbnailJob() thumbnails mismatch (-want +got):\n%s", diff)
+	}
+	if jobs, err := pg.ClaimThumbnailJobs(ctx, 10, 0); err != nil || len(jobs) != 0 {
+		t.Errorf("Got %+v, %v after completing, want no jobs", jobs, err)
+	}
+
+	// Thumbnails come with the attachment, and with the message it is sent
+	// with.
+	got, err := pg.GetAttachment(ctx, att.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(thumbs, got.Thumbnails); diff != "" {
+		t.Errorf("GetAttachment() thumbnails mismatch (-want +got):\n%s", diff)
+	}
+	msg, err := pg.InsertMessage(ctx, api.Message{
+		Text:        "look",
+		UserID:      "alice",
+		Attachments: []api.Attachment{{ID: att.ID}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msg.Attachments) != 1 || len(msg.Attachments[0].Thumbnails) != 1 {
+		t.Errorf("Got attachments %+v, want the thumbnail", msg.Attachments)
+	}
+}
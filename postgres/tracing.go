@@ -0,0 +1,48 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/schema"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// A queryHook creates a client span for every query bun runs, as a child of
+// the span in the query's context.
+type queryHook struct {
+	tracer trace.Tracer
+}
+
+func (h queryHook) BeforeQuery(ctx context.Context, e *bun.QueryEvent) context.Context {
+	name := e.Operation()
+	attrs := []attribute.KeyValue{
+		attribute.String("db.system", "postgresql"),
+		attribute.String("db.operation.name", e.Operation()),
+	}
+	if m, ok := e.Model.(interface{ Table() *schema.Table }); ok {
+		name += " " + m.Table().Name
+		attrs = append(attrs, attribute.String("db.collection.name", m.Table().Name))
+	}
+	ctx, _ = h.tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+	return ctx
+}
+
+func (h queryHook) AfterQuery(ctx context.Context, e *bun.QueryEvent) {
+	span := trace.SpanFromContext(ctx)
+	// The template has placeholders instead of the arguments, which may hold
+	// user data.
+	span.SetAttributes(attribute.String("db.query.text", e.QueryTemplate))
+	if e.Err != nil && !errors.Is(e.Err, sql.ErrNoRows) {
+		span.RecordError(e.Err)
+		span.SetStatus(codes.Error, e.Err.Error())
+	}
+	span.End()
+}
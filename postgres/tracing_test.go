@@ -0,0 +1,67 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/uptrace/bun"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestQueryHook(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus codes.Code
+	}{
+		{name: "OK"},
+		{name: "NoRows", err: sql.ErrNoRows},
+		{name: "Error", err: errors.New("connection refused"), wantStatus: codes.Error},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exp := tracetest.NewInMemoryExporter()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+			h := queryHook{tracer: tp.Tracer("test")}
+
+			parent, parentSpan := tp.Tracer("test").Start(context.Background(), "request")
+			e := &bun.QueryEvent{
+				Query:         `SELECT * FROM "messages" WHERE id = 'secret'`,
+				QueryTemplate: `SELECT * FROM "messages" WHERE id = ?`,
+			}
+			ctx := h.BeforeQuery(parent, e)
+			e.Err = tt.err
+			h.AfterQuery(ctx, e)
+			parentSpan.End()
+
+			spans := exp.GetSpans()
+			if len(spans) != 2 {
+				t.Fatalf("Got %d spans, want 2", len(spans))
+			}
+			span := spans[0]
+			if span.Name != "SELECT" {
+				t.Errorf("Got span name %q, want SELECT", span.Name)
+			}
+			if span.SpanKind != trace.SpanKindClient {
+				t.Errorf("Got span kind %s, want client", span.SpanKind)
+			}
+			if span.Parent.SpanID() != parentSpan.SpanContext().SpanID() {
+				t.Error("Query span is not a child of the request span")
+			}
+			if span.Status.Code != tt.wantStatus {
+				t.Errorf("Got status %s, want %s", span.Status.Code, tt.wantStatus)
+			}
+			for _, a := range span.Attributes {
+				if a.Key == "db.query.text" && a.Value.AsString() != e.QueryTemplate {
+					t.Errorf("Got query text %q, want the template", a.Value.AsString())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,450 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+	"github.com/uptrace/bun"
+)
+
+// exportBatchSize is how many rows an export reads at a time.
+const exportBatchSize = 500
+
+// ExportUserData calls fn with each message of the user, with its
+// attachments, then each reaction of the user, oldest first. Rows are read
+// in batches, so a large export doesn't hold a connection while it is
+// written.
+func (pg *Postgres) ExportUserData(ctx context.Context, userID string, fn func(api.UserDataRecord) error) error {
+	var last *message
+	for {
+		var msgs []message
+		q := pg.bun.NewSelect().
+			Model(&msgs).
+			Where("user_id = ?", userID).
+			OrderExpr("created_at, id").
+			Limit(exportBatchSize)
+		if last != nil {
+			q = q.Where("(created_at, id) > (?, ?)", last.CreatedAt, last.ID)
+		}
+		if err := q.Scan(ctx); err != nil {
+			return fmt.Errorf("select messages: %w", wrapErr(err))
+		}
+		ids := make([]string, len(msgs))
+		for i, m := range msgs {
+			ids[i] = m.ID
+		}
+		attachments, err := pg.attachments(ctx, ids)
+		if err != nil {
+			return err
+		}
+		mentioned, err := pg.mentionedUsers(ctx, ids)
+		if err != nil {
+			return err
+		}
+		for _, m := range msgs {
+			msg := m.APIMessage()
+			msg.Attachments = attachments[m.ID]
+			msg.Mentions = mentioned[m.ID]
+			if err := fn(api.UserDataRecord{Message: &msg}); err != nil {
+				return err
+			}
+		}
+		if len(msgs) < exportBatchSize {
+			break
+		}
+		last = &msgs[len(msgs)-1]
+	}
+
+	var lastReaction *messageReaction
+	for {
+		var reactions []messageReaction
+		q := pg.bun.NewSelect().
+			Model(&reactions).
+			Where("user_id = ?", userID).
+			OrderExpr("created_at, id").
+			Limit(exportBatchSize)
+		if lastReaction != nil {
+			q = q.Where("(created_at, id) > (?, ?)", lastReaction.CreatedAt, lastReaction.ID)
+		}
+		if err := q.Scan(ctx); err != nil {
+			return fmt.Errorf("select reactions: %w", wrapErr(err))
+		}
+		for _, r := range reactions {
+			reaction := r.APIMessageReaction()
+			if err := fn(api.UserDataRecord{Reaction: &reaction}); err != nil {
+				return err
+			}
+		}
+		if len(reactions) < exportBatchSize {
+			return nil
+		}
+		lastReaction = &reactions[len(reactions)-1]
+	}
+}
+
+// InsertErasureJob queues an erasure job. The returned job holds the
+// generated ID.
+func (pg *Postgres) InsertErasureJob(ctx context.Context, job api.ErasureJob) (api.ErasureJob, error) {
+	j := &erasureJob{
+		UserID:      job.UserID,
+		Mode:        job.Mode,
+		RequestedBy: job.RequestedBy,
+		Status:      api.ErasurePending,
+		CreatedAt:   job.CreatedAt,
+		UpdatedAt:   job.CreatedAt,
+	}
+	if _, err := pg.bun.NewInsert().Model(j).Returning("*").Exec(ctx); err != nil {
+		return api.ErasureJob{}, fmt.Errorf("insert: %w", wrapErr(err))
+	}
+	return j.APIErasureJob(), nil
+}
+
+// GetErasureJob returns the erasure job with the given ID, or
+// api.ErrErasureJobNotFound.
+func (pg *Postgres) GetErasureJob(ctx context.Context, id string) (*api.ErasureJob, error) {
+	var j erasureJob
+	err := pg.bun.NewSelect().Model(&j).Where("id = ?", id).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) || isInvalidText(err) {
+		return nil, api.ErrErasureJobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", wrapErr(err))
+	}
+	job := j.APIErasureJob()
+	return &job, nil
+}
+
+// ClaimErasureJobs claims up to limit jobs that are due, oldest first, for
+// lease. Jobs claimed by another worker are skipped rather than waited for.
+func (pg *Postgres) ClaimErasureJobs(ctx context.Context, limit int, lease time.Duration) ([]api.ErasureJob, error) {
+	due := pg.bun.NewSelect().
+		Model((*erasureJob)(nil)).
+		Column("id").
+		Where("status IN (?)", bun.In([]string{api.ErasurePending, api.ErasureRunning})).
+		Where("run_at <= now()").
+		OrderExpr("run_at").
+		Limit(limit).
+		For("UPDATE SKIP LOCKED")
+	var jobs []erasureJob
+	_, err := pg.bun.NewUpdate().
+		Model((*erasureJob)(nil)).
+		Set("status = ?", api.ErasureRunning).
+		Set("run_at = now() + make_interval(secs => ?)", lease.Seconds()).
+		Set("updated_at = now()").
+		Where("id IN (?)", due).
+		Returning("*").
+		Exec(ctx, &jobs)
+	if err != nil {
+		return nil, fmt.Errorf("update: %w", wrapErr(err))
+	}
+	out := make([]api.ErasureJob, len(jobs))
+	for i, j := range jobs {
+		out[i] = j.APIErasureJob()
+	}
+	return out, nil
+}
+
+// EraseUserData erases up to batchSize attachments, messages, reactions,
+// mentions and flags of the job's user, and records the progress in the same
+// transaction. Erased rows no longer belong to the user, so the next batch
+// carries on where this one stopped. The batch that finds nothing left
+// deletes the user's profile, blocks, bans and read marker, completes the job
+// and writes its audit record.
+func (pg *Postgres) EraseUserData(ctx context.Context, job api.ErasureJob, batchSize int) (api.ErasureBatch, error) {
+	var batch api.ErasureBatch
+	err := pg.bun.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		batch = api.ErasureBatch{}
+
+		// Attachments go first, as deleting their messages would delete
+		// them without their keys.
+		var atts []attachment
+		err := tx.NewSelect().
+			Model(&atts).
+			Where("user_id = ?", job.UserID).
+			Limit(batchSize).
+			For("UPDATE").
+			Scan(ctx)
+		if err != nil {
+			return fmt.Errorf("select attachments: %w", err)
+		}
+		if len(atts) > 0 {
+			ids := make([]string, len(atts))
+			for i, a := range atts {
+				ids[i] = a.ID
+			}
+			thumbs, err := thumbnails(ctx, tx, ids)
+			if err != nil {
+				return err
+			}
+			for _, a := range atts {
+				batch.BlobKeys = append(batch.BlobKeys, a.StorageKey)
+				for _, th := range thumbs[a.ID] {
+					batch.BlobKeys = append(batch.BlobKeys, th.Key)
+				}
+				if a.MessageID != "" {
+					batch.MessageIDs = append(batch.MessageIDs, a.MessageID)
+				}
+			}
+			if _, err := tx.NewDelete().Model((*attachment)(nil)).Where("id IN (?)", bun.In(ids)).Exec(ctx); err != nil {
+				return fmt.Errorf("delete attachments: %w", err)
+			}
+			batch.Attachments = len(atts)
+		}
+
+		var msgIDs []string
+		err = tx.NewSelect().
+			Model((*message)(nil)).
+			Column("id").
+			Where("user_id = ?", job.UserID).
+			Limit(batchSize).
+			For("UPDATE").
+			Scan(ctx, &msgIDs)
+		if err != nil {
+			return fmt.Errorf("select messages: %w", err)
+		}
+		if len(msgIDs) > 0 {
+			if err := eraseMessages(ctx, tx, job, msgIDs); err != nil {
+				return err
+			}
+			batch.Messages = len(msgIDs)
+			batch.MessageIDs = append(batch.MessageIDs, msgIDs...)
+		}
+
+		var reactions []messageReaction
+		err = tx.NewSelect().
+			Model(&reactions).
+			Column("id", "message_id").
+			Where("user_id = ?", job.UserID).
+			Limit(batchSize).
+			For("UPDATE").
+			Scan(ctx)
+		if err != nil {
+			return fmt.Errorf("select reactions: %w", err)
+		}
+		if len(reactions) > 0 {
+			ids := make([]string, len(reactions))
+			for i, r := range reactions {
+				ids[i] = r.ID
+			}
+			if job.Mode == api.ErasureDelete {
+				// The counts on the messages change, so their cached
+				// copies are stale.
+				for _, r := range reactions {
+					batch.MessageIDs = append(batch.MessageIDs, r.MessageID)
+				}
+				_, err = tx.NewDelete().Model((*messageReaction)(nil)).Where("id IN (?)", bun.In(ids)).Exec(ctx)
+			} else {
+				_, err = tx.NewUpdate().
+					Model((*messageReaction)(nil)).
+					Set("user_id = ?", job.Pseudonym).
+					Where("id IN (?)", bun.In(ids)).
+					Exec(ctx)
+			}
+			if err != nil {
+				return fmt.Errorf("erase reactions: %w", err)
+			}
+			batch.Reactions = len(reactions)
+		}
+
+		var mentioned []string
+		err = tx.NewSelect().
+			Model((*messageMention)(nil)).
+			Column("message_id").
+			Where("user_id = ?", job.UserID).
+			Limit(batchSize).
+			For("UPDATE").
+			Scan(ctx, &mentioned)
+		if err != nil {
+			return fmt.Errorf("select mentions: %w", err)
+		}
+		if len(mentioned) > 0 {
+			_, err := tx.NewDelete().
+				Model((*messageMention)(nil)).
+				Where("user_id = ?", job.UserID).
+				Where("message_id IN (?)", bun.In(mentioned)).
+				Exec(ctx)
+			if err != nil {
+				return fmt.Errorf("delete mentions: %w", err)
+			}
+		}
+
+		var flagged []string
+		err = tx.NewSelect().
+			Model((*messageFlag)(nil)).
+			Column("message_id").
+			Where("user_id = ?", job.UserID).
+			Limit(batchSize).
+			For("UPDATE").
+			Scan(ctx, &flagged)
+		if err != nil {
+			return fmt.Errorf("select flags: %w", err)
+		}
+		if len(flagged) > 0 {
+			if job.Mode == api.ErasureDelete {
+				_, err = tx.NewDelete().
+					Model((*messageFlag)(nil)).
+					Where("user_id = ?", job.UserID).
+					Where("message_id IN (?)", bun.In(flagged)).
+					Exec(ctx)
+			} else {
+				// Pending flags still count towards hiding the messages.
+				_, err = tx.NewUpdate().
+					Model((*messageFlag)(nil)).
+					Set("user_id = ?", job.Pseudonym).
+					Where("user_id = ?", job.UserID).
+					Where("message_id IN (?)", bun.In(flagged)).
+					Exec(ctx)
+			}
+			if err != nil {
+				return fmt.Errorf("erase flags: %w", err)
+			}
+		}
+
+		batch.MessageIDs = uniq(batch.MessageIDs)
+		batch.Done = len(atts) < batchSize && len(msgIDs) < batchSize && len(reactions) < batchSize &&
+			len(mentioned) < batchSize && len(flagged) < batchSize
+		if batch.Done {
+			if err := eraseUser(ctx, tx, job, &batch); err != nil {
+				return err
+			}
+		}
+		return completeErasureBatch(ctx, tx, job, &batch)
+	})
+	if err != nil {
+		return api.ErasureBatch{}, fmt.Errorf("erase: %w", wrapErr(err))
+	}
+	return batch, nil
+}
+
+// ListUserArchives returns the keys of the archives that hold messages or
+// mentions of the user, oldest first.
+func (pg *Postgres) ListUserArchives(ctx context.Context, userID string) ([]string, error) {
+	var keys []string
+	err := pg.bun.NewSelect().
+		Model((*archiveUser)(nil)).
+		Column("archive_key").
+		Where("user_id = ?", userID).
+		OrderExpr("archive_key").
+		Scan(ctx, &keys)
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", wrapErr(err))
+	}
+	return keys, nil
+}
+
+// DeleteArchiveUser records that the archive under key no longer holds
+// anything of the user.
+func (pg *Postgres) DeleteArchiveUser(ctx context.Context, key, userID string) error {
+	_, err := pg.bun.NewDelete().
+		Model((*archiveUser)(nil)).
+		Where("user_id = ?", userID).
+		Where("archive_key = ?", key).
+		Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("delete: %w", wrapErr(err))
+	}
+	return nil
+}
+
+// eraseMessages deletes the messages, or blanks them and hands them to the
+// job's pseudonym along with dropping their mentions.
+func eraseMessages(ctx context.Context, tx bun.Tx, job api.ErasureJob, ids []string) error {
+	if job.Mode == api.ErasureDelete {
+		if _, err := tx.NewDelete().Model((*message)(nil)).Where("id IN (?)", bun.In(ids)).Exec(ctx); err != nil {
+			return fmt.Errorf("delete messages: %w", err)
+		}
+		return nil
+	}
+	_, err := tx.NewUpdate().
+		Model((*message)(nil)).
+		Set("message_text = ''").
+		Set("format = NULL").
+		Set("user_id = ?", job.Pseudonym).
+		Where("id IN (?)", bun.In(ids)).
+		Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("anonymize messages: %w", err)
+	}
+	if _, err := tx.NewDelete().Model((*messageMention)(nil)).Where("message_id IN (?)", bun.In(ids)).Exec(ctx); err != nil {
+		return fmt.Errorf("delete mentions: %w", err)
+	}
+	return nil
+}
+
+// eraseUser deletes the profile, bans and read marker of the job's user, and
+// their blocks, both theirs and those of others on them, and adds the users
+// whose cached profile, blocks, bans or read marker are stale to the batch.
+func eraseUser(ctx context.Context, tx bun.Tx, job api.ErasureJob, batch *api.ErasureBatch) error {
+	if _, err := tx.NewDelete().Model((*userProfile)(nil)).Where("id = ?", job.UserID).Exec(ctx); err != nil {
+		return fmt.Errorf("delete profile: %w", err)
+	}
+	if _, err := tx.NewDelete().Model((*userBan)(nil)).Where("user_id = ?", job.UserID).Exec(ctx); err != nil {
+		return fmt.Errorf("delete bans: %w", err)
+	}
+	if _, err := tx.NewDelete().Model((*readMarker)(nil)).Where("user_id = ?", job.UserID).Exec(ctx); err != nil {
+		return fmt.Errorf("delete read marker: %w", err)
+	}
+	var blockers []string
+	_, err := tx.NewDelete().
+		Model((*userBlock)(nil)).
+		Where("user_id = ? OR blocked_user_id = ?", job.UserID, job.UserID).
+		Returning("user_id").
+		Exec(ctx, &blockers)
+	if err != nil {
+		return fmt.Errorf("delete blocks: %w", err)
+	}
+	batch.UserIDs = uniq(append([]string{job.UserID}, blockers...))
+	return nil
+}
+
+// completeErasureBatch adds the batch to the progress of the job and, if it
+// is the last, completes the job with an audit record. A job completed by
+// another worker meanwhile is left as it is.
+func completeErasureBatch(ctx context.Context, tx bun.Tx, job api.ErasureJob, batch *api.ErasureBatch) error {
+	var j erasureJob
+	q := tx.NewUpdate().
+		Model(&j).
+		Set("messages = messages + ?", batch.Messages).
+		Set("attachments = attachments + ?", batch.Attachments).
+		Set("reactions = reactions + ?", batch.Reactions).
+		Set("updated_at = now()").
+		Where("id = ?", job.ID).
+		Where("status <> ?", api.ErasureDone).
+		Returning("*")
+	if batch.Done {
+		// The pseudonym is forgotten, so nothing ties it to the user.
+		q = q.Set("status = ?", api.ErasureDone).Set("completed_at = now()").Set("pseudonym = NULL")
+	}
+	err := q.Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		batch.Done = true
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("update job: %w", err)
+	}
+	if !batch.Done {
+		return nil
+	}
+	rec := &auditRecord{
+		Action:  "user_data.erased",
+		Actor:   j.RequestedBy,
+		Subject: j.UserID,
+		Details: map[string]any{
+			"erasure_job_id": j.ID,
+			"mode":           j.Mode,
+			"messages":       j.Messages,
+			"attachments":    j.Attachments,
+			"reactions":      j.Reactions,
+			"requested_at":   j.CreatedAt,
+		},
+	}
+	if _, err := tx.NewInsert().Model(rec).Exec(ctx); err != nil {
+		return fmt.Errorf("insert audit record: %w", err)
+	}
+	return nil
+}
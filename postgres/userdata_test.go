@@ -0,0 +1,220 @@
+//go:build integration
+
+package postgres
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+)
+
+func TestPostgres_UserData(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	pg := connect(t)
+	for _, model := range []any{(*erasureJob)(nil), (*auditRecord)(nil)} {
+		if _, err := pg.bun.NewTruncateTable().Model(model).Exec(ctx); err != nil {
+			t.Fatalf("Could not truncate table: %v", err)
+		}
+	}
+	userID := "gdpr-" + time.Now().Format("150405.000000")
+	att, err := pg.InsertAttachment(ctx, api.Attachment{
+		UserID:      userID,
+		FileName:    "cat.png",
+		ContentType: "image/png",
+		Size:        5,
+		Key:         "attachments/" + userID,
+		CreatedAt:   time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := pg.InsertMessage(ctx, api.Message{Text: "look", UserID: userID, Attachments: []api.Attachment{{ID: att.ID}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pg.InsertMessage(ctx, api.Message{Text: "again", UserID: userID}); err != nil {
+		t.Fatal(err)
+	}
+	other, err := pg.InsertMessage(ctx, api.Message{Text: "hello", UserID: "bob", Mentions: []string{userID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pg.InsertUser(ctx, api.User{ID: userID, Name: "Alice"}); err != nil {
+		t.Fatal(err)
+	}
+	blocker := userID + "-blocker"
+	for _, b := range []api.Block{
+		{UserID: userID, BlockedUserID: "bob"},
+		{UserID: blocker, BlockedUserID: userID},
+		{UserID: blocker, BlockedUserID: "bob"},
+	} {
+		if _, _, err := pg.BlockUser(ctx, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := pg.InsertReaction(ctx, api.Reaction{MessageID: other.ID, Type: "like", Score: 1, UserID: userID}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pg.FlagMessage(ctx, api.Flag{MessageID: other.ID, UserID: userID, Reason: "spam"}, 3); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pg.InsertBan(ctx, api.Ban{UserID: userID, Kind: api.BanMute, CreatedBy: "mod"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pg.MarkRead(ctx, userID, other.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	var kinds []string
+	err = pg.ExportUserData(ctx, userID, func(rec api.UserDataRecord) error {
+		if rec.Message != nil {
+			kinds = append(kinds, "message:"+rec.Message.Text)
+			if rec.Message.ID == first.ID && len(rec.Message.Attachments) != 1 {
+				t.Errorf("Got attachments %+v on %q, want cat.png", rec.Message.Attachments, rec.Message.Text)
+			}
+		} else {
+			kinds = append(kinds, "reaction:"+rec.Reaction.Type)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"message:look", "message:again", "reaction:like"}; !slices.Equal(kinds, want) {
+		t.Errorf("Got export %v, want %v", kinds, want)
+	}
+
+	job, err := pg.InsertErasureJob(ctx, api.ErasureJob{UserID: userID, Mode: api.ErasureAnonymize, RequestedBy: "user:" + userID, CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.ID == "" || job.Status != api.ErasurePending {
+		t.Errorf("Got job %+v, want it pending", job)
+	}
+	if job.Pseudonym == "" || strings.Contains(job.Pseudonym, job.ID) {
+		t.Errorf("Got pseudonym %q, want a random one", job.Pseudonym)
+	}
+	if _, err := pg.GetErasureJob(ctx, "not-a-uuid"); !errors.Is(err, api.ErrErasureJobNotFound) {
+		t.Errorf("Got error %v for a malformed ID, want ErrErasureJobNotFound", err)
+	}
+
+	claimed, err := pg.ClaimErasureJobs(ctx, 10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 1 || claimed[0].ID != job.ID || claimed[0].Status != api.ErasureRunning {
+		t.Fatalf("Got claimed %+v, want the job running", claimed)
+	}
+	// The lease keeps others from claiming it.
+	if claimed, err := pg.ClaimErasureJobs(ctx, 10, time.Minute); err != nil || len(claimed) != 0 {
+		t.Errorf("Got claimed %+v, %v, want none while leased", claimed, err)
+	}
+
+	// A batch of one takes a call per row and one to find nothing left.
+	var batches []api.ErasureBatch
+	for range 5 {
+		batch, err := pg.EraseUserData(ctx, job, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		batches = append(batches, batch)
+		if batch.Done {
+			break
+		}
+	}
+	last := batches[len(batches)-1]
+	if !last.Done {
+		t.Fatalf("Got batches %+v, want the last done", batches)
+	}
+	if !slices.Contains(batches[0].BlobKeys, att.Key) {
+		t.Errorf("Got blob keys %v, want %q", batches[0].BlobKeys, att.Key)
+	}
+	if want := []string{userID, blocker}; !slices.Equal(last.UserIDs, want) {
+		t.Errorf("Got users %v to evict, want %v", last.UserIDs, want)
+	}
+
+	got, err := pg.GetErasureJob(ctx, job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != api.ErasureDone || got.CompletedAt == nil || got.Messages != 2 || got.Attachments != 1 || got.Reactions != 1 {
+		t.Errorf("Got job %+v, want done with 2 messages, 1 attachment and 1 reaction", got)
+	}
+	if got.Pseudonym != "" {
+		t.Errorf("Got pseudonym %q on the done job, want it forgotten", got.Pseudonym)
+	}
+	kinds = nil
+	if err := pg.ExportUserData(ctx, userID, func(api.UserDataRecord) error {
+		kinds = append(kinds, "record")
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(kinds) != 0 {
+		t.Errorf("Got %d records after erasure, want none", len(kinds))
+	}
+
+	// The profile, blocks and mentions of the user are gone, but not the
+	// blocks of others on others.
+	if _, err := pg.GetUser(ctx, userID); !errors.Is(err, api.ErrUserNotFound) {
+		t.Errorf("Got error %v getting the erased profile, want ErrUserNotFound", err)
+	}
+	if blocks, err := pg.ListBlocks(ctx, userID); err != nil || len(blocks) != 0 {
+		t.Errorf("Got blocks %+v, %v of the erased user, want none", blocks, err)
+	}
+	if blocks, err := pg.ListBlocks(ctx, blocker); err != nil || len(blocks) != 1 || blocks[0].BlockedUserID != "bob" {
+		t.Errorf("Got blocks %+v, %v of the blocker, want only bob", blocks, err)
+	}
+	if mentions, err := pg.ListMentions(ctx, api.MentionQuery{UserID: userID, Limit: 10}); err != nil || len(mentions) != 0 {
+		t.Errorf("Got mentions %+v, %v of the erased user, want none", mentions, err)
+	}
+	if bans, err := pg.ListBans(ctx, userID); err != nil || len(bans) != 0 {
+		t.Errorf("Got bans %+v, %v of the erased user, want none", bans, err)
+	}
+	if _, err := pg.GetReadMarker(ctx, userID); !errors.Is(err, api.ErrReadMarkerNotFound) {
+		t.Errorf("Got error %v getting the erased read marker, want ErrReadMarkerNotFound", err)
+	}
+	// The flag still counts, under the pseudonym.
+	var flags []messageFlag
+	if err := pg.bun.NewSelect().Model(&flags).Where("message_id = ?", other.ID).Scan(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(flags) != 1 || flags[0].UserID != job.Pseudonym {
+		t.Errorf("Got flags %+v, want one by %q", flags, job.Pseudonym)
+	}
+
+	// The messages stay, blank, under the pseudonym.
+	var anon message
+	if err := pg.bun.NewSelect().Model(&anon).Where("id = ?", first.ID).Scan(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if anon.UserID != job.Pseudonym || anon.MessageText != "" {
+		t.Errorf("Got message by %q with text %q, want it blank by %q", anon.UserID, anon.MessageText, job.Pseudonym)
+	}
+
+	var records []auditRecord
+	if err := pg.bun.NewSelect().Model(&records).Scan(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Action != "user_data.erased" || records[0].Subject != userID {
+		t.Errorf("Got audit records %+v, want one for the erasure", records)
+	}
+	for _, rec := range records {
+		if _, ok := rec.Details["pseudonym"]; ok {
+			t.Errorf("Got audit details %v, want no pseudonym tied to the user", rec.Details)
+		}
+	}
+
+	// Running the done job again changes nothing.
+	batch, err := pg.EraseUserData(ctx, job, 1)
+	if err != nil || !batch.Done {
+		t.Errorf("Got batch %+v, %v, want done", batch, err)
+	}
+}
@@ -0,0 +1,109 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/driver/pgdriver"
+)
+
+// InsertUser inserts a profile, or returns api.ErrUserExists if the user has
+// one.
+func (pg *Postgres) InsertUser(ctx context.Context, user api.User) (api.User, error) {
+	u := &userProfile{
+		ID:        user.ID,
+		Name:      user.Name,
+		AvatarURL: user.AvatarURL,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.CreatedAt,
+	}
+	_, err := pg.bun.NewInsert().Model(u).Returning("*").Exec(ctx)
+	if isUniqueViolation(err) {
+		return api.User{}, api.ErrUserExists
+	}
+	if err != nil {
+		return api.User{}, fmt.Errorf("insert: %w", wrapErr(err))
+	}
+	return u.APIUser(), nil
+}
+
+// GetUser returns the profile of a user, or api.ErrUserNotFound.
+func (pg *Postgres) GetUser(ctx context.Context, id string) (*api.User, error) {
+	var u userProfile
+	err := pg.bun.NewSelect().Model(&u).Where("id = ?", id).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, api.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", wrapErr(err))
+	}
+	user := u.APIUser()
+	return &user, nil
+}
+
+// GetUsers returns the profiles of those users who have one.
+func (pg *Postgres) GetUsers(ctx context.Context, ids []string) ([]api.User, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	var users []userProfile
+	if err := pg.bun.NewSelect().Model(&users).Where("id IN (?)", bun.In(ids)).Scan(ctx); err != nil {
+		return nil, fmt.Errorf("select: %w", wrapErr(err))
+	}
+	out := make([]api.User, len(users))
+	for i, u := range users {
+		out[i] = u.APIUser()
+	}
+	return out, nil
+}
+
+// UpdateUser stores the name and avatar of a profile.
+func (pg *Postgres) UpdateUser(ctx context.Context, user api.User) (api.User, error) {
+	var u userProfile
+	err := pg.bun.NewUpdate().
+		Model(&u).
+		Set("name = ?", user.Name).
+		Set("avatar_url = NULLIF(?, '')", user.AvatarURL).
+		Set("updated_at = now()").
+		Where("id = ?", user.ID).
+		Returning("*").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return api.User{}, api.ErrUserNotFound
+	}
+	if err != nil {
+		return api.User{}, fmt.Errorf("update: %w", wrapErr(err))
+	}
+	return u.APIUser(), nil
+}
+
+// DeactivateUser marks a profile deactivated and returns it.
+func (pg *Postgres) DeactivateUser(ctx context.Context, id string) (*api.User, error) {
+	var u userProfile
+	err := pg.bun.NewUpdate().
+		Model(&u).
+		Set("deactivated = true").
+		Set("updated_at = now()").
+		Where("id = ?", id).
+		Returning("*").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, api.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("update: %w", wrapErr(err))
+	}
+	user := u.APIUser()
+	return &user, nil
+}
+
+// isUniqueViolation reports whether err is Postgres rejecting a duplicate
+// key.
+func isUniqueViolation(err error) bool {
+	var pgErr pgdriver.Error
+	return errors.As(err, &pgErr) && pgErr.Field('C') == "23505"
+}
@@ -0,0 +1,72 @@
+//go:build integration
+
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+)
+
+func TestPostgres_Users(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	pg := connect(t)
+	if _, err := pg.bun.NewTruncateTable().Model((*userProfile)(nil)).Exec(ctx); err != nil {
+		t.Fatalf("Could not truncate table: %v", err)
+	}
+	alice, err := pg.InsertUser(ctx, api.User{ID: "alice", Name: "Alice", CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alice.CreatedAt.IsZero() || alice.Deactivated {
+		t.Errorf("Got user %+v, want it stored", alice)
+	}
+	if _, err := pg.InsertUser(ctx, api.User{ID: "alice", Name: "Other"}); !errors.Is(err, api.ErrUserExists) {
+		t.Errorf("Got %v inserting alice again, want ErrUserExists", err)
+	}
+	if _, err := pg.InsertUser(ctx, api.User{ID: "bob", Name: "Bob", AvatarURL: "https://example.com/b.png"}); err != nil {
+		t.Fatal(err)
+	}
+
+	users, err := pg.GetUsers(ctx, []string{"alice", "bob", "carol"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 {
+		t.Errorf("Got users %+v, want alice and bob", users)
+	}
+
+	alice.AvatarURL = "https://example.com/a.png"
+	updated, err := pg.UpdateUser(ctx, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.AvatarURL != alice.AvatarURL || updated.Name != "Alice" {
+		t.Errorf("Got updated user %+v", updated)
+	}
+	if _, err := pg.DeactivateUser(ctx, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := pg.GetUser(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Deactivated {
+		t.Errorf("Got user %+v, want it deactivated", got)
+	}
+
+	if _, err := pg.GetUser(ctx, "carol"); !errors.Is(err, api.ErrUserNotFound) {
+		t.Errorf("Got %v for carol, want ErrUserNotFound", err)
+	}
+	if _, err := pg.UpdateUser(ctx, api.User{ID: "carol"}); !errors.Is(err, api.ErrUserNotFound) {
+		t.Errorf("Got %v updating carol, want ErrUserNotFound", err)
+	}
+	if _, err := pg.DeactivateUser(ctx, "carol"); !errors.Is(err, api.ErrUserNotFound) {
+		t.Errorf("Got %v deactivating carol, want ErrUserNotFound", err)
+	}
+}
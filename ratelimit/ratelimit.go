@@ -0,0 +1,122 @@
+// Package ratelimit provides an in-memory token bucket rate limiter and a
+// limiter that falls back to it while the shared one is unavailable.
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+)
+
+// sweepEvery is how many calls to Allow a Memory limiter handles between
+// sweeps for idle buckets.
+const sweepEvery = 1000
+
+// Memory is a token bucket rate limiter local to the process. Each key has a
+// bucket holding up to limit.Requests tokens that refills at
+// limit.Requests per limit.Window; a request takes a token.
+type Memory struct {
+	now func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	calls   int
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	window time.Duration // refill time from empty, for sweeping
+}
+
+// NewMemory returns an empty in-memory limiter.
+func NewMemory() *Memory {
+	return &Memory{
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow takes a request from the bucket for key.
+func (m *Memory) Allow(_ context.Context, key string, limit api.RateLimit) (api.RateLimitResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.calls++
+	if m.calls%sweepEvery == 0 {
+		m.sweep(now)
+	}
+
+	capacity := float64(limit.Requests)
+	rate := capacity / float64(limit.Window) // tokens per nanosecond
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, last: now}
+		m.buckets[key] = b
+	}
+	b.tokens = math.Min(capacity, b.tokens+float64(now.Sub(b.last))*rate)
+	b.last = now
+	b.window = limit.Window
+
+	var res api.RateLimitResult
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration(math.Ceil((1 - b.tokens) / rate))
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = time.Duration(math.Ceil((capacity - b.tokens) / rate))
+	return res, nil
+}
+
+// sweep drops buckets that have been idle long enough to be full again;
+// a new bucket starts out full, so they carry no state.
+func (m *Memory) sweep(now time.Time) {
+	for key, b := range m.buckets {
+		if now.Sub(b.last) >= b.window {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+// Fallback uses a shared limiter, normally Redis, and switches to an
+// in-memory one for calls where it fails. Limits are then enforced per
+// process rather than across all of them, which is better than none.
+type Fallback struct {
+	primary  api.RateLimiter
+	fallback *Memory
+	logger   *slog.Logger
+	failing  atomic.Bool
+}
+
+// NewFallback returns a limiter that uses primary while it works.
+func NewFallback(primary api.RateLimiter, logger *slog.Logger) *Fallback {
+	return &Fallback{
+		primary:  primary,
+		fallback: NewMemory(),
+		logger:   logger,
+	}
+}
+
+// Allow takes a request from the primary limiter, or from the in-memory one
+// if the primary fails.
+func (f *Fallback) Allow(ctx context.Context, key string, limit api.RateLimit) (api.RateLimitResult, error) {
+	res, err := f.primary.Allow(ctx, key, limit)
+	if err == nil {
+		if f.failing.CompareAndSwap(true, false) {
+			f.logger.Info("Rate limiter recovered")
+		}
+		return res, nil
+	}
+	if f.failing.CompareAndSwap(false, true) {
+		f.logger.Warn("Rate limiter unavailable, limiting in memory", "error", err.Error())
+	}
+	return f.fallback.Allow(ctx, key, limit)
+}
@@ -0,0 +1,112 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+	"github.com/neilotoole/slogt"
+)
+
+func TestMemory_Allow(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := NewMemory()
+	m.now = func() time.Time { return now }
+	limit := api.RateLimit{Requests: 3, Window: 3 * time.Second}
+	allow := func() api.RateLimitResult {
+		t.Helper()
+		res, err := m.Allow(context.Background(), "k", limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	// A full bucket allows a burst of Requests.
+	for i := 2; i >= 0; i-- {
+		res := allow()
+		if !res.Allowed || res.Remaining != i {
+			t.Fatalf("Got %+v, want allowed with %d remaining", res, i)
+		}
+	}
+	res := allow()
+	if res.Allowed {
+		t.Fatal("Request over the limit allowed")
+	}
+	if res.RetryAfter != time.Second {
+		t.Errorf("Got RetryAfter %s, want 1s", res.RetryAfter)
+	}
+	if res.Reset != 3*time.Second {
+		t.Errorf("Got Reset %s, want 3s", res.Reset)
+	}
+
+	// Tokens refill at Requests per Window.
+	now = now.Add(time.Second)
+	if res := allow(); !res.Allowed {
+		t.Errorf("Got %+v after refill, want allowed", res)
+	}
+	if res := allow(); res.Allowed {
+		t.Errorf("Got %+v, want only one token refilled", res)
+	}
+
+	// Other keys have their own bucket.
+	if res, _ := m.Allow(context.Background(), "other", limit); !res.Allowed {
+		t.Error("Request for other key not allowed")
+	}
+}
+
+func TestMemory_sweep(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := NewMemory()
+	m.now = func() time.Time { return now }
+	limit := api.RateLimit{Requests: 1, Window: time.Second}
+
+	m.Allow(context.Background(), "idle", limit)
+	now = now.Add(time.Second)
+	for range sweepEvery - 1 {
+		m.Allow(context.Background(), "busy", limit)
+	}
+	if _, ok := m.buckets["idle"]; ok {
+		t.Error("Idle bucket was not swept")
+	}
+	if _, ok := m.buckets["busy"]; !ok {
+		t.Error("Busy bucket was swept")
+	}
+}
+
+func TestFallback(t *testing.T) {
+	primary := &testlimiter{}
+	f := NewFallback(primary, slogt.New(t))
+	limit := api.RateLimit{Requests: 1, Window: time.Hour}
+
+	primary.err = errors.New("connection refused")
+	if res, err := f.Allow(context.Background(), "k", limit); err != nil || !res.Allowed {
+		t.Fatalf("Got %+v, %v, want allowed by fallback", res, err)
+	}
+	if res, _ := f.Allow(context.Background(), "k", limit); res.Allowed {
+		t.Error("Fallback does not enforce the limit")
+	}
+
+	primary.err = nil
+	if res, _ := f.Allow(context.Background(), "k", limit); !res.Allowed {
+		t.Error("Recovered primary not used")
+	}
+	if primary.calls != 3 {
+		t.Errorf("Primary called %d times, want 3", primary.calls)
+	}
+}
+
+type testlimiter struct {
+	err   error
+	calls int
+}
+
+func (l *testlimiter) Allow(context.Context, string, api.RateLimit) (api.RateLimitResult, error) {
+	l.calls++
+	if l.err != nil {
+		return api.RateLimitResult{}, l.err
+	}
+	return api.RateLimitResult{Allowed: true}, nil
+}
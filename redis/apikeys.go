@@ -0,0 +1,56 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	apiKeyPrefix = "apikeys"
+	// apiKeyTTL bounds how long a key stays usable after it was revoked if
+	// evicting it from the cache failed.
+	apiKeyTTL = 5 * time.Minute
+)
+
+// GetAPIKey returns the cached API key with the given hash, or
+// api.ErrAPIKeyNotFoundInCache.
+func (r *Redis) GetAPIKey(ctx context.Context, hash string) (*api.APIKey, error) {
+	b, err := r.cli.Get(ctx, apiKeyPrefix+":"+hash).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, api.ErrAPIKeyNotFoundInCache
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get: %w", err)
+	}
+	var key api.APIKey
+	if err := json.Unmarshal(b, &key); err != nil {
+		return nil, fmt.Errorf("unmarshal: %w", err)
+	}
+	return &key, nil
+}
+
+// SetAPIKey caches the API key by its hash for a few minutes.
+func (r *Redis) SetAPIKey(ctx context.Context, key api.APIKey) error {
+	b, err := json.Marshal(key)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+	if err := r.cli.Set(ctx, apiKeyPrefix+":"+key.Hash, b, apiKeyTTL).Err(); err != nil {
+		return fmt.Errorf("set: %w", err)
+	}
+	return nil
+}
+
+// DeleteAPIKey removes the API key with the given hash from the cache.
+func (r *Redis) DeleteAPIKey(ctx context.Context, hash string) error {
+	if err := r.cli.Del(ctx, apiKeyPrefix+":"+hash).Err(); err != nil {
+		return fmt.Errorf("del: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+//go:build integration
+
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRedis_APIKey(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	r := connect(t)
+	if _, err := r.GetAPIKey(ctx, "abc"); !errors.Is(err, api.ErrAPIKeyNotFoundInCache) {
+		t.Fatalf("Got %v for missing key, want ErrAPIKeyNotFoundInCache", err)
+	}
+
+	expires := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	key := api.APIKey{
+		ID:        "1",
+		Name:      "billing",
+		Prefix:    "sk_0123456",
+		Hash:      "abc",
+		Scopes:    []string{api.ScopeMessagesWrite},
+		CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		ExpiresAt: &expires,
+	}
+	if err := r.SetAPIKey(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	got, err := r.GetAPIKey(ctx, "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(key, *got); diff != "" {
+		t.Errorf("GetAPIKey() mismatch (-want +got):\n%s", diff)
+	}
+	if ttl := r.cli.TTL(ctx, "apikeys:abc").Val(); ttl <= 0 || ttl > apiKeyTTL {
+		t.Errorf("Got TTL %s, want up to %s", ttl, apiKeyTTL)
+	}
+
+	if err := r.DeleteAPIKey(ctx, "abc"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.GetAPIKey(ctx, "abc"); !errors.Is(err, api.ErrAPIKeyNotFoundInCache) {
+		t.Errorf("Got %v for deleted key, want ErrAPIKeyNotFoundInCache", err)
+	}
+}
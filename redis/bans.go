@@ -0,0 +1,60 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	banPrefix = "bans"
+	// banTTL bounds how long a change to a user's bans goes unnoticed if
+	// evicting them from the cache failed.
+	banTTL = 5 * time.Minute
+)
+
+// GetBans returns the cached active bans of a user, which are empty for most
+// users, or api.ErrBansNotFoundInCache.
+func (r *Redis) GetBans(ctx context.Context, userID string) ([]api.Ban, error) {
+	b, err := r.cli.Get(ctx, banPrefix+":"+userID).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, api.ErrBansNotFoundInCache
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get: %w", err)
+	}
+	var bans []api.Ban
+	if err := json.Unmarshal(b, &bans); err != nil {
+		return nil, fmt.Errorf("unmarshal: %w", err)
+	}
+	return bans, nil
+}
+
+// SetBans caches the active bans of a user for a few minutes. Caching that a
+// user has none keeps checking them from reaching the database.
+func (r *Redis) SetBans(ctx context.Context, userID string, bans []api.Ban) error {
+	if bans == nil {
+		bans = []api.Ban{}
+	}
+	b, err := json.Marshal(bans)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+	if err := r.cli.Set(ctx, banPrefix+":"+userID, b, banTTL).Err(); err != nil {
+		return fmt.Errorf("set: %w", err)
+	}
+	return nil
+}
+
+// DeleteBans removes the bans of a user from the cache.
+func (r *Redis) DeleteBans(ctx context.Context, userID string) error {
+	if err := r.cli.Del(ctx, banPrefix+":"+userID).Err(); err != nil {
+		return fmt.Errorf("del: %w", err)
+	}
+	return nil
+}
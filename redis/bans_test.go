@@ -0,0 +1,62 @@
+//go:build integration
+
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRedis_Bans(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	r := connect(t)
+	if _, err := r.GetBans(ctx, "spammer"); !errors.Is(err, api.ErrBansNotFoundInCache) {
+		t.Fatalf("Got %v for missing bans, want ErrBansNotFoundInCache", err)
+	}
+
+	// Having no bans is cached too.
+	if err := r.SetBans(ctx, "alice", nil); err != nil {
+		t.Fatal(err)
+	}
+	if bans, err := r.GetBans(ctx, "alice"); err != nil || len(bans) != 0 {
+		t.Errorf("Got bans %+v, %v, want none cached", bans, err)
+	}
+
+	expires := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	bans := []api.Ban{{
+		ID:        "1",
+		UserID:    "spammer",
+		Kind:      api.BanMute,
+		Reason:    "spam",
+		CreatedBy: "mod",
+		CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		ExpiresAt: &expires,
+	}}
+	if err := r.SetBans(ctx, "spammer", bans); err != nil {
+		t.Fatal(err)
+	}
+	got, err := r.GetBans(ctx, "spammer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(bans, got); diff != "" {
+		t.Errorf("GetBans() mismatch (-want +got):\n%s", diff)
+	}
+	if ttl := r.cli.TTL(ctx, "bans:spammer").Val(); ttl <= 0 || ttl > banTTL {
+		t.Errorf("Got TTL %s, want up to %s", ttl, banTTL)
+	}
+
+	if err := r.DeleteBans(ctx, "spammer"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.GetBans(ctx, "spammer"); !errors.Is(err, api.ErrBansNotFoundInCache) {
+		t.Errorf("Got %v for deleted bans, want ErrBansNotFoundInCache", err)
+	}
+}
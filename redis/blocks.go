@@ -0,0 +1,60 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	blockPrefix = "blocks"
+	// blockTTL bounds how long a change to a user's blocks goes unnoticed if
+	// evicting them from the cache failed.
+	blockTTL = 5 * time.Minute
+)
+
+// GetBlockedUsers returns the cached IDs of the users a user blocked, or
+// api.ErrBlocksNotFoundInCache.
+func (r *Redis) GetBlockedUsers(ctx context.Context, userID string) ([]string, error) {
+	b, err := r.cli.Get(ctx, blockPrefix+":"+userID).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, api.ErrBlocksNotFoundInCache
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get: %w", err)
+	}
+	var blocked []string
+	if err := json.Unmarshal(b, &blocked); err != nil {
+		return nil, fmt.Errorf("unmarshal: %w", err)
+	}
+	return blocked, nil
+}
+
+// SetBlockedUsers caches the IDs of the users a user blocked for a few
+// minutes, including that they blocked nobody.
+func (r *Redis) SetBlockedUsers(ctx context.Context, userID string, blocked []string) error {
+	if blocked == nil {
+		blocked = []string{}
+	}
+	b, err := json.Marshal(blocked)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+	if err := r.cli.Set(ctx, blockPrefix+":"+userID, b, blockTTL).Err(); err != nil {
+		return fmt.Errorf("set: %w", err)
+	}
+	return nil
+}
+
+// DeleteBlockedUsers removes the blocked users of a user from the cache.
+func (r *Redis) DeleteBlockedUsers(ctx context.Context, userID string) error {
+	if err := r.cli.Del(ctx, blockPrefix+":"+userID).Err(); err != nil {
+		return fmt.Errorf("del: %w", err)
+	}
+	return nil
+}
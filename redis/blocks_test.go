@@ -0,0 +1,52 @@
+//go:build integration
+
+package redis
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+)
+
+func TestRedis_BlockedUsers(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	r := connect(t)
+	if _, err := r.GetBlockedUsers(ctx, "alice"); !errors.Is(err, api.ErrBlocksNotFoundInCache) {
+		t.Fatalf("Got %v for missing blocks, want ErrBlocksNotFoundInCache", err)
+	}
+
+	// Blocking nobody is cached too.
+	if err := r.SetBlockedUsers(ctx, "bob", nil); err != nil {
+		t.Fatal(err)
+	}
+	if blocked, err := r.GetBlockedUsers(ctx, "bob"); err != nil || len(blocked) != 0 {
+		t.Errorf("Got blocked users %v, %v, want none cached", blocked, err)
+	}
+
+	if err := r.SetBlockedUsers(ctx, "alice", []string{"troll", "spammer"}); err != nil {
+		t.Fatal(err)
+	}
+	blocked, err := r.GetBlockedUsers(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(blocked, []string{"troll", "spammer"}) {
+		t.Errorf("Got blocked users %v, want troll and spammer", blocked)
+	}
+	if ttl := r.cli.TTL(ctx, "blocks:alice").Val(); ttl <= 0 || ttl > blockTTL {
+		t.Errorf("Got TTL %s, want up to %s", ttl, blockTTL)
+	}
+
+	if err := r.DeleteBlockedUsers(ctx, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.GetBlockedUsers(ctx, "alice"); !errors.Is(err, api.ErrBlocksNotFoundInCache) {
+		t.Errorf("Got %v for deleted blocks, want ErrBlocksNotFoundInCache", err)
+	}
+}
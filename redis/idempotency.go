@@ -0,0 +1,71 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+	"github.com/redis/go-redis/v9"
+)
+
+const idempotencyPrefix = "idempotency"
+
+// Reserve stores an in-flight record for key unless one exists, in which case
+// that one is returned. Checking and setting is a single SET NX GET, so of
+// concurrent requests with the same key exactly one gets to reserve it.
+func (r *Redis) Reserve(ctx context.Context, key, fingerprint string, ttl time.Duration) (*api.IdempotencyRecord, error) {
+	b, err := json.Marshal(idempotencyRecord{Fingerprint: fingerprint})
+	if err != nil {
+		return nil, fmt.Errorf("marshal: %w", err)
+	}
+	prev, err := r.cli.SetArgs(ctx, idempotencyPrefix+":"+key, b, redis.SetArgs{
+		Mode: "NX",
+		Get:  true,
+		TTL:  ttl,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("set: %w", err)
+	}
+
+	var rec idempotencyRecord
+	if err := json.Unmarshal([]byte(prev), &rec); err != nil {
+		return nil, fmt.Errorf("unmarshal: %w", err)
+	}
+	return &api.IdempotencyRecord{
+		Fingerprint: rec.Fingerprint,
+		Status:      rec.Status,
+		Header:      rec.Header,
+		Body:        rec.Body,
+	}, nil
+}
+
+// Save stores the completed record for key, replacing the in-flight one.
+func (r *Redis) Save(ctx context.Context, key string, rec api.IdempotencyRecord, ttl time.Duration) error {
+	b, err := json.Marshal(idempotencyRecord{
+		Fingerprint: rec.Fingerprint,
+		Status:      rec.Status,
+		Header:      rec.Header,
+		Body:        rec.Body,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+	if err := r.cli.Set(ctx, idempotencyPrefix+":"+key, b, ttl).Err(); err != nil {
+		return fmt.Errorf("set: %w", err)
+	}
+	return nil
+}
+
+// Release removes the record for key so the request can be retried.
+func (r *Redis) Release(ctx context.Context, key string) error {
+	if err := r.cli.Del(ctx, idempotencyPrefix+":"+key).Err(); err != nil {
+		return fmt.Errorf("del: %w", err)
+	}
+	return nil
+}
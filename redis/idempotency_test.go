@@ -0,0 +1,61 @@
+//go:build integration
+
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRedis_Idempotency(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	r := connect(t)
+	prev, err := r.Reserve(ctx, "k", "abc", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prev != nil {
+		t.Fatalf("Reserved a new key, got existing record %+v", prev)
+	}
+
+	prev, err = r.Reserve(ctx, "k", "def", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(&api.IdempotencyRecord{Fingerprint: "abc"}, prev); diff != "" {
+		t.Errorf("Reserve() of an in-flight key mismatch (-want +got):\n%s", diff)
+	}
+
+	rec := api.IdempotencyRecord{
+		Fingerprint: "abc",
+		Status:      201,
+		Header:      map[string]string{"Content-Type": "application/json"},
+		Body:        []byte(`{"id": "1"}`),
+	}
+	if err := r.Save(ctx, "k", rec, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	prev, err = r.Reserve(ctx, "k", "abc", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(&rec, prev); diff != "" {
+		t.Errorf("Reserve() of a completed key mismatch (-want +got):\n%s", diff)
+	}
+	if ttl := r.cli.TTL(ctx, "idempotency:k").Val(); ttl <= time.Minute {
+		t.Errorf("Got TTL %s, want the TTL passed to Save", ttl)
+	}
+
+	if err := r.Release(ctx, "k"); err != nil {
+		t.Fatal(err)
+	}
+	if prev, err := r.Reserve(ctx, "k", "abc", time.Minute); err != nil || prev != nil {
+		t.Errorf("Got %+v, %v after release, want the key reserved again", prev, err)
+	}
+}
@@ -0,0 +1,37 @@
+package redis
+
+import (
+	"context"
+	"errors"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+	"github.com/redis/go-redis/v9"
+)
+
+// A logHook logs failed commands with the logger from the command's
+// context, so they can be tied back to the request that made them.
+type logHook struct{}
+
+func (logHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (logHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		err := next(ctx, cmd)
+		if err != nil && !errors.Is(err, redis.Nil) {
+			api.LoggerFrom(ctx).Warn("Redis command failed", "command", cmd.Name(), "error", err.Error())
+		}
+		return err
+	}
+}
+
+func (logHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		err := next(ctx, cmds)
+		if err != nil && !errors.Is(err, redis.Nil) {
+			api.LoggerFrom(ctx).Warn("Redis pipeline failed", "commands", len(cmds), "error", err.Error())
+		}
+		return err
+	}
+}
@@ -11,15 +11,19 @@ import (
 type message struct {
 	ID                    string    `redis:"id" json:"id"`
 	Text                  string    `redis:"text" json:"text"`
+	Format                string    `redis:"format" json:"format"`
 	UserID                string    `redis:"user_id" json:"user_id"`
 	CreatedAt             time.Time `redis:"created_at" json:"created_at"`
 	MessageReactionCounts string    `redis:"message_reaction_counts" json:"message_reaction_counts"`
+	Attachments           string    `redis:"attachments" json:"attachments"`
+	Mentions              string    `redis:"mentions" json:"mentions"`
 }
 
 func (m message) APIMessage() (api.Message, error) {
 	am := api.Message{
 		ID:        m.ID,
 		Text:      m.Text,
+		Format:    m.Format,
 		UserID:    m.UserID,
 		CreatedAt: m.CreatedAt,
 	}
@@ -29,5 +33,56 @@ func (m message) APIMessage() (api.Message, error) {
 			return api.Message{}, err
 		}
 	}
+	if m.Attachments != "" {
+		if err := json.Unmarshal([]byte(m.Attachments), &am.Attachments); err != nil {
+			return api.Message{}, err
+		}
+	}
+	if m.Mentions != "" {
+		if err := json.Unmarshal([]byte(m.Mentions), &am.Mentions); err != nil {
+			return api.Message{}, err
+		}
+	}
 	return am, nil
 }
+
+// A queuedWrite is the payload of an entry in the write queue stream.
+type queuedWrite struct {
+	Message  *api.Message  `json:"message,omitempty"`
+	Reaction *api.Reaction `json:"reaction,omitempty"`
+}
+
+// An idempotencyRecord is the stored outcome of a request made with an
+// idempotency key.
+type idempotencyRecord struct {
+	Fingerprint string            `json:"fingerprint"`
+	Status      int               `json:"status,omitempty"`
+	Header      map[string]string `json:"header,omitempty"`
+	Body        []byte            `json:"body,omitempty"`
+}
+
+// A pin is a member of the pins sorted set.
+type pin struct {
+	MessageID string    `json:"message_id"`
+	Text      string    `json:"text"`
+	Format    string    `json:"format,omitempty"`
+	UserID    string    `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+	PinnedBy  string    `json:"pinned_by"`
+	PinnedAt  time.Time `json:"pinned_at"`
+}
+
+func (p pin) APIPin() api.Pin {
+	return api.Pin{
+		Message: api.Message{
+			ID:        p.MessageID,
+			Text:      p.Text,
+			Format:    p.Format,
+			UserID:    p.UserID,
+			CreatedAt: p.CreatedAt,
+			Pinned:    true,
+		},
+		PinnedBy: p.PinnedBy,
+		PinnedAt: p.PinnedAt,
+	}
+}
@@ -0,0 +1,86 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// pinsKey holds the pins in a sorted set scored by when they were pinned.
+	pinsKey = "pins"
+	// pinsCachedKey is set along with the pins, as an empty set doesn't
+	// exist in Redis but no pins is worth caching.
+	pinsCachedKey = "pins:cached"
+	// pinsTTL bounds how long the pins are stale if refreshing them after a
+	// change failed.
+	pinsTTL = 10 * time.Minute
+)
+
+// ListPins returns the cached pins, most recently pinned first, or
+// api.ErrPinsNotFoundInCache.
+func (r *Redis) ListPins(ctx context.Context) ([]api.Pin, error) {
+	var (
+		cached  *redis.IntCmd
+		members *redis.StringSliceCmd
+	)
+	_, err := r.cli.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		cached = pipe.Exists(ctx, pinsCachedKey)
+		members = pipe.ZRevRange(ctx, pinsKey, 0, -1)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list pins: %w", err)
+	}
+	if cached.Val() == 0 {
+		return nil, api.ErrPinsNotFoundInCache
+	}
+
+	out := make([]api.Pin, len(members.Val()))
+	for i, member := range members.Val() {
+		var p pin
+		if err := json.Unmarshal([]byte(member), &p); err != nil {
+			return nil, fmt.Errorf("unmarshal: %w", err)
+		}
+		out[i] = p.APIPin()
+	}
+	return out, nil
+}
+
+// SetPins replaces the cached pins.
+func (r *Redis) SetPins(ctx context.Context, pins []api.Pin) error {
+	members := make([]redis.Z, len(pins))
+	for i, p := range pins {
+		b, err := json.Marshal(pin{
+			MessageID: p.Message.ID,
+			Text:      p.Message.Text,
+			Format:    p.Message.Format,
+			UserID:    p.Message.UserID,
+			CreatedAt: p.Message.CreatedAt,
+			PinnedBy:  p.PinnedBy,
+			PinnedAt:  p.PinnedAt,
+		})
+		if err != nil {
+			return fmt.Errorf("marshal: %w", err)
+		}
+		members[i] = redis.Z{Score: float64(p.PinnedAt.UnixNano()), Member: b}
+	}
+
+	_, err := r.cli.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, pinsKey)
+		if len(members) > 0 {
+			pipe.ZAdd(ctx, pinsKey, members...)
+			pipe.Expire(ctx, pinsKey, pinsTTL)
+		}
+		pipe.Set(ctx, pinsCachedKey, 1, pinsTTL)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("set pins: %w", err)
+	}
+	return nil
+}
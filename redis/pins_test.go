@@ -0,0 +1,61 @@
+//go:build integration
+
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRedis_Pins(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	r := connect(t)
+	r.cli.Del(ctx, pinsKey, pinsCachedKey)
+	if _, err := r.ListPins(ctx); !errors.Is(err, api.ErrPinsNotFoundInCache) {
+		t.Fatalf("Got %v before caching, want ErrPinsNotFoundInCache", err)
+	}
+
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	pins := []api.Pin{
+		{
+			Message:  api.Message{ID: "2", Text: "world", UserID: "alice", CreatedAt: created, Pinned: true},
+			PinnedBy: "bob",
+			PinnedAt: created.Add(2 * time.Hour),
+		},
+		{
+			Message:  api.Message{ID: "1", Text: "hello", UserID: "alice", CreatedAt: created, Pinned: true},
+			PinnedBy: "bob",
+			PinnedAt: created.Add(time.Hour),
+		},
+	}
+	// Out of order, to check they are sorted.
+	if err := r.SetPins(ctx, []api.Pin{pins[1], pins[0]}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := r.ListPins(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(pins, got); diff != "" {
+		t.Errorf("ListPins() mismatch (-want +got):\n%s", diff)
+	}
+
+	// No pins are cached too.
+	if err := r.SetPins(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	got, err = r.ListPins(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("Got %d pins, want none", len(got))
+	}
+}
@@ -0,0 +1,64 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+	"github.com/redis/go-redis/v9"
+)
+
+const queueStream = "queue"
+
+// Enqueue appends the write to a Redis stream. Entries survive a restart as
+// long as Redis itself is configured with persistence (AOF or RDB).
+func (r *Redis) Enqueue(ctx context.Context, w api.QueuedWrite) error {
+	b, err := json.Marshal(queuedWrite{
+		Message:  w.Message,
+		Reaction: w.Reaction,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+	err = r.cli.XAdd(ctx, &redis.XAddArgs{
+		Stream: queueStream,
+		Values: map[string]any{"write": string(b)},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("xadd: %w", err)
+	}
+	return nil
+}
+
+// Pending returns up to count of the oldest writes in the queue, oldest
+// first.
+func (r *Redis) Pending(ctx context.Context, count int) ([]api.QueuedWrite, error) {
+	vals, err := r.cli.XRangeN(ctx, queueStream, "-", "+", int64(count)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("xrange: %w", err)
+	}
+
+	out := make([]api.QueuedWrite, len(vals))
+	for i, val := range vals {
+		s, _ := val.Values["write"].(string)
+		var w queuedWrite
+		if err := json.Unmarshal([]byte(s), &w); err != nil {
+			return nil, fmt.Errorf("unmarshal %s: %w", val.ID, err)
+		}
+		out[i] = api.QueuedWrite{
+			ID:       val.ID,
+			Message:  w.Message,
+			Reaction: w.Reaction,
+		}
+	}
+	return out, nil
+}
+
+// Ack removes a replayed write from the queue.
+func (r *Redis) Ack(ctx context.Context, id string) error {
+	if err := r.cli.XDel(ctx, queueStream, id).Err(); err != nil {
+		return fmt.Errorf("xdel: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+//go:build integration
+
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+)
+
+func TestRedis_Queue(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	r := connect(t)
+	writes := []api.QueuedWrite{
+		{Message: &api.Message{ID: "m1", Text: "hello", UserID: "test"}},
+		{Reaction: &api.Reaction{ID: "r1", MessageID: "m1", Type: "like", UserID: "test"}},
+	}
+	for _, w := range writes {
+		if err := r.Enqueue(ctx, w); err != nil {
+			t.Fatalf("Enqueue failed: %v", err)
+		}
+	}
+
+	got, err := r.Pending(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("Got %d pending writes, want 2", len(got))
+	}
+	if got[0].Message == nil || got[0].Message.ID != "m1" {
+		t.Errorf("First write is %+v, want message m1", got[0])
+	}
+	if got[1].Reaction == nil || got[1].Reaction.ID != "r1" {
+		t.Errorf("Second write is %+v, want reaction r1", got[1])
+	}
+
+	if err := r.Ack(ctx, got[0].ID); err != nil {
+		t.Fatalf("Ack failed: %v", err)
+	}
+	got, err = r.Pending(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Reaction == nil {
+		t.Errorf("Got %+v after ack, want only the reaction", got)
+	}
+}
@@ -0,0 +1,66 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+	"github.com/redis/go-redis/v9"
+)
+
+const rateLimitPrefix = "ratelimit"
+
+// tokenBucket takes a token from the bucket at KEYS[1], which holds up to
+// ARGV[1] tokens and refills completely in ARGV[2] milliseconds. The bucket
+// is read and updated in one step, using the server's clock, so concurrent
+// requests from all instances are counted exactly once. It returns whether
+// the request is allowed, the tokens left and the milliseconds until the next
+// token and until the bucket is full.
+var tokenBucket = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local rate = capacity / window
+
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local b = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(b[1]) or capacity
+local ts = tonumber(b[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate)
+
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+else
+  retry = math.ceil((1 - tokens) / rate)
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], window)
+return {allowed, math.floor(tokens), retry, math.ceil((capacity - tokens) / rate)}
+`)
+
+// Allow takes a request from the token bucket for key. Buckets expire once
+// they would be full again.
+func (r *Redis) Allow(ctx context.Context, key string, limit api.RateLimit) (api.RateLimitResult, error) {
+	vals, err := tokenBucket.Run(ctx, r.cli,
+		[]string{rateLimitPrefix + ":" + key},
+		limit.Requests, limit.Window.Milliseconds(),
+	).Int64Slice()
+	if err != nil {
+		return api.RateLimitResult{}, fmt.Errorf("token bucket: %w", err)
+	}
+	if len(vals) != 4 {
+		return api.RateLimitResult{}, fmt.Errorf("token bucket: got %d values, want 4", len(vals))
+	}
+	return api.RateLimitResult{
+		Allowed:    vals[0] == 1,
+		Remaining:  int(vals[1]),
+		RetryAfter: time.Duration(vals[2]) * time.Millisecond,
+		Reset:      time.Duration(vals[3]) * time.Millisecond,
+	}, nil
+}
@@ -0,0 +1,46 @@
+//go:build integration
+
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+)
+
+func TestRedis_Allow(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	r := connect(t)
+	limit := api.RateLimit{Requests: 2, Window: time.Minute}
+	for i := 1; i >= 0; i-- {
+		res, err := r.Allow(ctx, "test", limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.Allowed || res.Remaining != i {
+			t.Fatalf("Got %+v, want allowed with %d remaining", res, i)
+		}
+	}
+
+	res, err := r.Allow(ctx, "test", limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Allowed {
+		t.Fatal("Request over the limit allowed")
+	}
+	if res.RetryAfter <= 0 || res.RetryAfter > 30*time.Second {
+		t.Errorf("Got RetryAfter %s, want up to 30s", res.RetryAfter)
+	}
+	if ttl := r.cli.PTTL(ctx, "ratelimit:test").Val(); ttl <= 0 || ttl > time.Minute {
+		t.Errorf("Got TTL %s, want up to a minute", ttl)
+	}
+
+	if res, _ := r.Allow(ctx, "other", limit); !res.Allowed {
+		t.Error("Request for other key not allowed")
+	}
+}
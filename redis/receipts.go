@@ -0,0 +1,56 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	readMarkerPrefix = "readmarkers"
+	// readMarkerTTL bounds how long a marker stays behind the database if
+	// caching a newer one failed.
+	readMarkerTTL = 10 * time.Minute
+)
+
+// GetReadMarker returns the cached read marker of a user, or
+// api.ErrReadMarkerNotFoundInCache.
+func (r *Redis) GetReadMarker(ctx context.Context, userID string) (*api.ReadMarker, error) {
+	b, err := r.cli.Get(ctx, readMarkerPrefix+":"+userID).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, api.ErrReadMarkerNotFoundInCache
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get: %w", err)
+	}
+	var marker api.ReadMarker
+	if err := json.Unmarshal(b, &marker); err != nil {
+		return nil, fmt.Errorf("unmarshal: %w", err)
+	}
+	return &marker, nil
+}
+
+// SetReadMarker caches the read marker of a user for a few minutes.
+func (r *Redis) SetReadMarker(ctx context.Context, marker api.ReadMarker) error {
+	b, err := json.Marshal(marker)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+	if err := r.cli.Set(ctx, readMarkerPrefix+":"+marker.UserID, b, readMarkerTTL).Err(); err != nil {
+		return fmt.Errorf("set: %w", err)
+	}
+	return nil
+}
+
+// DeleteReadMarker removes the read marker of a user from the cache.
+func (r *Redis) DeleteReadMarker(ctx context.Context, userID string) error {
+	if err := r.cli.Del(ctx, readMarkerPrefix+":"+userID).Err(); err != nil {
+		return fmt.Errorf("del: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+//go:build integration
+
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRedis_ReadMarker(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	r := connect(t)
+	if _, err := r.GetReadMarker(ctx, "alice"); !errors.Is(err, api.ErrReadMarkerNotFoundInCache) {
+		t.Fatalf("Got %v for missing marker, want ErrReadMarkerNotFoundInCache", err)
+	}
+
+	marker := api.ReadMarker{
+		UserID:           "alice",
+		MessageID:        "1",
+		MessageCreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		UpdatedAt:        time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+	}
+	if err := r.SetReadMarker(ctx, marker); err != nil {
+		t.Fatal(err)
+	}
+	got, err := r.GetReadMarker(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(&marker, got); diff != "" {
+		t.Errorf("GetReadMarker() mismatch (-want +got):\n%s", diff)
+	}
+	if ttl := r.cli.TTL(ctx, readMarkerPrefix+":alice").Val(); ttl <= 0 || ttl > readMarkerTTL {
+		t.Errorf("Got TTL %s, want at most %s", ttl, readMarkerTTL)
+	}
+
+	if err := r.DeleteReadMarker(ctx, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.GetReadMarker(ctx, "alice"); !errors.Is(err, api.ErrReadMarkerNotFoundInCache) {
+		t.Errorf("Got %v after deleting the marker, want ErrReadMarkerNotFoundInCache", err)
+	}
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/GetStream/stream-backend-homework-assignment/api"
 	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
 )
 
 // Redis provides caching in Redis.
@@ -21,6 +22,10 @@ func Connect(ctx context.Context, addr string) (*Redis, error) {
 	cli := redis.NewClient(&redis.Options{
 		Addr: addr,
 	})
+	cli.AddHook(tracingHook{
+		tracer: otel.Tracer("github.com/GetStream/stream-backend-homework-assignment/redis"),
+	})
+	cli.AddHook(logHook{})
 	if err := cli.Ping(ctx).Err(); err != nil {
 		return nil, fmt.Errorf("ping redis: %w", err)
 	}
@@ -29,6 +34,19 @@ func Connect(ctx context.Context, addr string) (*Redis, error) {
 	}, nil
 }
 
+// Ping checks that the Redis server is reachable.
+func (r *Redis) Ping(ctx context.Context) error {
+	if err := r.cli.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("ping redis: %w", err)
+	}
+	return nil
+}
+
+// PoolStats returns connection pool statistics.
+func (r *Redis) PoolStats() *redis.PoolStats {
+	return r.cli.PoolStats()
+}
+
 const (
 	messagePrefix = "messages"
 	maxSize       = 10
@@ -143,6 +161,7 @@ func (m message) ToAPIMessage() (*api.Message, error) {
 
 	am.ID = m.ID
 	am.Text = m.Text
+	am.Format = m.Format
 	am.UserID = m.UserID
 	am.CreatedAt = m.CreatedAt
 	if m.MessageReactionCounts != "" {
@@ -151,6 +170,16 @@ func (m message) ToAPIMessage() (*api.Message, error) {
 			return nil, err
 		}
 	}
+	if m.Attachments != "" {
+		if err := json.Unmarshal([]byte(m.Attachments), &am.Attachments); err != nil {
+			return nil, err
+		}
+	}
+	if m.Mentions != "" {
+		if err := json.Unmarshal([]byte(m.Mentions), &am.Mentions); err != nil {
+			return nil, err
+		}
+	}
 	return am, nil
 }
 
@@ -158,6 +187,7 @@ func (r *Redis) toRedisMessage(apiMsg api.Message) (message, error) {
 	m := message{
 		ID:        apiMsg.ID,
 		Text:      apiMsg.Text,
+		Format:    apiMsg.Format,
 		UserID:    apiMsg.UserID,
 		CreatedAt: apiMsg.CreatedAt,
 	}
@@ -168,6 +198,20 @@ func (r *Redis) toRedisMessage(apiMsg api.Message) (message, error) {
 		}
 		m.MessageReactionCounts = string(reactionCountsJSON)
 	}
+	if len(apiMsg.Attachments) > 0 {
+		b, err := json.Marshal(apiMsg.Attachments)
+		if err != nil {
+			return message{}, fmt.Errorf("failed to marshal attachments: %w", err)
+		}
+		m.Attachments = string(b)
+	}
+	if len(apiMsg.Mentions) > 0 {
+		b, err := json.Marshal(apiMsg.Mentions)
+		if err != nil {
+			return message{}, fmt.Errorf("failed to marshal mentions: %w", err)
+		}
+		m.Mentions = string(b)
+	}
 	return m, nil
 }
 
@@ -178,6 +222,7 @@ func (r *Redis) evictOldest(ctx context.Context) error {
 	}
 
 	for _, key := range vals {
+		// Failures are logged by the hook; the next insert retries them.
 		_ = r.cli.ZRem(ctx, messagePrefix, key).Err()
 		_ = r.cli.Del(ctx, key).Err()
 	}
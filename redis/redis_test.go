@@ -140,6 +140,24 @@ func TestRedis_InsertMessage(t *testing.T) {
 				}
 			},
 		},
+		{
+			name: "Mentions",
+			msg: api.Message{
+				ID:       "9cbf8127-299b-4a84-8920-cd35ea0c084c",
+				Text:     "Hello @bob",
+				UserID:   "testuser",
+				Mentions: []string{"bob"},
+			},
+			check: func(t *testing.T, r *Redis) {
+				got, err := r.GetMessage(context.Background(), "9cbf8127-299b-4a84-8920-cd35ea0c084c")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff([]string{"bob"}, got.Mentions); diff != "" {
+					t.Errorf("Mentions mismatch (-want +got):\n%s", diff)
+				}
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,71 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// A tracingHook creates a client span for every command or pipeline, as a
+// child of the span in the command's context.
+type tracingHook struct {
+	tracer trace.Tracer
+}
+
+func (h tracingHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		ctx, span := h.start(ctx, "redis dial")
+		conn, err := next(ctx, network, addr)
+		end(span, err)
+		return conn, err
+	}
+}
+
+func (h tracingHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		ctx, span := h.start(ctx, cmd.Name(), attribute.String("db.operation.name", cmd.Name()))
+		err := next(ctx, cmd)
+		end(span, err)
+		return err
+	}
+}
+
+func (h tracingHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		names := make([]string, len(cmds))
+		for i, cmd := range cmds {
+			names[i] = cmd.Name()
+		}
+		ctx, span := h.start(ctx, "pipeline",
+			attribute.String("db.operation.name", strings.Join(names, " ")),
+			attribute.Int("db.operation.batch.size", len(cmds)),
+		)
+		err := next(ctx, cmds)
+		end(span, err)
+		return err
+	}
+}
+
+func (h tracingHook) start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs, attribute.String("db.system", "redis"))
+	return h.tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+// end ends the span, recording err unless it is the expected redis.Nil
+// returned for missing keys.
+func end(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, redis.Nil) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,58 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracingHook(t *testing.T) {
+	exp := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+	h := tracingHook{tracer: tp.Tracer("test")}
+
+	parent, parentSpan := tp.Tracer("test").Start(context.Background(), "request")
+
+	process := h.ProcessHook(func(ctx context.Context, cmd redis.Cmder) error {
+		return redis.Nil
+	})
+	_ = process(parent, redis.NewStringCmd(parent, "get", "messages:1"))
+
+	pipeline := h.ProcessPipelineHook(func(ctx context.Context, cmds []redis.Cmder) error {
+		return errors.New("connection refused")
+	})
+	_ = pipeline(parent, []redis.Cmder{
+		redis.NewIntCmd(parent, "hset", "messages:1", "id", "1"),
+		redis.NewIntCmd(parent, "zadd", "messages", 1, "messages:1"),
+	})
+	parentSpan.End()
+
+	spans := exp.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("Got %d spans, want 3", len(spans))
+	}
+	tests := []struct {
+		name       string
+		wantStatus codes.Code
+	}{
+		{name: "get"}, // redis.Nil is a cache miss, not an error
+		{name: "pipeline", wantStatus: codes.Error},
+	}
+	for i, tt := range tests {
+		span := spans[i]
+		if span.Name != tt.name {
+			t.Errorf("Got span name %q, want %q", span.Name, tt.name)
+		}
+		if span.Status.Code != tt.wantStatus {
+			t.Errorf("%s: got status %s, want %s", tt.name, span.Status.Code, tt.wantStatus)
+		}
+		if span.Parent.SpanID() != parentSpan.SpanContext().SpanID() {
+			t.Errorf("%s: span is not a child of the request span", tt.name)
+		}
+	}
+}
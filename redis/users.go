@@ -0,0 +1,75 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	userPrefix = "users"
+	// userTTL bounds how long messages show an old profile if evicting it
+	// from the cache failed.
+	userTTL = 10 * time.Minute
+)
+
+// GetUsers returns the cached profiles of the users, with one round trip.
+// Users cached as having no profile map to nil; those not cached are left
+// out.
+func (r *Redis) GetUsers(ctx context.Context, ids []string) (map[string]*api.User, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = userPrefix + ":" + id
+	}
+	vals, err := r.cli.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("mget: %w", err)
+	}
+	users := make(map[string]*api.User, len(ids))
+	for i, v := range vals {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		var u *api.User
+		if err := json.Unmarshal([]byte(s), &u); err != nil {
+			return nil, fmt.Errorf("unmarshal: %w", err)
+		}
+		users[ids[i]] = u
+	}
+	return users, nil
+}
+
+// SetUsers caches the profiles for a few minutes, including that users have
+// none.
+func (r *Redis) SetUsers(ctx context.Context, users map[string]*api.User) error {
+	_, err := r.cli.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for id, u := range users {
+			b, err := json.Marshal(u)
+			if err != nil {
+				return fmt.Errorf("marshal: %w", err)
+			}
+			pipe.Set(ctx, userPrefix+":"+id, b, userTTL)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("set: %w", err)
+	}
+	return nil
+}
+
+// DeleteUser removes the profile of a user from the cache.
+func (r *Redis) DeleteUser(ctx context.Context, id string) error {
+	if err := r.cli.Del(ctx, userPrefix+":"+id).Err(); err != nil {
+		return fmt.Errorf("del: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+//go:build integration
+
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/GetStream/stream-backend-homework-assignment/api"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRedis_Users(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	r := connect(t)
+	alice := &api.User{
+		ID:        "alice",
+		Name:      "Alice",
+		AvatarURL: "https://example.com/a.png",
+		CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		UpdatedAt: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+	}
+	if err := r.SetUsers(ctx, map[string]*api.User{"alice": alice, "carol": nil}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := r.GetUsers(ctx, []string{"alice", "bob", "carol"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]*api.User{"alice": alice, "carol": nil}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("GetUsers() mismatch (-want +got):\n%s", diff)
+	}
+	if ttl := r.cli.TTL(ctx, "users:alice").Val(); ttl <= 0 || ttl > userTTL {
+		t.Errorf("Got TTL %s, want up to %s", ttl, userTTL)
+	}
+
+	if err := r.DeleteUser(ctx, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	got, err = r.GetUsers(ctx, []string{"alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("Got users %+v after deleting alice, want none", got)
+	}
+}